@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/config"
+	"github.com/hpcsc/outside-in-go/internal/logging"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const monthLayout = "2006-01"
+
+type backfillTask struct {
+	reportType storer.ReportType
+	year       int
+	month      int
+}
+
+func (t backfillTask) String() string {
+	return fmt.Sprintf("%s %d-%02d", t.reportType, t.year, t.month)
+}
+
+type backfillFailure struct {
+	task backfillTask
+	err  error
+}
+
+type backfillSummary struct {
+	total     int
+	succeeded int
+	failed    []backfillFailure
+	skipped   int
+	duration  time.Duration
+}
+
+func runBackfill(args []string) error {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	loader := config.NewLoader(flags)
+	from := flags.String("from", "", "first month to regenerate, as YYYY-MM")
+	to := flags.String("to", "", "last month to regenerate, as YYYY-MM")
+	reportTypeParam := flags.String("type", "", "report type to regenerate: single or cumulative. Both when empty")
+	concurrency := flags.Int("concurrency", 4, "number of aggregates regenerated at the same time")
+
+	cfg, err := loadConfig(flags, loader, args, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	reportTypes := storer.ReportTypes
+	if *reportTypeParam != "" {
+		reportType, err := storer.ParseReportType(*reportTypeParam)
+		if err != nil {
+			return err
+		}
+		reportTypes = []storer.ReportType{reportType}
+	}
+
+	tasks, err := backfillTasks(*from, *to, reportTypes, cfg.Reports.MinimumYear)
+	if err != nil {
+		return err
+	}
+
+	if *concurrency < 1 {
+		return fmt.Errorf("concurrency must be positive, got %d", *concurrency)
+	}
+
+	s, err := newStorer(cfg.Storage)
+	if err != nil {
+		return err
+	}
+
+	generator, stopWebhooks, err := newGenerator(s, cfg)
+	if err != nil {
+		return err
+	}
+	defer stopWebhooks()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	summary := backfill(ctx, generator, tasks, *concurrency)
+	printBackfillSummary(os.Stdout, summary)
+
+	if len(summary.failed) > 0 || summary.skipped > 0 {
+		return fmt.Errorf("backfill incomplete: %d failed, %d skipped", len(summary.failed), summary.skipped)
+	}
+
+	return nil
+}
+
+func backfillTasks(from string, to string, reportTypes []storer.ReportType, minimumYear int) ([]backfillTask, error) {
+	start, err := time.Parse(monthLayout, from)
+	if err != nil {
+		return nil, fmt.Errorf("from '%s' is invalid, expected YYYY-MM", from)
+	}
+
+	end, err := time.Parse(monthLayout, to)
+	if err != nil {
+		return nil, fmt.Errorf("to '%s' is invalid, expected YYYY-MM", to)
+	}
+
+	if end.Before(start) {
+		return nil, fmt.Errorf("to %s is before from %s", to, from)
+	}
+
+	if err := validatePeriod(start.Year(), int(start.Month()), minimumYear); err != nil {
+		return nil, err
+	}
+
+	var tasks []backfillTask
+	for m := start; !m.After(end); m = m.AddDate(0, 1, 0) {
+		for _, reportType := range reportTypes {
+			tasks = append(tasks, backfillTask{
+				reportType: reportType,
+				year:       m.Year(),
+				month:      int(m.Month()),
+			})
+		}
+	}
+
+	return tasks, nil
+}
+
+// backfill regenerates every task with at most concurrency regenerations in flight. Tasks not started when ctx is cancelled are counted as skipped
+func backfill(ctx context.Context, generator report.Generator, tasks []backfillTask, concurrency int) backfillSummary {
+	start := time.Now()
+	summary := backfillSummary{total: len(tasks)}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	for _, task := range tasks {
+		if !acquireSlot(ctx, slots) {
+			mu.Lock()
+			summary.skipped++
+			mu.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func(task backfillTask) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			taskStart := time.Now()
+			_, err := generator.Regenerate(ctx, task.reportType, task.year, task.month)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				summary.failed = append(summary.failed, backfillFailure{task: task, err: err})
+			} else {
+				summary.succeeded++
+			}
+
+			slog.Info("backfill progress",
+				slog.String("report_type", string(task.reportType)),
+				logging.Period(task.year, task.month),
+				slog.Bool("success", err == nil),
+				slog.Int("done", summary.succeeded+len(summary.failed)),
+				slog.Int("total", summary.total),
+				logging.Duration(taskStart),
+			)
+		}(task)
+	}
+
+	wg.Wait()
+	summary.duration = time.Since(start)
+	return summary
+}
+
+func acquireSlot(ctx context.Context, slots chan struct{}) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case slots <- struct{}{}:
+	}
+
+	if ctx.Err() != nil {
+		<-slots
+		return false
+	}
+
+	return true
+}
+
+func printBackfillSummary(w io.Writer, summary backfillSummary) {
+	fmt.Fprintf(w, "backfill finished in %s: %d total, %d succeeded, %d failed, %d skipped\n",
+		summary.duration.Round(time.Millisecond), summary.total, summary.succeeded, len(summary.failed), summary.skipped)
+	for _, f := range summary.failed {
+		fmt.Fprintf(w, "  %s: %v\n", f.task, f.err)
+	}
+}
@@ -0,0 +1,97 @@
+//go:build unit
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBackfillTasks(t *testing.T) {
+	t.Run("include every month and report type within range", func(t *testing.T) {
+		tasks, err := backfillTasks("2021-11", "2022-01", storer.ReportTypes, 2020)
+
+		require.NoError(t, err)
+		require.Equal(t, []backfillTask{
+			{reportType: storer.SingleReportType, year: 2021, month: 11},
+			{reportType: storer.CumulativeReportType, year: 2021, month: 11},
+			{reportType: storer.SingleReportType, year: 2021, month: 12},
+			{reportType: storer.CumulativeReportType, year: 2021, month: 12},
+			{reportType: storer.SingleReportType, year: 2022, month: 1},
+			{reportType: storer.CumulativeReportType, year: 2022, month: 1},
+		}, tasks)
+	})
+
+	t.Run("return error when month is malformed", func(t *testing.T) {
+		_, err := backfillTasks("2021/11", "2022-01", storer.ReportTypes, 2020)
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "from '2021/11' is invalid, expected YYYY-MM")
+	})
+
+	t.Run("return error when range is reversed", func(t *testing.T) {
+		_, err := backfillTasks("2022-02", "2022-01", storer.ReportTypes, 2020)
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "to 2022-01 is before from 2022-02")
+	})
+
+	t.Run("return error when range starts before minimum year", func(t *testing.T) {
+		_, err := backfillTasks("2019-12", "2022-01", storer.ReportTypes, 2020)
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "2019 is too early")
+	})
+}
+
+func TestBackfill(t *testing.T) {
+	tasks := []backfillTask{
+		{reportType: storer.SingleReportType, year: 2022, month: 1},
+		{reportType: storer.SingleReportType, year: 2022, month: 2},
+		{reportType: storer.SingleReportType, year: 2022, month: 3},
+	}
+
+	t.Run("regenerate every task and summarise failures", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Regenerate", mock.Anything, storer.SingleReportType, 2022, 2).Return(nil, errors.New("some error"))
+		stubGenerator.On("Regenerate", mock.Anything, storer.SingleReportType, 2022, mock.Anything).Return([]byte("some,data"), nil)
+
+		summary := backfill(context.Background(), stubGenerator, tasks, 2)
+
+		require.Equal(t, 3, summary.total)
+		require.Equal(t, 2, summary.succeeded)
+		require.Equal(t, []backfillFailure{{task: tasks[1], err: errors.New("some error")}}, summary.failed)
+		require.Zero(t, summary.skipped)
+		stubGenerator.AssertNumberOfCalls(t, "Regenerate", 3)
+	})
+
+	t.Run("skip remaining tasks once cancelled", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		summary := backfill(ctx, stubGenerator, tasks, 1)
+
+		require.Equal(t, 3, summary.skipped)
+		stubGenerator.AssertNotCalled(t, "Regenerate", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("print summary with failures", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		printBackfillSummary(&buf, backfillSummary{
+			total:     3,
+			succeeded: 2,
+			failed:    []backfillFailure{{task: tasks[1], err: errors.New("some error")}},
+		})
+
+		require.Contains(t, buf.String(), "3 total, 2 succeeded, 1 failed, 0 skipped")
+		require.Contains(t, buf.String(), "single 2022-02: some error")
+	})
+}
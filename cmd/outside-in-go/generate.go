@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/config"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func runGenerate(args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	loader := config.NewLoader(flags)
+	reportTypeParam := flags.String("type", "", "report type: single or cumulative")
+	year := flags.Int("year", 0, "year of the report")
+	month := flags.Int("month", 0, "month of the report")
+	out := flags.String("out", "-", "file to write the report to, - for stdout")
+	format := flags.String("format", report.CSVFormat, "output format: csv or json")
+
+	cfg, err := loadConfig(flags, loader, args, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	reportType, err := storer.ParseReportType(*reportTypeParam)
+	if err != nil {
+		return err
+	}
+
+	if err := validatePeriod(*year, *month, cfg.Reports.MinimumYear); err != nil {
+		return err
+	}
+
+	if *format != report.CSVFormat && *format != report.JSONFormat {
+		return fmt.Errorf("format '%s' is invalid", *format)
+	}
+
+	s, err := newStorer(cfg.Storage)
+	if err != nil {
+		return err
+	}
+
+	generator, stopWebhooks, err := newGenerator(s, cfg)
+	if err != nil {
+		return err
+	}
+	defer stopWebhooks()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	data, err := generator.Generate(ctx, reportType, *year, *month)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(*out, func(w io.Writer) error {
+		return report.Write(w, data, *format)
+	})
+}
+
+func writeOutput(path string, write func(w io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", path, err)
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+
+	return f.Close()
+}
+
+func validatePeriod(year int, month int, minimumYear int) error {
+	if year < minimumYear {
+		return fmt.Errorf("%d is too early", year)
+	}
+
+	if month < 1 || month > 12 {
+		return errors.New("month must be in the range 1..12")
+	}
+
+	return nil
+}
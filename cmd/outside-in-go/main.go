@@ -1,39 +1,236 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"github.com/hpcsc/outside-in-go/internal/handler"
+	"github.com/hpcsc/outside-in-go/internal/config"
+	"github.com/hpcsc/outside-in-go/internal/ingest"
+	"github.com/hpcsc/outside-in-go/internal/logging"
 	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/schema"
 	"github.com/hpcsc/outside-in-go/internal/storer"
-	"log"
-	"net/http"
+	"github.com/hpcsc/outside-in-go/internal/webhook"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
+	"time"
 )
 
-var (
-	s3Endpoint = os.Getenv("S3_ENDPOINT")
-	port       = os.Getenv("PORT")
-	bucket     = os.Getenv("BUCKET")
-)
+const serviceName = "outside-in-go"
+
+const usage = `Usage: outside-in-go <command> [flags]
+
+Commands:
+  serve      run the HTTP API (default)
+  generate   generate a single report and write it to a file or stdout
+  backfill   regenerate all aggregates within a range of months
+
+Run 'outside-in-go <command> -h' to list the flags of a command.
+`
 
 func main() {
-	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "serve":
+		err = runServe(args)
+	case "generate":
+		err = runGenerate(args)
+	case "backfill":
+		err = runBackfill(args)
+	case "help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command '%s'\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		slog.Error("exiting", slog.String("command", command), slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+}
+
+// loadConfig parses args into flags, loads the configuration and installs the default logger writing to logOutput
+func loadConfig(flags *flag.FlagSet, loader *config.Loader, args []string, logOutput io.Writer) (*config.Config, error) {
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg, err := loader.Load(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	slog.SetDefault(logging.NewJSONLogger(logOutput, level))
+
+	return cfg, nil
+}
+
+func newStorer(cfg config.Storage) (storer.Storer, error) {
+	return storer.NewS3Storer(cfg.Endpoint, cfg.Bucket,
+		storer.WithRegion(cfg.Region),
+		storer.WithStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey),
+		storer.WithKeyLayout(cfg.KeyLayout),
+	)
+}
+
+// newGenerator builds the report generator from the ingestion, schema, deduplication, sorting and quality settings, notifying the configured webhooks of every stored aggregate.
+// The returned function waits up to timeout for deliveries in progress and must be called before exiting
+func newGenerator(s storer.Storer, c *config.Config) (report.Generator, func(), error) {
+	schemas, policy, err := newSchemas(c.Schemas)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := []report.GeneratorOption{
+		report.WithSchemas(schemas, policy),
+		report.WithQuality(report.QualityOptions{ExpectedClusters: c.Quality.ExpectedClusters, RowCountThreshold: c.Quality.RowCountThreshold}),
+	}
+
+	ingestion, err := newIngestion(c.Ingestion)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts = append(opts, report.WithIngestion(ingestion))
+
+	sorting, err := newSorting(c.Sorting)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts = append(opts, report.WithSorting(sorting))
+
+	if c.PartialAggregation.Enabled {
+		opts = append(opts, report.WithPartialAggregation(c.PartialAggregation.Store))
+		if c.PartialAggregation.Quarantine {
+			opts = append(opts, report.WithQuarantine())
+		}
+	}
+
+	if c.Deduplication.Enabled {
+		dedup, err := newDeduplication(c.Deduplication)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, report.WithDeduplication(dedup))
+	}
 
-	handler.RegisterReportsRoutes(r, newReportGenerator())
+	cfg := c.Webhooks
+	if len(cfg.URLs) == 0 {
+		return report.NewCsvGenerator(s, opts...), func() {}, nil
+	}
+
+	var deadLetter *os.File
+	if cfg.DeadLetterFile != "" {
+		f, err := os.OpenFile(cfg.DeadLetterFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open webhook dead letter file: %v", err)
+		}
+		deadLetter = f
+	}
+
+	options := webhook.Options{
+		URLs:           cfg.URLs,
+		Secret:         cfg.Secret,
+		MaxAttempts:    cfg.MaxAttempts,
+		InitialBackoff: cfg.InitialBackoff,
+		Timeout:        cfg.Timeout,
+	}
+	if deadLetter != nil {
+		options.DeadLetter = deadLetter
+	}
+	notifier := webhook.New(options)
+
+	stop := func() {
+		select {
+		case <-notifier.Stop().Done():
+		case <-time.After(c.Server.ShutdownTimeout):
+			slog.Warn("webhook deliveries still in progress after shutdown timeout")
+		}
+
+		if deadLetter != nil {
+			deadLetter.Close()
+		}
+	}
 
-	addr := fmt.Sprintf(":%s", port)
-	log.Printf("listening at %s", addr)
-	http.ListenAndServe(addr, r)
+	return report.NewCsvGenerator(s, append(opts, report.WithAggregateListener(notifier))...), stop, nil
 }
 
-func newReportGenerator() report.Generator {
-	s, err := storer.NewS3Storer(s3Endpoint, bucket)
+func newDeduplication(cfg config.Deduplication) (report.Deduplication, error) {
+	keep, err := report.ParseKeepPolicy(cfg.Keep)
 	if err != nil {
-		log.Fatalf("%v", err)
+		return report.Deduplication{}, err
 	}
-	gen := report.NewCsvGenerator(s)
-	return gen
+
+	keys := make(map[storer.ReportType][]string, len(cfg.Keys))
+	for name, columns := range cfg.Keys {
+		reportType, err := storer.ParseReportType(name)
+		if err != nil {
+			return report.Deduplication{}, err
+		}
+		keys[reportType] = columns
+	}
+
+	return report.Deduplication{Keep: keep, Keys: keys}, nil
+}
+
+func newIngestion(cfg config.Ingestion) (ingest.Options, error) {
+	encoding, err := ingest.ParseEncoding(cfg.Encoding)
+	if err != nil {
+		return ingest.Options{}, err
+	}
+
+	delimiter, err := ingest.ParseDelimiter(cfg.Delimiter)
+	if err != nil {
+		return ingest.Options{}, err
+	}
+
+	ragged, err := ingest.ParseRaggedPolicy(cfg.RaggedRows)
+	if err != nil {
+		return ingest.Options{}, err
+	}
+
+	return ingest.Options{Encoding: encoding, Delimiter: delimiter, Ragged: ragged}, nil
+}
+
+func newSorting(cfg config.Sorting) (report.Sorting, error) {
+	keys := make(map[storer.ReportType][]string, len(cfg.Keys))
+	for name, columns := range cfg.Keys {
+		reportType, err := storer.ParseReportType(name)
+		if err != nil {
+			return report.Sorting{}, err
+		}
+		keys[reportType] = columns
+	}
+
+	return report.Sorting{Keys: keys, ChunkRows: cfg.ChunkRows, TempDir: cfg.TempDir}, nil
+}
+
+func newSchemas(cfg config.Schemas) (map[storer.ReportType]*schema.Validator, schema.Policy, error) {
+	policy, err := schema.ParsePolicy(cfg.Policy)
+	if err != nil {
+		return nil, "", err
+	}
+
+	validators := make(map[storer.ReportType]*schema.Validator, len(cfg.Reports))
+	for name, s := range cfg.Reports {
+		reportType, err := storer.ParseReportType(name)
+		if err != nil {
+			return nil, "", err
+		}
+
+		v, err := schema.New(s)
+		if err != nil {
+			return nil, "", fmt.Errorf("schema of %s is invalid: %v", name, err)
+		}
+		validators[reportType] = v
+	}
+
+	return validators, policy, nil
 }
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/hpcsc/outside-in-go/internal/config"
+	"github.com/hpcsc/outside-in-go/internal/handler"
+	"github.com/hpcsc/outside-in-go/internal/job"
+	"github.com/hpcsc/outside-in-go/internal/logging"
+	"github.com/hpcsc/outside-in-go/internal/metrics"
+	"github.com/hpcsc/outside-in-go/internal/period"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/s3event"
+	"github.com/hpcsc/outside-in-go/internal/scheduler"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"github.com/hpcsc/outside-in-go/internal/upload"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	loader := config.NewLoader(flags)
+	printConfig := flags.Bool("print-config", false, "print the effective configuration and exit")
+
+	cfg, err := loadConfig(flags, loader, args, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	if *printConfig {
+		return cfg.Print(os.Stdout)
+	}
+
+	if err := serveAPI(cfg); err != nil {
+		return err
+	}
+
+	slog.Info("exited")
+	return nil
+}
+
+func serveAPI(cfg *config.Config) error {
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Exporter, serviceName)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	s, err := newStorer(cfg.Storage)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Readiness.FailFast {
+		if err := pingStorer(s, cfg.Readiness); err != nil {
+			return err
+		}
+	}
+
+	r := chi.NewRouter()
+	r.Use(otelhttp.NewMiddleware(serviceName))
+	r.Use(middleware.RequestID)
+	r.Use(logging.RequestLogger(slog.Default()))
+	r.Use(metrics.RequestMiddleware)
+
+	generator, stopWebhooks, err := newGenerator(s, cfg)
+	if err != nil {
+		return err
+	}
+	defer stopWebhooks()
+
+	r.Handle("/metrics", metrics.Handler())
+	handler.RegisterHealthRoutes(r, s, cfg.Readiness.CacheTTL, cfg.Readiness.PingTimeout)
+	records := report.NewRecords(s)
+	handler.RegisterReportsRoutes(r, generator, records, cfg.Reports.MinimumYear, cfg.Periods.AdminToken)
+	handler.RegisterReportEventsRoutes(r, generator, cfg.Reports.MinimumYear)
+	handler.RegisterReportDiffRoutes(r, generator, records, cfg.Reports.MinimumYear)
+	handler.RegisterReportSummaryRoutes(r, generator, cfg.Reports.MinimumYear)
+	handler.RegisterReportQualityRoutes(r, generator, cfg.Reports.MinimumYear)
+	// uploads write individual files, so they stay disabled until there is a token to authenticate clusters with
+	if len(cfg.Uploads.Tokens) > 0 || cfg.Periods.AdminToken != "" {
+		ingestion, err := newIngestion(cfg.Ingestion)
+		if err != nil {
+			return err
+		}
+
+		uploader := upload.NewUploader(s, upload.Options{Header: cfg.Uploads.Header, Ingestion: ingestion})
+		handler.RegisterUploadRoutes(r, uploader, cfg.Reports.MinimumYear, int64(cfg.Uploads.MaxBytes), cfg.Uploads.Tokens, cfg.Periods.AdminToken)
+	}
+
+	if cfg.Periods.AdminToken != "" {
+		periods := period.NewManager(generator, s, period.Options{
+			Retention:     cfg.Periods.Retention,
+			RetentionMode: storer.RetentionMode(cfg.Periods.RetentionMode),
+		})
+		handler.RegisterPeriodsRoutes(r, periods, cfg.Reports.MinimumYear, cfg.Periods.AdminToken)
+	}
+
+	jobs := job.NewQueueManager(generator, s, job.Options{
+		Workers:   cfg.Jobs.Workers,
+		QueueSize: cfg.Jobs.QueueSize,
+		Lease:     cfg.Jobs.Lease,
+		Retention: cfg.Jobs.Retention,
+		Owner:     owner(),
+	})
+	if err := jobs.Start(context.Background()); err != nil {
+		return err
+	}
+	defer waitForJobs(jobs, cfg.Server.ShutdownTimeout)
+	handler.RegisterJobsRoutes(r, jobs, cfg.Reports.MinimumYear)
+
+	if cfg.Scheduler.Enabled {
+		sched, err := newScheduler(generator, s, cfg.Scheduler)
+		if err != nil {
+			return err
+		}
+		handler.RegisterSchedulerRoutes(r, sched)
+
+		sched.Start()
+		defer waitForScheduler(sched, cfg.Server.ShutdownTimeout)
+	}
+
+	if cfg.Events.Enabled() {
+		processor := s3event.NewProcessor(generator, s, s3event.Options{
+			Rebuild:  cfg.Events.Rebuild,
+			Debounce: cfg.Events.Debounce,
+		})
+		defer waitForEvents(processor, cfg.Server.ShutdownTimeout)
+
+		if cfg.Events.HTTP {
+			handler.RegisterS3EventsRoutes(r, processor, cfg.Events.Token)
+		}
+
+		if cfg.Events.QueueURL != "" {
+			consumer, err := s3event.NewSQSConsumer(processor, cfg.Events.QueueURL, s3event.SQSOptions{
+				Endpoint:        cfg.Events.QueueEndpoint,
+				Region:          cfg.Storage.Region,
+				AccessKeyID:     cfg.Storage.AccessKeyID,
+				SecretAccessKey: cfg.Storage.SecretAccessKey,
+			})
+			if err != nil {
+				return err
+			}
+
+			consumer.Start()
+			// deferred after the processor so that consuming stops before pending rebuilds are dropped
+			defer waitForEvents(consumer, cfg.Server.ShutdownTimeout)
+		}
+	}
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:           r,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen at %s: %v", server.Addr, err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	slog.Info("listening", slog.String("addr", listener.Addr().String()))
+	return serve(server, listener, signals, cfg.Server.ShutdownTimeout)
+}
+
+func newScheduler(generator report.Generator, s storer.Storer, cfg config.Scheduler) (*scheduler.Scheduler, error) {
+	return scheduler.New(generator, s, scheduler.Options{
+		Cron:           cfg.Cron,
+		NotBeforeDay:   cfg.NotBeforeDay,
+		NotBeforeHour:  cfg.NotBeforeHour,
+		MaxAttempts:    cfg.MaxAttempts,
+		InitialBackoff: cfg.InitialBackoff,
+		LeaseDuration:  cfg.LeaseDuration,
+		Owner:          owner(),
+	})
+}
+
+func waitForScheduler(sched *scheduler.Scheduler, timeout time.Duration) {
+	select {
+	case <-sched.Stop().Done():
+	case <-time.After(timeout):
+		slog.Warn("scheduler run still in progress after shutdown timeout")
+	}
+}
+
+func waitForJobs(jobs job.Manager, timeout time.Duration) {
+	select {
+	case <-jobs.Stop().Done():
+	case <-time.After(timeout):
+		slog.Warn("jobs still running after shutdown timeout")
+	}
+}
+
+func waitForEvents(component interface{ Stop() context.Context }, timeout time.Duration) {
+	select {
+	case <-component.Stop().Done():
+	case <-time.After(timeout):
+		slog.Warn("s3 event notifications still being processed after shutdown timeout")
+	}
+}
+
+// owner identifies this replica in locks shared with other replicas
+func owner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+func pingStorer(s storer.Storer, cfg config.Readiness) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.PingTimeout)
+	defer cancel()
+
+	if err := s.Ping(ctx); err != nil {
+		return fmt.Errorf("storage is not ready: %v", err)
+	}
+
+	return nil
+}
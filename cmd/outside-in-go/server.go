@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// serve runs server until it fails or a signal arrives. On a signal it stops accepting connections and waits up to drainTimeout
+// for in-flight requests, including any generation and aggregate store they are running, to complete
+func serve(server *http.Server, listener net.Listener, signals <-chan os.Signal, drainTimeout time.Duration) error {
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serverErr:
+		return fmt.Errorf("server stopped unexpectedly: %v", err)
+	case sig := <-signals:
+		slog.Info("shutting down",
+			slog.String("signal", sig.String()),
+			slog.Duration("drain_timeout", drainTimeout),
+		)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to drain in-flight requests: %v", err)
+	}
+
+	if err := <-serverErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server stopped unexpectedly: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+//go:build unit
+
+package main
+
+import (
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestServe(t *testing.T) {
+	t.Run("let in-flight request finish after shutdown signal", func(t *testing.T) {
+		requestStarted := make(chan struct{})
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(requestStarted)
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte("done"))
+		})}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		signals := make(chan os.Signal, 1)
+		serveErr := make(chan error, 1)
+		go func() {
+			serveErr <- serve(server, listener, signals, time.Second)
+		}()
+
+		responseBody := make(chan string, 1)
+		go func() {
+			resp, err := http.Get("http://" + listener.Addr().String())
+			if err != nil {
+				responseBody <- err.Error()
+				return
+			}
+			body, _ := io.ReadAll(resp.Body)
+			responseBody <- string(body)
+		}()
+		<-requestStarted
+		signals <- syscall.SIGTERM
+
+		require.Equal(t, "done", <-responseBody)
+		require.NoError(t, <-serveErr)
+	})
+
+	t.Run("return error when in-flight requests do not finish within drain timeout", func(t *testing.T) {
+		requestStarted := make(chan struct{})
+		release := make(chan struct{})
+		defer close(release)
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(requestStarted)
+			<-release
+		})}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		signals := make(chan os.Signal, 1)
+		serveErr := make(chan error, 1)
+		go func() {
+			serveErr <- serve(server, listener, signals, 10*time.Millisecond)
+		}()
+
+		go http.Get("http://" + listener.Addr().String())
+		<-requestStarted
+		signals <- syscall.SIGTERM
+
+		err = <-serveErr
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to drain in-flight requests")
+	})
+
+	t.Run("return error when server fails", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		listener.Close()
+
+		err = serve(&http.Server{}, listener, make(chan os.Signal), time.Second)
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "server stopped unexpectedly")
+	})
+}
@@ -0,0 +1,595 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/ingest"
+	"github.com/hpcsc/outside-in-go/internal/logging"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/schema"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/url"
+	"slices"
+	"time"
+)
+
+const redacted = "******"
+
+type Config struct {
+	Server    Server    `yaml:"server"`
+	Storage   Storage   `yaml:"storage"`
+	Reports   Reports   `yaml:"reports"`
+	Log       Log       `yaml:"log"`
+	Tracing   Tracing   `yaml:"tracing"`
+	Readiness Readiness `yaml:"readiness"`
+	Scheduler Scheduler `yaml:"scheduler"`
+	Jobs      Jobs      `yaml:"jobs"`
+	Webhooks  Webhooks  `yaml:"webhooks"`
+	Events    Events    `yaml:"events"`
+	Uploads   Uploads   `yaml:"uploads"`
+	Periods   Periods   `yaml:"periods"`
+	Schemas   Schemas   `yaml:"schemas"`
+	// Deduplication drops rows appearing in more than one individual file, such as those of retried uploads
+	Deduplication Deduplication `yaml:"deduplication"`
+	// Sorting orders the rows of aggregates so that identical inputs build byte-identical aggregates
+	Sorting Sorting `yaml:"sorting"`
+	// Ingestion decides how individual files are read before they are merged
+	Ingestion Ingestion `yaml:"ingestion"`
+	// PartialAggregation builds aggregates from the readable individual files when some cannot be read
+	PartialAggregation PartialAggregation `yaml:"partial_aggregation"`
+	// Quality decides what data-quality reports check the individual files of a period against
+	Quality Quality `yaml:"quality"`
+}
+
+type Server struct {
+	Port            int           `yaml:"port"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type Storage struct {
+	// Endpoint overrides the S3 endpoint, e.g. to point at mock-aws. Empty means the AWS default
+	Endpoint string `yaml:"endpoint"`
+	Bucket   string `yaml:"bucket"`
+	// Region overrides the region from the AWS default configuration chain when set
+	Region string `yaml:"region"`
+	// AccessKeyID and SecretAccessKey override the AWS default credential chain when set
+	AccessKeyID     string           `yaml:"access_key_id"`
+	SecretAccessKey string           `yaml:"secret_access_key"`
+	KeyLayout       storer.KeyLayout `yaml:"key_layout"`
+}
+
+type Reports struct {
+	MinimumYear int `yaml:"minimum_year"`
+}
+
+type Log struct {
+	Level string `yaml:"level"`
+}
+
+type Tracing struct {
+	Exporter string `yaml:"exporter"`
+}
+
+type Readiness struct {
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+	// FailFast makes startup fail when the bucket is not reachable
+	FailFast    bool          `yaml:"fail_fast"`
+	PingTimeout time.Duration `yaml:"ping_timeout"`
+}
+
+type Scheduler struct {
+	Enabled bool `yaml:"enabled"`
+	// Cron decides how often the scheduler checks whether the previous month needs building
+	Cron string `yaml:"cron"`
+	// NotBeforeDay and NotBeforeHour mark the point in a month after which the previous month is considered complete
+	NotBeforeDay   int           `yaml:"not_before_day"`
+	NotBeforeHour  int           `yaml:"not_before_hour"`
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	LeaseDuration  time.Duration `yaml:"lease_duration"`
+}
+
+type Jobs struct {
+	Workers int `yaml:"workers"`
+	// QueueSize is the number of jobs that can wait for a worker before submissions are refused
+	QueueSize int `yaml:"queue_size"`
+	// Lease bounds how long a crashed replica keeps others from resuming its jobs
+	Lease time.Duration `yaml:"lease"`
+	// Retention is how long finished jobs and their results are kept
+	Retention time.Duration `yaml:"retention"`
+}
+
+type Webhooks struct {
+	// URLs receive a signed notification whenever an aggregate is stored. Empty disables webhooks
+	URLs   []string `yaml:"urls"`
+	Secret string   `yaml:"secret"`
+	// MaxAttempts bounds the deliveries per URL before a notification is dead-lettered
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	Timeout        time.Duration `yaml:"timeout"`
+	// DeadLetterFile is appended one JSON line per notification that could not be delivered. Empty only logs them
+	DeadLetterFile string `yaml:"dead_letter_file"`
+}
+
+type Events struct {
+	// HTTP accepts S3 event notifications posted to /events/s3
+	HTTP bool `yaml:"http"`
+	// Token is the bearer token notifications posted to /events/s3 must carry. It is required when HTTP is set
+	Token string `yaml:"token"`
+	// QueueURL is an SQS queue receiving S3 event notifications. Empty disables polling
+	QueueURL string `yaml:"queue_url"`
+	// QueueEndpoint overrides the SQS endpoint, e.g. to point at mock-aws. Region and credentials are shared with storage
+	QueueEndpoint string `yaml:"queue_endpoint"`
+	// Rebuild regenerates invalidated aggregates in the background instead of leaving them to be built on next read
+	Rebuild bool `yaml:"rebuild"`
+	// Debounce is how long a period must go without uploads before it is rebuilt
+	Debounce time.Duration `yaml:"debounce"`
+}
+
+type Uploads struct {
+	// MaxBytes bounds the size of an uploaded individual file
+	MaxBytes int `yaml:"max_bytes"`
+	// Header is the header every uploaded file must have. Empty means uploads must match the files already uploaded for the period
+	Header []string `yaml:"header"`
+	// Tokens are the bearer tokens of the clusters allowed to upload, keyed by cluster. The period admin token can upload for any cluster.
+	// Uploads are disabled when there are neither tokens nor an admin token
+	Tokens map[string]string `yaml:"tokens"`
+}
+
+type Periods struct {
+	// AdminToken is the bearer token required by the period lifecycle endpoints and the release of quarantined files. Empty disables them
+	AdminToken string `yaml:"admin_token"`
+	// Retention is how long S3 Object Lock protects the aggregates of a locked period
+	Retention time.Duration `yaml:"retention"`
+	// RetentionMode is the S3 Object Lock mode, GOVERNANCE or COMPLIANCE
+	RetentionMode string `yaml:"retention_mode"`
+}
+
+type Deduplication struct {
+	Enabled bool `yaml:"enabled"`
+	// Keep decides which duplicate row stays, ordered by the last modified time of their files: first or last
+	Keep string `yaml:"keep"`
+	// Keys lists the columns identifying a row, keyed by report type. Report types without key columns compare whole rows
+	Keys map[string][]string `yaml:"keys"`
+}
+
+type PartialAggregation struct {
+	Enabled bool `yaml:"enabled"`
+	// Store caches partial aggregates as if they were complete. Otherwise they are rebuilt on every request until every file can be read
+	Store bool `yaml:"store"`
+	// Quarantine moves the individual files left out under the quarantine prefix, so that they are not read again until released
+	Quarantine bool `yaml:"quarantine"`
+}
+
+type Quality struct {
+	// ExpectedClusters lists the clusters expected to upload every period. Empty expects the clusters that uploaded the previous month
+	ExpectedClusters []string `yaml:"expected_clusters"`
+	// RowCountThreshold is the relative change in the rows of a cluster from the previous month above which it is flagged, 0.5 for 50%
+	RowCountThreshold float64 `yaml:"row_count_threshold"`
+}
+
+type Ingestion struct {
+	// Encoding of individual files: auto, utf-8, utf-16, latin-1 or windows-1252. Auto follows the byte order mark and reads invalid UTF-8 as windows-1252
+	Encoding string `yaml:"encoding"`
+	// Delimiter of individual files, or auto to detect it from the header of each file
+	Delimiter string `yaml:"delimiter"`
+	// RaggedRows decides what happens to rows with a different number of fields than the header: fail, skip or pad
+	RaggedRows string `yaml:"ragged_rows"`
+}
+
+type Sorting struct {
+	// Keys lists the columns aggregates are sorted by, keyed by report type. Report types without sort keys keep the order files are listed in
+	Keys map[string][]string `yaml:"keys"`
+	// ChunkRows is the number of rows held and sorted at once before they are spilled to a temporary file. It bounds the rows a build holds, not its files and aggregate, which stay in memory
+	ChunkRows int `yaml:"chunk_rows"`
+	// TempDir holds spilled rows. Empty uses the default directory for temporary files
+	TempDir string `yaml:"temp_dir"`
+}
+
+type Schemas struct {
+	// Policy decides what happens to source rows not matching their schema: fail, skip or quarantine
+	Policy string `yaml:"policy"`
+	// Reports holds the schema of each report type, keyed by report type. Report types without a schema are not validated
+	Reports map[string]schema.Schema `yaml:"reports"`
+}
+
+// Enabled reports whether S3 event notifications are received at all
+func (e Events) Enabled() bool {
+	return e.HTTP || e.QueueURL != ""
+}
+
+func Default() Config {
+	return Config{
+		Server: Server{
+			Port:        3333,
+			ReadTimeout: 15 * time.Second,
+			// generation of a large aggregate happens within the request, so writes get a generous deadline
+			WriteTimeout:    120 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Storage: Storage{
+			KeyLayout: storer.DefaultKeyLayout(),
+		},
+		Reports: Reports{
+			MinimumYear: 2020,
+		},
+		Log: Log{
+			Level: "info",
+		},
+		Tracing: Tracing{
+			Exporter: tracing.NoneExporter,
+		},
+		Readiness: Readiness{
+			CacheTTL:    10 * time.Second,
+			PingTimeout: 10 * time.Second,
+		},
+		Scheduler: Scheduler{
+			Cron:           "0 * * * *",
+			NotBeforeDay:   2,
+			NotBeforeHour:  6,
+			MaxAttempts:    3,
+			InitialBackoff: 30 * time.Second,
+			LeaseDuration:  time.Hour,
+		},
+		Jobs: Jobs{
+			Workers:   2,
+			QueueSize: 100,
+			Lease:     30 * time.Minute,
+			Retention: 24 * time.Hour,
+		},
+		Webhooks: Webhooks{
+			MaxAttempts:    5,
+			InitialBackoff: 5 * time.Second,
+			Timeout:        10 * time.Second,
+		},
+		Events: Events{
+			Debounce: time.Minute,
+		},
+		Uploads: Uploads{
+			MaxBytes: 10 << 20,
+		},
+		Periods: Periods{
+			// financial records are commonly kept for seven years
+			Retention:     7 * 365 * 24 * time.Hour,
+			RetentionMode: string(storer.GovernanceRetentionMode),
+		},
+		Schemas: Schemas{
+			Policy: string(schema.FailPolicy),
+		},
+		Deduplication: Deduplication{
+			Keep: string(report.KeepLast),
+		},
+		Sorting: Sorting{
+			ChunkRows: 100000,
+		},
+		Ingestion: Ingestion{
+			Encoding:   string(ingest.AutoEncoding),
+			Delimiter:  ingest.AutoDelimiter,
+			RaggedRows: string(ingest.FailRagged),
+		},
+		Quality: Quality{
+			RowCountThreshold: report.DefaultRowCountThreshold,
+		},
+	}
+}
+
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server port must be in the range 1..65535, got %d", c.Server.Port))
+	}
+
+	for _, t := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"server read timeout", c.Server.ReadTimeout},
+		{"server write timeout", c.Server.WriteTimeout},
+		{"server idle timeout", c.Server.IdleTimeout},
+		{"server shutdown timeout", c.Server.ShutdownTimeout},
+		{"readiness ping timeout", c.Readiness.PingTimeout},
+		{"jobs lease", c.Jobs.Lease},
+		{"jobs retention", c.Jobs.Retention},
+	} {
+		if t.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %s", t.name, t.value))
+		}
+	}
+
+	if c.Readiness.CacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("readiness cache ttl must not be negative, got %s", c.Readiness.CacheTTL))
+	}
+
+	if c.Storage.Bucket == "" {
+		errs = append(errs, errors.New("storage bucket is required"))
+	}
+
+	if (c.Storage.AccessKeyID == "") != (c.Storage.SecretAccessKey == "") {
+		errs = append(errs, errors.New("storage access key id and secret access key must be provided together"))
+	}
+
+	if err := c.Storage.KeyLayout.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.Reports.MinimumYear < 1 {
+		errs = append(errs, fmt.Errorf("reports minimum year must be positive, got %d", c.Reports.MinimumYear))
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, err)
+	}
+
+	switch c.Tracing.Exporter {
+	case "", tracing.NoneExporter, tracing.StdoutExporter, tracing.OTLPExporter:
+	default:
+		errs = append(errs, fmt.Errorf("tracing exporter '%s' is invalid", c.Tracing.Exporter))
+	}
+
+	if c.Jobs.Workers < 1 {
+		errs = append(errs, fmt.Errorf("jobs workers must be positive, got %d", c.Jobs.Workers))
+	}
+
+	if c.Jobs.QueueSize < 1 {
+		errs = append(errs, fmt.Errorf("jobs queue size must be positive, got %d", c.Jobs.QueueSize))
+	}
+
+	if c.Uploads.MaxBytes < 1 {
+		errs = append(errs, fmt.Errorf("uploads max bytes must be positive, got %d", c.Uploads.MaxBytes))
+	}
+
+	var clustersWithoutToken []string
+	for cluster, token := range c.Uploads.Tokens {
+		if token == "" {
+			clustersWithoutToken = append(clustersWithoutToken, cluster)
+		}
+	}
+	slices.Sort(clustersWithoutToken)
+	for _, cluster := range clustersWithoutToken {
+		errs = append(errs, fmt.Errorf("uploads token of cluster '%s' is empty", cluster))
+	}
+
+	if c.Periods.AdminToken != "" {
+		errs = append(errs, c.Periods.validate()...)
+	}
+
+	errs = append(errs, c.Schemas.validate()...)
+
+	if c.Deduplication.Enabled {
+		errs = append(errs, c.Deduplication.validate()...)
+	}
+
+	errs = append(errs, c.Sorting.validate()...)
+	errs = append(errs, c.Ingestion.validate()...)
+
+	if c.Quality.RowCountThreshold <= 0 {
+		errs = append(errs, fmt.Errorf("quality row count threshold must be positive, got %g", c.Quality.RowCountThreshold))
+	}
+
+	if c.Scheduler.Enabled {
+		errs = append(errs, c.Scheduler.validate()...)
+	}
+
+	if len(c.Webhooks.URLs) > 0 {
+		errs = append(errs, c.Webhooks.validate()...)
+	}
+
+	if c.Events.Enabled() {
+		errs = append(errs, c.Events.validate()...)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s Scheduler) validate() []error {
+	var errs []error
+
+	if _, err := cron.ParseStandard(s.Cron); err != nil {
+		errs = append(errs, fmt.Errorf("scheduler cron '%s' is invalid: %v", s.Cron, err))
+	}
+
+	// every month has a 28th
+	if s.NotBeforeDay < 1 || s.NotBeforeDay > 28 {
+		errs = append(errs, fmt.Errorf("scheduler not before day must be in the range 1..28, got %d", s.NotBeforeDay))
+	}
+
+	if s.NotBeforeHour < 0 || s.NotBeforeHour > 23 {
+		errs = append(errs, fmt.Errorf("scheduler not before hour must be in the range 0..23, got %d", s.NotBeforeHour))
+	}
+
+	if s.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("scheduler max attempts must be positive, got %d", s.MaxAttempts))
+	}
+
+	if s.InitialBackoff <= 0 {
+		errs = append(errs, fmt.Errorf("scheduler initial backoff must be positive, got %s", s.InitialBackoff))
+	}
+
+	if s.LeaseDuration <= 0 {
+		errs = append(errs, fmt.Errorf("scheduler lease duration must be positive, got %s", s.LeaseDuration))
+	}
+
+	return errs
+}
+
+func (w Webhooks) validate() []error {
+	var errs []error
+
+	for _, u := range w.URLs {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("webhook url '%s' is invalid", u))
+		}
+	}
+
+	if w.Secret == "" {
+		errs = append(errs, errors.New("webhook secret is required when webhook urls are configured"))
+	}
+
+	if w.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("webhook max attempts must be positive, got %d", w.MaxAttempts))
+	}
+
+	if w.InitialBackoff <= 0 {
+		errs = append(errs, fmt.Errorf("webhook initial backoff must be positive, got %s", w.InitialBackoff))
+	}
+
+	if w.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("webhook timeout must be positive, got %s", w.Timeout))
+	}
+
+	return errs
+}
+
+func (e Events) validate() []error {
+	var errs []error
+
+	if e.QueueURL != "" {
+		if parsed, err := url.Parse(e.QueueURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("events queue url '%s' is invalid", e.QueueURL))
+		}
+	}
+
+	if e.HTTP && e.Token == "" {
+		errs = append(errs, errors.New("events token is required to accept notifications over http"))
+	}
+
+	if e.Rebuild && e.Debounce <= 0 {
+		errs = append(errs, fmt.Errorf("events debounce must be positive, got %s", e.Debounce))
+	}
+
+	return errs
+}
+
+func (p Periods) validate() []error {
+	var errs []error
+
+	if p.Retention <= 0 {
+		errs = append(errs, fmt.Errorf("periods retention must be positive, got %s", p.Retention))
+	}
+
+	switch storer.RetentionMode(p.RetentionMode) {
+	case storer.GovernanceRetentionMode, storer.ComplianceRetentionMode:
+	default:
+		errs = append(errs, fmt.Errorf("periods retention mode '%s' is invalid", p.RetentionMode))
+	}
+
+	return errs
+}
+
+func (d Deduplication) validate() []error {
+	var errs []error
+
+	if _, err := report.ParseKeepPolicy(d.Keep); err != nil {
+		errs = append(errs, err)
+	}
+
+	for reportType := range d.Keys {
+		if _, err := storer.ParseReportType(reportType); err != nil {
+			errs = append(errs, fmt.Errorf("deduplication report type '%s' is invalid", reportType))
+		}
+	}
+
+	return errs
+}
+
+func (i Ingestion) validate() []error {
+	var errs []error
+
+	if _, err := ingest.ParseEncoding(i.Encoding); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := ingest.ParseDelimiter(i.Delimiter); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := ingest.ParseRaggedPolicy(i.RaggedRows); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func (s Sorting) validate() []error {
+	var errs []error
+
+	if s.ChunkRows <= 0 {
+		errs = append(errs, fmt.Errorf("sorting chunk rows must be positive, got %d", s.ChunkRows))
+	}
+
+	for reportType := range s.Keys {
+		if _, err := storer.ParseReportType(reportType); err != nil {
+			errs = append(errs, fmt.Errorf("sorting report type '%s' is invalid", reportType))
+		}
+	}
+
+	return errs
+}
+
+func (s Schemas) validate() []error {
+	var errs []error
+
+	if _, err := schema.ParsePolicy(s.Policy); err != nil {
+		errs = append(errs, err)
+	}
+
+	for reportType, sch := range s.Reports {
+		if _, err := storer.ParseReportType(reportType); err != nil {
+			errs = append(errs, fmt.Errorf("schema report type '%s' is invalid", reportType))
+			continue
+		}
+
+		if _, err := schema.New(sch); err != nil {
+			errs = append(errs, fmt.Errorf("schema of %s is invalid: %v", reportType, err))
+		}
+	}
+
+	return errs
+}
+
+// Redacted returns a copy of the configuration that is safe to print
+func (c Config) Redacted() Config {
+	if c.Storage.SecretAccessKey != "" {
+		c.Storage.SecretAccessKey = redacted
+	}
+
+	if c.Webhooks.Secret != "" {
+		c.Webhooks.Secret = redacted
+	}
+
+	if c.Periods.AdminToken != "" {
+		c.Periods.AdminToken = redacted
+	}
+
+	if c.Events.Token != "" {
+		c.Events.Token = redacted
+	}
+
+	if len(c.Uploads.Tokens) > 0 {
+		tokens := make(map[string]string, len(c.Uploads.Tokens))
+		for cluster := range c.Uploads.Tokens {
+			tokens[cluster] = redacted
+		}
+		c.Uploads.Tokens = tokens
+	}
+
+	return c
+}
+
+// Print writes the redacted configuration to w as YAML
+func (c Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	defer encoder.Close()
+	return encoder.Encode(c.Redacted())
+}
@@ -0,0 +1,490 @@
+//go:build unit
+
+package config
+
+import (
+	"bytes"
+	"flag"
+	"github.com/hpcsc/outside-in-go/internal/schema"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoader(t *testing.T) {
+	t.Run("use defaults when only required fields are provided", func(t *testing.T) {
+		cfg, err := load(t, nil, map[string]string{"BUCKET": "some-bucket"})
+
+		require.NoError(t, err)
+		expected := Default()
+		expected.Storage.Bucket = "some-bucket"
+		require.Equal(t, expected, *cfg)
+	})
+
+	t.Run("read values from config file", func(t *testing.T) {
+		path := writeConfigFile(t, `
+server:
+  port: 8080
+  write_timeout: 5m
+storage:
+  bucket: file-bucket
+  key_layout:
+    aggregate: aggregates/{type}/{year}{month}.csv
+reports:
+  minimum_year: 2018
+`)
+
+		cfg, err := load(t, []string{"-config", path}, nil)
+
+		require.NoError(t, err)
+		require.Equal(t, 8080, cfg.Server.Port)
+		require.Equal(t, 5*time.Minute, cfg.Server.WriteTimeout)
+		require.Equal(t, 15*time.Second, cfg.Server.ReadTimeout)
+		require.Equal(t, "file-bucket", cfg.Storage.Bucket)
+		require.Equal(t, "aggregates/{type}/{year}{month}.csv", cfg.Storage.KeyLayout.Aggregate)
+		require.Equal(t, "{year}/{month}/{type}", cfg.Storage.KeyLayout.IndividualPrefix)
+		require.Equal(t, 2018, cfg.Reports.MinimumYear)
+	})
+
+	t.Run("take config file path from environment", func(t *testing.T) {
+		path := writeConfigFile(t, "storage:\n  bucket: file-bucket\n")
+
+		cfg, err := load(t, nil, map[string]string{"CONFIG_FILE": path})
+
+		require.NoError(t, err)
+		require.Equal(t, "file-bucket", cfg.Storage.Bucket)
+	})
+
+	t.Run("environment overrides config file and flags override environment", func(t *testing.T) {
+		path := writeConfigFile(t, `
+server:
+  port: 8080
+storage:
+  bucket: file-bucket
+  region: file-region
+`)
+
+		cfg, err := load(t,
+			[]string{"-config", path, "-port", "9090"},
+			map[string]string{"PORT": "7070", "BUCKET": "env-bucket"},
+		)
+
+		require.NoError(t, err)
+		require.Equal(t, 9090, cfg.Server.Port)
+		require.Equal(t, "env-bucket", cfg.Storage.Bucket)
+		require.Equal(t, "file-region", cfg.Storage.Region)
+	})
+
+	t.Run("return error when config file has unknown fields", func(t *testing.T) {
+		path := writeConfigFile(t, "storage:\n  buckett: some-bucket\n")
+
+		_, err := load(t, []string{"-config", path}, nil)
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse config file")
+	})
+
+	t.Run("return error when environment value has wrong type", func(t *testing.T) {
+		_, err := load(t, nil, map[string]string{"BUCKET": "some-bucket", "PORT": "abc"})
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "environment variable PORT: 'abc' is not a number")
+	})
+
+	t.Run("return error when flag value has wrong type", func(t *testing.T) {
+		_, err := load(t, []string{"-shutdown-timeout", "soon"}, map[string]string{"BUCKET": "some-bucket"})
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "flag -shutdown-timeout: 'soon' is not a duration")
+	})
+
+	t.Run("set boolean flag given without a value", func(t *testing.T) {
+		cfg, err := load(t, []string{"--scheduler-enabled", "-readiness-fail-fast=false"}, map[string]string{"BUCKET": "some-bucket", "READINESS_FAIL_FAST": "true"})
+
+		require.NoError(t, err)
+		require.True(t, cfg.Scheduler.Enabled)
+		require.False(t, cfg.Readiness.FailFast)
+	})
+
+	t.Run("return error when required fields are missing", func(t *testing.T) {
+		_, err := load(t, nil, nil)
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "storage bucket is required")
+	})
+}
+
+func TestConfig_ValidateWebhooks(t *testing.T) {
+	t.Run("ignore webhook settings when no url is configured", func(t *testing.T) {
+		cfg := Default()
+		cfg.Storage.Bucket = "some-bucket"
+		cfg.Webhooks.MaxAttempts = 0
+
+		require.NoError(t, cfg.Validate())
+	})
+
+	t.Run("report invalid webhook settings when urls are configured", func(t *testing.T) {
+		cfg := Default()
+		cfg.Storage.Bucket = "some-bucket"
+		cfg.Webhooks.URLs = []string{"https://example.com/hook", "not-a-url"}
+		cfg.Webhooks.MaxAttempts = 0
+
+		err := cfg.Validate()
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "webhook url 'not-a-url' is invalid")
+		require.Contains(t, err.Error(), "webhook secret is required when webhook urls are configured")
+		require.Contains(t, err.Error(), "webhook max attempts must be positive, got 0")
+		require.NotContains(t, err.Error(), "example.com")
+	})
+
+	t.Run("read comma separated urls from environment", func(t *testing.T) {
+		cfg, err := load(t, nil, map[string]string{
+			"BUCKET":         "some-bucket",
+			"WEBHOOK_URLS":   "https://a.example.com/hook, https://b.example.com/hook,",
+			"WEBHOOK_SECRET": "some-secret",
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, []string{"https://a.example.com/hook", "https://b.example.com/hook"}, cfg.Webhooks.URLs)
+	})
+}
+
+func TestConfig_Validate(t *testing.T) {
+	t.Run("report every invalid field", func(t *testing.T) {
+		cfg := Default()
+		cfg.Server.Port = 0
+		cfg.Server.IdleTimeout = 0
+		cfg.Storage.AccessKeyID = "some-key"
+		cfg.Log.Level = "verbose"
+		cfg.Tracing.Exporter = "zipkin"
+		cfg.Jobs.Workers = 0
+		cfg.Uploads.MaxBytes = 0
+
+		err := cfg.Validate()
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "server port must be in the range 1..65535, got 0")
+		require.Contains(t, err.Error(), "server idle timeout must be positive")
+		require.Contains(t, err.Error(), "storage bucket is required")
+		require.Contains(t, err.Error(), "storage access key id and secret access key must be provided together")
+		require.Contains(t, err.Error(), "log level 'verbose' is invalid")
+		require.Contains(t, err.Error(), "tracing exporter 'zipkin' is invalid")
+		require.Contains(t, err.Error(), "jobs workers must be positive, got 0")
+		require.Contains(t, err.Error(), "uploads max bytes must be positive, got 0")
+	})
+}
+
+func TestConfig_ValidateEvents(t *testing.T) {
+	t.Run("ignore event settings when disabled", func(t *testing.T) {
+		cfg := Default()
+		cfg.Storage.Bucket = "some-bucket"
+		cfg.Events.Rebuild = true
+		cfg.Events.Debounce = 0
+
+		require.NoError(t, cfg.Validate())
+	})
+
+	t.Run("validate event settings when enabled", func(t *testing.T) {
+		cfg := Default()
+		cfg.Storage.Bucket = "some-bucket"
+		cfg.Events.QueueURL = "not-a-url"
+		cfg.Events.Rebuild = true
+		cfg.Events.Debounce = 0
+
+		err := cfg.Validate()
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "events queue url 'not-a-url' is invalid")
+		require.Contains(t, err.Error(), "events debounce must be positive, got 0s")
+	})
+
+	t.Run("require token to accept notifications over http", func(t *testing.T) {
+		cfg := Default()
+		cfg.Storage.Bucket = "some-bucket"
+		cfg.Events.HTTP = true
+
+		err := cfg.Validate()
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "events token is required to accept notifications over http")
+	})
+}
+
+func TestConfig_ValidatePeriods(t *testing.T) {
+	t.Run("validate period settings when admin token is set", func(t *testing.T) {
+		cfg := Default()
+		cfg.Storage.Bucket = "some-bucket"
+		cfg.Periods.AdminToken = "some-token"
+		cfg.Periods.RetentionMode = "forever"
+
+		err := cfg.Validate()
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "periods retention mode 'forever' is invalid")
+	})
+}
+
+func TestConfig_ValidateUploads(t *testing.T) {
+	t.Run("return error for cluster with empty token", func(t *testing.T) {
+		cfg := Default()
+		cfg.Storage.Bucket = "some-bucket"
+		cfg.Uploads.Tokens = map[string]string{"cluster-1": "some-token", "cluster-2": ""}
+
+		err := cfg.Validate()
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "uploads token of cluster 'cluster-2' is empty")
+		require.NotContains(t, err.Error(), "cluster-1")
+	})
+}
+
+func TestConfig_ValidateDeduplication(t *testing.T) {
+	t.Run("ignore deduplication settings when disabled", func(t *testing.T) {
+		cfg := Default()
+		cfg.Storage.Bucket = "some-bucket"
+		cfg.Deduplication.Keep = "middle"
+
+		require.NoError(t, cfg.Validate())
+	})
+
+	t.Run("validate deduplication settings when enabled", func(t *testing.T) {
+		cfg := Default()
+		cfg.Storage.Bucket = "some-bucket"
+		cfg.Deduplication.Enabled = true
+		cfg.Deduplication.Keep = "middle"
+		cfg.Deduplication.Keys = map[string][]string{"weekly": {"CLUSTER"}}
+
+		err := cfg.Validate()
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "deduplication keep policy 'middle' is invalid")
+		require.Contains(t, err.Error(), "deduplication report type 'weekly' is invalid")
+	})
+
+	t.Run("read key columns from config file", func(t *testing.T) {
+		path := writeConfigFile(t, `
+storage:
+  bucket: file-bucket
+deduplication:
+  enabled: true
+  keep: first
+  keys:
+    single: [CLUSTER, DAY]
+`)
+
+		cfg, err := load(t, []string{"-config", path}, nil)
+
+		require.NoError(t, err)
+		require.Equal(t, Deduplication{Enabled: true, Keep: "first", Keys: map[string][]string{"single": {"CLUSTER", "DAY"}}}, cfg.Deduplication)
+	})
+}
+
+func TestConfig_PartialAggregation(t *testing.T) {
+	t.Run("read partial aggregation settings from environment", func(t *testing.T) {
+		cfg, err := load(t, nil, map[string]string{
+			"BUCKET":                         "some-bucket",
+			"PARTIAL_AGGREGATION_ENABLED":    "true",
+			"PARTIAL_AGGREGATION_STORE":      "true",
+			"PARTIAL_AGGREGATION_QUARANTINE": "true",
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, PartialAggregation{Enabled: true, Store: true, Quarantine: true}, cfg.PartialAggregation)
+	})
+}
+
+func TestConfig_Quality(t *testing.T) {
+	t.Run("read quality settings from environment", func(t *testing.T) {
+		cfg, err := load(t, nil, map[string]string{
+			"BUCKET":                      "some-bucket",
+			"QUALITY_EXPECTED_CLUSTERS":   "cluster-1, cluster-2",
+			"QUALITY_ROW_COUNT_THRESHOLD": "0.25",
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, Quality{ExpectedClusters: []string{"cluster-1", "cluster-2"}, RowCountThreshold: 0.25}, cfg.Quality)
+	})
+
+	t.Run("return error for threshold that is not a number", func(t *testing.T) {
+		_, err := load(t, nil, map[string]string{
+			"BUCKET":                      "some-bucket",
+			"QUALITY_ROW_COUNT_THRESHOLD": "half",
+		})
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "'half' is not a number")
+	})
+
+	t.Run("report threshold that is not positive", func(t *testing.T) {
+		cfg := Default()
+		cfg.Storage.Bucket = "some-bucket"
+		cfg.Quality.RowCountThreshold = 0
+
+		err := cfg.Validate()
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "quality row count threshold must be positive, got 0")
+	})
+}
+
+func TestConfig_ValidateIngestion(t *testing.T) {
+	t.Run("report invalid ingestion settings", func(t *testing.T) {
+		cfg := Default()
+		cfg.Storage.Bucket = "some-bucket"
+		cfg.Ingestion.Encoding = "ebcdic"
+		cfg.Ingestion.Delimiter = ";;"
+		cfg.Ingestion.RaggedRows = "ignore"
+
+		err := cfg.Validate()
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "ingestion encoding 'ebcdic' is invalid")
+		require.Contains(t, err.Error(), "ingestion delimiter ';;' is invalid")
+		require.Contains(t, err.Error(), "ingestion ragged rows policy 'ignore' is invalid")
+	})
+}
+
+func TestConfig_ValidateSorting(t *testing.T) {
+	t.Run("report invalid sorting settings", func(t *testing.T) {
+		cfg := Default()
+		cfg.Storage.Bucket = "some-bucket"
+		cfg.Sorting.ChunkRows = 0
+		cfg.Sorting.Keys = map[string][]string{"weekly": {"CLUSTER"}}
+
+		err := cfg.Validate()
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "sorting chunk rows must be positive, got 0")
+		require.Contains(t, err.Error(), "sorting report type 'weekly' is invalid")
+	})
+
+	t.Run("read sort keys from config file", func(t *testing.T) {
+		path := writeConfigFile(t, `
+storage:
+  bucket: file-bucket
+sorting:
+  keys:
+    cumulative: [CLUSTER, DAY]
+`)
+
+		cfg, err := load(t, []string{"-config", path}, nil)
+
+		require.NoError(t, err)
+		require.Equal(t, Sorting{Keys: map[string][]string{"cumulative": {"CLUSTER", "DAY"}}, ChunkRows: 100000}, cfg.Sorting)
+	})
+}
+
+func TestConfig_ValidateSchemas(t *testing.T) {
+	t.Run("read schemas from config file", func(t *testing.T) {
+		path := writeConfigFile(t, `
+storage:
+  bucket: file-bucket
+schemas:
+  policy: quarantine
+  reports:
+    single:
+      columns:
+        - name: CLUSTER
+          required: true
+        - name: COST
+          type: number
+`)
+
+		cfg, err := load(t, []string{"-config", path}, nil)
+
+		require.NoError(t, err)
+		require.Equal(t, "quarantine", cfg.Schemas.Policy)
+		require.Equal(t, schema.Schema{Columns: []schema.Column{
+			{Name: "CLUSTER", Required: true},
+			{Name: "COST", Type: schema.NumberType},
+		}}, cfg.Schemas.Reports["single"])
+	})
+
+	t.Run("report invalid schema settings", func(t *testing.T) {
+		cfg := Default()
+		cfg.Storage.Bucket = "some-bucket"
+		cfg.Schemas.Policy = "ignore"
+		cfg.Schemas.Reports = map[string]schema.Schema{
+			"weekly": {Columns: []schema.Column{{Name: "CLUSTER"}}},
+			"single": {Columns: []schema.Column{{Name: "COST", Type: "money"}}},
+		}
+
+		err := cfg.Validate()
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "schema policy 'ignore' is invalid")
+		require.Contains(t, err.Error(), "schema report type 'weekly' is invalid")
+		require.Contains(t, err.Error(), "schema of single is invalid: schema column 'COST' type 'money' is invalid")
+	})
+}
+
+func TestConfig_ValidateScheduler(t *testing.T) {
+	t.Run("ignore scheduler settings when disabled", func(t *testing.T) {
+		cfg := Default()
+		cfg.Storage.Bucket = "some-bucket"
+		cfg.Scheduler.Cron = "invalid"
+
+		require.NoError(t, cfg.Validate())
+	})
+
+	t.Run("validate scheduler settings when enabled", func(t *testing.T) {
+		cfg := Default()
+		cfg.Storage.Bucket = "some-bucket"
+		cfg.Scheduler.Enabled = true
+		cfg.Scheduler.Cron = "invalid"
+		cfg.Scheduler.NotBeforeDay = 31
+		cfg.Scheduler.MaxAttempts = 0
+
+		err := cfg.Validate()
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "scheduler cron 'invalid' is invalid")
+		require.Contains(t, err.Error(), "scheduler not before day must be in the range 1..28, got 31")
+		require.Contains(t, err.Error(), "scheduler max attempts must be positive, got 0")
+	})
+}
+
+func TestConfig_Print(t *testing.T) {
+	t.Run("redact secrets", func(t *testing.T) {
+		cfg := Default()
+		cfg.Storage.AccessKeyID = "some-key"
+		cfg.Storage.SecretAccessKey = "some-secret"
+		cfg.Webhooks.Secret = "some-webhook-secret"
+		cfg.Periods.AdminToken = "some-admin-token"
+		cfg.Uploads.Tokens = map[string]string{"cluster-1": "some-cluster-token"}
+		cfg.Events.Token = "some-events-token"
+
+		var buf bytes.Buffer
+		require.NoError(t, cfg.Print(&buf))
+
+		require.Contains(t, buf.String(), "access_key_id: some-key")
+		require.Contains(t, buf.String(), "secret_access_key: '******'")
+		require.NotContains(t, buf.String(), "some-secret")
+		require.NotContains(t, buf.String(), "some-webhook-secret")
+		require.NotContains(t, buf.String(), "some-admin-token")
+		require.NotContains(t, buf.String(), "some-cluster-token")
+		require.NotContains(t, buf.String(), "some-events-token")
+		require.Equal(t, "some-secret", cfg.Storage.SecretAccessKey)
+		require.Equal(t, "some-cluster-token", cfg.Uploads.Tokens["cluster-1"])
+	})
+}
+
+func load(t *testing.T, args []string, env map[string]string) (*Config, error) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := NewLoader(flags)
+	require.NoError(t, flags.Parse(args))
+
+	return loader.Load(func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	})
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const configFileEnv = "CONFIG_FILE"
+
+type binding struct {
+	env   string
+	flag  string
+	usage string
+	set   func(c *Config, value string) error
+	// boolean lets the flag be given without a value to mean true
+	boolean bool
+}
+
+var bindings = []binding{
+	{env: "PORT", flag: "port", usage: "port to listen on", set: intValue(func(c *Config) *int { return &c.Server.Port })},
+	{env: "READ_TIMEOUT", flag: "read-timeout", usage: "server read timeout", set: durationValue(func(c *Config) *time.Duration { return &c.Server.ReadTimeout })},
+	{env: "WRITE_TIMEOUT", flag: "write-timeout", usage: "server write timeout", set: durationValue(func(c *Config) *time.Duration { return &c.Server.WriteTimeout })},
+	{env: "IDLE_TIMEOUT", flag: "idle-timeout", usage: "server idle timeout", set: durationValue(func(c *Config) *time.Duration { return &c.Server.IdleTimeout })},
+	{env: "SHUTDOWN_TIMEOUT", flag: "shutdown-timeout", usage: "time allowed for in-flight requests to finish on shutdown", set: durationValue(func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout })},
+	{env: "S3_ENDPOINT", flag: "s3-endpoint", usage: "S3 endpoint override", set: stringValue(func(c *Config) *string { return &c.Storage.Endpoint })},
+	{env: "BUCKET", flag: "bucket", usage: "S3 bucket holding reports", set: stringValue(func(c *Config) *string { return &c.Storage.Bucket })},
+	{env: "AWS_REGION", flag: "region", usage: "AWS region", set: stringValue(func(c *Config) *string { return &c.Storage.Region })},
+	{env: "S3_ACCESS_KEY_ID", flag: "s3-access-key-id", usage: "static S3 access key id", set: stringValue(func(c *Config) *string { return &c.Storage.AccessKeyID })},
+	{env: "S3_SECRET_ACCESS_KEY", flag: "s3-secret-access-key", usage: "static S3 secret access key", set: stringValue(func(c *Config) *string { return &c.Storage.SecretAccessKey })},
+	{env: "KEY_LAYOUT_INDIVIDUAL_PREFIX", flag: "key-layout-individual-prefix", usage: "key prefix template of individual cluster files", set: stringValue(func(c *Config) *string { return &c.Storage.KeyLayout.IndividualPrefix })},
+	{env: "KEY_LAYOUT_AGGREGATE", flag: "key-layout-aggregate", usage: "key template of aggregated files", set: stringValue(func(c *Config) *string { return &c.Storage.KeyLayout.Aggregate })},
+	{env: "KEY_LAYOUT_PERIOD", flag: "key-layout-period", usage: "key template of period statuses", set: stringValue(func(c *Config) *string { return &c.Storage.KeyLayout.Period })},
+	{env: "KEY_LAYOUT_LOCKS", flag: "key-layout-locks", usage: "key prefix of locks", set: stringValue(func(c *Config) *string { return &c.Storage.KeyLayout.Locks })},
+	{env: "KEY_LAYOUT_JOBS", flag: "key-layout-jobs", usage: "key prefix of background jobs", set: stringValue(func(c *Config) *string { return &c.Storage.KeyLayout.Jobs })},
+	{env: "MINIMUM_YEAR", flag: "minimum-year", usage: "earliest year reports can be requested for", set: intValue(func(c *Config) *int { return &c.Reports.MinimumYear })},
+	{env: "LOG_LEVEL", flag: "log-level", usage: "log level: debug, info, warn or error", set: stringValue(func(c *Config) *string { return &c.Log.Level })},
+	{env: "TRACES_EXPORTER", flag: "traces-exporter", usage: "traces exporter: none, stdout or otlp", set: stringValue(func(c *Config) *string { return &c.Tracing.Exporter })},
+	{env: "READINESS_CACHE_TTL", flag: "readiness-cache-ttl", usage: "how long a readiness result is reused", set: durationValue(func(c *Config) *time.Duration { return &c.Readiness.CacheTTL })},
+	{env: "READINESS_FAIL_FAST", flag: "readiness-fail-fast", usage: "fail startup when the bucket is not reachable", set: boolValue(func(c *Config) *bool { return &c.Readiness.FailFast }), boolean: true},
+	{env: "READINESS_PING_TIMEOUT", flag: "readiness-ping-timeout", usage: "timeout of the startup and readiness bucket checks", set: durationValue(func(c *Config) *time.Duration { return &c.Readiness.PingTimeout })},
+	{env: "SCHEDULER_ENABLED", flag: "scheduler-enabled", usage: "pre-generate the previous month's aggregates in the background", set: boolValue(func(c *Config) *bool { return &c.Scheduler.Enabled }), boolean: true},
+	{env: "SCHEDULER_CRON", flag: "scheduler-cron", usage: "cron expression of pre-generation checks", set: stringValue(func(c *Config) *string { return &c.Scheduler.Cron })},
+	{env: "SCHEDULER_NOT_BEFORE_DAY", flag: "scheduler-not-before-day", usage: "day of month from which the previous month is pre-generated", set: intValue(func(c *Config) *int { return &c.Scheduler.NotBeforeDay })},
+	{env: "SCHEDULER_NOT_BEFORE_HOUR", flag: "scheduler-not-before-hour", usage: "hour of that day from which the previous month is pre-generated", set: intValue(func(c *Config) *int { return &c.Scheduler.NotBeforeHour })},
+	{env: "SCHEDULER_MAX_ATTEMPTS", flag: "scheduler-max-attempts", usage: "attempts per aggregate before a pre-generation run fails", set: intValue(func(c *Config) *int { return &c.Scheduler.MaxAttempts })},
+	{env: "SCHEDULER_INITIAL_BACKOFF", flag: "scheduler-initial-backoff", usage: "wait before the first retry, doubled after every retry", set: durationValue(func(c *Config) *time.Duration { return &c.Scheduler.InitialBackoff })},
+	{env: "SCHEDULER_LEASE_DURATION", flag: "scheduler-lease-duration", usage: "how long a replica holds the pre-generation lock while building", set: durationValue(func(c *Config) *time.Duration { return &c.Scheduler.LeaseDuration })},
+	{env: "JOBS_WORKERS", flag: "jobs-workers", usage: "number of report generation jobs run concurrently", set: intValue(func(c *Config) *int { return &c.Jobs.Workers })},
+	{env: "JOBS_QUEUE_SIZE", flag: "jobs-queue-size", usage: "number of jobs that can wait for a worker", set: intValue(func(c *Config) *int { return &c.Jobs.QueueSize })},
+	{env: "JOBS_LEASE", flag: "jobs-lease", usage: "how long a replica holds the lock of a running job", set: durationValue(func(c *Config) *time.Duration { return &c.Jobs.Lease })},
+	{env: "JOBS_RETENTION", flag: "jobs-retention", usage: "how long finished jobs and their results are kept", set: durationValue(func(c *Config) *time.Duration { return &c.Jobs.Retention })},
+	{env: "WEBHOOK_URLS", flag: "webhook-urls", usage: "comma separated URLs notified when an aggregate is stored", set: listValue(func(c *Config) *[]string { return &c.Webhooks.URLs })},
+	{env: "WEBHOOK_SECRET", flag: "webhook-secret", usage: "secret signing webhook payloads", set: stringValue(func(c *Config) *string { return &c.Webhooks.Secret })},
+	{env: "WEBHOOK_MAX_ATTEMPTS", flag: "webhook-max-attempts", usage: "deliveries per URL before a notification is dead-lettered", set: intValue(func(c *Config) *int { return &c.Webhooks.MaxAttempts })},
+	{env: "WEBHOOK_INITIAL_BACKOFF", flag: "webhook-initial-backoff", usage: "wait before the first webhook retry, doubled after every retry", set: durationValue(func(c *Config) *time.Duration { return &c.Webhooks.InitialBackoff })},
+	{env: "WEBHOOK_TIMEOUT", flag: "webhook-timeout", usage: "timeout of a single webhook delivery", set: durationValue(func(c *Config) *time.Duration { return &c.Webhooks.Timeout })},
+	{env: "WEBHOOK_DEAD_LETTER_FILE", flag: "webhook-dead-letter-file", usage: "file appended with undeliverable webhook notifications", set: stringValue(func(c *Config) *string { return &c.Webhooks.DeadLetterFile })},
+	{env: "EVENTS_HTTP", flag: "events-http", usage: "accept S3 event notifications posted to /events/s3", set: boolValue(func(c *Config) *bool { return &c.Events.HTTP }), boolean: true},
+	{env: "EVENTS_TOKEN", flag: "events-token", usage: "bearer token of S3 event notifications posted to /events/s3", set: stringValue(func(c *Config) *string { return &c.Events.Token })},
+	{env: "EVENTS_QUEUE_URL", flag: "events-queue-url", usage: "SQS queue URL to consume S3 event notifications from", set: stringValue(func(c *Config) *string { return &c.Events.QueueURL })},
+	{env: "EVENTS_QUEUE_ENDPOINT", flag: "events-queue-endpoint", usage: "SQS endpoint override", set: stringValue(func(c *Config) *string { return &c.Events.QueueEndpoint })},
+	{env: "EVENTS_REBUILD", flag: "events-rebuild", usage: "rebuild aggregates invalidated by uploads in the background", set: boolValue(func(c *Config) *bool { return &c.Events.Rebuild }), boolean: true},
+	{env: "EVENTS_DEBOUNCE", flag: "events-debounce", usage: "time without uploads to a period before it is rebuilt", set: durationValue(func(c *Config) *time.Duration { return &c.Events.Debounce })},
+	{env: "UPLOAD_MAX_BYTES", flag: "upload-max-bytes", usage: "size limit of an uploaded individual file", set: intValue(func(c *Config) *int { return &c.Uploads.MaxBytes })},
+	{env: "UPLOAD_HEADER", flag: "upload-header", usage: "comma separated header every uploaded file must have", set: listValue(func(c *Config) *[]string { return &c.Uploads.Header })},
+	{env: "PERIODS_ADMIN_TOKEN", flag: "periods-admin-token", usage: "bearer token of the period lifecycle and quarantine release endpoints, which are disabled when empty", set: stringValue(func(c *Config) *string { return &c.Periods.AdminToken })},
+	{env: "PERIODS_RETENTION", flag: "periods-retention", usage: "how long object lock retains the aggregates of a locked period", set: durationValue(func(c *Config) *time.Duration { return &c.Periods.Retention })},
+	{env: "PERIODS_RETENTION_MODE", flag: "periods-retention-mode", usage: "object lock mode of locked aggregates: GOVERNANCE or COMPLIANCE", set: stringValue(func(c *Config) *string { return &c.Periods.RetentionMode })},
+	{env: "DEDUPLICATION_ENABLED", flag: "deduplication-enabled", usage: "drop rows appearing in more than one individual file when merging", set: boolValue(func(c *Config) *bool { return &c.Deduplication.Enabled }), boolean: true},
+	{env: "DEDUPLICATION_KEEP", flag: "deduplication-keep", usage: "duplicate row to keep by file last modified time: first or last", set: stringValue(func(c *Config) *string { return &c.Deduplication.Keep })},
+	{env: "PARTIAL_AGGREGATION_ENABLED", flag: "partial-aggregation-enabled", usage: "leave unreadable individual files out of aggregates instead of failing", set: boolValue(func(c *Config) *bool { return &c.PartialAggregation.Enabled }), boolean: true},
+	{env: "PARTIAL_AGGREGATION_STORE", flag: "partial-aggregation-store", usage: "store aggregates built without some of their individual files", set: boolValue(func(c *Config) *bool { return &c.PartialAggregation.Store }), boolean: true},
+	{env: "PARTIAL_AGGREGATION_QUARANTINE", flag: "partial-aggregation-quarantine", usage: "move individual files left out of aggregates to quarantine", set: boolValue(func(c *Config) *bool { return &c.PartialAggregation.Quarantine }), boolean: true},
+	{env: "INGESTION_ENCODING", flag: "ingestion-encoding", usage: "encoding of individual files: auto, utf-8, utf-16, latin-1 or windows-1252", set: stringValue(func(c *Config) *string { return &c.Ingestion.Encoding })},
+	{env: "INGESTION_DELIMITER", flag: "ingestion-delimiter", usage: "delimiter of individual files, or auto to detect it", set: stringValue(func(c *Config) *string { return &c.Ingestion.Delimiter })},
+	{env: "INGESTION_RAGGED_ROWS", flag: "ingestion-ragged-rows", usage: "handling of rows with a different number of fields than the header: fail, skip or pad", set: stringValue(func(c *Config) *string { return &c.Ingestion.RaggedRows })},
+	{env: "SORTING_CHUNK_ROWS", flag: "sorting-chunk-rows", usage: "rows sorted at once before spilling to a temporary file", set: intValue(func(c *Config) *int { return &c.Sorting.ChunkRows })},
+	{env: "SORTING_TEMP_DIR", flag: "sorting-temp-dir", usage: "directory for rows spilled while sorting aggregates", set: stringValue(func(c *Config) *string { return &c.Sorting.TempDir })},
+	{env: "QUALITY_EXPECTED_CLUSTERS", flag: "quality-expected-clusters", usage: "comma separated clusters expected to upload every period, defaulting to those of the previous month", set: listValue(func(c *Config) *[]string { return &c.Quality.ExpectedClusters })},
+	{env: "QUALITY_ROW_COUNT_THRESHOLD", flag: "quality-row-count-threshold", usage: "relative change in the rows of a cluster from the previous month above which it is flagged", set: floatValue(func(c *Config) *float64 { return &c.Quality.RowCountThreshold })},
+	{env: "SCHEMAS_POLICY", flag: "schemas-policy", usage: "handling of source rows not matching their schema: fail, skip or quarantine", set: stringValue(func(c *Config) *string { return &c.Schemas.Policy })},
+}
+
+// Loader registers configuration flags on a flag set and builds the configuration once the flag set is parsed
+type Loader struct {
+	flags      *flag.FlagSet
+	configFile *string
+	values     map[string]*flagValue
+}
+
+func NewLoader(flags *flag.FlagSet) *Loader {
+	l := &Loader{
+		flags:      flags,
+		configFile: flags.String("config", "", fmt.Sprintf("path to YAML config file (env %s)", configFileEnv)),
+		values:     map[string]*flagValue{},
+	}
+	for _, b := range bindings {
+		l.values[b.flag] = &flagValue{boolean: b.boolean}
+		flags.Var(l.values[b.flag], b.flag, fmt.Sprintf("%s (env %s)", b.usage, b.env))
+	}
+
+	return l
+}
+
+// Load builds the configuration from defaults, then the YAML file, then environment variables, then flags, each overriding the previous
+func (l *Loader) Load(lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := Default()
+
+	path := *l.configFile
+	if path == "" {
+		path, _ = lookupEnv(configFileEnv)
+	}
+	if path != "" {
+		if err := loadFile(&cfg, path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, b := range bindings {
+		if value, ok := lookupEnv(b.env); ok && value != "" {
+			if err := b.set(&cfg, value); err != nil {
+				return nil, fmt.Errorf("environment variable %s: %v", b.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	setFlags := map[string]bool{}
+	l.flags.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+	for _, b := range bindings {
+		if !setFlags[b.flag] {
+			continue
+		}
+		if err := b.set(&cfg, l.values[b.flag].value); err != nil && flagErr == nil {
+			flagErr = fmt.Errorf("flag -%s: %v", b.flag, err)
+		}
+	}
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	return &cfg, nil
+}
+
+// flagValue keeps the raw value of a flag so that it is parsed by its binding once defaults, the config file and environment variables are applied
+type flagValue struct {
+	value   string
+	boolean bool
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.value
+}
+
+func (v *flagValue) Set(value string) error {
+	v.value = value
+	return nil
+}
+
+// IsBoolFlag makes the flag package accept a bare boolean flag, setting it to "true"
+func (v *flagValue) IsBoolFlag() bool {
+	return v.boolean
+}
+
+func loadFile(cfg *Config, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	return nil
+}
+
+func stringValue(field func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+// listValue splits a comma separated value, ignoring blank items
+func listValue(field func(c *Config) *[]string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field(c) = items
+		return nil
+	}
+}
+
+func intValue(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a number", value)
+		}
+		*field(c) = v
+		return nil
+	}
+}
+
+func floatValue(field func(c *Config) *float64) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a number", value)
+		}
+		*field(c) = v
+		return nil
+	}
+}
+
+func boolValue(field func(c *Config) *bool) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a boolean", value)
+		}
+		*field(c) = v
+		return nil
+	}
+}
+
+func durationValue(field func(c *Config) *time.Duration) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a duration", value)
+		}
+		*field(c) = v
+		return nil
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strings"
+)
+
+// requireBearerToken lets a request through when it carries token as a bearer token, and otherwise responds with message
+func requireBearerToken(token string, message string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !hasBearerToken(r, token) {
+				unauthorized(w, message)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireClusterToken lets a request through when it carries the token of the cluster in its URL, or adminToken, as a bearer token
+func requireClusterToken(clusterTokens map[string]string, adminToken string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !hasBearerToken(r, clusterTokens[chi.URLParam(r, "cluster")]) && !hasBearerToken(r, adminToken) {
+				unauthorized(w, "a valid cluster or admin token is required")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasBearerToken reports whether r carries token as its bearer token. An empty token never matches
+func hasBearerToken(r *http.Request, token string) bool {
+	provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && token != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	w.WriteHeader(http.StatusUnauthorized)
+	errorResponse(w, message)
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const reportDiffRoutePattern = "/reports/{type}/diff"
+
+// RegisterReportDiffRoutes serves the differences between the aggregates of two periods, or two versions of them
+func RegisterReportDiffRoutes(router *chi.Mux, generator report.Generator, records report.Records, minimumYear int) {
+	h := &reportDiffHandler{
+		generator:   generator,
+		records:     records,
+		minimumYear: minimumYear,
+	}
+	router.Get(reportDiffRoutePattern, h.Diff)
+}
+
+type reportDiffHandler struct {
+	generator   report.Generator
+	records     report.Records
+	minimumYear int
+}
+
+func (h *reportDiffHandler) Diff(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "reportDiffHandler.Diff")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	reportType, err := storer.ParseReportType(chi.URLParam(r, "type"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	baseYear, baseMonth, err := parsePeriod(query.Get("base"), h.minimumYear)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, fmt.Sprintf("base %v", err))
+		return
+	}
+
+	headYear, headMonth, err := parsePeriod(query.Get("head"), h.minimumYear)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, fmt.Sprintf("head %v", err))
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = report.CSVFormat
+	}
+
+	if format != report.CSVFormat && format != report.JSONFormat {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, fmt.Sprintf("format '%s' is invalid", format))
+		return
+	}
+
+	var key []string
+	if query.Get("key") != "" {
+		key = strings.Split(query.Get("key"), ",")
+	}
+
+	span.SetAttributes(
+		attribute.String("report.type", string(reportType)),
+		attribute.String("report.base", query.Get("base")),
+		attribute.String("report.head", query.Get("head")),
+	)
+
+	base, err := h.aggregate(ctx, reportType, baseYear, baseMonth, query.Get("base_version"))
+	if err != nil {
+		generateErrorResponse(w, r, err)
+		return
+	}
+
+	head, err := h.aggregate(ctx, reportType, headYear, headMonth, query.Get("head_version"))
+	if err != nil {
+		generateErrorResponse(w, r, err)
+		return
+	}
+
+	diff, err := report.Compare(base, head, key)
+	if errors.Is(err, report.ErrUnknownColumn) {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to compare reports", slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	if format == report.JSONFormat {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%d%02d-%d%02d-diff.csv", reportType, baseYear, baseMonth, headYear, headMonth))
+	}
+	w.WriteHeader(http.StatusOK)
+	if err := report.WriteDiff(w, diff, format); err != nil {
+		slog.WarnContext(ctx, "failed to write diff", slog.String("error", err.Error()))
+	}
+}
+
+// aggregate resolves one side of a diff. A version is read from the records, otherwise the generator reuses an existing aggregate or builds a missing one
+func (h *reportDiffHandler) aggregate(ctx context.Context, reportType storer.ReportType, year int, month int, version string) ([]byte, error) {
+	if version != "" {
+		return h.records.Version(ctx, reportType, year, month, version)
+	}
+
+	return h.generator.Generate(ctx, reportType, year, month)
+}
+
+// parsePeriod reads a period written as YYYY-MM
+func parsePeriod(period string, minimumYear int) (int, int, error) {
+	yearParam, monthParam, found := strings.Cut(period, "-")
+	if !found || yearParam == "" || monthParam == "" {
+		return 0, 0, fmt.Errorf("period '%s' is invalid, expected YYYY-MM", period)
+	}
+
+	year, month, err := parseYearAndMonth(yearParam, monthParam, minimumYear)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return *year, *month, nil
+}
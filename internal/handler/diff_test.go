@@ -0,0 +1,152 @@
+//go:build unit
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReportDiff(t *testing.T) {
+	base := []byte(`CLUSTER,CPU
+cluster-1,1
+cluster-2,2
+`)
+	head := []byte(`CLUSTER,CPU
+cluster-1,3
+`)
+
+	t.Run("return 200 with csv diff of two periods", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/cumulative/diff?base=2022-03&head=2022-04&key=CLUSTER", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Generate", mock.Anything, storer.CumulativeReportType, 2022, 3).Return(base, nil)
+		stubGenerator.On("Generate", mock.Anything, storer.CumulativeReportType, 2022, 4).Return(head, nil)
+		router := testRouterWithReportDiff(stubGenerator, report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "text/csv", recorder.Header().Get("Content-Type"))
+		require.Equal(t, "attachment; filename=cumulative-202203-202204-diff.csv", recorder.Header().Get("Content-Disposition"))
+		require.Equal(t, `change,CLUSTER,column,base,head,delta
+removed,cluster-2,CPU,2,,
+changed,cluster-1,CPU,1,3,2
+`, recorder.Body.String())
+	})
+
+	t.Run("return 200 with json diff of two versions", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/diff?base=2022-04&head=2022-04&base_version=v1&head_version=v2&key=CLUSTER&format=json", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubRecords := report.NewMockRecords()
+		stubRecords.StubVersion(storer.SingleReportType, 2022, 4, "v1").Return(base, nil)
+		stubRecords.StubVersion(storer.SingleReportType, 2022, 4, "v2").Return(head, nil)
+		router := testRouterWithReportDiff(report.NewMockGenerator(), stubRecords)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		require.JSONEq(t, `{
+			"key": ["CLUSTER"],
+			"added": [],
+			"removed": [{"CLUSTER": "cluster-2", "CPU": "2"}],
+			"changed": [{"key": {"CLUSTER": "cluster-1"}, "columns": [{"column": "CPU", "base": "1", "head": "3", "delta": 2}]}],
+			"added_columns": [],
+			"removed_columns": []
+		}`, recorder.Body.String())
+	})
+
+	t.Run("return 400 when period is invalid", func(t *testing.T) {
+		router := testRouterWithReportDiff(report.NewMockGenerator(), report.NewMockRecords())
+
+		for url, message := range map[string]string{
+			"/reports/single/diff?head=2022-04":                         "base period '' is invalid, expected YYYY-MM",
+			"/reports/single/diff?base=2022-04&head=2022":               "head period '2022' is invalid, expected YYYY-MM",
+			"/reports/single/diff?base=2022-13&head=2022-04":            "base month must be in the range 1..12",
+			"/reports/single/diff?base=2019-12&head=2022-04":            "base 2019 is too early",
+			"/reports/single/diff?base=2022-03&head=2022-04&format=xml": "format 'xml' is invalid",
+		} {
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", url, nil)
+			require.NoError(t, err)
+
+			router.ServeHTTP(recorder, req)
+
+			require.Equal(t, http.StatusBadRequest, recorder.Code, url)
+			requireErrorResponse(t, recorder, message)
+		}
+	})
+
+	t.Run("return 400 when key column is unknown", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/diff?base=2022-03&head=2022-04&key=OWNER", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Generate", mock.Anything, storer.SingleReportType, mock.Anything, mock.Anything).Return(base, nil)
+		router := testRouterWithReportDiff(stubGenerator, report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		requireErrorResponse(t, recorder, "unknown column: key column 'OWNER' is not in both reports")
+	})
+
+	t.Run("return 404 when a period has no data", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/diff?base=2022-03&head=2022-04", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Generate", mock.Anything, storer.SingleReportType, 2022, 3).Return(nil, fmt.Errorf("%w for 03/2022", report.ErrNoData))
+		router := testRouterWithReportDiff(stubGenerator, report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+		requireErrorResponse(t, recorder, "no data available for 03/2022")
+	})
+
+	t.Run("return 500 when generator returns error", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/diff?base=2022-03&head=2022-04", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Generate", mock.Anything, storer.SingleReportType, 2022, 3).Return(base, nil)
+		stubGenerator.On("Generate", mock.Anything, storer.SingleReportType, 2022, 4).Return(nil, errors.New("some error"))
+		router := testRouterWithReportDiff(stubGenerator, report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusInternalServerError, recorder.Code)
+		requireErrorResponse(t, recorder, "some error")
+	})
+
+	t.Run("return 404 when report type is unknown", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/not-valid/diff?base=2022-03&head=2022-04", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		router := testRouterWithReportDiff(report.NewMockGenerator(), report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+}
+
+func testRouterWithReportDiff(generator report.Generator, records report.Records) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	RegisterReportDiffRoutes(r, generator, records, 2020)
+	return r
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	healthzRoutePattern = "/healthz"
+	readyzRoutePattern  = "/readyz"
+)
+
+type HealthResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// RegisterHealthRoutes registers liveness and readiness routes. Readiness pings the storer at most once per readinessCacheTTL, giving up after pingTimeout
+func RegisterHealthRoutes(router *chi.Mux, storer storer.Storer, readinessCacheTTL time.Duration, pingTimeout time.Duration) {
+	h := &healthHandler{
+		storer:      storer,
+		cacheTTL:    readinessCacheTTL,
+		pingTimeout: pingTimeout,
+		now:         time.Now,
+	}
+	router.Get(healthzRoutePattern, h.Liveness)
+	router.Get(readyzRoutePattern, h.Readiness)
+}
+
+type healthHandler struct {
+	storer      storer.Storer
+	cacheTTL    time.Duration
+	pingTimeout time.Duration
+	now         func() time.Time
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	lastErr   error
+}
+
+func (h *healthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	h.healthResponse(w, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+func (h *healthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	if err := h.ready(r.Context()); err != nil {
+		h.healthResponse(w, http.StatusServiceUnavailable, HealthResponse{
+			Status:  "unavailable",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.healthResponse(w, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+func (h *healthHandler) ready(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.checkedAt.IsZero() && h.now().Sub(h.checkedAt) < h.cacheTTL {
+		return h.lastErr
+	}
+
+	// the ping is detached from the probe so that an aborted probe neither cuts it short nor leaves a cancellation cached
+	pingCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), h.pingTimeout)
+	defer cancel()
+
+	err := h.storer.Ping(pingCtx)
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	h.lastErr = err
+	h.checkedAt = h.now()
+	if h.lastErr != nil {
+		slog.WarnContext(ctx, "readiness check failed", slog.String("error", h.lastErr.Error()))
+	}
+
+	return h.lastErr
+}
+
+func (h *healthHandler) healthResponse(w http.ResponseWriter, status int, response HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
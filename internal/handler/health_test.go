@@ -0,0 +1,132 @@
+//go:build unit
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	t.Run("liveness returns 200 without checking storer", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		router := testRouterWithHealth(stubStorer, time.Minute)
+
+		recorder := serveHealthRequest(t, router, "/healthz")
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		requireHealthResponse(t, recorder, HealthResponse{Status: "ok"})
+		stubStorer.AssertNotCalled(t, "Ping")
+	})
+
+	t.Run("readiness returns 200 when storer is reachable", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubPing().Return(nil)
+		router := testRouterWithHealth(stubStorer, time.Minute)
+
+		recorder := serveHealthRequest(t, router, "/readyz")
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		requireHealthResponse(t, recorder, HealthResponse{Status: "ok"})
+	})
+
+	t.Run("readiness returns 503 when storer is not reachable", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubPing().Return(errors.New("some error"))
+		router := testRouterWithHealth(stubStorer, time.Minute)
+
+		recorder := serveHealthRequest(t, router, "/readyz")
+
+		require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		requireHealthResponse(t, recorder, HealthResponse{Status: "unavailable", Message: "some error"})
+	})
+
+	t.Run("readiness reuses cached result within ttl", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubPing().Return(nil)
+		router := testRouterWithHealth(stubStorer, time.Minute)
+
+		serveHealthRequest(t, router, "/readyz")
+		serveHealthRequest(t, router, "/readyz")
+
+		stubStorer.AssertNumberOfCalls(t, "Ping", 1)
+	})
+
+	t.Run("readiness checks storer again once ttl expires", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubPing().Return(nil)
+		router := testRouterWithHealth(stubStorer, 0)
+
+		serveHealthRequest(t, router, "/readyz")
+		serveHealthRequest(t, router, "/readyz")
+
+		stubStorer.AssertNumberOfCalls(t, "Ping", 2)
+	})
+
+	t.Run("readiness does not cache a cancelled check", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubPing().Return(context.Canceled).Once()
+		stubStorer.StubPing().Return(nil)
+		router := testRouterWithHealth(stubStorer, time.Minute)
+
+		serveHealthRequest(t, router, "/readyz")
+		recorder := serveHealthRequest(t, router, "/readyz")
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		stubStorer.AssertNumberOfCalls(t, "Ping", 2)
+	})
+
+	t.Run("readiness pings storer with a context that outlives the probe", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		var pingErr error
+		var hasDeadline bool
+		stubStorer.StubPing().Run(func(args mock.Arguments) {
+			pingCtx := args.Get(0).(context.Context)
+			pingErr = pingCtx.Err()
+			_, hasDeadline = pingCtx.Deadline()
+		}).Return(nil)
+		router := testRouterWithHealth(stubStorer, time.Minute)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req, err := http.NewRequestWithContext(ctx, "GET", "/readyz", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.NoError(t, pingErr)
+		require.True(t, hasDeadline)
+	})
+}
+
+func serveHealthRequest(t *testing.T, router *chi.Mux, path string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", path, nil)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func requireHealthResponse(t *testing.T, recorder *httptest.ResponseRecorder, expected HealthResponse) {
+	var response HealthResponse
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.Equal(t, expected, response)
+}
+
+func testRouterWithHealth(s storer.Storer, readinessCacheTTL time.Duration) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	RegisterHealthRoutes(r, s, readinessCacheTTL, time.Second)
+	return r
+}
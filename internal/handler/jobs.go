@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/hpcsc/outside-in-go/internal/job"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	reportJobsRoutePattern = "/reports/{type}/jobs"
+	jobRoutePattern        = "/jobs/{id}"
+	jobResultRoutePattern  = "/jobs/{id}/result"
+)
+
+func RegisterJobsRoutes(router *chi.Mux, manager job.Manager, minimumYear int) {
+	h := &jobsHandler{
+		manager:     manager,
+		minimumYear: minimumYear,
+	}
+	router.Post(reportJobsRoutePattern, h.Submit)
+	router.Get(jobRoutePattern, h.Get)
+	router.Get(jobResultRoutePattern, h.Result)
+}
+
+type jobsHandler struct {
+	manager     job.Manager
+	minimumYear int
+}
+
+func (h *jobsHandler) Submit(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "jobsHandler.Submit")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	reportType, err := storer.ParseReportType(chi.URLParam(r, "type"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	year, month, err := parseYearAndMonth(r.URL.Query().Get("year"), r.URL.Query().Get("month"), h.minimumYear)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("report.type", string(reportType)),
+		attribute.Int("report.year", *year),
+		attribute.Int("report.month", *month),
+	)
+
+	j, err := h.manager.Submit(ctx, reportType, *year, *month)
+	if errors.Is(err, job.ErrQueueFull) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to submit job", slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%s", j.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(j)
+}
+
+func (h *jobsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "jobsHandler.Get")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.String("job.id", id))
+
+	j, err := h.manager.Get(ctx, id)
+	if err != nil {
+		h.jobErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(j)
+}
+
+func (h *jobsHandler) Result(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "jobsHandler.Result")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.String("job.id", id))
+
+	j, err := h.manager.Get(ctx, id)
+	if err != nil {
+		h.jobErrorResponse(w, r, err)
+		return
+	}
+
+	data, err := h.manager.Result(ctx, id)
+	if err != nil {
+		h.jobErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%d%02d.csv", j.ReportType, j.Year, j.Month))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (h *jobsHandler) jobErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, job.ErrNotFound), errors.Is(err, report.ErrVersionNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, job.ErrNotFinished), errors.Is(err, job.ErrFailed):
+		w.WriteHeader(http.StatusConflict)
+	default:
+		slog.ErrorContext(r.Context(), "failed to retrieve job", slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	errorResponse(w, err.Error())
+}
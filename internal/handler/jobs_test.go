@@ -0,0 +1,148 @@
+//go:build unit
+
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/hpcsc/outside-in-go/internal/job"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJobs(t *testing.T) {
+	t.Run("return 202 with queued job when submitted", func(t *testing.T) {
+		stubManager := job.NewMockManager()
+		stubManager.StubSubmit(storer.CumulativeReportType, 2022, 4).Return(job.Job{ID: "some-job", Status: job.QueuedStatus}, nil)
+
+		recorder := serveJobsRequest(t, stubManager, "POST", "/reports/cumulative/jobs?year=2022&month=4")
+
+		require.Equal(t, http.StatusAccepted, recorder.Code)
+		require.Equal(t, "/jobs/some-job", recorder.Header().Get("Location"))
+		var response job.Job
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+		require.Equal(t, "some-job", response.ID)
+		require.Equal(t, job.QueuedStatus, response.Status)
+	})
+
+	t.Run("return 404 when submitting unknown report type", func(t *testing.T) {
+		recorder := serveJobsRequest(t, job.NewMockManager(), "POST", "/reports/not-valid/jobs?year=2022&month=4")
+
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("return 400 when submitting invalid period", func(t *testing.T) {
+		recorder := serveJobsRequest(t, job.NewMockManager(), "POST", "/reports/single/jobs?year=2022&month=13")
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		requireErrorMessage(t, recorder, "month must be in the range 1..12")
+	})
+
+	t.Run("return 503 when queue is full", func(t *testing.T) {
+		stubManager := job.NewMockManager()
+		stubManager.StubSubmit(storer.SingleReportType, 2022, 4).Return(job.Job{}, job.ErrQueueFull)
+
+		recorder := serveJobsRequest(t, stubManager, "POST", "/reports/single/jobs?year=2022&month=4")
+
+		require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		require.NotEmpty(t, recorder.Header().Get("Retry-After"))
+	})
+
+	t.Run("return job status and progress", func(t *testing.T) {
+		stubManager := job.NewMockManager()
+		stubManager.StubGet("some-job").Return(job.Job{
+			ID:       "some-job",
+			Status:   job.RunningStatus,
+			Progress: job.Progress{Processed: 1, Total: 3},
+		}, nil)
+
+		recorder := serveJobsRequest(t, stubManager, "GET", "/jobs/some-job")
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var response job.Job
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+		require.Equal(t, job.RunningStatus, response.Status)
+		require.Equal(t, job.Progress{Processed: 1, Total: 3}, response.Progress)
+	})
+
+	t.Run("return 404 for unknown job", func(t *testing.T) {
+		stubManager := job.NewMockManager()
+		stubManager.StubGet("unknown").Return(job.Job{}, job.ErrNotFound)
+
+		recorder := serveJobsRequest(t, stubManager, "GET", "/jobs/unknown")
+
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("return csv result of succeeded job", func(t *testing.T) {
+		stubManager := job.NewMockManager()
+		stubManager.StubGet("some-job").Return(job.Job{
+			ID:         "some-job",
+			ReportType: storer.SingleReportType,
+			Year:       2022,
+			Month:      4,
+			Status:     job.SucceededStatus,
+		}, nil)
+		stubManager.StubResult("some-job").Return([]byte("some,csv,data"), nil)
+
+		recorder := serveJobsRequest(t, stubManager, "GET", "/jobs/some-job/result")
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "text/csv", recorder.Header().Get("Content-Type"))
+		require.Equal(t, "attachment; filename=single-202204.csv", recorder.Header().Get("Content-Disposition"))
+		require.Equal(t, "some,csv,data", recorder.Body.String())
+	})
+
+	t.Run("return 409 for result of unfinished job", func(t *testing.T) {
+		stubManager := job.NewMockManager()
+		stubManager.StubGet("some-job").Return(job.Job{ID: "some-job", Status: job.RunningStatus}, nil)
+		stubManager.StubResult("some-job").Return(nil, job.ErrNotFinished)
+
+		recorder := serveJobsRequest(t, stubManager, "GET", "/jobs/some-job/result")
+
+		require.Equal(t, http.StatusConflict, recorder.Code)
+	})
+
+	t.Run("return 404 when version built by job is no longer kept", func(t *testing.T) {
+		stubManager := job.NewMockManager()
+		stubManager.StubGet("some-job").Return(job.Job{ID: "some-job", Status: job.SucceededStatus, Version: "some-version"}, nil)
+		stubManager.StubResult("some-job").Return(nil, report.ErrVersionNotFound)
+
+		recorder := serveJobsRequest(t, stubManager, "GET", "/jobs/some-job/result")
+
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("return 500 when job cannot be retrieved", func(t *testing.T) {
+		stubManager := job.NewMockManager()
+		stubManager.StubGet("some-job").Return(job.Job{}, errors.New("some error"))
+
+		recorder := serveJobsRequest(t, stubManager, "GET", "/jobs/some-job")
+
+		require.Equal(t, http.StatusInternalServerError, recorder.Code)
+		requireErrorMessage(t, recorder, "some error")
+	})
+}
+
+func serveJobsRequest(t *testing.T, manager job.Manager, method string, url string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	r := chi.NewRouter()
+	RegisterJobsRoutes(r, manager, 2020)
+
+	r.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func requireErrorMessage(t *testing.T, recorder *httptest.ResponseRecorder, message string) {
+	var response ErrorResponse
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.Equal(t, message, response.Message)
+}
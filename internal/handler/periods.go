@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/hpcsc/outside-in-go/internal/period"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	periodRoutePattern       = "/periods/{year}/{month}"
+	closePeriodRoutePattern  = "/periods/{year}/{month}/close"
+	reopenPeriodRoutePattern = "/periods/{year}/{month}/reopen"
+	lockPeriodRoutePattern   = "/periods/{year}/{month}/lock"
+)
+
+// RegisterPeriodsRoutes serves the admin endpoints of the period lifecycle. Every request must carry token as a bearer token
+func RegisterPeriodsRoutes(router *chi.Mux, manager period.Manager, minimumYear int, token string) {
+	h := &periodsHandler{
+		manager:     manager,
+		minimumYear: minimumYear,
+	}
+	router.Group(func(r chi.Router) {
+		r.Use(requireBearerToken(token, "a valid admin token is required"))
+		r.Get(periodRoutePattern, h.Get)
+		r.Post(closePeriodRoutePattern, h.handle("periodsHandler.Close", manager.Close))
+		r.Post(reopenPeriodRoutePattern, h.handle("periodsHandler.Reopen", manager.Reopen))
+		r.Post(lockPeriodRoutePattern, h.handle("periodsHandler.Lock", manager.Lock))
+	})
+}
+
+type periodsHandler struct {
+	manager     period.Manager
+	minimumYear int
+}
+
+func (h *periodsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	h.handle("periodsHandler.Get", h.manager.Get)(w, r)
+}
+
+// handle applies a period operation to the year and month in the URL and responds with the resulting period
+func (h *periodsHandler) handle(spanName string, apply func(ctx context.Context, year int, month int) (period.Period, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), spanName)
+		var err error
+		defer func() { tracing.End(span, err) }()
+
+		year, month, err := parseYearAndMonth(chi.URLParam(r, "year"), chi.URLParam(r, "month"), h.minimumYear)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			errorResponse(w, err.Error())
+			return
+		}
+
+		span.SetAttributes(
+			attribute.Int("report.year", *year),
+			attribute.Int("report.month", *month),
+		)
+
+		p, err := apply(ctx, *year, *month)
+		if errors.Is(err, period.ErrInvalidTransition) || errors.Is(err, period.ErrIncomplete) || errors.Is(err, period.ErrChanged) {
+			w.WriteHeader(http.StatusConflict)
+			errorResponse(w, err.Error())
+			return
+		}
+
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to change period status", slog.String("error", err.Error()))
+			w.WriteHeader(http.StatusInternalServerError)
+			errorResponse(w, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(p)
+	}
+}
@@ -0,0 +1,107 @@
+//go:build unit
+
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/hpcsc/outside-in-go/internal/period"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPeriods(t *testing.T) {
+	t.Run("return period status", func(t *testing.T) {
+		stubManager := period.NewMockManager()
+		stubManager.StubGet(2022, 4).Return(period.Period{Year: 2022, Month: 4, Status: storer.OpenPeriodStatus}, nil)
+
+		recorder := servePeriodsRequest(t, stubManager, "GET", "/periods/2022/04", "some-token")
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var response period.Period
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+		require.Equal(t, period.Period{Year: 2022, Month: 4, Status: storer.OpenPeriodStatus}, response)
+	})
+
+	t.Run("close, reopen and lock period", func(t *testing.T) {
+		stubManager := period.NewMockManager()
+		stubManager.StubClose(2022, 4).Return(period.Period{Year: 2022, Month: 4, Status: storer.ClosedPeriodStatus}, nil)
+		stubManager.StubReopen(2022, 4).Return(period.Period{Year: 2022, Month: 4, Status: storer.OpenPeriodStatus}, nil)
+		stubManager.StubLock(2022, 4).Return(period.Period{Year: 2022, Month: 4, Status: storer.LockedPeriodStatus}, nil)
+
+		for action, status := range map[string]storer.PeriodStatus{
+			"close":  storer.ClosedPeriodStatus,
+			"reopen": storer.OpenPeriodStatus,
+			"lock":   storer.LockedPeriodStatus,
+		} {
+			recorder := servePeriodsRequest(t, stubManager, "POST", fmt.Sprintf("/periods/2022/04/%s", action), "some-token")
+
+			require.Equal(t, http.StatusOK, recorder.Code, action)
+			var response period.Period
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+			require.Equal(t, status, response.Status)
+		}
+	})
+
+	t.Run("return 409 for invalid transition", func(t *testing.T) {
+		stubManager := period.NewMockManager()
+		stubManager.StubReopen(2022, 4).Return(period.Period{}, fmt.Errorf("%w: 04/2022 is locked", period.ErrInvalidTransition))
+
+		recorder := servePeriodsRequest(t, stubManager, "POST", "/periods/2022/04/reopen", "some-token")
+
+		require.Equal(t, http.StatusConflict, recorder.Code)
+		requireErrorMessage(t, recorder, "invalid period transition: 04/2022 is locked")
+	})
+
+	t.Run("return 409 when period has incomplete aggregates", func(t *testing.T) {
+		stubManager := period.NewMockManager()
+		stubManager.StubClose(2022, 4).Return(period.Period{}, fmt.Errorf("%w: single aggregate of 04/2022 leaves out 1 individual files", period.ErrIncomplete))
+
+		recorder := servePeriodsRequest(t, stubManager, "POST", "/periods/2022/04/close", "some-token")
+
+		require.Equal(t, http.StatusConflict, recorder.Code)
+	})
+
+	t.Run("return 500 when status cannot be changed", func(t *testing.T) {
+		stubManager := period.NewMockManager()
+		stubManager.StubClose(2022, 4).Return(period.Period{}, errors.New("some error"))
+
+		recorder := servePeriodsRequest(t, stubManager, "POST", "/periods/2022/04/close", "some-token")
+
+		require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	})
+
+	t.Run("return 400 for invalid period", func(t *testing.T) {
+		recorder := servePeriodsRequest(t, period.NewMockManager(), "POST", "/periods/2022/13/close", "some-token")
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("return 401 without valid admin token", func(t *testing.T) {
+		for _, token := range []string{"", "other-token"} {
+			recorder := servePeriodsRequest(t, period.NewMockManager(), "POST", "/periods/2022/04/close", token)
+
+			require.Equal(t, http.StatusUnauthorized, recorder.Code)
+		}
+	})
+}
+
+func servePeriodsRequest(t *testing.T, manager period.Manager, method string, url string, token string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	r := chi.NewRouter()
+	RegisterPeriodsRoutes(r, manager, 2020, "some-token")
+
+	r.ServeHTTP(recorder, req)
+
+	return recorder
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"log/slog"
+	"net/http"
+)
+
+const reportQualityRoutePattern = "/reports/{type}/quality"
+
+// RegisterReportQualityRoutes serves data-quality reports of the individual files of a period, to review before the period is closed
+func RegisterReportQualityRoutes(router *chi.Mux, generator report.Generator, minimumYear int) {
+	h := &reportQualityHandler{
+		generator:   generator,
+		minimumYear: minimumYear,
+	}
+	router.Get(reportQualityRoutePattern, h.Quality)
+}
+
+type reportQualityHandler struct {
+	generator   report.Generator
+	minimumYear int
+}
+
+func (h *reportQualityHandler) Quality(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "reportQualityHandler.Quality")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	reportType, err := storer.ParseReportType(chi.URLParam(r, "type"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	year, month, err := parseYearAndMonth(r.URL.Query().Get("year"), r.URL.Query().Get("month"), h.minimumYear)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("report.type", string(reportType)),
+		attribute.Int("report.year", *year),
+		attribute.Int("report.month", *month),
+	)
+
+	quality, err := h.generator.Quality(ctx, reportType, *year, *month)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to check report quality", slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(quality)
+}
@@ -0,0 +1,96 @@
+//go:build unit
+
+package handler
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/schema"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReportQuality(t *testing.T) {
+	t.Run("return 200 with quality of period", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/quality?year=2022&month=4", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		previousRows := 1
+		stubGenerator.StubQuality(storer.SingleReportType, 2022, 4).Return(report.Quality{
+			ExpectedFrom:       report.PreviousMonthExpectedClusters,
+			Clusters:           []report.ClusterQuality{{Cluster: "cluster-1", Key: "2022/04/single/cluster-1.csv", Rows: 3, PreviousRows: &previousRows}},
+			MissingClusters:    []string{"cluster-2"},
+			UnexpectedClusters: []string{},
+			EmptyFiles:         []string{},
+			UnreadableFiles:    []storer.FileFailure{},
+			RowCountAnomalies:  []report.RowCountAnomaly{{Cluster: "cluster-1", Rows: 3, PreviousRows: 1, Change: 2}},
+			SchemaViolations:   []schema.Problem{},
+		}, nil)
+		router := testRouterWithReportQuality(stubGenerator)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		require.JSONEq(t, `{
+			"expected_from": "previous_month",
+			"clusters": [{"cluster": "cluster-1", "key": "2022/04/single/cluster-1.csv", "rows": 3, "previous_rows": 1}],
+			"missing_clusters": ["cluster-2"],
+			"unexpected_clusters": [],
+			"empty_files": [],
+			"unreadable_files": [],
+			"row_count_anomalies": [{"cluster": "cluster-1", "rows": 3, "previous_rows": 1, "change": 2}],
+			"schema_violations": []
+		}`, recorder.Body.String())
+	})
+
+	t.Run("return 404 when report type is unknown", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/not-valid/quality?year=2022&month=4", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		router := testRouterWithReportQuality(report.NewMockGenerator())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("return 400 when year is invalid", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/quality?year=abc&month=4", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		router := testRouterWithReportQuality(report.NewMockGenerator())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		requireErrorResponse(t, recorder, "year 'abc' is invalid")
+	})
+
+	t.Run("return 500 when generator returns error", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/quality?year=2022&month=4", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.StubQuality(storer.SingleReportType, 2022, 4).Return(report.Quality{}, errors.New("some error"))
+		router := testRouterWithReportQuality(stubGenerator)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusInternalServerError, recorder.Code)
+		requireErrorResponse(t, recorder, "some error")
+	})
+}
+
+func testRouterWithReportQuality(generator report.Generator) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	RegisterReportQualityRoutes(r, generator, 2020)
+	return r
+}
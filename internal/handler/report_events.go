@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const reportEventsRoutePattern = "/reports/{type}/events"
+
+// RegisterReportEventsRoutes serves report generation as a Server-Sent Events stream of its progress
+func RegisterReportEventsRoutes(router *chi.Mux, generator report.Generator, minimumYear int) {
+	h := &reportEventsHandler{
+		generator:   generator,
+		minimumYear: minimumYear,
+	}
+	router.Get(reportEventsRoutePattern, h.Stream)
+}
+
+type reportEventsHandler struct {
+	generator   report.Generator
+	minimumYear int
+}
+
+func (h *reportEventsHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "reportEventsHandler.Stream")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	reportType, err := storer.ParseReportType(chi.URLParam(r, "type"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	year, month, err := parseYearAndMonth(r.URL.Query().Get("year"), r.URL.Query().Get("month"), h.minimumYear)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("report.type", string(reportType)),
+		attribute.Int("report.year", *year),
+		attribute.Int("report.month", *month),
+	)
+
+	controller := http.NewResponseController(w)
+	// the stream lasts as long as the generation, which can outlive the server write timeout
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		slog.WarnContext(ctx, "failed to clear write deadline of event stream", slog.String("error", err.Error()))
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	controller.Flush()
+
+	observer := report.ObserverFunc(func(e report.Event) {
+		if err := writeEvent(w, e); err != nil {
+			slog.WarnContext(ctx, "failed to write event", slog.String("event", string(e.Type)), slog.String("error", err.Error()))
+			return
+		}
+		controller.Flush()
+	})
+
+	if _, err = h.generator.Generate(report.WithObserver(ctx, observer), reportType, *year, *month); err != nil {
+		// the failure has already been sent to the client as the last event
+		slog.ErrorContext(ctx, "failed to generate report", slog.String("error", err.Error()))
+	}
+}
+
+func writeEvent(w io.Writer, e report.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+	return err
+}
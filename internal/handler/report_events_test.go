@@ -0,0 +1,84 @@
+//go:build unit
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReportEvents(t *testing.T) {
+	t.Run("stream generator events", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Generate", mock.Anything, storer.SingleReportType, 2022, 4).
+			Run(func(args mock.Arguments) {
+				observer := report.ObserverFrom(args.Get(0).(context.Context))
+				observer.Observe(report.Event{Type: report.FilesListedEvent, Total: 1})
+				observer.Observe(report.Event{Type: report.RowsMergedEvent, Rows: 3})
+				observer.Observe(report.Event{Type: report.CompletedEvent})
+			}).
+			Return([]byte("some,csv,data"), nil)
+
+		recorder := serveReportEventsRequest(t, stubGenerator, "/reports/single/events?year=2022&month=4")
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"))
+		require.Equal(t, `event: files_listed
+data: {"type":"files_listed","total":1}
+
+event: rows_merged
+data: {"type":"rows_merged","rows":3}
+
+event: completed
+data: {"type":"completed"}
+
+`, recorder.Body.String())
+	})
+
+	t.Run("stream failure as last event", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Generate", mock.Anything, storer.CumulativeReportType, 2022, 4).
+			Run(func(args mock.Arguments) {
+				report.ObserverFrom(args.Get(0).(context.Context)).Observe(report.Event{Type: report.FailedEvent, Error: "some error"})
+			}).
+			Return(nil, errors.New("some error"))
+
+		recorder := serveReportEventsRequest(t, stubGenerator, "/reports/cumulative/events?year=2022&month=4")
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "event: failed\ndata: {\"type\":\"failed\",\"error\":\"some error\"}\n\n", recorder.Body.String())
+	})
+
+	t.Run("return 404 for unknown report type", func(t *testing.T) {
+		recorder := serveReportEventsRequest(t, report.NewMockGenerator(), "/reports/not-valid/events")
+
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("return 400 for invalid period", func(t *testing.T) {
+		recorder := serveReportEventsRequest(t, report.NewMockGenerator(), "/reports/single/events?year=2019&month=4")
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		requireErrorMessage(t, recorder, "2019 is too early")
+	})
+}
+
+func serveReportEventsRequest(t *testing.T, generator report.Generator, url string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	r := chi.NewRouter()
+	RegisterReportEventsRoutes(r, generator, 2020)
+
+	r.ServeHTTP(recorder, req)
+
+	return recorder
+}
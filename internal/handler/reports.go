@@ -1,11 +1,19 @@
 package handler
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/schema"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
@@ -14,67 +22,386 @@ import (
 const (
 	reportsSingleRoutePattern     = "/reports/single"
 	reportsCumulativeRoutePattern = "/reports/cumulative"
+	reportVersionsRoutePattern    = "/reports/{type}/versions"
+	reportValidationRoutePattern  = "/reports/{type}/validation"
+	reportFailuresRoutePattern    = "/reports/{type}/failures"
+	reportQuarantineRoutePattern  = "/reports/{type}/quarantine"
+	reportReleaseRoutePattern     = "/reports/{type}/quarantine/{name}/release"
 )
 
+const (
+	// partialHeader is set on reports built without some of their individual files, whose failures are listed at reportFailuresRoutePattern
+	partialHeader     = "X-Report-Partial"
+	failedFilesHeader = "X-Report-Failed-Files"
+)
+
+var tracer = otel.Tracer("github.com/hpcsc/outside-in-go/internal/handler")
+
 type ErrorResponse struct {
 	Message string `json:"message"`
 }
 
-func RegisterReportsRoutes(router *chi.Mux, generator report.Generator) {
+type ReleaseResponse struct {
+	Key string `json:"key"`
+}
+
+type ValidationResponse struct {
+	Problems []schema.Problem `json:"problems"`
+}
+
+// RegisterReportsRoutes serves the aggregates of a period. Releasing a quarantined file requires adminToken as a bearer token and is disabled when it is empty
+func RegisterReportsRoutes(router *chi.Mux, generator report.Generator, records report.Records, minimumYear int, adminToken string) {
 	h := &reportsHandler{
-		generator: generator,
+		generator:   generator,
+		records:     records,
+		minimumYear: minimumYear,
 	}
 	router.Get(reportsSingleRoutePattern, h.Single)
 	router.Get(reportsCumulativeRoutePattern, h.Cumulative)
+	router.Get(reportVersionsRoutePattern, h.Versions)
+	router.Get(reportValidationRoutePattern, h.Validation)
+	router.Get(reportFailuresRoutePattern, h.Failures)
+	router.Get(reportQuarantineRoutePattern, h.Quarantine)
+
+	if adminToken != "" {
+		router.With(requireBearerToken(adminToken, "a valid admin token is required")).Post(reportReleaseRoutePattern, h.Release)
+	}
 }
 
 type reportsHandler struct {
-	generator report.Generator
+	generator   report.Generator
+	records     report.Records
+	minimumYear int
 }
 
 func (h *reportsHandler) Single(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "reportsHandler.Single")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
 	yearParam := r.URL.Query().Get("year")
 	monthParam := r.URL.Query().Get("month")
 
-	year, month, err := h.parseYearAndMonth(yearParam, monthParam)
+	year, month, err := parseYearAndMonth(yearParam, monthParam, h.minimumYear)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		h.errorResponse(w, err.Error())
+		errorResponse(w, err.Error())
 		return
 	}
 
-	data, err := h.generator.GenerateSingle(*year, *month)
+	span.SetAttributes(attribute.Int("report.year", *year), attribute.Int("report.month", *month))
+
+	query, err := report.ParseQuery(r.URL.Query().Get("columns"), r.URL.Query()["filter"])
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.errorResponse(w, err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
 		return
 	}
 
-	h.csvResponse(w, year, month, data)
+	var data []byte
+	failed := new(int)
+	if version := r.URL.Query().Get("version"); version != "" {
+		span.SetAttributes(attribute.String("report.version", version))
+		data, err = h.records.Version(ctx, storer.SingleReportType, *year, *month, version)
+	} else {
+		ctx, failed = observeFailedFiles(ctx)
+		data, err = h.generator.GenerateSingle(ctx, *year, *month)
+	}
+
+	if err != nil {
+		generateErrorResponse(w, r, err)
+		return
+	}
+
+	selection, err := query.Select(bytes.NewReader(data))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	setPartialHeaders(w, *failed)
+	h.csvResponse(ctx, w, year, month, selection)
 }
 
 func (h *reportsHandler) Cumulative(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "reportsHandler.Cumulative")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
 	yearParam := r.URL.Query().Get("year")
 	monthParam := r.URL.Query().Get("month")
 
-	year, month, err := h.parseYearAndMonth(yearParam, monthParam)
+	year, month, err := parseYearAndMonth(yearParam, monthParam, h.minimumYear)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	span.SetAttributes(attribute.Int("report.year", *year), attribute.Int("report.month", *month))
+
+	query, err := report.ParseQuery(r.URL.Query().Get("columns"), r.URL.Query()["filter"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	var data []byte
+	failed := new(int)
+	if version := r.URL.Query().Get("version"); version != "" {
+		span.SetAttributes(attribute.String("report.version", version))
+		data, err = h.records.Version(ctx, storer.CumulativeReportType, *year, *month, version)
+	} else {
+		ctx, failed = observeFailedFiles(ctx)
+		data, err = h.generator.GenerateCumulative(ctx, *year, *month)
+	}
+
+	if err != nil {
+		generateErrorResponse(w, r, err)
+		return
+	}
+
+	selection, err := query.Select(bytes.NewReader(data))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	setPartialHeaders(w, *failed)
+	h.csvResponse(ctx, w, year, month, selection)
+}
+
+func (h *reportsHandler) Failures(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "reportsHandler.Failures")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	reportType, err := storer.ParseReportType(chi.URLParam(r, "type"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	year, month, err := parseYearAndMonth(r.URL.Query().Get("year"), r.URL.Query().Get("month"), h.minimumYear)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("report.type", string(reportType)),
+		attribute.Int("report.year", *year),
+		attribute.Int("report.month", *month),
+	)
+
+	failures, err := h.records.Failures(ctx, reportType, *year, *month)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to retrieve report failures", slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(failures)
+}
+
+func (h *reportsHandler) Quarantine(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "reportsHandler.Quarantine")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	reportType, err := storer.ParseReportType(chi.URLParam(r, "type"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	year, month, err := parseYearAndMonth(r.URL.Query().Get("year"), r.URL.Query().Get("month"), h.minimumYear)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		h.errorResponse(w, err.Error())
+		errorResponse(w, err.Error())
 		return
 	}
 
-	data, err := h.generator.GenerateCumulative(*year, *month)
+	span.SetAttributes(
+		attribute.String("report.type", string(reportType)),
+		attribute.Int("report.year", *year),
+		attribute.Int("report.month", *month),
+	)
+
+	files, err := h.records.Quarantined(ctx, reportType, *year, *month)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list quarantined files", slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(files)
+}
+
+// Release moves a quarantined file back among the individual files once it is fixed, responding with the key it is restored to
+func (h *reportsHandler) Release(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "reportsHandler.Release")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	reportType, err := storer.ParseReportType(chi.URLParam(r, "type"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	year, month, err := parseYearAndMonth(r.URL.Query().Get("year"), r.URL.Query().Get("month"), h.minimumYear)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	span.SetAttributes(
+		attribute.String("report.type", string(reportType)),
+		attribute.Int("report.year", *year),
+		attribute.Int("report.month", *month),
+		attribute.String("report.quarantined_file", name),
+	)
+
+	key, err := h.records.Release(ctx, reportType, *year, *month, name)
+	switch {
+	case errors.Is(err, storer.ErrNotQuarantined):
+		w.WriteHeader(http.StatusNotFound)
+		errorResponse(w, err.Error())
+		return
+	case errors.Is(err, storer.ErrPeriodClosed):
+		w.WriteHeader(http.StatusConflict)
+		errorResponse(w, err.Error())
+		return
+	case err != nil:
+		slog.ErrorContext(ctx, "failed to release quarantined file", slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ReleaseResponse{Key: key})
+}
+
+// observeFailedFiles counts the individual files a generation leaves out, passing every event on to the observer already in ctx
+func observeFailedFiles(ctx context.Context) (context.Context, *int) {
+	failed := 0
+	next := report.ObserverFrom(ctx)
+	return report.WithObserver(ctx, report.ObserverFunc(func(event report.Event) {
+		if event.Type == report.FileFailedEvent {
+			failed++
+		}
+		next.Observe(event)
+	})), &failed
+}
+
+func setPartialHeaders(w http.ResponseWriter, failed int) {
+	if failed == 0 {
+		return
+	}
+
+	w.Header().Set(partialHeader, "true")
+	w.Header().Set(failedFilesHeader, strconv.Itoa(failed))
+}
+
+func (h *reportsHandler) Versions(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "reportsHandler.Versions")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	reportType, err := storer.ParseReportType(chi.URLParam(r, "type"))
 	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	year, month, err := parseYearAndMonth(r.URL.Query().Get("year"), r.URL.Query().Get("month"), h.minimumYear)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("report.type", string(reportType)),
+		attribute.Int("report.year", *year),
+		attribute.Int("report.month", *month),
+	)
+
+	versions, err := h.records.Versions(ctx, reportType, *year, *month)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list report versions", slog.String("error", err.Error()))
 		w.WriteHeader(http.StatusInternalServerError)
-		h.errorResponse(w, err.Error())
+		errorResponse(w, err.Error())
 		return
 	}
 
-	h.csvResponse(w, year, month, data)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(versions)
 }
 
-func (h *reportsHandler) parseYearAndMonth(yearParam string, monthParam string) (*int, *int, error) {
+func (h *reportsHandler) Validation(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "reportsHandler.Validation")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	reportType, err := storer.ParseReportType(chi.URLParam(r, "type"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	year, month, err := parseYearAndMonth(r.URL.Query().Get("year"), r.URL.Query().Get("month"), h.minimumYear)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("report.type", string(reportType)),
+		attribute.Int("report.year", *year),
+		attribute.Int("report.month", *month),
+	)
+
+	problems, err := h.generator.Validate(ctx, reportType, *year, *month)
+	if errors.Is(err, report.ErrNoSchema) {
+		w.WriteHeader(http.StatusNotFound)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	if err != nil {
+		generateErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ValidationResponse{Problems: problems})
+}
+
+func parseYearAndMonth(yearParam string, monthParam string, minimumYear int) (*int, *int, error) {
 	if (yearParam != "" && monthParam == "") || (yearParam == "" && monthParam != "") {
 		return nil, nil, errors.New("either both year and month are provided or none are provided")
 	}
@@ -92,7 +419,7 @@ func (h *reportsHandler) parseYearAndMonth(yearParam string, monthParam string)
 		return nil, nil, fmt.Errorf("year '%s' is invalid", yearParam)
 	}
 
-	if year < 2020 {
+	if year < minimumYear {
 		return nil, nil, fmt.Errorf("%d is too early", year)
 	}
 
@@ -108,15 +435,31 @@ func (h *reportsHandler) parseYearAndMonth(yearParam string, monthParam string)
 	return &year, &month, nil
 }
 
-func (h *reportsHandler) errorResponse(w http.ResponseWriter, message string) error {
+// generateErrorResponse maps generator failures to a response, telling apart missing data and closed periods from unexpected errors
+func generateErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, report.ErrNoData), errors.Is(err, report.ErrVersionNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, storer.ErrPeriodClosed):
+		w.WriteHeader(http.StatusConflict)
+	default:
+		slog.ErrorContext(r.Context(), "failed to generate report", slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	errorResponse(w, err.Error())
+}
+
+func errorResponse(w http.ResponseWriter, message string) error {
 	return json.NewEncoder(w).Encode(ErrorResponse{
 		Message: message,
 	})
 }
 
-func (h *reportsHandler) csvResponse(w http.ResponseWriter, year *int, month *int, data []byte) {
+func (h *reportsHandler) csvResponse(ctx context.Context, w http.ResponseWriter, year *int, month *int, selection *report.Selection) {
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "text/csv")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=single-%d%02d.csv", *year, *month))
-	w.Write(data)
+	if err := selection.Write(w); err != nil {
+		slog.WarnContext(ctx, "failed to write report", slog.String("error", err.Error()))
+	}
 }
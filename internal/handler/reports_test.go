@@ -3,12 +3,15 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/schema"
+	"github.com/hpcsc/outside-in-go/internal/storer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -24,7 +27,7 @@ func TestReports(t *testing.T) {
 		require.NoError(t, err)
 		recorder := httptest.NewRecorder()
 		stubGenerator := report.NewMockGenerator()
-		router := testRouterWithReports(stubGenerator)
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
 
 		router.ServeHTTP(recorder, req)
 
@@ -41,13 +44,47 @@ func TestReports(t *testing.T) {
 }
 
 func reportEndpointTestSuite(t *testing.T, reportType string, generatorFunc string) {
+	t.Run("flag report built without some of its files", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/reports/%s?year=2022&month=4", reportType), nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On(generatorFunc, mock.Anything, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				observer := report.ObserverFrom(args.Get(0).(context.Context))
+				observer.Observe(report.Event{Type: report.FileFailedEvent, Key: "2022/04/single/cluster-2.csv", Line: 3, Error: "wrong number of fields"})
+			}).
+			Return([]byte("some,csv,data"), nil)
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "true", recorder.Header().Get("X-Report-Partial"))
+		require.Equal(t, "1", recorder.Header().Get("X-Report-Failed-Files"))
+	})
+
+	t.Run("not flag report built from every file", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/reports/%s?year=2022&month=4", reportType), nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On(generatorFunc, mock.Anything, mock.Anything, mock.Anything).Return([]byte("some,csv,data"), nil)
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Empty(t, recorder.Header().Get("X-Report-Partial"))
+	})
+
 	t.Run("return 200 with csv file when report is generated successfully", func(t *testing.T) {
 		req, err := http.NewRequest("GET", fmt.Sprintf("/reports/%s?year=2022&month=4", reportType), nil)
 		require.NoError(t, err)
 		recorder := httptest.NewRecorder()
 		stubGenerator := report.NewMockGenerator()
-		stubGenerator.On(generatorFunc, mock.Anything, mock.Anything).Return([]byte("some,csv,data"), nil)
-		router := testRouterWithReports(stubGenerator)
+		stubGenerator.On(generatorFunc, mock.Anything, mock.Anything, mock.Anything).Return([]byte("some,csv,data"), nil)
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
 
 		router.ServeHTTP(recorder, req)
 
@@ -62,19 +99,19 @@ func reportEndpointTestSuite(t *testing.T, reportType string, generatorFunc stri
 		require.NoError(t, err)
 		recorder := httptest.NewRecorder()
 		stubGenerator := report.NewMockGenerator()
-		stubGenerator.On(generatorFunc, mock.Anything, mock.Anything).Return([]byte("some,csv,data"), nil)
-		router := testRouterWithReports(stubGenerator)
+		stubGenerator.On(generatorFunc, mock.Anything, mock.Anything, mock.Anything).Return([]byte("some,csv,data"), nil)
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
 
 		router.ServeHTTP(recorder, req)
 
 		now := time.Now()
 		previousMonth := now.AddDate(0, 0, -now.Day())
-		stubGenerator.AssertCalled(t, generatorFunc, previousMonth.Year(), int(previousMonth.Month()))
+		stubGenerator.AssertCalled(t, generatorFunc, mock.Anything, previousMonth.Year(), int(previousMonth.Month()))
 	})
 
 	t.Run("return 400 when only year or month is provided", func(t *testing.T) {
 		stubGenerator := report.NewMockGenerator()
-		router := testRouterWithReports(stubGenerator)
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
 
 		missingMonthRecorder := httptest.NewRecorder()
 		missingMonthReq, err := http.NewRequest("GET", fmt.Sprintf("/reports/%s?year=2022", reportType), nil)
@@ -98,7 +135,7 @@ func reportEndpointTestSuite(t *testing.T, reportType string, generatorFunc stri
 		require.NoError(t, err)
 		recorder := httptest.NewRecorder()
 		stubGenerator := report.NewMockGenerator()
-		router := testRouterWithReports(stubGenerator)
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
 
 		router.ServeHTTP(recorder, req)
 
@@ -111,7 +148,7 @@ func reportEndpointTestSuite(t *testing.T, reportType string, generatorFunc stri
 		require.NoError(t, err)
 		recorder := httptest.NewRecorder()
 		stubGenerator := report.NewMockGenerator()
-		router := testRouterWithReports(stubGenerator)
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
 
 		router.ServeHTTP(recorder, req)
 
@@ -124,7 +161,7 @@ func reportEndpointTestSuite(t *testing.T, reportType string, generatorFunc stri
 		require.NoError(t, err)
 		recorder := httptest.NewRecorder()
 		stubGenerator := report.NewMockGenerator()
-		router := testRouterWithReports(stubGenerator)
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
 
 		router.ServeHTTP(recorder, req)
 
@@ -134,7 +171,7 @@ func reportEndpointTestSuite(t *testing.T, reportType string, generatorFunc stri
 
 	t.Run("return 400 when month is not in range", func(t *testing.T) {
 		stubGenerator := report.NewMockGenerator()
-		router := testRouterWithReports(stubGenerator)
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
 
 		for _, m := range []string{"0", "13"} {
 			recorder := httptest.NewRecorder()
@@ -152,8 +189,415 @@ func reportEndpointTestSuite(t *testing.T, reportType string, generatorFunc stri
 		require.NoError(t, err)
 		recorder := httptest.NewRecorder()
 		stubGenerator := report.NewMockGenerator()
-		stubGenerator.On(generatorFunc, mock.Anything, mock.Anything).Return(nil, errors.New("some error"))
-		router := testRouterWithReports(stubGenerator)
+		stubGenerator.On(generatorFunc, mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("some error"))
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusInternalServerError, recorder.Code)
+		requireErrorResponse(t, recorder, "some error")
+	})
+
+	t.Run("return 409 when aggregate of closed period cannot be built", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/reports/%s?year=2022&month=4", reportType), nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On(generatorFunc, mock.Anything, mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: 04/2022 is closed", storer.ErrPeriodClosed))
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusConflict, recorder.Code)
+	})
+
+	t.Run("return 404 when there is no data", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/reports/%s?year=2022&month=4", reportType), nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On(generatorFunc, mock.Anything, mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w for 04/2022", report.ErrNoData))
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("return 200 with selected columns of matching rows", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/reports/%s?year=2022&month=4&columns=CLUSTER,COST&filter=CLUSTER%%3Dcluster-1&filter=COST%%3E1", reportType), nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On(generatorFunc, mock.Anything, mock.Anything, mock.Anything).Return([]byte(`CLUSTER,OWNER,COST
+cluster-1,team-a,5
+cluster-1,team-b,0.5
+cluster-2,team-a,7
+`), nil)
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, `CLUSTER,COST
+cluster-1,5
+`, recorder.Body.String())
+	})
+
+	t.Run("return 400 when filter is invalid", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/reports/%s?year=2022&month=4&filter=CLUSTER", reportType), nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		requireErrorResponse(t, recorder, "invalid filter: 'CLUSTER'")
+		stubGenerator.AssertNotCalled(t, generatorFunc, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("return 400 when column is not in report header", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/reports/%s?year=2022&month=4&columns=REGION", reportType), nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On(generatorFunc, mock.Anything, mock.Anything, mock.Anything).Return([]byte("CLUSTER,COST\ncluster-1,5\n"), nil)
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		requireErrorResponse(t, recorder, "unknown column: 'REGION'")
+	})
+
+	t.Run("return 200 with csv file of requested version", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/reports/%s?year=2022&month=4&version=20220503T101500.000000000Z", reportType), nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubRecords := report.NewMockRecords()
+		stubRecords.StubVersion(storer.ReportType(reportType), 2022, 4, "20220503T101500.000000000Z").Return([]byte("some,old,data"), nil)
+		router := testRouterWithReports(stubGenerator, stubRecords)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "some,old,data", recorder.Body.String())
+		stubGenerator.AssertNotCalled(t, generatorFunc, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("return 404 when requested version is not found", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/reports/%s?year=2022&month=4&version=unknown", reportType), nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubRecords := report.NewMockRecords()
+		stubRecords.StubVersion(storer.ReportType(reportType), 2022, 4, "unknown").Return(nil, fmt.Errorf("%w: unknown", report.ErrVersionNotFound))
+		router := testRouterWithReports(report.NewMockGenerator(), stubRecords)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+		requireErrorResponse(t, recorder, "aggregate version not found: unknown")
+	})
+}
+
+func TestReportVersions(t *testing.T) {
+	t.Run("return 200 with versions of report", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/cumulative/versions?year=2022&month=4", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubRecords := report.NewMockRecords()
+		createdAt := time.Date(2022, 5, 3, 10, 15, 0, 0, time.UTC)
+		stubRecords.StubVersions(storer.CumulativeReportType, 2022, 4).Return([]storer.AggregateVersion{{
+			ID:         "20220503T101500.000000000Z",
+			CreatedAt:  createdAt,
+			Rows:       2,
+			Duplicates: 1,
+			Checksum:   "abc",
+			Sources:    []storer.IndividualFile{{Key: "2022/04/cumulative/cluster-1.csv", LastModified: createdAt, Size: 10}},
+		}}, nil)
+		router := testRouterWithReports(report.NewMockGenerator(), stubRecords)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		require.JSONEq(t, `[{
+			"id": "20220503T101500.000000000Z",
+			"created_at": "2022-05-03T10:15:00Z",
+			"rows": 2,
+			"duplicates_dropped": 1,
+			"checksum": "abc",
+			"sources": [{"key": "2022/04/cumulative/cluster-1.csv", "last_modified": "2022-05-03T10:15:00Z", "size": 10}]
+		}]`, recorder.Body.String())
+	})
+
+	t.Run("return 404 when report type is unknown", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/not-valid/versions?year=2022&month=4", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		router := testRouterWithReports(report.NewMockGenerator(), report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("return 400 when period is invalid", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/versions?year=2022&month=13", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		router := testRouterWithReports(report.NewMockGenerator(), report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		requireErrorResponse(t, recorder, "month must be in the range 1..12")
+	})
+
+	t.Run("return 500 when failed to list versions", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/versions?year=2022&month=4", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubRecords := report.NewMockRecords()
+		stubRecords.StubVersions(storer.SingleReportType, 2022, 4).Return(nil, errors.New("some error"))
+		router := testRouterWithReports(report.NewMockGenerator(), stubRecords)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusInternalServerError, recorder.Code)
+		requireErrorResponse(t, recorder, "some error")
+	})
+}
+
+func TestReportFailures(t *testing.T) {
+	t.Run("return 200 with failures of latest build", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/cumulative/failures?year=2022&month=4", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubRecords := report.NewMockRecords()
+		stubRecords.StubFailures(storer.CumulativeReportType, 2022, 4).Return([]storer.FileFailure{
+			{Key: "2022/04/cumulative/cluster-2.csv", Line: 3, Error: "wrong number of fields: expected 2, got 1"},
+			{Key: "2022/04/cumulative/cluster-3.csv", Error: "failed to read header"},
+		}, nil)
+		router := testRouterWithReports(report.NewMockGenerator(), stubRecords)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		require.JSONEq(t, `[
+			{"key": "2022/04/cumulative/cluster-2.csv", "line": 3, "error": "wrong number of fields: expected 2, got 1"},
+			{"key": "2022/04/cumulative/cluster-3.csv", "error": "failed to read header"}
+		]`, recorder.Body.String())
+	})
+
+	t.Run("return 404 when report type is unknown", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/not-valid/failures?year=2022&month=4", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		router := testRouterWithReports(report.NewMockGenerator(), report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("return 500 when generator returns error", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/failures?year=2022&month=4", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubRecords := report.NewMockRecords()
+		stubRecords.StubFailures(storer.SingleReportType, 2022, 4).Return(nil, errors.New("some error"))
+		router := testRouterWithReports(report.NewMockGenerator(), stubRecords)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusInternalServerError, recorder.Code)
+		requireErrorResponse(t, recorder, "some error")
+	})
+}
+
+func TestReportQuarantine(t *testing.T) {
+	t.Run("return 200 with quarantined files", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/quarantine?year=2022&month=4", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubRecords := report.NewMockRecords()
+		stubRecords.StubQuarantined(storer.SingleReportType, 2022, 4).Return([]storer.QuarantinedFile{{
+			Name:          "cluster-2.csv",
+			Key:           "quarantine/2022/04/single/cluster-2.csv",
+			OriginalKey:   "2022/04/single/cluster-2.csv",
+			Reason:        "line 3: wrong number of fields",
+			QuarantinedAt: time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC),
+			Size:          42,
+		}}, nil)
+		router := testRouterWithReports(report.NewMockGenerator(), stubRecords)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		require.JSONEq(t, `[{
+			"name": "cluster-2.csv",
+			"key": "quarantine/2022/04/single/cluster-2.csv",
+			"original_key": "2022/04/single/cluster-2.csv",
+			"reason": "line 3: wrong number of fields",
+			"quarantined_at": "2022-05-01T00:00:00Z",
+			"size": 42
+		}]`, recorder.Body.String())
+	})
+
+	t.Run("return 400 when month is invalid", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/quarantine?year=2022&month=13", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		router := testRouterWithReports(report.NewMockGenerator(), report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("return 500 when generator returns error", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/quarantine?year=2022&month=4", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubRecords := report.NewMockRecords()
+		stubRecords.StubQuarantined(storer.SingleReportType, 2022, 4).Return(nil, errors.New("some error"))
+		router := testRouterWithReports(report.NewMockGenerator(), stubRecords)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusInternalServerError, recorder.Code)
+		requireErrorResponse(t, recorder, "some error")
+	})
+}
+
+func TestReportRelease(t *testing.T) {
+	t.Run("return 200 with key file is restored to", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/reports/single/quarantine/cluster-2.csv/release?year=2022&month=4", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer some-token")
+		recorder := httptest.NewRecorder()
+		stubRecords := report.NewMockRecords()
+		stubRecords.StubRelease(storer.SingleReportType, 2022, 4, "cluster-2.csv").Return("2022/04/single/cluster-2.csv", nil)
+		router := testRouterWithReports(report.NewMockGenerator(), stubRecords)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.JSONEq(t, `{"key": "2022/04/single/cluster-2.csv"}`, recorder.Body.String())
+	})
+
+	t.Run("return 404 when file is not quarantined", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/reports/single/quarantine/cluster-2.csv/release?year=2022&month=4", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer some-token")
+		recorder := httptest.NewRecorder()
+		stubRecords := report.NewMockRecords()
+		stubRecords.StubRelease(storer.SingleReportType, 2022, 4, "cluster-2.csv").Return("", storer.ErrNotQuarantined)
+		router := testRouterWithReports(report.NewMockGenerator(), stubRecords)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+		requireErrorResponse(t, recorder, storer.ErrNotQuarantined.Error())
+	})
+
+	t.Run("return 409 when period is closed", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/reports/single/quarantine/cluster-2.csv/release?year=2022&month=4", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer some-token")
+		recorder := httptest.NewRecorder()
+		stubRecords := report.NewMockRecords()
+		stubRecords.StubRelease(storer.SingleReportType, 2022, 4, "cluster-2.csv").Return("", storer.ErrPeriodClosed)
+		router := testRouterWithReports(report.NewMockGenerator(), stubRecords)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusConflict, recorder.Code)
+	})
+
+	t.Run("return 401 without valid admin token", func(t *testing.T) {
+		for _, token := range []string{"", "other-token"} {
+			req, err := http.NewRequest("POST", "/reports/single/quarantine/cluster-2.csv/release?year=2022&month=4", nil)
+			require.NoError(t, err)
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			recorder := httptest.NewRecorder()
+			mockRecords := report.NewMockRecords()
+			router := testRouterWithReports(report.NewMockGenerator(), mockRecords)
+
+			router.ServeHTTP(recorder, req)
+
+			require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			mockRecords.AssertNotCalled(t, "Release", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		}
+	})
+}
+
+func TestReportValidation(t *testing.T) {
+	t.Run("return 200 with problems of source files", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/validation?year=2022&month=4", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.StubValidate(storer.SingleReportType, 2022, 4).Return([]schema.Problem{
+			{Key: "2022/04/single/cluster-1.csv", Line: 3, Column: "COST", Value: "free", Message: "value is not a number"},
+		}, nil)
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		require.JSONEq(t, `{"problems": [{
+			"key": "2022/04/single/cluster-1.csv",
+			"line": 3,
+			"column": "COST",
+			"value": "free",
+			"message": "value is not a number"
+		}]}`, recorder.Body.String())
+	})
+
+	t.Run("return 404 when report type has no schema", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/validation?year=2022&month=4", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.StubValidate(storer.SingleReportType, 2022, 4).Return(nil, fmt.Errorf("%w for single", report.ErrNoSchema))
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+		requireErrorResponse(t, recorder, "no schema configured for single")
+	})
+
+	t.Run("return 404 when period has no data", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/validation?year=2022&month=4", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.StubValidate(storer.SingleReportType, 2022, 4).Return(nil, fmt.Errorf("%w for 04/2022", report.ErrNoData))
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("return 500 when failed to validate", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/validation?year=2022&month=4", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.StubValidate(storer.SingleReportType, 2022, 4).Return(nil, errors.New("some error"))
+		router := testRouterWithReports(stubGenerator, report.NewMockRecords())
 
 		router.ServeHTTP(recorder, req)
 
@@ -171,9 +615,9 @@ func requireErrorResponse(t *testing.T, recorder *httptest.ResponseRecorder, mes
 	require.Equal(t, expectedResponse, response)
 }
 
-func testRouterWithReports(generator report.Generator) *chi.Mux {
+func testRouterWithReports(generator report.Generator, records report.Records) *chi.Mux {
 	r := chi.NewRouter()
 	r.Use(middleware.Recoverer)
-	RegisterReportsRoutes(r, generator)
+	RegisterReportsRoutes(r, generator, records, 2020, "some-token")
 	return r
 }
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/hpcsc/outside-in-go/internal/s3event"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	s3EventsRoutePattern = "/events/s3"
+	// maxNotificationBytes is well above the size of an S3 event notification, which holds a single record
+	maxNotificationBytes = 1 << 20
+)
+
+// RegisterS3EventsRoutes accepts S3 event notifications posted directly, as an alternative to consuming them from a queue.
+// Notifications invalidate aggregates, so they must carry token as a bearer token
+func RegisterS3EventsRoutes(router *chi.Mux, processor s3event.Processor, token string) {
+	h := &s3EventsHandler{
+		processor: processor,
+	}
+	router.With(requireBearerToken(token, "a valid events token is required")).Post(s3EventsRoutePattern, h.Receive)
+}
+
+type s3EventsHandler struct {
+	processor s3event.Processor
+}
+
+func (h *s3EventsHandler) Receive(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "s3EventsHandler.Receive")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxNotificationBytes))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, fmt.Sprintf("failed to read notification: %v", err))
+		return
+	}
+
+	err = h.processor.Process(ctx, body)
+	if errors.Is(err, s3event.ErrInvalidNotification) {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to process s3 event notification", slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
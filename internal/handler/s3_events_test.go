@@ -0,0 +1,80 @@
+//go:build unit
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/hpcsc/outside-in-go/internal/s3event"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestS3Events(t *testing.T) {
+	notification := `{"Records":[{"eventName":"ObjectCreated:Put","s3":{"object":{"key":"2022/04/single/cluster-1.csv"}}}]}`
+
+	t.Run("return 204 when notification is processed", func(t *testing.T) {
+		mockProcessor := s3event.NewMockProcessor()
+		mockProcessor.StubProcess([]byte(notification)).Return(nil)
+
+		recorder := serveS3EventsRequest(t, mockProcessor, notification)
+
+		require.Equal(t, http.StatusNoContent, recorder.Code)
+		mockProcessor.AssertExpectations(t)
+	})
+
+	t.Run("return 400 for invalid notification", func(t *testing.T) {
+		stubProcessor := s3event.NewMockProcessor()
+		stubProcessor.StubProcess([]byte("not json")).Return(fmt.Errorf("%w: some reason", s3event.ErrInvalidNotification))
+
+		recorder := serveS3EventsRequest(t, stubProcessor, "not json")
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		requireErrorMessage(t, recorder, "invalid s3 event notification: some reason")
+	})
+
+	t.Run("return 401 without valid events token", func(t *testing.T) {
+		for _, token := range []string{"", "other-token"} {
+			mockProcessor := s3event.NewMockProcessor()
+
+			recorder := serveS3EventsRequestWithToken(t, mockProcessor, notification, token)
+
+			require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			requireErrorMessage(t, recorder, "a valid events token is required")
+			mockProcessor.AssertNotCalled(t, "Process", mock.Anything, mock.Anything)
+		}
+	})
+
+	t.Run("return 500 when aggregate cannot be invalidated", func(t *testing.T) {
+		stubProcessor := s3event.NewMockProcessor()
+		stubProcessor.StubProcess([]byte(notification)).Return(errors.New("some error"))
+
+		recorder := serveS3EventsRequest(t, stubProcessor, notification)
+
+		require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	})
+}
+
+func serveS3EventsRequest(t *testing.T, processor s3event.Processor, body string) *httptest.ResponseRecorder {
+	return serveS3EventsRequestWithToken(t, processor, body, "some-token")
+}
+
+func serveS3EventsRequestWithToken(t *testing.T, processor s3event.Processor, body string, token string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("POST", "/events/s3", strings.NewReader(body))
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	r := chi.NewRouter()
+	RegisterS3EventsRoutes(r, processor, "some-token")
+
+	r.ServeHTTP(recorder, req)
+
+	return recorder
+}
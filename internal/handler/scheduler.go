@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/hpcsc/outside-in-go/internal/scheduler"
+	"net/http"
+)
+
+const schedulerRoutePattern = "/admin/scheduler"
+
+func RegisterSchedulerRoutes(router *chi.Mux, scheduler *scheduler.Scheduler) {
+	h := &schedulerHandler{
+		scheduler: scheduler,
+	}
+	router.Get(schedulerRoutePattern, h.Status)
+}
+
+type schedulerHandler struct {
+	scheduler *scheduler.Scheduler
+}
+
+func (h *schedulerHandler) Status(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.scheduler.Status())
+}
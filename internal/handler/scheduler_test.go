@@ -0,0 +1,43 @@
+//go:build unit
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/scheduler"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestScheduler(t *testing.T) {
+	t.Run("return last run status", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubAcquireLock(mock.Anything).Return(false, nil)
+		sched, err := scheduler.New(report.NewMockGenerator(), stubStorer, scheduler.Options{
+			Cron:        "0 * * * *",
+			MaxAttempts: 1,
+		})
+		require.NoError(t, err)
+		expected := sched.RunOnce(context.Background())
+		r := chi.NewRouter()
+		RegisterSchedulerRoutes(r, sched)
+
+		req, err := http.NewRequest("GET", "/admin/scheduler", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var response scheduler.Status
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+		require.Equal(t, expected.Result, response.Result)
+		require.Equal(t, expected.Period, response.Period)
+	})
+}
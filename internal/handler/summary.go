@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"log/slog"
+	"net/http"
+)
+
+const reportSummaryRoutePattern = "/reports/{type}/summary"
+
+// RegisterReportSummaryRoutes serves group by summaries of aggregates
+func RegisterReportSummaryRoutes(router *chi.Mux, generator report.Generator, minimumYear int) {
+	h := &reportSummaryHandler{
+		generator:   generator,
+		minimumYear: minimumYear,
+	}
+	router.Get(reportSummaryRoutePattern, h.Summary)
+}
+
+type reportSummaryHandler struct {
+	generator   report.Generator
+	minimumYear int
+}
+
+func (h *reportSummaryHandler) Summary(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "reportSummaryHandler.Summary")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	reportType, err := storer.ParseReportType(chi.URLParam(r, "type"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	year, month, err := parseYearAndMonth(query.Get("year"), query.Get("month"), h.minimumYear)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	summary, err := report.ParseSummary(query.Get("group_by"), query["aggregate"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = report.CSVFormat
+	}
+
+	if format != report.CSVFormat && format != report.JSONFormat {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, fmt.Sprintf("format '%s' is invalid", format))
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("report.type", string(reportType)),
+		attribute.Int("report.year", *year),
+		attribute.Int("report.month", *month),
+		attribute.String("report.summary", summary.Name()),
+	)
+
+	data, err := h.generator.Summarize(ctx, reportType, *year, *month, summary)
+	if errors.Is(err, report.ErrUnknownColumn) {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	if errors.Is(err, report.ErrNonNumeric) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	if err != nil {
+		generateErrorResponse(w, r, err)
+		return
+	}
+
+	var body bytes.Buffer
+	if err = report.Write(&body, data, format); err != nil {
+		slog.ErrorContext(ctx, "failed to write summary", slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	if format == report.JSONFormat {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%d%02d-summary.csv", reportType, *year, *month))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
@@ -0,0 +1,132 @@
+//go:build unit
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReportSummary(t *testing.T) {
+	summary := report.Summary{
+		GroupBy:  []string{"CLUSTER"},
+		Measures: []report.Measure{{Function: report.SumFunction, Column: "COST"}, {Function: report.CountFunction}},
+	}
+
+	t.Run("return 200 with csv summary", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/cumulative/summary?year=2022&month=4&group_by=CLUSTER&aggregate=sum:COST&aggregate=count", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.StubSummarize(storer.CumulativeReportType, 2022, 4, summary).Return([]byte("CLUSTER,sum(COST),count\ncluster-1,3,2\n"), nil)
+		router := testRouterWithReportSummary(stubGenerator)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "text/csv", recorder.Header().Get("Content-Type"))
+		require.Equal(t, "attachment; filename=cumulative-202204-summary.csv", recorder.Header().Get("Content-Disposition"))
+		require.Equal(t, "CLUSTER,sum(COST),count\ncluster-1,3,2\n", recorder.Body.String())
+	})
+
+	t.Run("return 200 with json summary", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/cumulative/summary?year=2022&month=4&group_by=CLUSTER&aggregate=sum:COST&aggregate=count&format=json", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.StubSummarize(storer.CumulativeReportType, 2022, 4, summary).Return([]byte("CLUSTER,sum(COST),count\ncluster-1,3,2\n"), nil)
+		router := testRouterWithReportSummary(stubGenerator)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		require.JSONEq(t, `[{"CLUSTER": "cluster-1", "sum(COST)": "3", "count": "2"}]`, recorder.Body.String())
+	})
+
+	t.Run("return 400 when summary is invalid", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/summary?year=2022&month=4&aggregate=median:COST", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		router := testRouterWithReportSummary(report.NewMockGenerator())
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		requireErrorResponse(t, recorder, "invalid summary: aggregate 'median:COST' is not one of sum, count, min, max, avg")
+	})
+
+	t.Run("return 400 when column is not in report header", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/summary?year=2022&month=4&group_by=REGION", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.StubSummarize(storer.SingleReportType, 2022, 4, report.Summary{
+			GroupBy:  []string{"REGION"},
+			Measures: []report.Measure{{Function: report.CountFunction}},
+		}).Return(nil, fmt.Errorf("%w: 'REGION'", report.ErrUnknownColumn))
+		router := testRouterWithReportSummary(stubGenerator)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		requireErrorResponse(t, recorder, "unknown column: 'REGION'")
+	})
+
+	t.Run("return 422 when measured column has non-numeric cells", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/summary?year=2022&month=4&group_by=CLUSTER&aggregate=sum:COST&aggregate=count", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.StubSummarize(storer.SingleReportType, 2022, 4, summary).Return(nil, fmt.Errorf("%w: 'free' in column 'COST' at line 3", report.ErrNonNumeric))
+		router := testRouterWithReportSummary(stubGenerator)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+		requireErrorResponse(t, recorder, "non-numeric value: 'free' in column 'COST' at line 3")
+	})
+
+	t.Run("return 404 when period has no data", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/summary?year=2022&month=4&group_by=CLUSTER&aggregate=sum:COST&aggregate=count", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.StubSummarize(storer.SingleReportType, 2022, 4, summary).Return(nil, fmt.Errorf("%w for 04/2022", report.ErrNoData))
+		router := testRouterWithReportSummary(stubGenerator)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+		requireErrorResponse(t, recorder, "no data available for 04/2022")
+	})
+
+	t.Run("return 500 when generator returns error", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/reports/single/summary?year=2022&month=4&group_by=CLUSTER&aggregate=sum:COST&aggregate=count", nil)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.StubSummarize(storer.SingleReportType, 2022, 4, summary).Return(nil, errors.New("some error"))
+		router := testRouterWithReportSummary(stubGenerator)
+
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusInternalServerError, recorder.Code)
+		requireErrorResponse(t, recorder, "some error")
+	})
+}
+
+func testRouterWithReportSummary(generator report.Generator) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	RegisterReportSummaryRoutes(r, generator, 2020)
+	return r
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"github.com/hpcsc/outside-in-go/internal/upload"
+	"go.opentelemetry.io/otel/attribute"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+const uploadRoutePattern = "/reports/{type}/{year}/{month}/sources/{cluster}"
+
+// RegisterUploadRoutes lets clusters upload their individual files through the API instead of writing to the bucket directly.
+// Every request must carry the token of the cluster it uploads for, keyed by cluster in clusterTokens, or adminToken as a bearer token
+func RegisterUploadRoutes(router *chi.Mux, uploader upload.Uploader, minimumYear int, maxBytes int64, clusterTokens map[string]string, adminToken string) {
+	h := &uploadHandler{
+		uploader:    uploader,
+		minimumYear: minimumYear,
+		maxBytes:    maxBytes,
+	}
+	router.With(requireClusterToken(clusterTokens, adminToken)).Put(uploadRoutePattern, h.Upload)
+}
+
+type uploadHandler struct {
+	uploader    upload.Uploader
+	minimumYear int
+	maxBytes    int64
+}
+
+func (h *uploadHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "uploadHandler.Upload")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	reportType, err := storer.ParseReportType(chi.URLParam(r, "type"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	year, month, err := parseYearAndMonth(chi.URLParam(r, "year"), chi.URLParam(r, "month"), h.minimumYear)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	cluster := chi.URLParam(r, "cluster")
+	span.SetAttributes(
+		attribute.String("report.type", string(reportType)),
+		attribute.Int("report.year", *year),
+		attribute.Int("report.month", *month),
+		attribute.String("upload.cluster", cluster),
+	)
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBytes))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		errorResponse(w, fmt.Sprintf("file exceeds the limit of %d bytes", h.maxBytes))
+		return
+	}
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, fmt.Sprintf("failed to read file: %v", err))
+		return
+	}
+
+	u, err := h.uploader.Upload(ctx, reportType, *year, *month, cluster, data)
+	switch {
+	case errors.Is(err, upload.ErrInvalidCluster), errors.Is(err, upload.ErrInvalidFile):
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse(w, err.Error())
+		return
+	case errors.Is(err, storer.ErrPeriodClosed):
+		w.WriteHeader(http.StatusConflict)
+		errorResponse(w, err.Error())
+		return
+	case err != nil:
+		slog.ErrorContext(ctx, "failed to upload individual file", slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		errorResponse(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(u)
+}
@@ -0,0 +1,124 @@
+//go:build unit
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/hpcsc/outside-in-go/internal/upload"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploads(t *testing.T) {
+	data := "BUCKET,PATH\nsome-bucket,some-path"
+
+	t.Run("return 200 with stored file", func(t *testing.T) {
+		stubUploader := upload.NewMockUploader()
+		stubUploader.StubUpload(storer.SingleReportType, 2022, 4, "cluster-1", []byte(data)).
+			Return(upload.Upload{Key: "2022/04/single/cluster-1.csv", Rows: 1}, nil)
+
+		recorder := serveUploadRequest(t, stubUploader, "/reports/single/2022/04/sources/cluster-1", data)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var response upload.Upload
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+		require.Equal(t, upload.Upload{Key: "2022/04/single/cluster-1.csv", Rows: 1}, response)
+	})
+
+	t.Run("return 404 for unknown report type", func(t *testing.T) {
+		recorder := serveUploadRequest(t, upload.NewMockUploader(), "/reports/not-valid/2022/04/sources/cluster-1", data)
+
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("return 400 for invalid period", func(t *testing.T) {
+		recorder := serveUploadRequest(t, upload.NewMockUploader(), "/reports/single/2022/13/sources/cluster-1", data)
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		requireErrorMessage(t, recorder, "month must be in the range 1..12")
+	})
+
+	t.Run("return 413 when file exceeds size limit", func(t *testing.T) {
+		mockUploader := upload.NewMockUploader()
+
+		recorder := serveUploadRequest(t, mockUploader, "/reports/single/2022/04/sources/cluster-1", strings.Repeat("a", 101))
+
+		require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+		requireErrorMessage(t, recorder, "file exceeds the limit of 100 bytes")
+		mockUploader.AssertUploadNotCalled(t)
+	})
+
+	t.Run("return 400 for invalid file", func(t *testing.T) {
+		stubUploader := upload.NewMockUploader()
+		stubUploader.StubUpload(storer.SingleReportType, 2022, 4, "cluster-1", []byte(data)).
+			Return(upload.Upload{}, fmt.Errorf("%w: some reason", upload.ErrInvalidFile))
+
+		recorder := serveUploadRequest(t, stubUploader, "/reports/single/2022/04/sources/cluster-1", data)
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		requireErrorMessage(t, recorder, "file is not a valid csv: some reason")
+	})
+
+	t.Run("return 409 for period that does not accept uploads", func(t *testing.T) {
+		stubUploader := upload.NewMockUploader()
+		stubUploader.StubUpload(storer.SingleReportType, 2022, 4, "cluster-1", []byte(data)).
+			Return(upload.Upload{}, fmt.Errorf("%w: 04/2022 is closed", storer.ErrPeriodClosed))
+
+		recorder := serveUploadRequest(t, stubUploader, "/reports/single/2022/04/sources/cluster-1", data)
+
+		require.Equal(t, http.StatusConflict, recorder.Code)
+	})
+
+	t.Run("accept admin token for any cluster", func(t *testing.T) {
+		stubUploader := upload.NewMockUploader()
+		stubUploader.StubUpload(storer.SingleReportType, 2022, 4, "cluster-3", []byte(data)).
+			Return(upload.Upload{Key: "2022/04/single/cluster-3.csv", Rows: 1}, nil)
+
+		recorder := serveUploadRequestWithToken(t, stubUploader, "/reports/single/2022/04/sources/cluster-3", data, "admin-token")
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+	})
+
+	t.Run("return 401 without token of uploading cluster", func(t *testing.T) {
+		for _, token := range []string{"", "cluster-2-token", "other-token"} {
+			mockUploader := upload.NewMockUploader()
+
+			recorder := serveUploadRequestWithToken(t, mockUploader, "/reports/single/2022/04/sources/cluster-1", data, token)
+
+			require.Equal(t, http.StatusUnauthorized, recorder.Code, token)
+			requireErrorMessage(t, recorder, "a valid cluster or admin token is required")
+			mockUploader.AssertUploadNotCalled(t)
+		}
+	})
+
+	t.Run("return 401 for cluster without token", func(t *testing.T) {
+		recorder := serveUploadRequestWithToken(t, upload.NewMockUploader(), "/reports/single/2022/04/sources/cluster-3", data, "")
+
+		require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+}
+
+func serveUploadRequest(t *testing.T, uploader upload.Uploader, url string, body string) *httptest.ResponseRecorder {
+	return serveUploadRequestWithToken(t, uploader, url, body, "cluster-1-token")
+}
+
+func serveUploadRequestWithToken(t *testing.T, uploader upload.Uploader, url string, body string, token string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("PUT", url, strings.NewReader(body))
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	r := chi.NewRouter()
+	RegisterUploadRoutes(r, uploader, 2020, 100, map[string]string{"cluster-1": "cluster-1-token", "cluster-2": "cluster-2-token"}, "admin-token")
+
+	r.ServeHTTP(recorder, req)
+
+	return recorder
+}
@@ -0,0 +1,270 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"io"
+	"slices"
+	"unicode/utf8"
+)
+
+// Encoding is the character encoding of source files
+type Encoding string
+
+const (
+	// AutoEncoding reads files with a byte order mark in its encoding, valid UTF-8 as is and anything else as Windows-1252
+	AutoEncoding        Encoding = "auto"
+	UTF8Encoding        Encoding = "utf-8"
+	UTF16Encoding       Encoding = "utf-16"
+	Latin1Encoding      Encoding = "latin-1"
+	Windows1252Encoding Encoding = "windows-1252"
+)
+
+func ParseEncoding(value string) (Encoding, error) {
+	switch e := Encoding(value); e {
+	case AutoEncoding, UTF8Encoding, UTF16Encoding, Latin1Encoding, Windows1252Encoding:
+		return e, nil
+	default:
+		return "", fmt.Errorf("ingestion encoding '%s' is invalid", value)
+	}
+}
+
+// RaggedPolicy decides what happens to rows with a different number of fields than the header
+type RaggedPolicy string
+
+const (
+	// FailRagged fails on the first ragged row
+	FailRagged RaggedPolicy = "fail"
+	// SkipRagged leaves ragged rows out
+	SkipRagged RaggedPolicy = "skip"
+	// PadRagged fills short rows with empty fields and drops empty trailing fields of long rows. Long rows with values past the header still fail
+	PadRagged RaggedPolicy = "pad"
+)
+
+func ParseRaggedPolicy(value string) (RaggedPolicy, error) {
+	switch p := RaggedPolicy(value); p {
+	case FailRagged, SkipRagged, PadRagged:
+		return p, nil
+	default:
+		return "", fmt.Errorf("ingestion ragged rows policy '%s' is invalid", value)
+	}
+}
+
+// AutoDelimiter detects the delimiter from the header of each file
+const AutoDelimiter = "auto"
+
+// delimiters are the candidates for delimiter detection, in order of preference on ties
+var delimiters = []rune{',', ';', '\t', '|'}
+
+// ParseDelimiter returns the delimiter a value stands for, or 0 when the delimiter is to be detected
+func ParseDelimiter(value string) (rune, error) {
+	switch value {
+	case AutoDelimiter:
+		return 0, nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+
+	r, size := utf8.DecodeRuneInString(value)
+	if size == 0 || size != len(value) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+		return 0, fmt.Errorf("ingestion delimiter '%s' is invalid", value)
+	}
+
+	return r, nil
+}
+
+// Options configure how source files are read. The zero value detects encoding and delimiter and fails on ragged rows
+type Options struct {
+	Encoding Encoding
+	// Delimiter is 0 to detect the delimiter of each file
+	Delimiter rune
+	Ragged    RaggedPolicy
+}
+
+var ErrRaggedRow = errors.New("wrong number of fields")
+
+// Error is a failure to read a source file, located by the key of the file and the line in it
+type Error struct {
+	Key  string
+	Line int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s line %d: %v", e.Key, e.Line, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Reader reads the rows of a source file after its header
+type Reader struct {
+	Header []string
+	// Skipped counts the ragged rows left out so far
+	Skipped int
+	key     string
+	csv     *csv.Reader
+	ragged  RaggedPolicy
+}
+
+// NewReader decodes a source file to UTF-8 and reads its header
+func NewReader(key string, data []byte, opts Options) (*Reader, error) {
+	decoded, err := decode(data, opts.Encoding)
+	if err != nil {
+		return nil, &Error{Key: key, Line: 1, Err: err}
+	}
+
+	delimiter := opts.Delimiter
+	if delimiter == 0 {
+		delimiter = detectDelimiter(decoded)
+	}
+
+	reader := csv.NewReader(bytes.NewReader(decoded))
+	reader.Comma = delimiter
+	// the number of fields is checked against the header by the ragged rows policy
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, locate(key, 1, err)
+	}
+
+	ragged := opts.Ragged
+	if ragged == "" {
+		ragged = FailRagged
+	}
+
+	return &Reader{Header: header, key: key, csv: reader, ragged: ragged}, nil
+}
+
+// Read returns the next row with its line, or io.EOF after the last row
+func (r *Reader) Read() ([]string, int, error) {
+	for {
+		record, err := r.csv.Read()
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+
+		if err != nil {
+			return nil, 0, locate(r.key, 0, err)
+		}
+
+		line, _ := r.csv.FieldPos(0)
+		if len(record) == len(r.Header) {
+			return record, line, nil
+		}
+
+		switch r.ragged {
+		case SkipRagged:
+			r.Skipped++
+			continue
+		case PadRagged:
+			if fitted, ok := fit(record, len(r.Header)); ok {
+				return fitted, line, nil
+			}
+		}
+
+		return nil, 0, &Error{Key: r.key, Line: line, Err: fmt.Errorf("%w: expected %d, got %d", ErrRaggedRow, len(r.Header), len(record))}
+	}
+}
+
+// fit pads a short record with empty fields, or trims the empty trailing fields of a long one
+func fit(record []string, width int) ([]string, bool) {
+	if len(record) < width {
+		return append(record, make([]string, width-len(record))...), true
+	}
+
+	for _, v := range record[width:] {
+		if v != "" {
+			return nil, false
+		}
+	}
+
+	return record[:width], true
+}
+
+// locate attaches the key of the file to a csv error, taking the line from the error when it has one
+func locate(key string, line int, err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &Error{Key: key, Line: parseErr.Line, Err: parseErr.Err}
+	}
+
+	return &Error{Key: key, Line: line, Err: err}
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// decode converts data to UTF-8 without byte order mark
+func decode(data []byte, e Encoding) ([]byte, error) {
+	var decoder *encoding.Decoder
+	switch e {
+	case UTF8Encoding:
+		return bytes.TrimPrefix(data, utf8BOM), nil
+	case UTF16Encoding:
+		decoder = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder()
+	case Latin1Encoding:
+		decoder = charmap.ISO8859_1.NewDecoder()
+	case Windows1252Encoding:
+		decoder = charmap.Windows1252.NewDecoder()
+	default:
+		switch {
+		case bytes.HasPrefix(data, utf8BOM):
+			return data[len(utf8BOM):], nil
+		case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+			decoder = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder()
+		case utf8.Valid(data):
+			return data, nil
+		default:
+			decoder = charmap.Windows1252.NewDecoder()
+		}
+	}
+
+	decoded, err := decoder.Bytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s content: %v", e, err)
+	}
+
+	return bytes.TrimPrefix(decoded, utf8BOM), nil
+}
+
+// detectDelimiter picks the candidate found most often in the first line outside of quotes, defaulting to comma
+func detectDelimiter(data []byte) rune {
+	counts := make(map[rune]int, len(delimiters))
+	quoted := false
+	// every candidate is ASCII, and ASCII bytes never occur within multi-byte UTF-8 characters
+	for _, c := range data {
+		r := rune(c)
+		if r == '"' {
+			quoted = !quoted
+			continue
+		}
+
+		if quoted {
+			continue
+		}
+
+		if r == '\n' {
+			break
+		}
+
+		if slices.Contains(delimiters, r) {
+			counts[r]++
+		}
+	}
+
+	best := delimiters[0]
+	for _, d := range delimiters {
+		if counts[d] > counts[best] {
+			best = d
+		}
+	}
+
+	return best
+}
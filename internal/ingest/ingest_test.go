@@ -0,0 +1,151 @@
+//go:build unit
+
+package ingest
+
+import (
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	readAll := func(t *testing.T, data []byte, opts Options) ([]string, [][]string) {
+		r, err := NewReader("2022/04/single/cluster-1.csv", data, opts)
+		require.NoError(t, err)
+
+		var records [][]string
+		for {
+			record, _, err := r.Read()
+			if err == io.EOF {
+				return r.Header, records
+			}
+			require.NoError(t, err)
+			records = append(records, record)
+		}
+	}
+
+	t.Run("strip utf-8 byte order mark", func(t *testing.T) {
+		header, records := readAll(t, []byte("\xEF\xBB\xBFCLUSTER,COST\ncluster-1,1\n"), Options{})
+
+		require.Equal(t, []string{"CLUSTER", "COST"}, header)
+		require.Equal(t, [][]string{{"cluster-1", "1"}}, records)
+	})
+
+	t.Run("detect delimiter from header", func(t *testing.T) {
+		for name, data := range map[string]string{
+			"semicolon": "CLUSTER;COST;NOTE\ncluster-1;1,5;a\n",
+			"tab":       "CLUSTER\tCOST\tNOTE\ncluster-1\t1,5\ta\n",
+			"pipe":      "CLUSTER|COST|NOTE\ncluster-1|1,5|a\n",
+		} {
+			header, records := readAll(t, []byte(data), Options{})
+
+			require.Equal(t, []string{"CLUSTER", "COST", "NOTE"}, header, name)
+			require.Equal(t, [][]string{{"cluster-1", "1,5", "a"}}, records, name)
+		}
+	})
+
+	t.Run("ignore delimiters within quoted header fields", func(t *testing.T) {
+		header, _ := readAll(t, []byte("\"CLUSTER;NAME\",COST\n"), Options{})
+
+		require.Equal(t, []string{"CLUSTER;NAME", "COST"}, header)
+	})
+
+	t.Run("use configured delimiter", func(t *testing.T) {
+		header, records := readAll(t, []byte("CLUSTER;COST,EUR\ncluster-1;1,5\n"), Options{Delimiter: ';'})
+
+		require.Equal(t, []string{"CLUSTER", "COST,EUR"}, header)
+		require.Equal(t, [][]string{{"cluster-1", "1,5"}}, records)
+	})
+
+	t.Run("transcode encodings to utf-8", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			data     []byte
+			encoding Encoding
+			expected string
+		}{
+			"detected windows-1252":   {data: []byte("CLUSTER,TEAM\ncluster-1,\xC9quipe \x80\n"), encoding: AutoEncoding, expected: "Équipe €"},
+			"configured latin-1":      {data: []byte("CLUSTER,TEAM\ncluster-1,\xC9quipe \xA4\n"), encoding: Latin1Encoding, expected: "Équipe ¤"},
+			"utf-16 little endian":    {data: []byte("\xFF\xFEC\x00L\x00U\x00S\x00T\x00E\x00R\x00,\x00T\x00E\x00A\x00M\x00\n\x00c\x00l\x00u\x00s\x00t\x00e\x00r\x00-\x001\x00,\x00\xC9\x00q\x00u\x00i\x00p\x00e\x00 \x00\xAC\x20\n\x00"), encoding: AutoEncoding, expected: "Équipe €"},
+			"configured utf-8 as is":  {data: []byte("CLUSTER,TEAM\ncluster-1,Équipe €\n"), encoding: UTF8Encoding, expected: "Équipe €"},
+			"detected utf-8 as is":    {data: []byte("CLUSTER,TEAM\ncluster-1,Équipe €\n"), encoding: AutoEncoding, expected: "Équipe €"},
+			"configured windows-1252": {data: []byte("CLUSTER,TEAM\ncluster-1,\xC9quipe \x80\n"), encoding: Windows1252Encoding, expected: "Équipe €"},
+		} {
+			header, records := readAll(t, tc.data, Options{Encoding: tc.encoding})
+
+			require.Equal(t, []string{"CLUSTER", "TEAM"}, header, name)
+			require.Equal(t, [][]string{{"cluster-1", tc.expected}}, records, name)
+		}
+	})
+
+	data := []byte("CLUSTER,COST,NOTE\ncluster-1,1\ncluster-2,2,a,\ncluster-3,3,b,c\ncluster-4,4,d\n")
+
+	t.Run("fail on ragged row with key and line", func(t *testing.T) {
+		r, err := NewReader("2022/04/single/cluster-1.csv", data, Options{})
+		require.NoError(t, err)
+
+		_, _, err = r.Read()
+
+		require.ErrorIs(t, err, ErrRaggedRow)
+		require.EqualError(t, err, "2022/04/single/cluster-1.csv line 2: wrong number of fields: expected 3, got 2")
+	})
+
+	t.Run("skip ragged rows", func(t *testing.T) {
+		r, err := NewReader("2022/04/single/cluster-1.csv", data, Options{Ragged: SkipRagged})
+		require.NoError(t, err)
+
+		record, line, err := r.Read()
+
+		require.NoError(t, err)
+		require.Equal(t, []string{"cluster-4", "4", "d"}, record)
+		require.Equal(t, 5, line)
+		require.Equal(t, 3, r.Skipped)
+	})
+
+	t.Run("pad short rows and trim empty trailing fields", func(t *testing.T) {
+		r, err := NewReader("2022/04/single/cluster-1.csv", data, Options{Ragged: PadRagged})
+		require.NoError(t, err)
+
+		first, _, err := r.Read()
+		require.NoError(t, err)
+		second, _, err := r.Read()
+		require.NoError(t, err)
+		_, _, err = r.Read()
+
+		require.Equal(t, []string{"cluster-1", "1", ""}, first)
+		require.Equal(t, []string{"cluster-2", "2", "a"}, second)
+		require.EqualError(t, err, "2022/04/single/cluster-1.csv line 4: wrong number of fields: expected 3, got 4")
+	})
+
+	t.Run("locate malformed csv", func(t *testing.T) {
+		r, err := NewReader("2022/04/single/cluster-1.csv", []byte("CLUSTER,COST\ncluster-1,1\ncluster-\"2,2\n"), Options{})
+		require.NoError(t, err)
+		_, _, err = r.Read()
+		require.NoError(t, err)
+
+		_, _, err = r.Read()
+
+		var ingestErr *Error
+		require.ErrorAs(t, err, &ingestErr)
+		require.Equal(t, "2022/04/single/cluster-1.csv", ingestErr.Key)
+		require.Equal(t, 3, ingestErr.Line)
+	})
+}
+
+func TestParseDelimiter(t *testing.T) {
+	t.Run("parse delimiters", func(t *testing.T) {
+		for value, expected := range map[string]rune{"auto": 0, ",": ',', ";": ';', "tab": '\t', `\t`: '\t', "|": '|'} {
+			d, err := ParseDelimiter(value)
+
+			require.NoError(t, err)
+			require.Equal(t, expected, d, value)
+		}
+	})
+
+	t.Run("return error for invalid delimiter", func(t *testing.T) {
+		for _, value := range []string{"", ";;", `"`, "\n"} {
+			_, err := ParseDelimiter(value)
+
+			require.Error(t, err, value)
+		}
+	})
+}
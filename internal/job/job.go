@@ -0,0 +1,62 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"time"
+)
+
+const (
+	QueuedStatus    = "queued"
+	RunningStatus   = "running"
+	SucceededStatus = "succeeded"
+	FailedStatus    = "failed"
+)
+
+var (
+	ErrNotFound    = errors.New("job not found")
+	ErrQueueFull   = errors.New("job queue is full")
+	ErrNotFinished = errors.New("job has not finished")
+	ErrFailed      = errors.New("job has failed")
+)
+
+type Progress struct {
+	Processed int `json:"processed"`
+	Total     int `json:"total"`
+}
+
+type Job struct {
+	ID         string            `json:"id"`
+	ReportType storer.ReportType `json:"report_type"`
+	Year       int               `json:"year"`
+	Month      int               `json:"month"`
+	Status     string            `json:"status"`
+	Progress   Progress          `json:"progress"`
+	Error      string            `json:"error,omitempty"`
+	// Version is the ID of the aggregate version a succeeded job built, which is served as its result
+	Version string `json:"version,omitempty"`
+	// Checksum is the SHA-256 of the aggregate a succeeded job built. Without a Version, the current aggregate is served as long as it matches
+	Checksum  string    `json:"checksum,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (j Job) Finished() bool {
+	return j.Status == SucceededStatus || j.Status == FailedStatus
+}
+
+// Manager runs report generation in the background so that callers do not have to hold a request open for it
+type Manager interface {
+	// Submit queues the generation of a report and returns the queued job, or ErrQueueFull when no more jobs can be accepted
+	Submit(ctx context.Context, reportType storer.ReportType, year int, month int) (Job, error)
+	// Get returns the current state of a job, or ErrNotFound
+	Get(ctx context.Context, id string) (Job, error)
+	// Result returns the version of the report built by a succeeded job, ErrNotFinished while it is queued or running and ErrFailed when it failed.
+	// It returns report.ErrVersionNotFound when the version is no longer kept, or when the job built no stored version and the aggregate has changed since
+	Result(ctx context.Context, id string) ([]byte, error)
+	// Start deletes finished jobs past their retention, resumes unfinished jobs left by a previous run and starts the workers
+	Start(ctx context.Context) error
+	// Stop stops the workers. The returned context is done once running jobs have been put back in the queue
+	Stop() context.Context
+}
@@ -0,0 +1,58 @@
+package job
+
+import (
+	"context"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ Manager = &mockManager{}
+
+type mockManager struct {
+	mock.Mock
+}
+
+func NewMockManager() *mockManager {
+	return &mockManager{}
+}
+
+func (m *mockManager) Submit(ctx context.Context, reportType storer.ReportType, year int, month int) (Job, error) {
+	args := m.Called(ctx, reportType, year, month)
+	return args.Get(0).(Job), args.Error(1)
+}
+
+func (m *mockManager) StubSubmit(reportType interface{}, year interface{}, month interface{}) *mock.Call {
+	return m.On("Submit", mock.Anything, reportType, year, month)
+}
+
+func (m *mockManager) Get(ctx context.Context, id string) (Job, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(Job), args.Error(1)
+}
+
+func (m *mockManager) StubGet(id interface{}) *mock.Call {
+	return m.On("Get", mock.Anything, id)
+}
+
+func (m *mockManager) Result(ctx context.Context, id string) ([]byte, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *mockManager) StubResult(id interface{}) *mock.Call {
+	return m.On("Result", mock.Anything, id)
+}
+
+func (m *mockManager) Start(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *mockManager) Stop() context.Context {
+	args := m.Called()
+	return args.Get(0).(context.Context)
+}
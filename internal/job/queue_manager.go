@@ -0,0 +1,489 @@
+package job
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/logging"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var _ Manager = &queueManager{}
+
+// progressInterval bounds how often the progress of a running job is persisted
+const progressInterval = 2 * time.Second
+
+type Options struct {
+	Workers int
+	// QueueSize is the number of jobs that can wait for a worker before submissions are refused
+	QueueSize int
+	// Lease bounds how long a crashed replica can keep others from resuming its jobs. It is renewed while a job runs
+	Lease time.Duration
+	Owner string
+	// Retention is how long finished jobs and their results are kept. Expired jobs are deleted on start and then every Retention
+	Retention time.Duration
+}
+
+type queueManager struct {
+	generator report.Generator
+	records   report.Records
+	storer    storer.Storer
+	options   Options
+	queue     chan string
+	now       func() time.Time
+	newID     func() string
+
+	mu      sync.Mutex
+	pending int
+	// active holds the jobs queued or running on this replica. Other jobs are read from storage
+	active  map[string]*Job
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+func NewQueueManager(generator report.Generator, storer storer.Storer, options Options) Manager {
+	return &queueManager{
+		generator: generator,
+		records:   report.NewRecords(storer),
+		storer:    storer,
+		options:   options,
+		queue:     make(chan string, options.QueueSize),
+		now:       time.Now,
+		newID:     newID,
+		active:    map[string]*Job{},
+	}
+}
+
+func (m *queueManager) Submit(ctx context.Context, reportType storer.ReportType, year int, month int) (Job, error) {
+	now := m.now()
+	j := &Job{
+		ID:         m.newID(),
+		ReportType: reportType,
+		Year:       year,
+		Month:      month,
+		Status:     QueuedStatus,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	if !m.reserve() {
+		return Job{}, ErrQueueFull
+	}
+
+	if err := m.persist(ctx, *j); err != nil {
+		m.mu.Lock()
+		m.pending--
+		m.mu.Unlock()
+		return Job{}, err
+	}
+
+	// workers own the job once it is enqueued
+	queued := *j
+	m.enqueue(j)
+	slog.InfoContext(ctx, "queued job",
+		slog.String("job_id", queued.ID),
+		slog.String("report_type", string(reportType)),
+		logging.Period(year, month),
+	)
+
+	return queued, nil
+}
+
+func (m *queueManager) Get(ctx context.Context, id string) (Job, error) {
+	m.mu.Lock()
+	if j, ok := m.active[id]; ok {
+		m.mu.Unlock()
+		return *j, nil
+	}
+	m.mu.Unlock()
+
+	return m.retrieve(ctx, id)
+}
+
+// retrieve reads a job from storage, returning ErrNotFound when there is no such job
+func (m *queueManager) retrieve(ctx context.Context, id string) (Job, error) {
+	data, err := m.storer.RetrieveJob(ctx, id)
+	if err != nil {
+		return Job{}, err
+	}
+
+	if data == nil {
+		return Job{}, ErrNotFound
+	}
+
+	var j Job
+	if err := json.Unmarshal(data, &j); err != nil {
+		return Job{}, fmt.Errorf("failed to decode job %s: %v", id, err)
+	}
+
+	return j, nil
+}
+
+func (m *queueManager) Result(ctx context.Context, id string) ([]byte, error) {
+	j, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case j.Status == SucceededStatus && j.Version != "":
+		// the aggregate may have been rebuilt since, so the result is the version the job built
+		return m.records.Version(ctx, j.ReportType, j.Year, j.Month, j.Version)
+	case j.Status == SucceededStatus:
+		return m.currentResult(ctx, j)
+	case j.Status == FailedStatus:
+		return nil, fmt.Errorf("%w: %s", ErrFailed, j.Error)
+	default:
+		return nil, ErrNotFinished
+	}
+}
+
+// currentResult serves the current aggregate as the result of a job that built no stored version, as long as it is still what the job built
+func (m *queueManager) currentResult(ctx context.Context, j Job) ([]byte, error) {
+	data, err := m.generator.Generate(ctx, j.ReportType, j.Year, j.Month)
+	if err != nil {
+		return nil, err
+	}
+
+	if j.Checksum != "" && checksumOf(data) != j.Checksum {
+		return nil, fmt.Errorf("%w: aggregate has changed since job %s built it", report.ErrVersionNotFound, j.ID)
+	}
+
+	return data, nil
+}
+
+func (m *queueManager) Start(ctx context.Context) error {
+	stored, err := m.storer.RetrieveJobs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve jobs: %v", err)
+	}
+
+	resumed := 0
+	for _, j := range m.removeExpired(ctx, stored) {
+		if j.Finished() {
+			continue
+		}
+
+		if !m.reserve() {
+			slog.WarnContext(ctx, "job queue is full, remaining unfinished jobs are left for another replica or restart")
+			break
+		}
+
+		// a job that was running when its replica went away starts over
+		j.Status = QueuedStatus
+		j.Progress = Progress{}
+		m.enqueue(&j)
+		resumed++
+	}
+
+	slog.InfoContext(ctx, "started job workers", slog.Int("workers", m.options.Workers), slog.Int("resumed", resumed))
+
+	workerCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	m.mu.Lock()
+	m.cancel = cancel
+	m.mu.Unlock()
+
+	for i := 0; i < m.options.Workers; i++ {
+		m.workers.Add(1)
+		go m.work(workerCtx)
+	}
+
+	m.workers.Add(1)
+	go m.cleanUp(workerCtx)
+
+	return nil
+}
+
+func (m *queueManager) Stop() context.Context {
+	m.mu.Lock()
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.mu.Unlock()
+
+	ctx, done := context.WithCancel(context.Background())
+	go func() {
+		m.workers.Wait()
+		done()
+	}()
+
+	return ctx
+}
+
+// cleanUp deletes expired jobs every retention period until ctx is done
+func (m *queueManager) cleanUp(ctx context.Context) {
+	defer m.workers.Done()
+
+	ticker := time.NewTicker(m.options.Retention)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stored, err := m.storer.RetrieveJobs(ctx)
+			if err != nil {
+				slog.WarnContext(ctx, "failed to retrieve jobs to clean up", slog.String("error", err.Error()))
+				continue
+			}
+
+			m.removeExpired(ctx, stored)
+		}
+	}
+}
+
+// removeExpired deletes the finished jobs last updated more than a retention period ago and returns the others.
+// A job that cannot be deleted is left for the next clean up, so errors are only logged
+func (m *queueManager) removeExpired(ctx context.Context, stored [][]byte) []Job {
+	expiry := m.now().Add(-m.options.Retention)
+
+	var kept []Job
+	deleted := 0
+	for _, data := range stored {
+		var j Job
+		if err := json.Unmarshal(data, &j); err != nil {
+			slog.WarnContext(ctx, "ignored unreadable job", slog.String("error", err.Error()))
+			continue
+		}
+
+		if !j.Finished() || !j.UpdatedAt.Before(expiry) {
+			kept = append(kept, j)
+			continue
+		}
+
+		if err := m.storer.DeleteJob(ctx, j.ID); err != nil {
+			slog.WarnContext(ctx, "failed to delete expired job", slog.String("job_id", j.ID), slog.String("error", err.Error()))
+			continue
+		}
+		deleted++
+	}
+
+	if deleted > 0 {
+		slog.InfoContext(ctx, "deleted expired jobs", slog.Int("jobs", deleted))
+	}
+
+	return kept
+}
+
+// reserve takes a place in the queue so that enqueue never blocks
+func (m *queueManager) reserve() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.pending >= m.options.QueueSize {
+		return false
+	}
+
+	m.pending++
+	return true
+}
+
+func (m *queueManager) enqueue(j *Job) {
+	m.mu.Lock()
+	m.active[j.ID] = j
+	m.mu.Unlock()
+
+	m.queue <- j.ID
+}
+
+func (m *queueManager) work(ctx context.Context) {
+	defer m.workers.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-m.queue:
+			m.mu.Lock()
+			m.pending--
+			m.mu.Unlock()
+
+			m.run(ctx, id)
+		}
+	}
+}
+
+func (m *queueManager) run(ctx context.Context, id string) {
+	defer func() {
+		m.mu.Lock()
+		delete(m.active, id)
+		m.mu.Unlock()
+	}()
+
+	logger := slog.Default().With(slog.String("job_id", id))
+	lockName := fmt.Sprintf("job-%s", id)
+
+	acquired, err := m.storer.AcquireLock(ctx, lockName, m.options.Owner, m.now().Add(m.options.Lease))
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to acquire job lock", slog.String("error", err.Error()))
+		m.fail(ctx, logger, id, fmt.Errorf("failed to acquire job lock: %v", err))
+		return
+	}
+
+	if !acquired {
+		logger.InfoContext(ctx, "skipped job, lock held by another replica")
+		return
+	}
+
+	defer func() {
+		if err := m.storer.ReleaseLock(context.WithoutCancel(ctx), lockName, m.options.Owner); err != nil {
+			logger.WarnContext(ctx, "failed to release job lock", slog.String("error", err.Error()))
+		}
+	}()
+
+	// another replica may have run the job and released its lock since this replica queued it
+	stored, err := m.retrieve(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		logger.InfoContext(ctx, "skipped job, no longer stored")
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to retrieve job", slog.String("error", err.Error()))
+		m.fail(ctx, logger, id, fmt.Errorf("failed to retrieve job: %v", err))
+		return
+	}
+
+	if stored.Finished() {
+		logger.InfoContext(ctx, "skipped job, finished by another replica", slog.String("status", stored.Status))
+		return
+	}
+
+	// a generation can outlast the lease, so the lock is renewed until the job finishes
+	lockCtx, stopRenewing := storer.KeepLock(ctx, m.storer, lockName, m.options.Owner, m.options.Lease)
+	defer stopRenewing()
+
+	j := m.update(id, func(j *Job) {
+		j.Status = RunningStatus
+	})
+	m.persistOrWarn(ctx, logger, j)
+
+	lastPersisted := m.now()
+	observer := report.ObserverFunc(func(e report.Event) {
+		// a file counts as processed once it has been parsed
+		if e.Type != report.FilesListedEvent && e.Type != report.FileParsedEvent {
+			return
+		}
+
+		j := m.update(id, func(j *Job) {
+			j.Progress = Progress{Processed: e.Processed, Total: e.Total}
+		})
+
+		if m.now().Sub(lastPersisted) >= progressInterval {
+			lastPersisted = m.now()
+			m.persistOrWarn(ctx, logger, j)
+		}
+	})
+
+	start := time.Now()
+	var version string
+	data, err := m.generator.Generate(report.WithObserver(lockCtx, observer), j.ReportType, j.Year, j.Month)
+	if err == nil {
+		version, err = m.builtVersion(ctx, j, data)
+	}
+
+	if lockCtx.Err() != nil && ctx.Err() == nil {
+		// the replica now holding the lock runs the job, so its state is left to that replica
+		logger.WarnContext(ctx, "abandoned job, lock taken by another replica")
+		return
+	}
+
+	j = m.update(id, func(j *Job) {
+		switch {
+		case err == nil:
+			j.Status = SucceededStatus
+			j.Version = version
+			j.Checksum = checksumOf(data)
+		case ctx.Err() != nil:
+			// stopped before completion, leave it for the next start to resume
+			j.Status = QueuedStatus
+			j.Progress = Progress{}
+		default:
+			j.Status = FailedStatus
+			j.Error = err.Error()
+		}
+	})
+
+	m.persistOrWarn(context.WithoutCancel(ctx), logger, j)
+	logger.InfoContext(ctx, "finished job", slog.String("status", j.Status), logging.Duration(start))
+}
+
+// builtVersion returns the ID of the stored version of the aggregate a job built, newest first as the job most likely built the latest one.
+// There is none when the aggregate has no version record, such as a partial aggregate when those are not stored or an aggregate stored before versions were kept
+func (m *queueManager) builtVersion(ctx context.Context, j Job, data []byte) (string, error) {
+	versions, err := m.records.Versions(ctx, j.ReportType, j.Year, j.Month)
+	if err != nil {
+		return "", fmt.Errorf("failed to find version built by job: %v", err)
+	}
+
+	checksum := checksumOf(data)
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].Checksum == checksum {
+			return versions[i].ID, nil
+		}
+	}
+
+	return "", nil
+}
+
+// fail records a job that cannot run, since nothing retries a job left queued. A job stopped before it could run is left for the next start to resume
+func (m *queueManager) fail(ctx context.Context, logger *slog.Logger, id string, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	j := m.update(id, func(j *Job) {
+		j.Status = FailedStatus
+		j.Error = err.Error()
+	})
+	m.persistOrWarn(context.WithoutCancel(ctx), logger, j)
+}
+
+// update applies fn to an active job and returns a copy of the result
+func (m *queueManager) update(id string, fn func(j *Job)) Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j := m.active[id]
+	fn(j)
+	j.UpdatedAt = m.now()
+
+	return *j
+}
+
+func (m *queueManager) persist(ctx context.Context, j Job) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %v", j.ID, err)
+	}
+
+	return m.storer.StoreJob(ctx, j.ID, data)
+}
+
+func (m *queueManager) persistOrWarn(ctx context.Context, logger *slog.Logger, j Job) {
+	if err := m.persist(ctx, j); err != nil {
+		logger.WarnContext(ctx, "failed to persist job", slog.String("status", j.Status), slog.String("error", err.Error()))
+	}
+}
+
+// checksumOf returns the hex encoded SHA-256 of an aggregate, as recorded in its versions
+func checksumOf(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,388 @@
+//go:build unit
+
+package job
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueueManager(t *testing.T) {
+	t.Run("run submitted job to completion", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubRecords := report.NewMockRecords()
+		stubGenerator.On("Generate", mock.Anything, storer.SingleReportType, 2022, 4).Return([]byte("some,data"), nil)
+		stubRecords.StubVersions(storer.SingleReportType, 2022, 4).Return(versionsOf("some,data"), nil)
+		stubRecords.StubVersion(storer.SingleReportType, 2022, 4, "version-1").Return([]byte("some,data"), nil)
+		m := newTestQueueManager(t, stubGenerator, stubRecords, newJobStorer(), 10)
+		require.NoError(t, m.Start(context.Background()))
+
+		j, err := m.Submit(context.Background(), storer.SingleReportType, 2022, 4)
+
+		require.NoError(t, err)
+		require.Equal(t, "job-1", j.ID)
+		require.Equal(t, QueuedStatus, j.Status)
+		j = requireJobStatus(t, m, "job-1", SucceededStatus)
+		require.Equal(t, "version-1", j.Version)
+		data, err := m.Result(context.Background(), "job-1")
+		require.NoError(t, err)
+		require.Equal(t, []byte("some,data"), data)
+	})
+
+	t.Run("serve version built by job after aggregate is rebuilt", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubRecords := report.NewMockRecords()
+		stubGenerator.On("Generate", mock.Anything, storer.SingleReportType, 2022, 4).Return([]byte("some,data"), nil)
+		stubRecords.StubVersions(storer.SingleReportType, 2022, 4).Return(versionsOf("other,data", "some,data", "newer,data"), nil)
+		stubRecords.StubVersion(storer.SingleReportType, 2022, 4, "version-2").Return([]byte("some,data"), nil)
+		m := newTestQueueManager(t, stubGenerator, stubRecords, newJobStorer(), 10)
+		require.NoError(t, m.Start(context.Background()))
+
+		_, err := m.Submit(context.Background(), storer.SingleReportType, 2022, 4)
+		require.NoError(t, err)
+		requireJobStatus(t, m, "job-1", SucceededStatus)
+
+		data, err := m.Result(context.Background(), "job-1")
+
+		require.NoError(t, err)
+		require.Equal(t, []byte("some,data"), data)
+		stubGenerator.AssertNumberOfCalls(t, "Generate", 1)
+	})
+
+	t.Run("serve current aggregate when job built no stored version", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubRecords := report.NewMockRecords()
+		stubGenerator.On("Generate", mock.Anything, storer.SingleReportType, 2022, 4).Return([]byte("partial,data"), nil)
+		stubRecords.StubVersions(storer.SingleReportType, 2022, 4).Return(versionsOf("some,data"), nil)
+		m := newTestQueueManager(t, stubGenerator, stubRecords, newJobStorer(), 10)
+		require.NoError(t, m.Start(context.Background()))
+
+		_, err := m.Submit(context.Background(), storer.SingleReportType, 2022, 4)
+		require.NoError(t, err)
+		j := requireJobStatus(t, m, "job-1", SucceededStatus)
+
+		data, err := m.Result(context.Background(), "job-1")
+
+		require.NoError(t, err)
+		require.Empty(t, j.Version)
+		require.Equal(t, []byte("partial,data"), data)
+	})
+
+	t.Run("return version not found when aggregate changed since job built no stored version", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Generate", mock.Anything, storer.SingleReportType, 2022, 4).Return([]byte("newer,data"), nil)
+		s := newJobStorer()
+		s.jobs["job-1"] = encodeJob(t, Job{ID: "job-1", ReportType: storer.SingleReportType, Year: 2022, Month: 4, Status: SucceededStatus, Checksum: versionsOf("some,data")[0].Checksum})
+		m := newTestQueueManager(t, stubGenerator, report.NewMockRecords(), s, 10)
+
+		_, err := m.Result(context.Background(), "job-1")
+
+		require.ErrorIs(t, err, report.ErrVersionNotFound)
+	})
+
+	t.Run("record error of failed job", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Generate", mock.Anything, storer.SingleReportType, 2022, 4).Return(nil, errors.New("some error"))
+		m := newTestQueueManager(t, stubGenerator, report.NewMockRecords(), newJobStorer(), 10)
+		require.NoError(t, m.Start(context.Background()))
+
+		_, err := m.Submit(context.Background(), storer.SingleReportType, 2022, 4)
+		require.NoError(t, err)
+
+		j := requireJobStatus(t, m, "job-1", FailedStatus)
+		require.Equal(t, "some error", j.Error)
+		_, err = m.Result(context.Background(), "job-1")
+		require.ErrorIs(t, err, ErrFailed)
+	})
+
+	t.Run("record progress reported by generator", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Generate", mock.Anything, storer.SingleReportType, 2022, 4).
+			Run(func(args mock.Arguments) {
+				observer := report.ObserverFrom(args.Get(0).(context.Context))
+				observer.Observe(report.Event{Type: report.FilesListedEvent, Total: 2})
+				observer.Observe(report.Event{Type: report.FileFetchedEvent, Processed: 2, Total: 2})
+				observer.Observe(report.Event{Type: report.FileParsedEvent, Processed: 1, Total: 2})
+			}).
+			Return(nil, errors.New("some error"))
+		m := newTestQueueManager(t, stubGenerator, report.NewMockRecords(), newJobStorer(), 10)
+		require.NoError(t, m.Start(context.Background()))
+
+		_, err := m.Submit(context.Background(), storer.SingleReportType, 2022, 4)
+		require.NoError(t, err)
+
+		j := requireJobStatus(t, m, "job-1", FailedStatus)
+		require.Equal(t, Progress{Processed: 1, Total: 2}, j.Progress)
+	})
+
+	t.Run("refuse job when queue is full", func(t *testing.T) {
+		m := newTestQueueManager(t, report.NewMockGenerator(), report.NewMockRecords(), newJobStorer(), 1)
+
+		_, err := m.Submit(context.Background(), storer.SingleReportType, 2022, 4)
+		require.NoError(t, err)
+		_, err = m.Submit(context.Background(), storer.SingleReportType, 2022, 5)
+
+		require.ErrorIs(t, err, ErrQueueFull)
+	})
+
+	t.Run("return not finished result of queued job", func(t *testing.T) {
+		m := newTestQueueManager(t, report.NewMockGenerator(), report.NewMockRecords(), newJobStorer(), 10)
+		_, err := m.Submit(context.Background(), storer.SingleReportType, 2022, 4)
+		require.NoError(t, err)
+
+		_, err = m.Result(context.Background(), "job-1")
+
+		require.ErrorIs(t, err, ErrNotFinished)
+	})
+
+	t.Run("return not found for unknown job", func(t *testing.T) {
+		m := newTestQueueManager(t, report.NewMockGenerator(), report.NewMockRecords(), newJobStorer(), 10)
+
+		_, err := m.Get(context.Background(), "unknown")
+
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("delete finished jobs older than retention on start", func(t *testing.T) {
+		s := newJobStorer()
+		now := time.Date(2022, 5, 2, 0, 0, 0, 0, time.UTC)
+		s.jobs["expired"] = encodeJob(t, Job{ID: "expired", Status: FailedStatus, UpdatedAt: now.Add(-25 * time.Hour)})
+		s.jobs["recent"] = encodeJob(t, Job{ID: "recent", Status: SucceededStatus, UpdatedAt: now.Add(-23 * time.Hour)})
+		m := newTestQueueManager(t, report.NewMockGenerator(), report.NewMockRecords(), s, 10)
+		m.now = func() time.Time { return now }
+
+		require.NoError(t, m.Start(context.Background()))
+
+		_, err := m.Get(context.Background(), "expired")
+		require.ErrorIs(t, err, ErrNotFound)
+		_, err = m.Get(context.Background(), "recent")
+		require.NoError(t, err)
+	})
+
+	t.Run("resume unfinished jobs on start", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubRecords := report.NewMockRecords()
+		stubGenerator.On("Generate", mock.Anything, storer.SingleReportType, 2022, 4).Return([]byte("some,data"), nil)
+		stubRecords.StubVersions(storer.SingleReportType, 2022, 4).Return(versionsOf("some,data"), nil)
+		s := newJobStorer()
+		s.jobs["finished"] = encodeJob(t, Job{ID: "finished", ReportType: storer.SingleReportType, Year: 2022, Month: 3, Status: SucceededStatus})
+		s.jobs["interrupted"] = encodeJob(t, Job{ID: "interrupted", ReportType: storer.SingleReportType, Year: 2022, Month: 4, Status: RunningStatus})
+		m := newTestQueueManager(t, stubGenerator, stubRecords, s, 10)
+
+		require.NoError(t, m.Start(context.Background()))
+
+		requireJobStatus(t, m, "interrupted", SucceededStatus)
+		stubGenerator.AssertNotCalled(t, "Generate", mock.Anything, mock.Anything, 2022, 3)
+	})
+
+	t.Run("put running job back in queue when stopped", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		started := make(chan struct{})
+		stubGenerator.On("Generate", mock.Anything, storer.SingleReportType, 2022, 4).
+			Run(func(args mock.Arguments) {
+				close(started)
+				<-args.Get(0).(context.Context).Done()
+			}).
+			Return(nil, context.Canceled)
+		m := newTestQueueManager(t, stubGenerator, report.NewMockRecords(), newJobStorer(), 10)
+		require.NoError(t, m.Start(context.Background()))
+		_, err := m.Submit(context.Background(), storer.SingleReportType, 2022, 4)
+		require.NoError(t, err)
+		<-started
+
+		<-m.Stop().Done()
+
+		j, err := m.Get(context.Background(), "job-1")
+		require.NoError(t, err)
+		require.Equal(t, QueuedStatus, j.Status)
+	})
+
+	t.Run("skip job locked by another replica", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		s := newJobStorer()
+		s.locks["job-job-1"] = "another-owner"
+		m := newTestQueueManager(t, stubGenerator, report.NewMockRecords(), s, 10)
+		require.NoError(t, m.Start(context.Background()))
+
+		_, err := m.Submit(context.Background(), storer.SingleReportType, 2022, 4)
+		require.NoError(t, err)
+
+		<-m.Stop().Done()
+		j, err := m.Get(context.Background(), "job-1")
+		require.NoError(t, err)
+		require.Equal(t, QueuedStatus, j.Status)
+		stubGenerator.AssertNotCalled(t, "Generate", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("skip job finished by another replica before lock was acquired", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		s := newJobStorer()
+		s.beforeLock = func() {
+			s.jobs["job-1"] = encodeJob(t, Job{ID: "job-1", ReportType: storer.SingleReportType, Year: 2022, Month: 4, Status: SucceededStatus, Version: "version-1"})
+		}
+		m := newTestQueueManager(t, stubGenerator, report.NewMockRecords(), s, 10)
+		require.NoError(t, m.Start(context.Background()))
+
+		_, err := m.Submit(context.Background(), storer.SingleReportType, 2022, 4)
+		require.NoError(t, err)
+
+		j := requireJobStatus(t, m, "job-1", SucceededStatus)
+		<-m.Stop().Done()
+		require.Equal(t, "version-1", j.Version)
+		stubGenerator.AssertNotCalled(t, "Generate", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("fail job when its lock cannot be acquired", func(t *testing.T) {
+		s := newJobStorer()
+		s.lockErr = errors.New("some error")
+		m := newTestQueueManager(t, report.NewMockGenerator(), report.NewMockRecords(), s, 10)
+		require.NoError(t, m.Start(context.Background()))
+
+		_, err := m.Submit(context.Background(), storer.SingleReportType, 2022, 4)
+		require.NoError(t, err)
+
+		j := requireJobStatus(t, m, "job-1", FailedStatus)
+		require.Equal(t, "failed to acquire job lock: some error", j.Error)
+	})
+}
+
+func newTestQueueManager(t *testing.T, generator report.Generator, records report.Records, s storer.Storer, queueSize int) *queueManager {
+	m := NewQueueManager(generator, s, Options{
+		Workers:   1,
+		QueueSize: queueSize,
+		Lease:     time.Minute,
+		Owner:     "some-owner",
+		Retention: 24 * time.Hour,
+	}).(*queueManager)
+	m.records = records
+
+	ids := 0
+	m.newID = func() string {
+		ids++
+		return fmt.Sprintf("job-%d", ids)
+	}
+	t.Cleanup(func() {
+		<-m.Stop().Done()
+	})
+
+	return m
+}
+
+// jobStorer keeps jobs and locks in memory. Other Storer methods are not expected to be called
+type jobStorer struct {
+	storer.Storer
+
+	mu    sync.Mutex
+	jobs  map[string][]byte
+	locks map[string]string
+	// lockErr fails every lock acquisition, and beforeLock runs before each one while jobs and locks are held
+	lockErr    error
+	beforeLock func()
+}
+
+func newJobStorer() *jobStorer {
+	return &jobStorer{
+		jobs:  map[string][]byte{},
+		locks: map[string]string{},
+	}
+}
+
+func (s *jobStorer) StoreJob(_ context.Context, id string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[id] = data
+	return nil
+}
+
+func (s *jobStorer) RetrieveJob(_ context.Context, id string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.jobs[id], nil
+}
+
+func (s *jobStorer) RetrieveJobs(_ context.Context) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs [][]byte
+	for _, data := range s.jobs {
+		jobs = append(jobs, data)
+	}
+	return jobs, nil
+}
+
+func (s *jobStorer) DeleteJob(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.jobs, id)
+	return nil
+}
+
+func (s *jobStorer) AcquireLock(_ context.Context, name string, owner string, _ time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.beforeLock != nil {
+		s.beforeLock()
+	}
+
+	if s.lockErr != nil {
+		return false, s.lockErr
+	}
+
+	if current, ok := s.locks[name]; ok && current != owner {
+		return false, nil
+	}
+
+	s.locks[name] = owner
+	return true, nil
+}
+
+func (s *jobStorer) ReleaseLock(_ context.Context, name string, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locks[name] == owner {
+		delete(s.locks, name)
+	}
+	return nil
+}
+
+func requireJobStatus(t *testing.T, m Manager, id string, status string) Job {
+	var j Job
+	require.Eventually(t, func() bool {
+		var err error
+		j, err = m.Get(context.Background(), id)
+		return err == nil && j.Status == status
+	}, time.Second, 10*time.Millisecond)
+
+	return j
+}
+
+// versionsOf describes a version of each aggregate content, oldest first, with IDs counting from version-1
+func versionsOf(contents ...string) []storer.AggregateVersion {
+	var versions []storer.AggregateVersion
+	for i, content := range contents {
+		versions = append(versions, storer.AggregateVersion{ID: fmt.Sprintf("version-%d", i+1), Checksum: fmt.Sprintf("%x", sha256.Sum256([]byte(content)))})
+	}
+	return versions
+}
+
+func encodeJob(t *testing.T, j Job) []byte {
+	data, err := json.Marshal(j)
+	require.NoError(t, err)
+	return data
+}
@@ -0,0 +1,123 @@
+//go:build unit
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSONLogger(t *testing.T) {
+	t.Run("include request id from context", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := NewJSONLogger(&buf, slog.LevelInfo)
+		ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "some-request-id")
+
+		logger.With(slog.String("report_type", "single")).InfoContext(ctx, "some message", Period(2022, 4))
+
+		record := decodeRecord(t, &buf)
+		require.Equal(t, "some message", record["msg"])
+		require.Equal(t, "some-request-id", record["request_id"])
+		require.Equal(t, "single", record["report_type"])
+		require.Equal(t, "2022-04", record["period"])
+	})
+
+	t.Run("include trace and span ids from context", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := NewJSONLogger(&buf, slog.LevelInfo)
+		traceID, _ := trace.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+		spanID, _ := trace.SpanIDFromHex("0102030405060708")
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceID,
+			SpanID:  spanID,
+		}))
+
+		logger.InfoContext(ctx, "some message")
+
+		record := decodeRecord(t, &buf)
+		require.Equal(t, "0102030405060708090a0b0c0d0e0f10", record["trace_id"])
+		require.Equal(t, "0102030405060708", record["span_id"])
+	})
+
+	t.Run("omit request id when context has none", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := NewJSONLogger(&buf, slog.LevelInfo)
+
+		logger.InfoContext(context.Background(), "some message")
+
+		record := decodeRecord(t, &buf)
+		require.NotContains(t, record, "request_id")
+	})
+
+	t.Run("skip records below configured level", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := NewJSONLogger(&buf, slog.LevelWarn)
+
+		logger.Info("some message")
+
+		require.Empty(t, buf.String())
+	})
+}
+
+func TestParseLevel(t *testing.T) {
+	t.Run("default to info when empty", func(t *testing.T) {
+		level, err := ParseLevel("")
+
+		require.NoError(t, err)
+		require.Equal(t, slog.LevelInfo, level)
+	})
+
+	t.Run("parse level case insensitively", func(t *testing.T) {
+		level, err := ParseLevel("debug")
+
+		require.NoError(t, err)
+		require.Equal(t, slog.LevelDebug, level)
+	})
+
+	t.Run("return error when level is unknown", func(t *testing.T) {
+		_, err := ParseLevel("verbose")
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "log level 'verbose' is invalid")
+	})
+}
+
+func TestRequestLogger(t *testing.T) {
+	t.Run("log request with request id and status", func(t *testing.T) {
+		var buf bytes.Buffer
+		r := chi.NewRouter()
+		r.Use(middleware.RequestID)
+		r.Use(RequestLogger(NewJSONLogger(&buf, slog.LevelInfo)))
+		r.Get("/some-path", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})
+		req, err := http.NewRequest("GET", "/some-path?year=2022", nil)
+		require.NoError(t, err)
+		req.Header.Set(middleware.RequestIDHeader, "some-request-id")
+
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		record := decodeRecord(t, &buf)
+		require.Equal(t, "some-request-id", record["request_id"])
+		require.Equal(t, "GET", record["method"])
+		require.Equal(t, "/some-path", record["path"])
+		require.Equal(t, "year=2022", record["query"])
+		require.Equal(t, float64(http.StatusTeapot), record["status"])
+		require.Contains(t, record, "duration_ms")
+	})
+}
+
+func decodeRecord(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	var record map[string]interface{}
+	require.NoError(t, json.NewDecoder(buf).Decode(&record))
+	return record
+}
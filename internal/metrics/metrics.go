@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+const namespace = "outside_in_go"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route, method and status",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route, method and status",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	aggregateCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "aggregate_cache_lookups_total",
+		Help:      "Number of existing aggregate lookups by report type and result (hit or miss)",
+	}, []string{"report_type", "result"})
+
+	generationSourceFiles = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "generation_source_files",
+		Help:      "Number of source files merged per aggregate generation",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+	}, []string{"report_type"})
+
+	generationRowsMerged = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "generation_rows_merged",
+		Help:      "Number of data rows merged per aggregate generation",
+		Buckets:   prometheus.ExponentialBuckets(10, 4, 10),
+	}, []string{"report_type"})
+
+	generationsInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "generations_in_flight",
+		Help:      "Number of aggregate generations currently running",
+	}, []string{"report_type"})
+
+	s3OperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "s3_operation_duration_seconds",
+		Help:      "Latency of S3 operations by operation",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	s3OperationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "s3_operation_errors_total",
+		Help:      "Number of failed S3 operations by operation",
+	}, []string{"operation"})
+
+	webhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Number of webhook deliveries by result (delivered or dead_lettered)",
+	}, []string{"result"})
+
+	objectCreatedEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "object_created_events_total",
+		Help:      "Number of S3 object created events by result (invalidated, ignored or failed)",
+	}, []string{"result"})
+
+	eventRebuilds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "event_rebuilds_total",
+		Help:      "Number of aggregates rebuilt after object created events by report type and result (succeeded or failed)",
+	}, []string{"report_type", "result"})
+
+	rowsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rows_rejected_total",
+		Help:      "Number of source rows left out of aggregates for not matching their schema by report type and policy (skip or quarantine)",
+	}, []string{"report_type", "policy"})
+
+	filesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "files_failed_total",
+		Help:      "Number of individual files left out of partial aggregates for being unreadable by report type",
+	}, []string{"report_type"})
+)
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+func AggregateCacheHit(reportType string) {
+	aggregateCacheLookups.WithLabelValues(reportType, "hit").Inc()
+}
+
+func AggregateCacheMiss(reportType string) {
+	aggregateCacheLookups.WithLabelValues(reportType, "miss").Inc()
+}
+
+func GenerationMerged(reportType string, files int, rows int) {
+	generationSourceFiles.WithLabelValues(reportType).Observe(float64(files))
+	generationRowsMerged.WithLabelValues(reportType).Observe(float64(rows))
+}
+
+// GenerationStarted marks a generation as in flight. The returned function must be called once the generation finishes
+func GenerationStarted(reportType string) func() {
+	gauge := generationsInFlight.WithLabelValues(reportType)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+func ObserveS3Operation(operation string, start time.Time, err error) {
+	s3OperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		s3OperationErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+func WebhookDelivered(result string) {
+	webhookDeliveries.WithLabelValues(result).Inc()
+}
+
+func ObjectCreatedEvent(result string) {
+	objectCreatedEvents.WithLabelValues(result).Inc()
+}
+
+func EventRebuilt(reportType string, result string) {
+	eventRebuilds.WithLabelValues(reportType, result).Inc()
+}
+
+func RowsRejected(reportType string, policy string, rows int) {
+	rowsRejected.WithLabelValues(reportType, policy).Add(float64(rows))
+}
+
+func FilesFailed(reportType string, files int) {
+	filesFailed.WithLabelValues(reportType).Add(float64(files))
+}
@@ -0,0 +1,70 @@
+//go:build unit
+
+package metrics
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequestMiddleware(t *testing.T) {
+	t.Run("label requests with route pattern and status", func(t *testing.T) {
+		r := chi.NewRouter()
+		r.Use(RequestMiddleware)
+		r.Get("/some/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		})
+		counter := httpRequests.WithLabelValues("/some/{id}", "GET", "202")
+		before := testutil.ToFloat64(counter)
+
+		req, err := http.NewRequest("GET", "/some/123", nil)
+		require.NoError(t, err)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		require.Equal(t, before+1, testutil.ToFloat64(counter))
+	})
+
+	t.Run("label unknown routes as unmatched", func(t *testing.T) {
+		r := chi.NewRouter()
+		r.Use(RequestMiddleware)
+		r.Get("/some", func(w http.ResponseWriter, r *http.Request) {})
+		counter := httpRequests.WithLabelValues(unmatchedRoute, "GET", "404")
+		before := testutil.ToFloat64(counter)
+
+		req, err := http.NewRequest("GET", "/not-found", nil)
+		require.NoError(t, err)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		require.Equal(t, before+1, testutil.ToFloat64(counter))
+	})
+}
+
+func TestObserveS3Operation(t *testing.T) {
+	t.Run("count errors per operation", func(t *testing.T) {
+		counter := s3OperationErrors.WithLabelValues("SomeOperation")
+		before := testutil.ToFloat64(counter)
+
+		ObserveS3Operation("SomeOperation", time.Now(), nil)
+		ObserveS3Operation("SomeOperation", time.Now(), errors.New("some error"))
+
+		require.Equal(t, before+1, testutil.ToFloat64(counter))
+	})
+}
+
+func TestGenerationStarted(t *testing.T) {
+	t.Run("track generation in flight until done", func(t *testing.T) {
+		gauge := generationsInFlight.WithLabelValues("some-type")
+
+		done := GenerationStarted("some-type")
+		require.Equal(t, float64(1), testutil.ToFloat64(gauge))
+
+		done()
+		require.Equal(t, float64(0), testutil.ToFloat64(gauge))
+	})
+}
@@ -0,0 +1,244 @@
+package period
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/logging"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+var tracer = otel.Tracer("github.com/hpcsc/outside-in-go/internal/period")
+
+var (
+	ErrInvalidTransition = errors.New("invalid period transition")
+	// ErrIncomplete is returned when closing a period whose aggregates leave out individual files that could not be read
+	ErrIncomplete = errors.New("period has individual files left out of its aggregates")
+	// ErrChanged is returned when individual files of a period change while it is being closed, which leaves it open
+	ErrChanged = errors.New("period changed while closing")
+)
+
+type Options struct {
+	// Retention is how long S3 Object Lock protects the aggregates of a locked period
+	Retention     time.Duration
+	RetentionMode storer.RetentionMode
+}
+
+type Period struct {
+	Year   int                 `json:"year"`
+	Month  int                 `json:"month"`
+	Status storer.PeriodStatus `json:"status"`
+	// RetainedUntil is set by Lock when S3 Object Lock retains aggregates of the period
+	RetainedUntil *time.Time `json:"retained_until,omitempty"`
+}
+
+// Manager moves periods through their lifecycle: open periods accept uploads and rebuilds, closed periods keep their
+// aggregates as signed off until reopened, and locked periods keep them for good
+type Manager interface {
+	Get(ctx context.Context, year int, month int) (Period, error)
+	// Close builds any missing aggregate of an open period, then closes it.
+	// It returns ErrIncomplete when an aggregate leaves out individual files, since a partial aggregate may not even be stored,
+	// and ErrChanged when individual files are uploaded while closing, in which case the period is left open
+	Close(ctx context.Context, year int, month int) (Period, error)
+	// Reopen opens a closed period again. Locked periods cannot be reopened
+	Reopen(ctx context.Context, year int, month int) (Period, error)
+	// Lock retains the aggregates of a closed period with S3 Object Lock where the bucket supports it, then locks the period.
+	// The returned period has no RetainedUntil when the bucket does not support it or there is no aggregate to retain
+	Lock(ctx context.Context, year int, month int) (Period, error)
+}
+
+var _ Manager = &manager{}
+
+type manager struct {
+	generator report.Generator
+	storer    storer.Storer
+	options   Options
+	now       func() time.Time
+}
+
+func NewManager(generator report.Generator, storer storer.Storer, options Options) Manager {
+	return &manager{
+		generator: generator,
+		storer:    storer,
+		options:   options,
+		now:       time.Now,
+	}
+}
+
+func (m *manager) Get(ctx context.Context, year int, month int) (Period, error) {
+	status, err := m.storer.RetrievePeriodStatus(ctx, year, month)
+	if err != nil {
+		return Period{}, err
+	}
+
+	return Period{Year: year, Month: month, Status: status}, nil
+}
+
+func (m *manager) Close(ctx context.Context, year int, month int) (_ Period, err error) {
+	ctx, span := startSpan(ctx, "manager.Close", year, month)
+	defer func() { tracing.End(span, err) }()
+
+	if err := m.transition(ctx, year, month, storer.OpenPeriodStatus, storer.ClosedPeriodStatus); err != nil {
+		return Period{}, err
+	}
+
+	// uploads check that the period is open before storing a file, so one may still land while closing.
+	// The files are listed before building and again once closed, and the period is reopened when they differ
+	before, err := m.individualFiles(ctx, year, month)
+	if err != nil {
+		return Period{}, err
+	}
+
+	// build before closing, since aggregates of a closed period can no longer be built
+	for _, reportType := range storer.ReportTypes {
+		_, err := m.generator.Generate(ctx, reportType, year, month)
+		if errors.Is(err, report.ErrNoData) {
+			continue
+		}
+		if err != nil {
+			return Period{}, fmt.Errorf("failed to build %s aggregate before closing: %v", reportType, err)
+		}
+
+		failures, err := m.storer.RetrieveFailures(ctx, reportType, year, month)
+		if err != nil {
+			return Period{}, fmt.Errorf("failed to check %s aggregate before closing: %v", reportType, err)
+		}
+
+		if len(failures) > 0 {
+			return Period{}, fmt.Errorf("%w: %s aggregate of %02d/%d leaves out %d individual files", ErrIncomplete, reportType, month, year, len(failures))
+		}
+	}
+
+	closed, err := m.store(ctx, year, month, storer.ClosedPeriodStatus)
+	if err != nil {
+		return Period{}, err
+	}
+
+	after, err := m.individualFiles(ctx, year, month)
+	if err == nil && sameFiles(before, after) {
+		return closed, nil
+	}
+
+	// the aggregates may leave out a file accepted while closing, so they cannot be signed off
+	if _, reopenErr := m.store(context.WithoutCancel(ctx), year, month, storer.OpenPeriodStatus); reopenErr != nil {
+		return Period{}, fmt.Errorf("failed to reopen %02d/%d after its individual files changed while closing: %v", month, year, reopenErr)
+	}
+
+	if err != nil {
+		return Period{}, fmt.Errorf("failed to check individual files after closing: %v", err)
+	}
+
+	return Period{}, fmt.Errorf("%w: individual files of %02d/%d were uploaded while closing, try again", ErrChanged, month, year)
+}
+
+func (m *manager) Reopen(ctx context.Context, year int, month int) (_ Period, err error) {
+	ctx, span := startSpan(ctx, "manager.Reopen", year, month)
+	defer func() { tracing.End(span, err) }()
+
+	if err := m.transition(ctx, year, month, storer.ClosedPeriodStatus, storer.OpenPeriodStatus); err != nil {
+		return Period{}, err
+	}
+
+	return m.store(ctx, year, month, storer.OpenPeriodStatus)
+}
+
+func (m *manager) Lock(ctx context.Context, year int, month int) (_ Period, err error) {
+	ctx, span := startSpan(ctx, "manager.Lock", year, month)
+	defer func() { tracing.End(span, err) }()
+
+	if err := m.transition(ctx, year, month, storer.ClosedPeriodStatus, storer.LockedPeriodStatus); err != nil {
+		return Period{}, err
+	}
+
+	until := m.now().Add(m.options.Retention)
+	retained := false
+	for _, reportType := range storer.ReportTypes {
+		logger := slog.Default().With(slog.String("report_type", string(reportType)), logging.Period(year, month))
+
+		ok, err := m.storer.RetainAggregated(ctx, reportType, year, month, m.options.RetentionMode, until)
+		if errors.Is(err, storer.ErrObjectLockUnavailable) {
+			// object lock is a property of the bucket, so none of the aggregates can be retained.
+			// The period status alone still keeps this service from changing them
+			logger.WarnContext(ctx, "locking period without object lock retention", slog.String("error", err.Error()))
+			break
+		}
+		if err != nil {
+			return Period{}, err
+		}
+
+		if !ok {
+			logger.InfoContext(ctx, "no aggregate to retain")
+			continue
+		}
+		retained = true
+	}
+
+	span.SetAttributes(attribute.Bool("period.retained", retained))
+	locked, err := m.store(ctx, year, month, storer.LockedPeriodStatus)
+	if err != nil {
+		return Period{}, err
+	}
+
+	if retained {
+		locked.RetainedUntil = &until
+	}
+
+	return locked, nil
+}
+
+// individualFiles lists the individual files of every report type of a period
+func (m *manager) individualFiles(ctx context.Context, year int, month int) ([]storer.IndividualFile, error) {
+	var files []storer.IndividualFile
+	for _, reportType := range storer.ReportTypes {
+		listed, err := m.storer.ListIndividualFiles(ctx, reportType, year, month)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, listed...)
+	}
+
+	return files, nil
+}
+
+func sameFiles(a []storer.IndividualFile, b []storer.IndividualFile) bool {
+	return slices.EqualFunc(a, b, func(x storer.IndividualFile, y storer.IndividualFile) bool {
+		return x.Key == y.Key && x.Size == y.Size && x.LastModified.Equal(y.LastModified)
+	})
+}
+
+// transition returns ErrInvalidTransition unless the period currently has the from status
+func (m *manager) transition(ctx context.Context, year int, month int, from storer.PeriodStatus, to storer.PeriodStatus) error {
+	status, err := m.storer.RetrievePeriodStatus(ctx, year, month)
+	if err != nil {
+		return err
+	}
+
+	if status != from {
+		return fmt.Errorf("%w: %02d/%d is %s, only a %s period can become %s", ErrInvalidTransition, month, year, status, from, to)
+	}
+
+	return nil
+}
+
+func (m *manager) store(ctx context.Context, year int, month int, status storer.PeriodStatus) (Period, error) {
+	if err := m.storer.StorePeriodStatus(ctx, year, month, status); err != nil {
+		return Period{}, err
+	}
+
+	return Period{Year: year, Month: month, Status: status}, nil
+}
+
+func startSpan(ctx context.Context, name string, year int, month int) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.Int("report.year", year),
+		attribute.Int("report.month", month),
+	))
+}
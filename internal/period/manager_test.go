@@ -0,0 +1,173 @@
+//go:build unit
+
+package period
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestManager(t *testing.T) {
+	now := time.Date(2022, 5, 10, 9, 0, 0, 0, time.UTC)
+
+	t.Run("build missing aggregates before closing open period", func(t *testing.T) {
+		mockGenerator := report.NewMockGenerator()
+		mockGenerator.On("Generate", mock.Anything, storer.SingleReportType, 2022, 4).Return([]byte("some,data"), nil)
+		mockGenerator.On("Generate", mock.Anything, storer.CumulativeReportType, 2022, 4).Return(nil, fmt.Errorf("%w for 04/2022", report.ErrNoData))
+		mockStorer := storer.NewMock()
+		mockStorer.StubRetrieveFailures(storer.SingleReportType, 2022, 4).Return([]storer.FileFailure{}, nil)
+		mockStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.OpenPeriodStatus, nil)
+		mockStorer.StubListIndividualFiles(storer.SingleReportType, 2022, 4).Return([]storer.IndividualFile{{Key: "2022/04/single/cluster-1.csv"}}, nil)
+		mockStorer.StubListIndividualFiles(storer.CumulativeReportType, 2022, 4).Return([]storer.IndividualFile{}, nil)
+		mockStorer.StubStorePeriodStatus(2022, 4, storer.ClosedPeriodStatus).Return(nil)
+		m := newTestManager(mockGenerator, mockStorer, now)
+
+		p, err := m.Close(context.Background(), 2022, 4)
+
+		require.NoError(t, err)
+		require.Equal(t, Period{Year: 2022, Month: 4, Status: storer.ClosedPeriodStatus}, p)
+		mockGenerator.AssertNumberOfCalls(t, "Generate", 2)
+		mockStorer.AssertExpectations(t)
+	})
+
+	t.Run("reopen period when individual files are uploaded while closing", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Generate", mock.Anything, mock.Anything, 2022, 4).Return([]byte("some,data"), nil)
+		mockStorer := storer.NewMock()
+		mockStorer.StubRetrieveFailures(mock.Anything, 2022, 4).Return([]storer.FileFailure{}, nil)
+		mockStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.OpenPeriodStatus, nil)
+		mockStorer.StubListIndividualFiles(storer.SingleReportType, 2022, 4).Return([]storer.IndividualFile{{Key: "2022/04/single/cluster-1.csv"}}, nil).Once()
+		mockStorer.StubListIndividualFiles(storer.SingleReportType, 2022, 4).Return([]storer.IndividualFile{{Key: "2022/04/single/cluster-1.csv"}, {Key: "2022/04/single/cluster-2.csv"}}, nil)
+		mockStorer.StubListIndividualFiles(storer.CumulativeReportType, 2022, 4).Return([]storer.IndividualFile{}, nil)
+		mockStorer.StubStorePeriodStatus(2022, 4, storer.ClosedPeriodStatus).Return(nil)
+		mockStorer.StubStorePeriodStatus(2022, 4, storer.OpenPeriodStatus).Return(nil)
+		m := newTestManager(stubGenerator, mockStorer, now)
+
+		_, err := m.Close(context.Background(), 2022, 4)
+
+		require.ErrorIs(t, err, ErrChanged)
+		mockStorer.AssertExpectations(t)
+	})
+
+	t.Run("keep period open when an aggregate cannot be built", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Generate", mock.Anything, storer.SingleReportType, 2022, 4).Return(nil, errors.New("some error"))
+		mockStorer := storer.NewMock()
+		mockStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.OpenPeriodStatus, nil)
+		mockStorer.StubListIndividualFiles(mock.Anything, 2022, 4).Return([]storer.IndividualFile{}, nil)
+		m := newTestManager(stubGenerator, mockStorer, now)
+
+		_, err := m.Close(context.Background(), 2022, 4)
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to build single aggregate before closing: some error")
+		mockStorer.AssertStorePeriodStatusNotCalled(t)
+	})
+
+	t.Run("keep period open when an aggregate leaves out individual files", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Generate", mock.Anything, storer.SingleReportType, 2022, 4).Return([]byte("some,data"), nil)
+		mockStorer := storer.NewMock()
+		mockStorer.StubRetrieveFailures(storer.SingleReportType, 2022, 4).Return([]storer.FileFailure{{Key: "2022/04/single/cluster-2.csv", Error: "some error"}}, nil)
+		mockStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.OpenPeriodStatus, nil)
+		mockStorer.StubListIndividualFiles(mock.Anything, 2022, 4).Return([]storer.IndividualFile{}, nil)
+		m := newTestManager(stubGenerator, mockStorer, now)
+
+		_, err := m.Close(context.Background(), 2022, 4)
+
+		require.ErrorIs(t, err, ErrIncomplete)
+		require.Contains(t, err.Error(), "single aggregate of 04/2022 leaves out 1 individual files")
+		mockStorer.AssertStorePeriodStatusNotCalled(t)
+	})
+
+	t.Run("reopen closed period", func(t *testing.T) {
+		mockStorer := storer.NewMock()
+		mockStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.ClosedPeriodStatus, nil)
+		mockStorer.StubStorePeriodStatus(2022, 4, storer.OpenPeriodStatus).Return(nil)
+		m := newTestManager(report.NewMockGenerator(), mockStorer, now)
+
+		p, err := m.Reopen(context.Background(), 2022, 4)
+
+		require.NoError(t, err)
+		require.Equal(t, storer.OpenPeriodStatus, p.Status)
+		mockStorer.AssertExpectations(t)
+	})
+
+	t.Run("refuse to reopen locked period", func(t *testing.T) {
+		mockStorer := storer.NewMock()
+		mockStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.LockedPeriodStatus, nil)
+		m := newTestManager(report.NewMockGenerator(), mockStorer, now)
+
+		_, err := m.Reopen(context.Background(), 2022, 4)
+
+		require.ErrorIs(t, err, ErrInvalidTransition)
+		require.Contains(t, err.Error(), "04/2022 is locked, only a closed period can become open")
+		mockStorer.AssertStorePeriodStatusNotCalled(t)
+	})
+
+	t.Run("retain aggregates until end of retention when locking closed period", func(t *testing.T) {
+		mockStorer := storer.NewMock()
+		mockStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.ClosedPeriodStatus, nil)
+		mockStorer.StubRetainAggregated(storer.SingleReportType, 2022, 4).Return(true, nil)
+		mockStorer.StubRetainAggregated(storer.CumulativeReportType, 2022, 4).Return(false, nil)
+		mockStorer.StubStorePeriodStatus(2022, 4, storer.LockedPeriodStatus).Return(nil)
+		m := newTestManager(report.NewMockGenerator(), mockStorer, now)
+
+		p, err := m.Lock(context.Background(), 2022, 4)
+
+		require.NoError(t, err)
+		require.Equal(t, storer.LockedPeriodStatus, p.Status)
+		require.Equal(t, now.Add(24*time.Hour), *p.RetainedUntil)
+		mockStorer.AssertCalled(t, "RetainAggregated", mock.Anything, storer.SingleReportType, 2022, 4, storer.ComplianceRetentionMode, now.Add(24*time.Hour))
+		mockStorer.AssertExpectations(t)
+	})
+
+	t.Run("lock period when bucket does not support object lock", func(t *testing.T) {
+		mockStorer := storer.NewMock()
+		mockStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.ClosedPeriodStatus, nil)
+		mockStorer.StubRetainAggregated(storer.SingleReportType, 2022, 4).Return(false, storer.ErrObjectLockUnavailable)
+		mockStorer.StubStorePeriodStatus(2022, 4, storer.LockedPeriodStatus).Return(nil)
+		m := newTestManager(report.NewMockGenerator(), mockStorer, now)
+
+		p, err := m.Lock(context.Background(), 2022, 4)
+
+		require.NoError(t, err)
+		require.Nil(t, p.RetainedUntil)
+		mockStorer.AssertExpectations(t)
+	})
+
+	t.Run("keep period closed when retention fails", func(t *testing.T) {
+		mockStorer := storer.NewMock()
+		mockStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.ClosedPeriodStatus, nil)
+		mockStorer.StubRetainAggregated(storer.SingleReportType, 2022, 4).Return(false, errors.New("some error"))
+		m := newTestManager(report.NewMockGenerator(), mockStorer, now)
+
+		_, err := m.Lock(context.Background(), 2022, 4)
+
+		require.Error(t, err)
+		mockStorer.AssertStorePeriodStatusNotCalled(t)
+	})
+
+	t.Run("refuse to lock open period", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.OpenPeriodStatus, nil)
+		m := newTestManager(report.NewMockGenerator(), stubStorer, now)
+
+		_, err := m.Lock(context.Background(), 2022, 4)
+
+		require.ErrorIs(t, err, ErrInvalidTransition)
+	})
+}
+
+func newTestManager(generator report.Generator, s storer.Storer, now time.Time) *manager {
+	m := NewManager(generator, s, Options{Retention: 24 * time.Hour, RetentionMode: storer.ComplianceRetentionMode}).(*manager)
+	m.now = func() time.Time { return now }
+	return m
+}
@@ -0,0 +1,52 @@
+package period
+
+import (
+	"context"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ Manager = &mockManager{}
+
+type mockManager struct {
+	mock.Mock
+}
+
+func NewMockManager() *mockManager {
+	return &mockManager{}
+}
+
+func (m *mockManager) Get(ctx context.Context, year int, month int) (Period, error) {
+	args := m.Called(ctx, year, month)
+	return args.Get(0).(Period), args.Error(1)
+}
+
+func (m *mockManager) StubGet(year interface{}, month interface{}) *mock.Call {
+	return m.On("Get", mock.Anything, year, month)
+}
+
+func (m *mockManager) Close(ctx context.Context, year int, month int) (Period, error) {
+	args := m.Called(ctx, year, month)
+	return args.Get(0).(Period), args.Error(1)
+}
+
+func (m *mockManager) StubClose(year interface{}, month interface{}) *mock.Call {
+	return m.On("Close", mock.Anything, year, month)
+}
+
+func (m *mockManager) Reopen(ctx context.Context, year int, month int) (Period, error) {
+	args := m.Called(ctx, year, month)
+	return args.Get(0).(Period), args.Error(1)
+}
+
+func (m *mockManager) StubReopen(year interface{}, month interface{}) *mock.Call {
+	return m.On("Reopen", mock.Anything, year, month)
+}
+
+func (m *mockManager) Lock(ctx context.Context, year int, month int) (Period, error) {
+	args := m.Called(ctx, year, month)
+	return args.Get(0).(Period), args.Error(1)
+}
+
+func (m *mockManager) StubLock(year interface{}, month interface{}) *mock.Call {
+	return m.On("Lock", mock.Anything, year, month)
+}
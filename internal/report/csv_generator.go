@@ -2,74 +2,678 @@ package report
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/ingest"
+	"github.com/hpcsc/outside-in-go/internal/logging"
+	"github.com/hpcsc/outside-in-go/internal/metrics"
+	"github.com/hpcsc/outside-in-go/internal/schema"
 	"github.com/hpcsc/outside-in-go/internal/storer"
-	"log"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
+	"time"
 )
 
 var _ Generator = &csvGenerator{}
 
-func NewCsvGenerator(storer storer.Storer) Generator {
-	return &csvGenerator{
+var ErrNoData = errors.New("no data available")
+
+var ErrVersionNotFound = errors.New("aggregate version not found")
+
+var (
+	ErrInvalidRows = errors.New("source rows do not match schema")
+	ErrNoSchema    = errors.New("no schema configured")
+)
+
+// versionIDFormat sorts lexically in creation order
+const versionIDFormat = "20060102T150405.000000000Z"
+
+var tracer = otel.Tracer("github.com/hpcsc/outside-in-go/internal/report")
+
+func NewCsvGenerator(storer storer.Storer, opts ...GeneratorOption) Generator {
+	g := &csvGenerator{
 		storer: storer,
+		now:    time.Now,
+		policy: schema.FailPolicy,
+	}
+	for _, opt := range opts {
+		opt(g)
 	}
+
+	return g
 }
 
 type csvGenerator struct {
-	storer storer.Storer
+	storer    storer.Storer
+	listeners []AggregateListener
+	now       func() time.Time
+	schemas   map[storer.ReportType]*schema.Validator
+	policy    schema.Policy
+	// dedup is nil when duplicate rows are kept
+	dedup     *Deduplication
+	sorting   Sorting
+	ingestion ingest.Options
+	// bestEffort leaves unreadable files out instead of failing, and storePartial caches the resulting partial aggregates
+	bestEffort   bool
+	storePartial bool
+	// quarantine moves the files left out of best-effort builds aside so that they are not read again until released
+	quarantine bool
+	quality    QualityOptions
+}
+
+func (g *csvGenerator) GenerateSingle(ctx context.Context, year int, month int) ([]byte, error) {
+	data, _, err := g.generate(ctx, storer.SingleReportType, year, month, true)
+	return data, err
 }
 
-func (g *csvGenerator) GenerateSingle(year int, month int) ([]byte, error) {
-	return g.generate(storer.SingleReportType, year, month)
+func (g *csvGenerator) GenerateCumulative(ctx context.Context, year int, month int) ([]byte, error) {
+	data, _, err := g.generate(ctx, storer.CumulativeReportType, year, month, true)
+	return data, err
 }
 
-func (g *csvGenerator) GenerateCumulative(year int, month int) ([]byte, error) {
-	return g.generate(storer.CumulativeReportType, year, month)
+func (g *csvGenerator) Generate(ctx context.Context, reportType storer.ReportType, year int, month int) ([]byte, error) {
+	data, _, err := g.generate(ctx, reportType, year, month, true)
+	return data, err
 }
 
-func (g *csvGenerator) generate(reportType storer.ReportType, year int, month int) ([]byte, error) {
-	existingAggregated, err := g.storer.RetrieveAggregated(reportType, year, month)
+func (g *csvGenerator) Regenerate(ctx context.Context, reportType storer.ReportType, year int, month int) ([]byte, error) {
+	data, _, err := g.generate(ctx, reportType, year, month, false)
+	return data, err
+}
+
+func (g *csvGenerator) generate(ctx context.Context, reportType storer.ReportType, year int, month int, useExisting bool) (_ []byte, _ bool, err error) {
+	ctx, span := tracer.Start(ctx, "csvGenerator.generate", trace.WithAttributes(
+		attribute.String("report.type", string(reportType)),
+		attribute.Int("report.year", year),
+		attribute.Int("report.month", month),
+		attribute.Bool("report.regenerate", !useExisting),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	observer := ObserverFrom(ctx)
+	defer func() {
+		if err != nil {
+			observer.Observe(Event{Type: FailedEvent, Error: err.Error()})
+			return
+		}
+		observer.Observe(Event{Type: CompletedEvent})
+	}()
+
+	logger := slog.Default().With(
+		slog.String("report_type", string(reportType)),
+		logging.Period(year, month),
+	)
+	start := time.Now()
+
+	if useExisting {
+		existingAggregated, err := g.storer.RetrieveAggregated(ctx, reportType, year, month)
+		if err != nil {
+			logger.WarnContext(ctx, "failed to retrieve existing aggregate", slog.String("error", err.Error()))
+			// continue with aggregate logic
+		} else if existingAggregated != nil {
+			span.SetAttributes(attribute.Bool("report.cache_hit", true))
+			metrics.AggregateCacheHit(string(reportType))
+			logger.InfoContext(ctx, "returning existing aggregate", logging.Duration(start))
+			return existingAggregated, false, nil
+		}
+
+		span.SetAttributes(attribute.Bool("report.cache_hit", false))
+		metrics.AggregateCacheMiss(string(reportType))
+	}
+
+	// a closed or locked period keeps its aggregate as signed off, so it is never rebuilt
+	status, err := g.storer.RetrievePeriodStatus(ctx, year, month)
 	if err != nil {
-		log.Printf("failed to retrieved existing aggregate: %v", err)
-		// continue with aggregate logic
-	} else if existingAggregated != nil {
-		return existingAggregated, nil
+		return nil, false, err
 	}
 
-	files, err := g.storer.RetrieveIndividualFiles(reportType, year, month)
+	if err := storer.EnsureOpen(status, year, month); err != nil {
+		return nil, false, err
+	}
+
+	defer metrics.GenerationStarted(string(reportType))()
+
+	files, sources, err := g.retrieveIndividualFiles(ctx, reportType, year, month)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var buf bytes.Buffer
+	m, err := g.merge(ctx, reportType, files, sources, &buf)
+	if err != nil {
+		return nil, false, err
+	}
+	aggregated, rows := buf.Bytes(), m.rows
+
+	observer.Observe(Event{Type: RowsMergedEvent, Rows: rows})
+	metrics.GenerationMerged(string(reportType), len(files), rows)
+	span.SetAttributes(
+		attribute.Int("report.files", len(files)),
+		attribute.Int("report.rows", rows),
+		attribute.Int("report.duplicates", m.duplicates),
+		attribute.Int("report.failures", len(m.failures)),
+	)
+
+	// files quarantined by earlier builds are no longer among the individual files, but the aggregate still leaves them out until they are released.
+	// They are listed before the failures of this build are quarantined so that those are not counted twice
+	if g.quarantine {
+		quarantined, err := g.quarantinedFailures(ctx, reportType, year, month)
+		if err != nil {
+			return nil, false, err
+		}
+
+		g.quarantineFailures(context.WithoutCancel(ctx), m.failures)
+		m.failures = append(m.failures, quarantined...)
+	}
+
+	// the failures of every best-effort build replace those of the previous one, so that a complete build clears them
+	if g.bestEffort {
+		if err := g.storer.StoreFailures(context.WithoutCancel(ctx), reportType, year, month, m.failures); err != nil {
+			return nil, false, err
+		}
+	}
+
+	partial := len(m.failures) > 0
+	if partial && !g.storePartial {
+		logger.WarnContext(ctx, "generated partial aggregate without storing it",
+			slog.Int("files", len(files)),
+			slog.Int("failures", len(m.failures)),
+			slog.Int("rows", rows),
+			logging.Duration(start),
+		)
+		return aggregated, true, nil
+	}
+
+	checksum := fmt.Sprintf("%x", sha256.Sum256(aggregated))
+	createdAt := g.now().UTC()
+	version := storer.AggregateVersion{
+		ID:         createdAt.Format(versionIDFormat),
+		CreatedAt:  createdAt,
+		Rows:       rows,
+		Duplicates: m.duplicates,
+		Checksum:   checksum,
+		Sources:    sources,
+		Failures:   m.failures,
+	}
+
+	// the aggregate is complete at this point, so storing it should not be abandoned because the caller went away.
+	// Rejected rows and the version are stored first so that the current aggregate is always accounted for
+	if g.policy == schema.QuarantinePolicy && g.schemas[reportType] != nil {
+		if err := g.storeRejectedRows(context.WithoutCancel(ctx), reportType, year, month, m.header, m.rejected); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := g.storer.StoreAggregateVersion(context.WithoutCancel(ctx), reportType, year, month, version, aggregated); err != nil {
+		return nil, false, err
+	}
+
+	if err := g.storer.StoreAggregated(context.WithoutCancel(ctx), reportType, year, month, aggregated); err != nil {
+		return nil, false, err
+	}
+
+	observer.Observe(Event{Type: AggregateStoredEvent})
+
+	stored := Aggregate{
+		ReportType: reportType,
+		Year:       year,
+		Month:      month,
+		Key:        g.storer.AggregateKey(reportType, year, month),
+		Rows:       rows,
+		Checksum:   checksum,
+	}
+	for _, l := range g.listeners {
+		l.AggregateStored(context.WithoutCancel(ctx), stored)
+	}
+
+	logger.InfoContext(ctx, "generated aggregate",
+		slog.Int("files", len(files)),
+		slog.Int("rows", rows),
+		slog.Int("duplicates", m.duplicates),
+		slog.Int("failures", len(m.failures)),
+		logging.Duration(start),
+	)
+
+	return aggregated, partial, nil
+}
+
+// quarantineFailures moves every failed file to quarantine. A file that cannot be moved is left to fail again on the next build, so errors are only logged
+func (g *csvGenerator) quarantineFailures(ctx context.Context, failures []storer.FileFailure) {
+	for _, f := range failures {
+		reason := f.Error
+		if f.Line > 0 {
+			reason = fmt.Sprintf("line %d: %s", f.Line, f.Error)
+		}
+
+		if _, err := g.storer.QuarantineIndividualFile(ctx, f.Key, reason); err != nil {
+			slog.WarnContext(ctx, "failed to quarantine individual file", slog.String("key", f.Key), slog.String("error", err.Error()))
+		}
+	}
+}
+
+// quarantinedFailures describes the files of a period still in quarantine as failures of the build, reporting each to the observer in ctx
+func (g *csvGenerator) quarantinedFailures(ctx context.Context, reportType storer.ReportType, year int, month int) ([]storer.FileFailure, error) {
+	observer := ObserverFrom(ctx)
+
+	quarantined, err := g.storer.ListQuarantinedFiles(ctx, reportType, year, month)
 	if err != nil {
 		return nil, err
 	}
 
+	failures := make([]storer.FileFailure, 0, len(quarantined))
+	for _, f := range quarantined {
+		failure := storer.FileFailure{Key: f.OriginalKey, Error: fmt.Sprintf("quarantined: %s", f.Reason)}
+		failures = append(failures, failure)
+		observer.Observe(Event{Type: FileFailedEvent, Key: failure.Key, Error: failure.Error})
+	}
+
+	return failures, nil
+}
+
+// storeRejectedRows keeps the quarantined rows of a build under the header of the aggregate, replacing those of the previous build
+func (g *csvGenerator) storeRejectedRows(ctx context.Context, reportType storer.ReportType, year int, month int, header []string, rejected []rejectedRow) error {
+	data, err := writeRejectedRows(header, rejected)
+	if err != nil {
+		return err
+	}
+
+	return g.storer.StoreRejectedRows(ctx, reportType, year, month, data)
+}
+
+// retrieveIndividualFiles reads the content of every individual file of the period along with the files it was read from, reporting progress to the observer in ctx
+func (g *csvGenerator) retrieveIndividualFiles(ctx context.Context, reportType storer.ReportType, year int, month int) ([][]byte, []storer.IndividualFile, error) {
+	observer := ObserverFrom(ctx)
+
+	listed, err := g.storer.ListIndividualFiles(ctx, reportType, year, month)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(listed) == 0 {
+		return nil, nil, fmt.Errorf("%w for %02d/%d", ErrNoData, month, year)
+	}
+
+	observer.Observe(Event{Type: FilesListedEvent, Total: len(listed)})
+
+	files := make([][]byte, 0, len(listed))
+	sources := make([]storer.IndividualFile, 0, len(listed))
+	for i, f := range listed {
+		content, err := g.storer.RetrieveIndividualFile(ctx, f.Key)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// a file removed between listing and retrieval is treated as not being part of the period
+		if content != nil {
+			files = append(files, content)
+			sources = append(sources, f)
+		}
+
+		observer.Observe(Event{Type: FileFetchedEvent, Key: f.Key, Processed: i + 1, Total: len(listed)})
+	}
+
 	if len(files) == 0 {
-		return nil, fmt.Errorf("no data available for %02d/%d", month, year)
+		return nil, nil, fmt.Errorf("%w for %02d/%d", ErrNoData, month, year)
 	}
 
-	var aggregatedLines [][]string
+	return files, sources, nil
+}
+
+// merged is the outcome of merging the individual files of a period
+type merged struct {
+	header []string
+	// rows is the number of data rows written
+	rows     int
+	rejected []rejectedRow
+	// duplicates is the number of rows dropped by deduplication
+	duplicates int
+	// failures are the files left out in best-effort mode
+	failures []storer.FileFailure
+}
+
+// merge concatenates the rows of all files under the header of the first one and writes them to dst.
+// Rows failing the schema of the report type are handled by the schema policy, and come back when they are to be quarantined.
+// Duplicate rows are dropped when deduplication is configured, and the remaining rows are sorted when the report type has sort keys.
+// Files are read again for every pass rather than holding their rows, so rows go one at a time to dst or to the sorter, which spills them to temporary files
+func (g *csvGenerator) merge(ctx context.Context, reportType storer.ReportType, files [][]byte, sources []storer.IndividualFile, dst io.Writer) (_ merged, err error) {
+	ctx, span := tracer.Start(ctx, "csvGenerator.merge")
+	defer func() { tracing.End(span, err) }()
+
+	observer := ObserverFrom(ctx)
+	validator := g.schemas[reportType]
+	ranks := rankSources(sources)
+
+	// the first pass finds the files that can be read, so that no row of a file left out reaches dst
+	var header []string
+	var readable []int
+	var rejected []rejectedRow
+	var failures []storer.FileFailure
+	var firstErr error
+	skipped := 0
+	ragged := 0
 	for i, f := range files {
-		reader := csv.NewReader(bytes.NewReader(f))
-		lines, err := reader.ReadAll()
+		read, err := g.readFile(sources[i].Key, f, validator, nil)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read one or more csv files: %v", err)
+			if !g.bestEffort {
+				return merged{}, fmt.Errorf("failed to read one or more csv files: %w", err)
+			}
+
+			failure := fileFailure(sources[i].Key, err)
+			failures = append(failures, failure)
+			if firstErr == nil {
+				firstErr = err
+			}
+			observer.Observe(Event{Type: FileFailedEvent, Key: failure.Key, Line: failure.Line, Error: failure.Error})
+			observer.Observe(Event{Type: FileParsedEvent, Processed: i + 1, Total: len(files)})
+			continue
 		}
 
-		if i == 0 {
-			aggregatedLines = append(aggregatedLines, lines[0])
+		if header == nil {
+			header = read.header
 		}
+		readable = append(readable, i)
+		rejected = append(rejected, read.rejected...)
+		skipped += read.skipped
+		ragged += read.ragged
+		observer.Observe(Event{Type: FileParsedEvent, Processed: i + 1, Total: len(files)})
+	}
 
-		aggregatedLines = append(aggregatedLines, lines[1:]...)
+	if len(failures) == len(files) {
+		return merged{}, fmt.Errorf("failed to read one or more csv files: %w", firstErr)
 	}
 
-	var aggregated bytes.Buffer
-	writer := csv.NewWriter(&aggregated)
-	if err = writer.WriteAll(aggregatedLines); err != nil {
-		return nil, fmt.Errorf("failed to write csv content to buffer: %v", err)
+	if len(failures) > 0 {
+		metrics.FilesFailed(string(reportType), len(failures))
+		slog.WarnContext(ctx, "left unreadable files out of partial aggregate",
+			slog.String("report_type", string(reportType)),
+			slog.Int("files", len(failures)),
+		)
 	}
 
-	if err := g.storer.StoreAggregated(reportType, year, month, aggregated.Bytes()); err != nil {
+	if ragged > 0 {
+		slog.WarnContext(ctx, "left rows with wrong number of fields out of aggregate",
+			slog.String("report_type", string(reportType)),
+			slog.Int("rows", ragged),
+		)
+	}
+
+	if skipped+len(rejected) > 0 {
+		metrics.RowsRejected(string(reportType), string(g.policy), skipped+len(rejected))
+		slog.WarnContext(ctx, "left rows not matching schema out of aggregate",
+			slog.String("report_type", string(reportType)),
+			slog.String("policy", string(g.policy)),
+			slog.Int("rows", skipped+len(rejected)),
+		)
+	}
+
+	var dedup *deduplicator
+	if g.dedup != nil {
+		dedup, err = g.dedup.newDeduplicator(reportType, header)
+		if err != nil {
+			return merged{}, err
+		}
+
+		row := 0
+		for _, i := range readable {
+			if _, err = g.readFile(sources[i].Key, files[i], validator, func(record []string) error {
+				dedup.observe(record, row, ranks[i])
+				row++
+				return nil
+			}); err != nil {
+				return merged{}, err
+			}
+		}
+	}
+
+	sorter, err := g.sorting.newSorter(reportType, header)
+	if err != nil {
+		return merged{}, err
+	}
+
+	if sorter != nil {
+		defer sorter.close()
+	}
+
+	writer := csv.NewWriter(dst)
+	if err = writer.Write(header); err != nil {
+		return merged{}, fmt.Errorf("failed to write csv content to buffer: %v", err)
+	}
+
+	row := 0
+	rows := 0
+	for _, i := range readable {
+		if _, err = g.readFile(sources[i].Key, files[i], validator, func(record []string) error {
+			row++
+			if dedup != nil && !dedup.keeps(record, row-1) {
+				return nil
+			}
+
+			rows++
+			if sorter != nil {
+				return sorter.add(record)
+			}
+
+			if err := writer.Write(record); err != nil {
+				return fmt.Errorf("failed to write csv content to buffer: %v", err)
+			}
+			return nil
+		}); err != nil {
+			return merged{}, err
+		}
+	}
+
+	if sorter != nil {
+		if err = sorter.writeTo(writer); err != nil {
+			return merged{}, err
+		}
+	}
+
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		return merged{}, fmt.Errorf("failed to write csv content to buffer: %v", err)
+	}
+
+	duplicates := row - rows
+	if duplicates > 0 {
+		slog.InfoContext(ctx, "dropped duplicate rows from aggregate",
+			slog.String("report_type", string(reportType)),
+			slog.String("keep", string(g.dedup.Keep)),
+			slog.Int("rows", duplicates),
+		)
+	}
+
+	return merged{header: header, rows: rows, rejected: rejected, duplicates: duplicates, failures: failures}, nil
+}
+
+// fileRows describes the rows read from one individual file
+type fileRows struct {
+	header   []string
+	rejected []rejectedRow
+	// skipped counts the rows left out by the skip schema policy
+	skipped int
+	// ragged counts the rows left out by the ragged rows policy
+	ragged int
+}
+
+// readFile reads the rows of an individual file, handling rows failing the schema by the schema policy and passing every other row to emit when it is set
+func (g *csvGenerator) readFile(key string, data []byte, validator *schema.Validator, emit func(record []string) error) (fileRows, error) {
+	rows, err := newSourceRows(key, data, g.ingestion, validator)
+	if err != nil {
+		return fileRows{}, err
+	}
+
+	read := fileRows{header: rows.header}
+	for {
+		record, line, problems, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return fileRows{}, err
+		}
+
+		if len(problems) == 0 {
+			if emit != nil {
+				if err := emit(record); err != nil {
+					return fileRows{}, err
+				}
+			}
+			continue
+		}
+
+		switch g.policy {
+		case schema.SkipPolicy:
+			read.skipped++
+		case schema.QuarantinePolicy:
+			read.rejected = append(read.rejected, rejectedRow{key: key, line: line, problems: problems, record: record})
+		default:
+			return fileRows{}, &invalidRowError{problem: problems[0]}
+		}
+	}
+
+	read.ragged = rows.reader.Skipped
+	return read, nil
+}
+
+// invalidRowError is a row failing the schema under the fail policy
+type invalidRowError struct {
+	problem schema.Problem
+}
+
+func (e *invalidRowError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrInvalidRows, e.problem)
+}
+
+func (e *invalidRowError) Unwrap() error {
+	return ErrInvalidRows
+}
+
+// fileFailure describes why an individual file was left out, locating the failure when it is tied to a line
+func fileFailure(key string, err error) storer.FileFailure {
+	var ingestErr *ingest.Error
+	if errors.As(err, &ingestErr) {
+		return storer.FileFailure{Key: key, Line: ingestErr.Line, Error: ingestErr.Err.Error()}
+	}
+
+	var invalidErr *invalidRowError
+	if errors.As(err, &invalidErr) {
+		return storer.FileFailure{
+			Key:   key,
+			Line:  invalidErr.problem.Line,
+			Error: fmt.Sprintf("%v: column '%s': %s", ErrInvalidRows, invalidErr.problem.Column, invalidErr.problem.Message),
+		}
+	}
+
+	return storer.FileFailure{Key: key, Error: err.Error()}
+}
+
+// Validate checks every row of the individual files of a period against the schema of the report type without building anything
+func (g *csvGenerator) Validate(ctx context.Context, reportType storer.ReportType, year int, month int) (_ []schema.Problem, err error) {
+	ctx, span := tracer.Start(ctx, "csvGenerator.Validate", trace.WithAttributes(
+		attribute.String("report.type", string(reportType)),
+		attribute.Int("report.year", year),
+		attribute.Int("report.month", month),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	validator, ok := g.schemas[reportType]
+	if !ok {
+		return nil, fmt.Errorf("%w for %s", ErrNoSchema, reportType)
+	}
+
+	files, sources, err := g.retrieveIndividualFiles(ctx, reportType, year, month)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []schema.Problem{}
+	for i, f := range files {
+		rows, err := newSourceRows(sources[i].Key, f, g.ingestion, validator)
+		if err != nil {
+			return nil, err
+		}
+
+		// every row of a file with an invalid header has the same problems, so they are listed once
+		if len(rows.headerProblems) > 0 {
+			problems = append(problems, rows.headerProblems...)
+			continue
+		}
+
+		for {
+			_, _, rowProblems, err := rows.next()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			problems = append(problems, rowProblems...)
+		}
+	}
+
+	span.SetAttributes(attribute.Int("report.problems", len(problems)))
+
+	return problems, nil
+}
+
+func (g *csvGenerator) Summarize(ctx context.Context, reportType storer.ReportType, year int, month int, summary Summary) (_ []byte, err error) {
+	name := summary.Name()
+	ctx, span := tracer.Start(ctx, "csvGenerator.Summarize", trace.WithAttributes(
+		attribute.String("report.type", string(reportType)),
+		attribute.Int("report.year", year),
+		attribute.Int("report.month", month),
+		attribute.String("report.summary", name),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	logger := slog.Default().With(
+		slog.String("report_type", string(reportType)),
+		logging.Period(year, month),
+		slog.String("summary", name),
+	)
+
+	aggregated, partial, err := g.generate(ctx, reportType, year, month, true)
+	if err != nil {
 		return nil, err
 	}
 
-	return aggregated.Bytes(), nil
+	// the summary is cached under the checksum of the aggregate it was derived from, so a summary stored while the aggregate changed is never returned for the new one
+	key := summary.cacheName(aggregated)
+	existing, err := g.storer.RetrieveSummary(ctx, reportType, year, month, key)
+	if err != nil {
+		logger.WarnContext(ctx, "failed to retrieve existing summary", slog.String("error", err.Error()))
+		// continue with summary logic
+	} else if existing != nil {
+		span.SetAttributes(attribute.Bool("report.cache_hit", true))
+		return existing, nil
+	}
+
+	span.SetAttributes(attribute.Bool("report.cache_hit", false))
+
+	summarized, err := Summarize(aggregated, summary)
+	if err != nil {
+		return nil, err
+	}
+
+	// a summary is only as final as its aggregate
+	if partial && !g.storePartial {
+		return summarized, nil
+	}
+
+	// a summary that could not be cached is still correct, so it is returned anyway
+	if err := g.storer.StoreSummary(context.WithoutCancel(ctx), reportType, year, month, key, summarized); err != nil {
+		logger.WarnContext(ctx, "failed to store summary", slog.String("error", err.Error()))
+	}
+
+	return summarized, nil
 }
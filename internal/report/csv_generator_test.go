@@ -3,25 +3,865 @@
 package report
 
 import (
+	"context"
+	"crypto/sha256"
 	"errors"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/ingest"
+	"github.com/hpcsc/outside-in-go/internal/schema"
 	"github.com/hpcsc/outside-in-go/internal/storer"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCsvGenerator(t *testing.T) {
 	t.Run("generate single", func(t *testing.T) {
 		generateReportTestSuite(t, storer.SingleReportType, func(gen Generator, year int, month int) ([]byte, error) {
-			return gen.GenerateSingle(year, month)
+			return gen.GenerateSingle(context.TODO(), year, month)
 		})
 	})
 
 	t.Run("generate cumulative", func(t *testing.T) {
 		generateReportTestSuite(t, storer.CumulativeReportType, func(gen Generator, year int, month int) ([]byte, error) {
-			return gen.GenerateCumulative(year, month)
+			return gen.GenerateCumulative(context.TODO(), year, month)
 		})
 	})
+
+	t.Run("generate by report type", func(t *testing.T) {
+		for _, reportType := range storer.ReportTypes {
+			reportType := reportType
+			t.Run(string(reportType), func(t *testing.T) {
+				generateReportTestSuite(t, reportType, func(gen Generator, year int, month int) ([]byte, error) {
+					return gen.Generate(context.TODO(), reportType, year, month)
+				})
+			})
+		}
+	})
+}
+
+func TestCsvGenerator_Regenerate(t *testing.T) {
+	year := 2022
+	month := 4
+
+	t.Run("rebuild and store aggregate without looking up existing one", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month,
+			[]byte(`CLUSTER,DATA
+cluster-1,data-1.1`),
+			[]byte(`CLUSTER,DATA
+cluster-2,data-2.1`),
+		)
+		stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+		stubStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer)
+
+		data, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, []byte(`CLUSTER,DATA
+cluster-1,data-1.1
+cluster-2,data-2.1
+`), data)
+		stubStorer.AssertRetrieveAggregatedNotCalled(t)
+		stubStorer.AssertStoreAggregatedCalled(t, storer.SingleReportType, year, month, data)
+	})
+
+	t.Run("report progress to observer in context", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month,
+			[]byte(`CLUSTER,DATA
+cluster-1,data-1.1`),
+			[]byte(`CLUSTER,DATA
+cluster-2,data-2.1`),
+		)
+		stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+		stubStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer)
+
+		var events []Event
+		ctx := WithObserver(context.TODO(), ObserverFunc(func(e Event) {
+			events = append(events, e)
+		}))
+		_, err := g.Regenerate(ctx, storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, []Event{
+			{Type: FilesListedEvent, Total: 2},
+			{Type: FileFetchedEvent, Key: "2022/04/single/cluster-1.csv", Processed: 1, Total: 2},
+			{Type: FileFetchedEvent, Key: "2022/04/single/cluster-2.csv", Processed: 2, Total: 2},
+			{Type: FileParsedEvent, Processed: 1, Total: 2},
+			{Type: FileParsedEvent, Processed: 2, Total: 2},
+			{Type: RowsMergedEvent, Rows: 2},
+			{Type: AggregateStoredEvent},
+			{Type: CompletedEvent},
+		}, events)
+	})
+
+	t.Run("notify listeners of stored aggregate", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month,
+			[]byte(`CLUSTER,DATA
+cluster-1,data-1.1`),
+		)
+		stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+		stubStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		listener := &recordingListener{}
+		g := NewCsvGenerator(stubStorer, WithAggregateListener(listener))
+
+		data, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, []Aggregate{{
+			ReportType: storer.SingleReportType,
+			Year:       year,
+			Month:      month,
+			Key:        "2022/04/aggregate/single.csv",
+			Rows:       1,
+			Checksum:   fmt.Sprintf("%x", sha256.Sum256(data)),
+		}}, listener.aggregates)
+	})
+
+	t.Run("not notify listeners when aggregate is not stored", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month,
+			[]byte(`CLUSTER,DATA
+cluster-1,data-1.1`),
+		)
+		stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+		stubStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(errors.New("some error"))
+		listener := &recordingListener{}
+		g := NewCsvGenerator(stubStorer, WithAggregateListener(listener))
+
+		_, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.Error(t, err)
+		require.Empty(t, listener.aggregates)
+	})
+
+	t.Run("report failure to observer in context", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubListIndividualFiles(storer.SingleReportType, year, month).Return(nil, errors.New("some error"))
+		g := NewCsvGenerator(stubStorer)
+
+		var events []Event
+		ctx := WithObserver(context.TODO(), ObserverFunc(func(e Event) {
+			events = append(events, e)
+		}))
+		_, err := g.Regenerate(ctx, storer.SingleReportType, year, month)
+
+		require.Error(t, err)
+		require.Equal(t, []Event{{Type: FailedEvent, Error: "some error"}}, events)
+	})
+
+	t.Run("refuse to rebuild aggregate of closed period", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.ClosedPeriodStatus, nil)
+		g := NewCsvGenerator(stubStorer)
+
+		_, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.ErrorIs(t, err, storer.ErrPeriodClosed)
+		require.Contains(t, err.Error(), "04/2022 is closed")
+		stubStorer.AssertListIndividualFilesNotCalled(t)
+		stubStorer.AssertStoreAggregatedNotCalled(t)
+	})
+
+	t.Run("return error if no individual files available", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubListIndividualFiles(storer.SingleReportType, year, month).Return([]storer.IndividualFile{}, nil)
+		g := NewCsvGenerator(stubStorer)
+
+		_, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.Error(t, err)
+		require.ErrorIs(t, err, ErrNoData)
+		require.Contains(t, err.Error(), "no data available for 04/2022")
+		stubStorer.AssertStoreAggregatedNotCalled(t)
+	})
+}
+
+func TestCsvGenerator_Versions(t *testing.T) {
+	year := 2022
+	month := 4
+
+	t.Run("store version with its sources before aggregate", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		sources := stubStorer.StubIndividualFiles(storer.SingleReportType, year, month,
+			[]byte(`CLUSTER,DATA
+cluster-1,data-1.1`),
+			[]byte(`CLUSTER,DATA
+cluster-2,data-2.1`),
+		)
+		stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+		stubStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer).(*csvGenerator)
+		g.now = func() time.Time {
+			return time.Date(2022, 5, 3, 10, 15, 0, 42, time.UTC)
+		}
+
+		data, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		stubStorer.AssertCalled(t, "StoreAggregateVersion", mock.Anything, storer.SingleReportType, year, month, storer.AggregateVersion{
+			ID:        "20220503T101500.000000042Z",
+			CreatedAt: time.Date(2022, 5, 3, 10, 15, 0, 42, time.UTC),
+			Rows:      2,
+			Checksum:  fmt.Sprintf("%x", sha256.Sum256(data)),
+			Sources:   sources,
+		}, data)
+	})
+
+	t.Run("not store aggregate when failed to store version", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month,
+			[]byte(`CLUSTER,DATA
+cluster-1,data-1.1`),
+		)
+		stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(errors.New("some error"))
+		g := NewCsvGenerator(stubStorer)
+
+		_, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "some error")
+		stubStorer.AssertStoreAggregatedNotCalled(t)
+	})
+}
+
+func TestCsvGenerator_Summarize(t *testing.T) {
+	year := 2022
+	month := 4
+	summary := Summary{GroupBy: []string{"CLUSTER"}, Measures: []Measure{{Function: SumFunction, Column: "COST"}}}
+
+	aggregated := []byte("CLUSTER,COST\ncluster-1,1\ncluster-1,2\n")
+	cacheName := summary.cacheName(aggregated)
+
+	t.Run("return summary cached for the aggregate", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrieveAggregated(storer.SingleReportType, year, month).Return(aggregated, nil)
+		stubStorer.StubRetrieveSummary(storer.SingleReportType, year, month, cacheName).Return([]byte("some,summary"), nil)
+		g := NewCsvGenerator(stubStorer)
+
+		data, err := g.Summarize(context.TODO(), storer.SingleReportType, year, month, summary)
+
+		require.NoError(t, err)
+		require.Equal(t, []byte("some,summary"), data)
+		stubStorer.AssertStoreSummaryNotCalled(t)
+	})
+
+	t.Run("not return summary cached for another aggregate", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrieveAggregated(storer.SingleReportType, year, month).Return([]byte("CLUSTER,COST\ncluster-1,5\n"), nil)
+		stubStorer.StubRetrieveSummary(storer.SingleReportType, year, month, cacheName).Return([]byte("some,summary"), nil)
+		stubStorer.StubRetrieveSummary(storer.SingleReportType, year, month, mock.Anything).Return(nil, nil)
+		stubStorer.StubStoreSummary(storer.SingleReportType, year, month, mock.Anything, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer)
+
+		data, err := g.Summarize(context.TODO(), storer.SingleReportType, year, month, summary)
+
+		require.NoError(t, err)
+		require.Equal(t, "CLUSTER,sum(COST)\ncluster-1,5\n", string(data))
+	})
+
+	t.Run("summarize existing aggregate and cache summary", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrieveSummary(storer.SingleReportType, year, month, cacheName).Return(nil, nil)
+		stubStorer.StubRetrieveAggregated(storer.SingleReportType, year, month).Return(aggregated, nil)
+		stubStorer.StubStoreSummary(storer.SingleReportType, year, month, cacheName, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer)
+
+		data, err := g.Summarize(context.TODO(), storer.SingleReportType, year, month, summary)
+
+		require.NoError(t, err)
+		require.Equal(t, "CLUSTER,sum(COST)\ncluster-1,3\n", string(data))
+		stubStorer.AssertCalled(t, "StoreSummary", mock.Anything, storer.SingleReportType, year, month, cacheName, data)
+	})
+
+	t.Run("return summary even when failed to cache it", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrieveSummary(storer.SingleReportType, year, month, mock.Anything).Return(nil, errors.New("some error"))
+		stubStorer.StubRetrieveAggregated(storer.SingleReportType, year, month).Return([]byte("CLUSTER,COST\ncluster-1,1\n"), nil)
+		stubStorer.StubStoreSummary(storer.SingleReportType, year, month, mock.Anything, mock.Anything).Return(errors.New("some error"))
+		g := NewCsvGenerator(stubStorer)
+
+		data, err := g.Summarize(context.TODO(), storer.SingleReportType, year, month, summary)
+
+		require.NoError(t, err)
+		require.Equal(t, "CLUSTER,sum(COST)\ncluster-1,1\n", string(data))
+	})
+
+	t.Run("not cache summary that failed", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrieveSummary(storer.SingleReportType, year, month, mock.Anything).Return(nil, nil)
+		stubStorer.StubRetrieveAggregated(storer.SingleReportType, year, month).Return([]byte("CLUSTER,COST\ncluster-1,free\n"), nil)
+		g := NewCsvGenerator(stubStorer)
+
+		_, err := g.Summarize(context.TODO(), storer.SingleReportType, year, month, summary)
+
+		require.ErrorIs(t, err, ErrNonNumeric)
+		stubStorer.AssertStoreSummaryNotCalled(t)
+	})
+}
+
+func TestCsvGenerator_Schemas(t *testing.T) {
+	year := 2022
+	month := 4
+	validator, err := schema.New(schema.Schema{Columns: []schema.Column{
+		{Name: "CLUSTER", Required: true},
+		{Name: "COST", Type: schema.NumberType},
+	}})
+	require.NoError(t, err)
+	schemas := map[storer.ReportType]*schema.Validator{storer.SingleReportType: validator}
+	stubSources := func(stubStorer interface {
+		StubIndividualFiles(storer.ReportType, int, int, ...[]byte) []storer.IndividualFile
+	}) {
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month,
+			[]byte(`CLUSTER,COST
+cluster-1,1.5
+cluster-1,free`),
+			[]byte(`CLUSTER,COST
+,2
+cluster-2,3`),
+		)
+	}
+
+	t.Run("fail generation on first invalid row", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubSources(stubStorer)
+		g := NewCsvGenerator(stubStorer, WithSchemas(schemas, schema.FailPolicy))
+
+		_, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.ErrorIs(t, err, ErrInvalidRows)
+		require.Contains(t, err.Error(), "2022/04/single/cluster-1.csv line 3 column 'COST': value is not a number")
+		stubStorer.AssertStoreAggregatedNotCalled(t)
+	})
+
+	t.Run("leave invalid rows out when skipping", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubSources(stubStorer)
+		stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+		stubStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer, WithSchemas(schemas, schema.SkipPolicy))
+
+		data, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, "CLUSTER,COST\ncluster-1,1.5\ncluster-2,3\n", string(data))
+	})
+
+	t.Run("store invalid rows aside when quarantining", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubSources(stubStorer)
+		stubStorer.StubStoreRejectedRows(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+		stubStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer, WithSchemas(schemas, schema.QuarantinePolicy))
+
+		data, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, "CLUSTER,COST\ncluster-1,1.5\ncluster-2,3\n", string(data))
+		stubStorer.AssertCalled(t, "StoreRejectedRows", mock.Anything, storer.SingleReportType, year, month, []byte(`key,line,problems,CLUSTER,COST
+2022/04/single/cluster-1.csv,3,column 'COST': value is not a number,cluster-1,free
+2022/04/single/cluster-2.csv,2,column 'CLUSTER': value is required,,2
+`))
+	})
+
+	t.Run("not validate report types without schema", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.CumulativeReportType, year, month, []byte("CLUSTER,COST\n,free\n"))
+		stubStorer.StubStoreAggregateVersion(storer.CumulativeReportType, year, month).Return(nil)
+		stubStorer.StubStoreAggregated(storer.CumulativeReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer, WithSchemas(schemas, schema.QuarantinePolicy))
+
+		data, err := g.Regenerate(context.TODO(), storer.CumulativeReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, "CLUSTER,COST\n,free\n", string(data))
+	})
+
+	t.Run("list problems of every source row", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month,
+			[]byte(`CLUSTER,COST
+cluster-1,free`),
+			[]byte(`CLUSTER
+cluster-2
+cluster-3`),
+		)
+		g := NewCsvGenerator(stubStorer, WithSchemas(schemas, schema.FailPolicy))
+
+		problems, err := g.Validate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, []schema.Problem{
+			{Key: "2022/04/single/cluster-1.csv", Line: 2, Column: "COST", Value: "free", Message: "value is not a number"},
+			{Key: "2022/04/single/cluster-2.csv", Line: 1, Column: "COST", Message: "column is missing from header"},
+		}, problems)
+	})
+
+	t.Run("return error when validating report type without schema", func(t *testing.T) {
+		g := NewCsvGenerator(storer.NewMock(), WithSchemas(schemas, schema.FailPolicy))
+
+		_, err := g.Validate(context.TODO(), storer.CumulativeReportType, year, month)
+
+		require.ErrorIs(t, err, ErrNoSchema)
+	})
+}
+
+func TestCsvGenerator_Deduplication(t *testing.T) {
+	year := 2022
+	month := 4
+	// cluster-1.csv was uploaded again after cluster-2.csv, so its rows are the most recent
+	stubSources := func(stubStorer interface {
+		StubListIndividualFiles(interface{}, interface{}, interface{}) *mock.Call
+		StubRetrieveIndividualFile(interface{}) *mock.Call
+	}) {
+		files := []storer.IndividualFile{
+			{Key: "2022/04/single/cluster-1.csv", LastModified: time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)},
+			{Key: "2022/04/single/cluster-2.csv", LastModified: time.Date(2022, 5, 1, 9, 0, 0, 0, time.UTC)},
+		}
+		stubStorer.StubListIndividualFiles(storer.SingleReportType, year, month).Return(files, nil)
+		stubStorer.StubRetrieveIndividualFile(files[0].Key).Return([]byte(`CLUSTER,DAY,COST
+cluster-1,01,1
+cluster-1,02,2`), nil)
+		stubStorer.StubRetrieveIndividualFile(files[1].Key).Return([]byte(`CLUSTER,DAY,COST
+cluster-1,02,2.5
+cluster-1,02,2
+cluster-2,01,3`), nil)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		dedup      Deduplication
+		expected   string
+		duplicates int
+	}{
+		{
+			name:       "drop identical rows",
+			dedup:      Deduplication{Keep: KeepLast},
+			expected:   "CLUSTER,DAY,COST\ncluster-1,01,1\ncluster-1,02,2\ncluster-1,02,2.5\ncluster-2,01,3\n",
+			duplicates: 1,
+		},
+		{
+			name:       "keep row of most recently modified file",
+			dedup:      Deduplication{Keep: KeepLast, Keys: map[storer.ReportType][]string{storer.SingleReportType: {"CLUSTER", "DAY"}}},
+			expected:   "CLUSTER,DAY,COST\ncluster-1,01,1\ncluster-1,02,2\ncluster-2,01,3\n",
+			duplicates: 2,
+		},
+		{
+			name:       "keep row of least recently modified file",
+			dedup:      Deduplication{Keep: KeepFirst, Keys: map[storer.ReportType][]string{storer.SingleReportType: {"CLUSTER", "DAY"}}},
+			expected:   "CLUSTER,DAY,COST\ncluster-1,01,1\ncluster-1,02,2.5\ncluster-2,01,3\n",
+			duplicates: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stubStorer := storer.NewMock()
+			stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+			stubSources(stubStorer)
+			stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+			stubStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+			g := NewCsvGenerator(stubStorer, WithDeduplication(tc.dedup))
+
+			data, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, string(data))
+			stubStorer.AssertCalled(t, "StoreAggregateVersion", mock.Anything, storer.SingleReportType, year, month, mock.MatchedBy(func(v storer.AggregateVersion) bool {
+				return v.Duplicates == tc.duplicates && v.Rows == strings.Count(tc.expected, "\n")-1
+			}), data)
+		})
+	}
+
+	t.Run("keep rows whose values only join to the same text", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month, []byte("CLUSTER,DAY,COST\n\"cluster-1\x00\",01,1\ncluster-1,\"\x0001\",1\n"))
+		stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+		stubStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer, WithDeduplication(Deduplication{Keep: KeepLast}))
+
+		data, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, 2, strings.Count(string(data), "\n")-1)
+	})
+
+	t.Run("keep duplicate rows when deduplication is not configured", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubSources(stubStorer)
+		stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+		stubStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer)
+
+		data, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, 5, strings.Count(string(data), "\n")-1)
+	})
+
+	t.Run("return error when key column is not in header", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubSources(stubStorer)
+		g := NewCsvGenerator(stubStorer, WithDeduplication(Deduplication{
+			Keep: KeepLast,
+			Keys: map[storer.ReportType][]string{storer.SingleReportType: {"REGION"}},
+		}))
+
+		_, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.ErrorIs(t, err, ErrUnknownColumn)
+		stubStorer.AssertStoreAggregatedNotCalled(t)
+	})
+}
+
+func TestCsvGenerator_Sorting(t *testing.T) {
+	year := 2022
+	month := 4
+	first := []byte("CLUSTER,COST\ncluster-2,3\ncluster-1,1\n")
+	second := []byte("CLUSTER,COST\ncluster-1,2\n")
+
+	t.Run("build identical aggregates whatever the order of files", func(t *testing.T) {
+		generate := func(contents ...[]byte) []byte {
+			stubStorer := storer.NewMock()
+			stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+			stubStorer.StubIndividualFiles(storer.SingleReportType, year, month, contents...)
+			stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+			stubStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+			g := NewCsvGenerator(stubStorer, WithSorting(Sorting{
+				Keys:      map[storer.ReportType][]string{storer.SingleReportType: {"CLUSTER"}},
+				ChunkRows: 1,
+				TempDir:   t.TempDir(),
+			}))
+
+			data, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+			require.NoError(t, err)
+			return data
+		}
+
+		data := generate(first, second)
+
+		require.Equal(t, "CLUSTER,COST\ncluster-1,1\ncluster-1,2\ncluster-2,3\n", string(data))
+		require.Equal(t, data, generate(second, first))
+	})
+
+	t.Run("sort rows kept by deduplication", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month, first, second, first)
+		stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+		stubStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer,
+			WithDeduplication(Deduplication{Keep: KeepLast}),
+			WithSorting(Sorting{
+				Keys:      map[storer.ReportType][]string{storer.SingleReportType: {"CLUSTER"}},
+				ChunkRows: 1,
+				TempDir:   t.TempDir(),
+			}),
+		)
+
+		data, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, "CLUSTER,COST\ncluster-1,1\ncluster-1,2\ncluster-2,3\n", string(data))
+		stubStorer.AssertCalled(t, "StoreAggregateVersion", mock.Anything, storer.SingleReportType, year, month, mock.MatchedBy(func(v storer.AggregateVersion) bool {
+			return v.Duplicates == 2 && v.Rows == 3
+		}), data)
+	})
+
+	t.Run("keep merge order of report types without sort keys", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.CumulativeReportType, year, month, first, second)
+		stubStorer.StubStoreAggregateVersion(storer.CumulativeReportType, year, month).Return(nil)
+		stubStorer.StubStoreAggregated(storer.CumulativeReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer, WithSorting(Sorting{Keys: map[storer.ReportType][]string{storer.SingleReportType: {"CLUSTER"}}}))
+
+		data, err := g.Regenerate(context.TODO(), storer.CumulativeReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, "CLUSTER,COST\ncluster-2,3\ncluster-1,1\ncluster-1,2\n", string(data))
+	})
+}
+
+func TestCsvGenerator_Ingestion(t *testing.T) {
+	year := 2022
+	month := 4
+
+	t.Run("merge files with byte order mark, other delimiter and encoding", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month,
+			[]byte("\xEF\xBB\xBFCLUSTER,TEAM\ncluster-1,team-a\n"),
+			[]byte("CLUSTER;TEAM\ncluster-2;\xC9quipe\n"),
+		)
+		stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+		stubStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer)
+
+		data, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, "CLUSTER,TEAM\ncluster-1,team-a\ncluster-2,Équipe\n", string(data))
+	})
+
+	t.Run("return error with key and line of ragged row", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month,
+			[]byte("CLUSTER,TEAM\ncluster-1,team-a\n"),
+			[]byte("CLUSTER,TEAM\ncluster-2,team-a\ncluster-2\n"),
+		)
+		g := NewCsvGenerator(stubStorer)
+
+		_, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.ErrorIs(t, err, ingest.ErrRaggedRow)
+		require.Contains(t, err.Error(), "2022/04/single/cluster-2.csv line 3")
+		stubStorer.AssertStoreAggregatedNotCalled(t)
+	})
+
+	t.Run("apply ragged rows policy", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month,
+			[]byte("CLUSTER,TEAM\ncluster-1,team-a\ncluster-2\n"),
+		)
+		stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+		stubStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer, WithIngestion(ingest.Options{Ragged: ingest.PadRagged}))
+
+		data, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, "CLUSTER,TEAM\ncluster-1,team-a\ncluster-2,\n", string(data))
+	})
+}
+
+func TestCsvGenerator_PartialAggregation(t *testing.T) {
+	year := 2022
+	month := 4
+	good := []byte("CLUSTER,COST\ncluster-1,1\n")
+	corrupt := []byte("CLUSTER,COST\ncluster-2,2\ncluster-2\n")
+	failures := []storer.FileFailure{{Key: "2022/04/single/cluster-2.csv", Line: 3, Error: "wrong number of fields: expected 2, got 1"}}
+
+	t.Run("leave unreadable files out without storing partial aggregate", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month, good, corrupt)
+		stubStorer.StubStoreFailures(storer.SingleReportType, year, month, failures).Return(nil)
+		g := NewCsvGenerator(stubStorer, WithPartialAggregation(false))
+		var events []Event
+		ctx := WithObserver(context.TODO(), ObserverFunc(func(e Event) {
+			if e.Type == FileFailedEvent {
+				events = append(events, e)
+			}
+		}))
+
+		data, err := g.Regenerate(ctx, storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, "CLUSTER,COST\ncluster-1,1\n", string(data))
+		require.Equal(t, []Event{{Type: FileFailedEvent, Key: "2022/04/single/cluster-2.csv", Line: 3, Error: "wrong number of fields: expected 2, got 1"}}, events)
+		stubStorer.AssertCalled(t, "StoreFailures", mock.Anything, storer.SingleReportType, year, month, failures)
+		stubStorer.AssertStoreAggregatedNotCalled(t)
+	})
+
+	t.Run("store partial aggregate with its failures when configured", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month, good, corrupt)
+		stubStorer.StubStoreFailures(storer.SingleReportType, year, month, failures).Return(nil)
+		stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+		stubStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer, WithPartialAggregation(true))
+
+		data, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, "CLUSTER,COST\ncluster-1,1\n", string(data))
+		stubStorer.AssertCalled(t, "StoreAggregateVersion", mock.Anything, storer.SingleReportType, year, month, mock.MatchedBy(func(v storer.AggregateVersion) bool {
+			return reflect.DeepEqual(v.Failures, failures)
+		}), data)
+	})
+
+	t.Run("clear failures of previous build when every file is read", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month, good)
+		stubStorer.StubStoreFailures(storer.SingleReportType, year, month, []storer.FileFailure(nil)).Return(nil)
+		stubStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+		stubStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer, WithPartialAggregation(false))
+
+		_, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		stubStorer.AssertCalled(t, "StoreAggregated", mock.Anything, storer.SingleReportType, year, month, mock.Anything)
+	})
+
+	t.Run("return error when no file can be read", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month, corrupt)
+		g := NewCsvGenerator(stubStorer, WithPartialAggregation(true))
+
+		_, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.ErrorIs(t, err, ingest.ErrRaggedRow)
+		stubStorer.AssertStoreAggregatedNotCalled(t)
+	})
+
+	t.Run("record line of rows failing schema", func(t *testing.T) {
+		validator, err := schema.New(schema.Schema{Columns: []schema.Column{{Name: "COST", Type: schema.NumberType}}})
+		require.NoError(t, err)
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month, good, []byte("CLUSTER,COST\ncluster-2,free\n"))
+		stubStorer.StubStoreFailures(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer,
+			WithSchemas(map[storer.ReportType]*schema.Validator{storer.SingleReportType: validator}, schema.FailPolicy),
+			WithPartialAggregation(false),
+		)
+
+		_, err = g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		stubStorer.AssertCalled(t, "StoreFailures", mock.Anything, storer.SingleReportType, year, month, []storer.FileFailure{
+			{Key: "2022/04/single/cluster-2.csv", Line: 2, Error: "source rows do not match schema: column 'COST': value is not a number"},
+		})
+	})
+
+	t.Run("not cache summary of partial aggregate", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrieveSummary(storer.SingleReportType, year, month, mock.Anything).Return(nil, nil)
+		stubStorer.StubRetrieveAggregated(storer.SingleReportType, year, month).Return(nil, nil)
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month, good, corrupt)
+		stubStorer.StubStoreFailures(storer.SingleReportType, year, month, failures).Return(nil)
+		g := NewCsvGenerator(stubStorer, WithPartialAggregation(false))
+		summary, err := ParseSummary("CLUSTER", []string{"sum:COST"})
+		require.NoError(t, err)
+
+		data, err := g.Summarize(context.TODO(), storer.SingleReportType, year, month, summary)
+
+		require.NoError(t, err)
+		require.Equal(t, "CLUSTER,sum(COST)\ncluster-1,1\n", string(data))
+		stubStorer.AssertStoreSummaryNotCalled(t)
+	})
+}
+
+func TestCsvGenerator_Quarantine(t *testing.T) {
+	year := 2022
+	month := 4
+	good := []byte("CLUSTER,COST\ncluster-1,1\n")
+	corrupt := []byte("CLUSTER,COST\ncluster-2,2\ncluster-2\n")
+
+	t.Run("quarantine files left out of best-effort build with reason", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month, good, corrupt)
+		stubStorer.StubStoreFailures(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		stubStorer.StubListQuarantinedFiles(storer.SingleReportType, year, month).Return([]storer.QuarantinedFile{}, nil)
+		stubStorer.StubQuarantineIndividualFile("2022/04/single/cluster-2.csv", "line 3: wrong number of fields: expected 2, got 1").Return("quarantine/2022/04/single/cluster-2.csv", nil)
+		g := NewCsvGenerator(stubStorer, WithPartialAggregation(false), WithQuarantine())
+
+		data, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, "CLUSTER,COST\ncluster-1,1\n", string(data))
+		stubStorer.AssertCalled(t, "QuarantineIndividualFile", mock.Anything, "2022/04/single/cluster-2.csv", "line 3: wrong number of fields: expected 2, got 1")
+	})
+
+	t.Run("return aggregate when file cannot be quarantined", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month, good, corrupt)
+		stubStorer.StubStoreFailures(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		stubStorer.StubListQuarantinedFiles(storer.SingleReportType, year, month).Return([]storer.QuarantinedFile{}, nil)
+		stubStorer.StubQuarantineIndividualFile(mock.Anything, mock.Anything).Return("", errors.New("some error"))
+		g := NewCsvGenerator(stubStorer, WithPartialAggregation(false), WithQuarantine())
+
+		data, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, "CLUSTER,COST\ncluster-1,1\n", string(data))
+	})
+
+	t.Run("keep counting files quarantined by earlier builds as failures until released", func(t *testing.T) {
+		mockStorer := storer.NewMock()
+		mockStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		mockStorer.StubIndividualFiles(storer.SingleReportType, year, month, good)
+		mockStorer.StubListQuarantinedFiles(storer.SingleReportType, year, month).Return([]storer.QuarantinedFile{
+			{Name: "cluster-2.csv", OriginalKey: "2022/04/single/cluster-2.csv", Reason: "line 3: wrong number of fields: expected 2, got 1"},
+		}, nil)
+		mockStorer.StubStoreFailures(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		mockStorer.StubStoreAggregateVersion(storer.SingleReportType, year, month).Return(nil)
+		mockStorer.StubStoreAggregated(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(mockStorer, WithPartialAggregation(true), WithQuarantine())
+
+		var failed []Event
+		ctx := WithObserver(context.TODO(), ObserverFunc(func(e Event) {
+			if e.Type == FileFailedEvent {
+				failed = append(failed, e)
+			}
+		}))
+		_, err := g.Regenerate(ctx, storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		expected := []storer.FileFailure{{Key: "2022/04/single/cluster-2.csv", Error: "quarantined: line 3: wrong number of fields: expected 2, got 1"}}
+		mockStorer.AssertCalled(t, "StoreFailures", mock.Anything, storer.SingleReportType, year, month, expected)
+		mockStorer.AssertCalled(t, "StoreAggregateVersion", mock.Anything, storer.SingleReportType, year, month, mock.MatchedBy(func(v storer.AggregateVersion) bool {
+			return reflect.DeepEqual(expected, v.Failures)
+		}), mock.Anything)
+		require.Equal(t, []Event{{Type: FileFailedEvent, Key: "2022/04/single/cluster-2.csv", Error: expected[0].Error}}, failed)
+		mockStorer.AssertQuarantineIndividualFileNotCalled(t)
+	})
+
+	t.Run("return error when quarantined files cannot be listed", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month, good)
+		stubStorer.StubListQuarantinedFiles(storer.SingleReportType, year, month).Return(nil, errors.New("some error"))
+		g := NewCsvGenerator(stubStorer, WithPartialAggregation(true), WithQuarantine())
+
+		_, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.EqualError(t, err, "some error")
+	})
+
+	t.Run("leave failed files in place without quarantine", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month, good, corrupt)
+		stubStorer.StubStoreFailures(storer.SingleReportType, year, month, mock.Anything).Return(nil)
+		g := NewCsvGenerator(stubStorer, WithPartialAggregation(false))
+
+		_, err := g.Regenerate(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		stubStorer.AssertQuarantineIndividualFileNotCalled(t)
+	})
 }
 
 func generateReportTestSuite(
@@ -41,14 +881,15 @@ func generateReportTestSuite(
 
 		require.NoError(t, err)
 		require.Equal(t, []byte("some,data"), data)
-		stubStorer.AssertRetrieveIndividualFilesNotCalled(t)
+		stubStorer.AssertListIndividualFilesNotCalled(t)
 		stubStorer.AssertStoreAggregatedNotCalled(t)
 	})
 
 	t.Run("return error if no individual files available for given year and month", func(t *testing.T) {
 		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
 		stubStorer.StubRetrieveAggregated(reportType, year, month).Return(nil, nil)
-		stubStorer.StubRetrieveIndividualFiles(reportType, year, month).Return([][]byte{}, nil)
+		stubStorer.StubListIndividualFiles(reportType, year, month).Return([]storer.IndividualFile{}, nil)
 		g := NewCsvGenerator(stubStorer)
 
 		_, err := generate(g, year, month)
@@ -59,8 +900,9 @@ func generateReportTestSuite(
 
 	t.Run("return error if failed to retrieve individual files", func(t *testing.T) {
 		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
 		stubStorer.StubRetrieveAggregated(reportType, year, month).Return(nil, nil)
-		stubStorer.StubRetrieveIndividualFiles(reportType, year, month).Return(nil, errors.New("some error"))
+		stubStorer.StubListIndividualFiles(reportType, year, month).Return(nil, errors.New("some error"))
 		g := NewCsvGenerator(stubStorer)
 
 		_, err := generate(g, year, month)
@@ -71,17 +913,17 @@ func generateReportTestSuite(
 
 	t.Run("store and return aggregated report", func(t *testing.T) {
 		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
 		stubStorer.StubRetrieveAggregated(reportType, year, month).Return(nil, nil)
-		stubStorer.StubRetrieveIndividualFiles(reportType, year, month).Return(
-			[][]byte{
-				[]byte(`CLUSTER,DATA
+		stubStorer.StubIndividualFiles(reportType, year, month,
+			[]byte(`CLUSTER,DATA
 cluster-1,data-1.1
 cluster-1,data-1.2`),
-				[]byte(`CLUSTER,DATA
+			[]byte(`CLUSTER,DATA
 cluster-2,data-2.1
 cluster-2,data-2.2`),
-			},
-			nil)
+		)
+		stubStorer.StubStoreAggregateVersion(reportType, year, month).Return(nil)
 		stubStorer.StubStoreAggregated(reportType, year, month, mock.Anything).Return(nil)
 		g := NewCsvGenerator(stubStorer)
 
@@ -100,14 +942,14 @@ cluster-2,data-2.2
 
 	t.Run("return error when failed to store aggregate file", func(t *testing.T) {
 		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(year, month).Return(storer.OpenPeriodStatus, nil)
 		stubStorer.StubRetrieveAggregated(reportType, year, month).Return(nil, nil)
-		stubStorer.StubRetrieveIndividualFiles(reportType, year, month).Return(
-			[][]byte{
-				[]byte(`CLUSTER,DATA
+		stubStorer.StubIndividualFiles(reportType, year, month,
+			[]byte(`CLUSTER,DATA
 cluster-1,data-1.1
 cluster-1,data-1.2`),
-			},
-			nil)
+		)
+		stubStorer.StubStoreAggregateVersion(reportType, year, month).Return(nil)
 		stubStorer.StubStoreAggregated(reportType, year, month, mock.Anything).Return(errors.New("some error"))
 		g := NewCsvGenerator(stubStorer)
 
@@ -117,3 +959,11 @@ cluster-1,data-1.2`),
 		require.Contains(t, err.Error(), "some error")
 	})
 }
+
+type recordingListener struct {
+	aggregates []Aggregate
+}
+
+func (l *recordingListener) AggregateStored(_ context.Context, aggregate Aggregate) {
+	l.aggregates = append(l.aggregates, aggregate)
+}
@@ -0,0 +1,129 @@
+package report
+
+import (
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// KeepPolicy decides which of several duplicate rows stays in an aggregate
+type KeepPolicy string
+
+const (
+	// KeepFirst keeps the row of the least recently modified file
+	KeepFirst KeepPolicy = "first"
+	// KeepLast keeps the row of the most recently modified file
+	KeepLast KeepPolicy = "last"
+)
+
+func ParseKeepPolicy(value string) (KeepPolicy, error) {
+	switch p := KeepPolicy(value); p {
+	case KeepFirst, KeepLast:
+		return p, nil
+	default:
+		return "", fmt.Errorf("deduplication keep policy '%s' is invalid", value)
+	}
+}
+
+// Deduplication drops rows appearing more than once across the individual files of a period
+type Deduplication struct {
+	Keep KeepPolicy
+	// Keys lists the columns identifying a row per report type. Report types without key columns compare whole rows
+	Keys map[storer.ReportType][]string
+}
+
+// rankSources orders files by last modified time, falling back to key order for files modified at the same time
+func rankSources(sources []storer.IndividualFile) []int {
+	order := make([]int, len(sources))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return sources[order[a]].LastModified.Before(sources[order[b]].LastModified)
+	})
+
+	ranks := make([]int, len(sources))
+	for rank, i := range order {
+		ranks[i] = rank
+	}
+
+	return ranks
+}
+
+// deduplicator picks the row kept for every key in a first pass over the merged rows, so that the rows can then be merged one at a time.
+// Rows are numbered in merge order, which is file key order, so ties within the same rank keep their order in the file
+type deduplicator struct {
+	keep  KeepPolicy
+	index []int
+	kept  map[string]keptRow
+}
+
+// keptRow is the row kept so far for a key, along with the rank of the file it was read from
+type keptRow struct {
+	row  int
+	rank int
+}
+
+func (d Deduplication) newDeduplicator(reportType storer.ReportType, header []string) (*deduplicator, error) {
+	var index []int
+	for _, k := range d.Keys[reportType] {
+		i := slices.Index(header, k)
+		if i < 0 {
+			return nil, fmt.Errorf("%w: deduplication key '%s'", ErrUnknownColumn, k)
+		}
+		index = append(index, i)
+	}
+
+	return &deduplicator{keep: d.Keep, index: index, kept: map[string]keptRow{}}, nil
+}
+
+// observe considers the row numbered row, read from a file of the given rank, for its key
+func (d *deduplicator) observe(record []string, row int, rank int) {
+	key := dedupKey(record, d.index)
+	current, ok := d.kept[key]
+	switch {
+	case !ok:
+		d.kept[key] = keptRow{row: row, rank: rank}
+	case d.keep == KeepFirst && rank < current.rank:
+		d.kept[key] = keptRow{row: row, rank: rank}
+	case d.keep == KeepLast && rank >= current.rank:
+		d.kept[key] = keptRow{row: row, rank: rank}
+	}
+}
+
+// keeps tells whether the row numbered row is the one kept for its key once every row has been observed
+func (d *deduplicator) keeps(record []string, row int) bool {
+	return d.kept[dedupKey(record, d.index)].row == row
+}
+
+// dedupKey joins the values of the key columns, or of the whole row without key columns
+func dedupKey(record []string, index []int) string {
+	if len(index) == 0 {
+		return joinKey(record)
+	}
+
+	values := make([]string, len(index))
+	for i, c := range index {
+		if c < len(record) {
+			values[i] = record[c]
+		}
+	}
+
+	return joinKey(values)
+}
+
+// joinKey prefixes every value with its length, so that different values can never join to the same key whatever characters they contain
+func joinKey(values []string) string {
+	var key strings.Builder
+	for _, v := range values {
+		key.WriteString(strconv.Itoa(len(v)))
+		key.WriteByte(':')
+		key.WriteString(v)
+	}
+
+	return key.String()
+}
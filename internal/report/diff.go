@@ -0,0 +1,317 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+var ErrUnknownColumn = errors.New("unknown column")
+
+const (
+	AddedChange   = "added"
+	RemovedChange = "removed"
+	ChangedChange = "changed"
+	// AddedColumnChange and RemovedColumnChange are columns in only one of the reports
+	AddedColumnChange   = "column_added"
+	RemovedColumnChange = "column_removed"
+)
+
+// Diff describes how the rows of a head report differ from those of a base report
+type Diff struct {
+	// Key are the columns identifying a row. Without key columns a row is identified by its values in the columns of both reports, so rows are only ever added or removed
+	Key     []string            `json:"key"`
+	Added   []map[string]string `json:"added"`
+	Removed []map[string]string `json:"removed"`
+	Changed []ChangedRow        `json:"changed"`
+	// AddedColumns are only in the head report and RemovedColumns only in the base report
+	AddedColumns   []string `json:"added_columns"`
+	RemovedColumns []string `json:"removed_columns"`
+	// header are the compared columns, base columns first: the union of base and head columns with key columns, and the columns of both reports without
+	header []string
+}
+
+// ChangedRow is a row found in both reports under the same key with different values
+type ChangedRow struct {
+	Key     map[string]string `json:"key"`
+	Columns []ColumnDelta     `json:"columns"`
+}
+
+type ColumnDelta struct {
+	Column string `json:"column"`
+	Base   string `json:"base"`
+	Head   string `json:"head"`
+	// Delta is head minus base, set only when both values are numbers
+	Delta *float64 `json:"delta,omitempty"`
+}
+
+// Compare matches the rows of two csv reports by key columns. Rows sharing a key are matched in order of appearance,
+// so duplicated keys pair up rather than fail. Columns are matched by name and a column missing from one report reads as empty.
+// Without key columns rows are matched by the columns of both reports, and columns in only one report are listed rather than compared
+func Compare(base []byte, head []byte, key []string) (Diff, error) {
+	baseTable, err := readTable(base)
+	if err != nil {
+		return Diff{}, fmt.Errorf("failed to read base report: %v", err)
+	}
+
+	headTable, err := readTable(head)
+	if err != nil {
+		return Diff{}, fmt.Errorf("failed to read head report: %v", err)
+	}
+
+	header := append([]string{}, baseTable.header...)
+	shared := []string{}
+	addedColumns := []string{}
+	removedColumns := []string{}
+	for _, column := range baseTable.header {
+		if headTable.has(column) {
+			shared = append(shared, column)
+		} else {
+			removedColumns = append(removedColumns, column)
+		}
+	}
+	for _, column := range headTable.header {
+		if !baseTable.has(column) {
+			header = append(header, column)
+			addedColumns = append(addedColumns, column)
+		}
+	}
+
+	keyColumns := key
+	if len(keyColumns) == 0 {
+		header, keyColumns = shared, shared
+	}
+
+	for _, column := range keyColumns {
+		if !baseTable.has(column) || !headTable.has(column) {
+			return Diff{}, fmt.Errorf("%w: key column '%s' is not in both reports", ErrUnknownColumn, column)
+		}
+	}
+
+	diff := Diff{
+		Key:            append([]string{}, key...),
+		Added:          []map[string]string{},
+		Removed:        []map[string]string{},
+		Changed:        []ChangedRow{},
+		AddedColumns:   addedColumns,
+		RemovedColumns: removedColumns,
+		header:         header,
+	}
+
+	// reports without a column in common have no rows in common either
+	if len(keyColumns) == 0 {
+		diff.Added = append(diff.Added, headTable.rows...)
+		diff.Removed = append(diff.Removed, baseTable.rows...)
+		return diff, nil
+	}
+
+	baseRows := map[string][]map[string]string{}
+	for _, row := range baseTable.rows {
+		k := rowKey(row, keyColumns)
+		baseRows[k] = append(baseRows[k], row)
+	}
+
+	matched := map[string]int{}
+	for _, row := range headTable.rows {
+		k := rowKey(row, keyColumns)
+		candidates := baseRows[k]
+		if matched[k] >= len(candidates) {
+			diff.Added = append(diff.Added, row)
+			continue
+		}
+
+		baseRow := candidates[matched[k]]
+		matched[k]++
+
+		if changed, ok := compareRow(baseRow, row, header, keyColumns); ok {
+			diff.Changed = append(diff.Changed, changed)
+		}
+	}
+
+	for _, row := range baseTable.rows {
+		k := rowKey(row, keyColumns)
+		if matched[k] > 0 {
+			matched[k]--
+			continue
+		}
+		diff.Removed = append(diff.Removed, row)
+	}
+
+	return diff, nil
+}
+
+// WriteDiff renders a diff to w in the given format. CSV output has one line per added or removed column, then one line per differing cell with the key columns of its row
+func WriteDiff(w io.Writer, diff Diff, format string) error {
+	switch format {
+	case CSVFormat:
+		return writeDiffCSV(w, diff)
+	case JSONFormat:
+		return json.NewEncoder(w).Encode(diff)
+	default:
+		return fmt.Errorf("format '%s' is invalid", format)
+	}
+}
+
+func writeDiffCSV(w io.Writer, diff Diff) error {
+	keyColumns := diff.Key
+	if len(keyColumns) == 0 {
+		keyColumns = diff.header
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(append(append([]string{"change"}, keyColumns...), "column", "base", "head", "delta")); err != nil {
+		return err
+	}
+
+	for _, column := range diff.AddedColumns {
+		if err := writer.Write(append(append([]string{AddedColumnChange}, make([]string, len(keyColumns))...), column, "", "", "")); err != nil {
+			return err
+		}
+	}
+
+	for _, column := range diff.RemovedColumns {
+		if err := writer.Write(append(append([]string{RemovedColumnChange}, make([]string, len(keyColumns))...), column, "", "", "")); err != nil {
+			return err
+		}
+	}
+
+	write := func(change string, row map[string]string, delta ColumnDelta) error {
+		line := []string{change}
+		for _, column := range keyColumns {
+			line = append(line, row[column])
+		}
+
+		formatted := ""
+		if delta.Delta != nil {
+			formatted = strconv.FormatFloat(*delta.Delta, 'f', -1, 64)
+		}
+
+		return writer.Write(append(line, delta.Column, delta.Base, delta.Head, formatted))
+	}
+
+	// an added or removed row is written as one line per non-key column, or a single line when every column is part of the key
+	writeRow := func(change string, row map[string]string, value func(column string) ColumnDelta) error {
+		written := false
+		for _, column := range diff.header {
+			if slices.Contains(keyColumns, column) {
+				continue
+			}
+
+			if err := write(change, row, value(column)); err != nil {
+				return err
+			}
+			written = true
+		}
+
+		if written {
+			return nil
+		}
+
+		return write(change, row, ColumnDelta{})
+	}
+
+	for _, row := range diff.Added {
+		row := row
+		if err := writeRow(AddedChange, row, func(column string) ColumnDelta {
+			return ColumnDelta{Column: column, Head: row[column]}
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, row := range diff.Removed {
+		row := row
+		if err := writeRow(RemovedChange, row, func(column string) ColumnDelta {
+			return ColumnDelta{Column: column, Base: row[column]}
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, changed := range diff.Changed {
+		for _, delta := range changed.Columns {
+			if err := write(ChangedChange, changed.Key, delta); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func compareRow(base map[string]string, head map[string]string, header []string, keyColumns []string) (ChangedRow, bool) {
+	var deltas []ColumnDelta
+	for _, column := range header {
+		if base[column] == head[column] {
+			continue
+		}
+
+		delta := ColumnDelta{Column: column, Base: base[column], Head: head[column]}
+		baseValue, baseErr := strconv.ParseFloat(base[column], 64)
+		headValue, headErr := strconv.ParseFloat(head[column], 64)
+		if baseErr == nil && headErr == nil {
+			d := headValue - baseValue
+			delta.Delta = &d
+		}
+		deltas = append(deltas, delta)
+	}
+
+	if len(deltas) == 0 {
+		return ChangedRow{}, false
+	}
+
+	key := make(map[string]string, len(keyColumns))
+	for _, column := range keyColumns {
+		key[column] = head[column]
+	}
+
+	return ChangedRow{Key: key, Columns: deltas}, true
+}
+
+func rowKey(row map[string]string, keyColumns []string) string {
+	values := make([]string, 0, len(keyColumns))
+	for _, column := range keyColumns {
+		values = append(values, row[column])
+	}
+
+	return joinKey(values)
+}
+
+type table struct {
+	header []string
+	rows   []map[string]string
+}
+
+func (t table) has(column string) bool {
+	return slices.Contains(t.header, column)
+}
+
+func readTable(data []byte) (table, error) {
+	lines, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return table{}, err
+	}
+
+	if len(lines) == 0 {
+		return table{rows: []map[string]string{}}, nil
+	}
+
+	t := table{header: lines[0], rows: make([]map[string]string, 0, len(lines)-1)}
+	for _, line := range lines[1:] {
+		row := make(map[string]string, len(t.header))
+		for i, column := range t.header {
+			if i < len(line) {
+				row[column] = line[i]
+			}
+		}
+		t.rows = append(t.rows, row)
+	}
+
+	return t, nil
+}
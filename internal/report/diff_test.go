@@ -0,0 +1,172 @@
+//go:build unit
+
+package report
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	base := []byte(`CLUSTER,NAMESPACE,CPU
+cluster-1,ns-1,1.5
+cluster-1,ns-2,2
+cluster-2,ns-1,3
+`)
+	head := []byte(`CLUSTER,NAMESPACE,CPU
+cluster-1,ns-1,2
+cluster-2,ns-1,3
+cluster-3,ns-1,4
+`)
+
+	t.Run("return added, removed and changed rows by key columns", func(t *testing.T) {
+		diff, err := Compare(base, head, []string{"CLUSTER", "NAMESPACE"})
+
+		require.NoError(t, err)
+		require.Equal(t, []map[string]string{{"CLUSTER": "cluster-3", "NAMESPACE": "ns-1", "CPU": "4"}}, diff.Added)
+		require.Equal(t, []map[string]string{{"CLUSTER": "cluster-1", "NAMESPACE": "ns-2", "CPU": "2"}}, diff.Removed)
+		delta := 0.5
+		require.Equal(t, []ChangedRow{{
+			Key:     map[string]string{"CLUSTER": "cluster-1", "NAMESPACE": "ns-1"},
+			Columns: []ColumnDelta{{Column: "CPU", Base: "1.5", Head: "2", Delta: &delta}},
+		}}, diff.Changed)
+	})
+
+	t.Run("only add and remove rows when no key columns are given", func(t *testing.T) {
+		diff, err := Compare(base, head, nil)
+
+		require.NoError(t, err)
+		require.Len(t, diff.Added, 2)
+		require.Len(t, diff.Removed, 2)
+		require.Empty(t, diff.Changed)
+	})
+
+	t.Run("match rows with duplicated keys in order", func(t *testing.T) {
+		diff, err := Compare([]byte(`CLUSTER,CPU
+cluster-1,1
+cluster-1,1
+`), []byte(`CLUSTER,CPU
+cluster-1,1
+`), nil)
+
+		require.NoError(t, err)
+		require.Empty(t, diff.Added)
+		require.Equal(t, []map[string]string{{"CLUSTER": "cluster-1", "CPU": "1"}}, diff.Removed)
+	})
+
+	t.Run("leave delta out when values are not numbers", func(t *testing.T) {
+		diff, err := Compare([]byte(`CLUSTER,OWNER
+cluster-1,team-a
+`), []byte(`CLUSTER,OWNER,CPU
+cluster-1,team-b,1
+`), []string{"CLUSTER"})
+
+		require.NoError(t, err)
+		require.Equal(t, []ColumnDelta{
+			{Column: "OWNER", Base: "team-a", Head: "team-b"},
+			{Column: "CPU", Base: "", Head: "1"},
+		}, diff.Changed[0].Columns)
+	})
+
+	t.Run("match rows by columns of both reports and list other columns when no key columns are given", func(t *testing.T) {
+		diff, err := Compare([]byte(`CLUSTER,OWNER,CPU
+cluster-1,team-a,1
+cluster-2,team-b,2
+`), []byte(`CLUSTER,CPU,MEMORY
+cluster-1,1,10
+cluster-2,3,20
+`), nil)
+
+		require.NoError(t, err)
+		require.Equal(t, []string{"MEMORY"}, diff.AddedColumns)
+		require.Equal(t, []string{"OWNER"}, diff.RemovedColumns)
+		require.Equal(t, []map[string]string{{"CLUSTER": "cluster-2", "CPU": "3", "MEMORY": "20"}}, diff.Added)
+		require.Equal(t, []map[string]string{{"CLUSTER": "cluster-2", "OWNER": "team-b", "CPU": "2"}}, diff.Removed)
+		require.Empty(t, diff.Changed)
+	})
+
+	t.Run("add and remove every row of reports without columns in common", func(t *testing.T) {
+		diff, err := Compare([]byte("CLUSTER\ncluster-1\n"), []byte("NAME\ncluster-1\n"), nil)
+
+		require.NoError(t, err)
+		require.Len(t, diff.Added, 1)
+		require.Len(t, diff.Removed, 1)
+	})
+
+	t.Run("tell apart keys whose values only join to the same text", func(t *testing.T) {
+		diff, err := Compare([]byte("CLUSTER,NAMESPACE,CPU\n\"cluster-1\x00\",ns-1,1\n"), []byte("CLUSTER,NAMESPACE,CPU\ncluster-1,\"\x00ns-1\",1\n"), []string{"CLUSTER", "NAMESPACE"})
+
+		require.NoError(t, err)
+		require.Len(t, diff.Added, 1)
+		require.Len(t, diff.Removed, 1)
+	})
+
+	t.Run("return error when key column is not in both reports", func(t *testing.T) {
+		_, err := Compare(base, head, []string{"OWNER"})
+
+		require.ErrorIs(t, err, ErrUnknownColumn)
+		require.Contains(t, err.Error(), "key column 'OWNER' is not in both reports")
+	})
+}
+
+func TestWriteDiff(t *testing.T) {
+	diff, err := Compare([]byte(`CLUSTER,CPU,MEMORY
+cluster-1,1,10
+cluster-2,2,20
+`), []byte(`CLUSTER,CPU,MEMORY
+cluster-1,1.5,10
+cluster-3,3,30
+`), []string{"CLUSTER"})
+	require.NoError(t, err)
+
+	t.Run("write one csv line per differing cell", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		require.NoError(t, WriteDiff(&buf, diff, CSVFormat))
+
+		require.Equal(t, `change,CLUSTER,column,base,head,delta
+added,cluster-3,CPU,,3,
+added,cluster-3,MEMORY,,30,
+removed,cluster-2,CPU,2,,
+removed,cluster-2,MEMORY,20,,
+changed,cluster-1,CPU,1,1.5,0.5
+`, buf.String())
+	})
+
+	t.Run("write json document", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		require.NoError(t, WriteDiff(&buf, diff, JSONFormat))
+
+		require.JSONEq(t, `{
+			"key": ["CLUSTER"],
+			"added": [{"CLUSTER": "cluster-3", "CPU": "3", "MEMORY": "30"}],
+			"removed": [{"CLUSTER": "cluster-2", "CPU": "2", "MEMORY": "20"}],
+			"changed": [{"key": {"CLUSTER": "cluster-1"}, "columns": [{"column": "CPU", "base": "1", "head": "1.5", "delta": 0.5}]}],
+			"added_columns": [],
+			"removed_columns": []
+		}`, buf.String())
+	})
+
+	t.Run("write added and removed columns before rows", func(t *testing.T) {
+		withColumns, err := Compare([]byte(`CLUSTER,OWNER
+cluster-1,team-a
+`), []byte(`CLUSTER,MEMORY
+cluster-1,10
+`), nil)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+
+		require.NoError(t, WriteDiff(&buf, withColumns, CSVFormat))
+
+		require.Equal(t, `change,CLUSTER,column,base,head,delta
+column_added,,MEMORY,,,
+column_removed,,OWNER,,,
+`, buf.String())
+	})
+
+	t.Run("return error for unknown format", func(t *testing.T) {
+		require.Error(t, WriteDiff(&bytes.Buffer{}, diff, "xml"))
+	})
+}
@@ -0,0 +1,34 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	CSVFormat  = "csv"
+	JSONFormat = "json"
+)
+
+// Write renders a csv report to w in the given format. JSON output is an array with one object per row, keyed by header
+func Write(w io.Writer, data []byte, format string) error {
+	switch format {
+	case CSVFormat:
+		_, err := w.Write(data)
+		return err
+	case JSONFormat:
+		return writeJSON(w, data)
+	default:
+		return fmt.Errorf("format '%s' is invalid", format)
+	}
+}
+
+func writeJSON(w io.Writer, data []byte) error {
+	t, err := readTable(data)
+	if err != nil {
+		return fmt.Errorf("failed to read csv content: %v", err)
+	}
+
+	return json.NewEncoder(w).Encode(t.rows)
+}
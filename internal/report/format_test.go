@@ -0,0 +1,47 @@
+//go:build unit
+
+package report
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	data := []byte(`CLUSTER,DATA
+cluster-1,data-1.1
+cluster-2,data-2.1
+`)
+
+	t.Run("write csv as is", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		require.NoError(t, Write(&buf, data, CSVFormat))
+
+		require.Equal(t, data, buf.Bytes())
+	})
+
+	t.Run("write json objects keyed by header", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		require.NoError(t, Write(&buf, data, JSONFormat))
+
+		require.JSONEq(t, `[{"CLUSTER":"cluster-1","DATA":"data-1.1"},{"CLUSTER":"cluster-2","DATA":"data-2.1"}]`, buf.String())
+	})
+
+	t.Run("write empty json array when there are no rows", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		require.NoError(t, Write(&buf, []byte("CLUSTER,DATA\n"), JSONFormat))
+
+		require.JSONEq(t, `[]`, buf.String())
+	})
+
+	t.Run("return error when format is unknown", func(t *testing.T) {
+		err := Write(&bytes.Buffer{}, data, "xml")
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "format 'xml' is invalid")
+	})
+}
@@ -1,6 +1,23 @@
 package report
 
+import (
+	"context"
+	"github.com/hpcsc/outside-in-go/internal/schema"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+)
+
 type Generator interface {
-	GenerateSingle(year int, month int) ([]byte, error)
-	GenerateCumulative(year int, month int) ([]byte, error)
+	GenerateSingle(ctx context.Context, year int, month int) ([]byte, error)
+	GenerateCumulative(ctx context.Context, year int, month int) ([]byte, error)
+	// Generate returns the existing aggregate of the given report type and period, building and storing it first if there is none.
+	// Building returns storer.ErrPeriodClosed when the period is not open
+	Generate(ctx context.Context, reportType storer.ReportType, year int, month int) ([]byte, error)
+	// Regenerate builds and stores the aggregate from individual files, replacing any existing aggregate. It returns storer.ErrPeriodClosed when the period is not open
+	Regenerate(ctx context.Context, reportType storer.ReportType, year int, month int) ([]byte, error)
+	// Summarize returns a summary of the aggregate, computing and caching it first if it is not cached since the aggregate last changed
+	Summarize(ctx context.Context, reportType storer.ReportType, year int, month int, summary Summary) ([]byte, error)
+	// Validate checks the individual files of a period against the schema of the report type. It returns ErrNoSchema when the report type has none
+	Validate(ctx context.Context, reportType storer.ReportType, year int, month int) ([]schema.Problem, error)
+	// Quality checks the individual files of a period for missing clusters, empty files, row count anomalies and schema violations without building anything
+	Quality(ctx context.Context, reportType storer.ReportType, year int, month int) (Quality, error)
 }
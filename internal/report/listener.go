@@ -0,0 +1,22 @@
+package report
+
+import (
+	"context"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+)
+
+// Aggregate describes an aggregate that has just been stored
+type Aggregate struct {
+	ReportType storer.ReportType
+	Year       int
+	Month      int
+	Key        string
+	Rows       int
+	// Checksum is the hex encoded SHA-256 of the aggregate content
+	Checksum string
+}
+
+// AggregateListener is told about every aggregate a generator stores. It is called on the generating goroutine, so slow work belongs in the background
+type AggregateListener interface {
+	AggregateStored(ctx context.Context, aggregate Aggregate)
+}
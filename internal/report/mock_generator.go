@@ -1,6 +1,9 @@
 package report
 
 import (
+	"context"
+	"github.com/hpcsc/outside-in-go/internal/schema"
+	"github.com/hpcsc/outside-in-go/internal/storer"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -14,8 +17,8 @@ func NewMockGenerator() *mockGenerator {
 	return &mockGenerator{}
 }
 
-func (m *mockGenerator) GenerateSingle(year int, month int) ([]byte, error) {
-	args := m.Called(year, month)
+func (m *mockGenerator) GenerateSingle(ctx context.Context, year int, month int) ([]byte, error) {
+	args := m.Called(ctx, year, month)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -23,11 +26,64 @@ func (m *mockGenerator) GenerateSingle(year int, month int) ([]byte, error) {
 	return args.Get(0).([]byte), args.Error(1)
 }
 
-func (m *mockGenerator) GenerateCumulative(year int, month int) ([]byte, error) {
-	args := m.Called(year, month)
+func (m *mockGenerator) GenerateCumulative(ctx context.Context, year int, month int) ([]byte, error) {
+	args := m.Called(ctx, year, month)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 
 	return args.Get(0).([]byte), args.Error(1)
 }
+
+func (m *mockGenerator) Generate(ctx context.Context, reportType storer.ReportType, year int, month int) ([]byte, error) {
+	args := m.Called(ctx, reportType, year, month)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *mockGenerator) Regenerate(ctx context.Context, reportType storer.ReportType, year int, month int) ([]byte, error) {
+	args := m.Called(ctx, reportType, year, month)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *mockGenerator) Quality(ctx context.Context, reportType storer.ReportType, year int, month int) (Quality, error) {
+	args := m.Called(ctx, reportType, year, month)
+	return args.Get(0).(Quality), args.Error(1)
+}
+
+func (m *mockGenerator) StubQuality(reportType interface{}, year interface{}, month interface{}) *mock.Call {
+	return m.On("Quality", mock.Anything, reportType, year, month)
+}
+
+func (m *mockGenerator) Summarize(ctx context.Context, reportType storer.ReportType, year int, month int, summary Summary) ([]byte, error) {
+	args := m.Called(ctx, reportType, year, month, summary)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *mockGenerator) StubSummarize(reportType interface{}, year interface{}, month interface{}, summary interface{}) *mock.Call {
+	return m.On("Summarize", mock.Anything, reportType, year, month, summary)
+}
+
+func (m *mockGenerator) Validate(ctx context.Context, reportType storer.ReportType, year int, month int) ([]schema.Problem, error) {
+	args := m.Called(ctx, reportType, year, month)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]schema.Problem), args.Error(1)
+}
+
+func (m *mockGenerator) StubValidate(reportType interface{}, year interface{}, month interface{}) *mock.Call {
+	return m.On("Validate", mock.Anything, reportType, year, month)
+}
@@ -0,0 +1,78 @@
+package report
+
+import (
+	"context"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ Records = &mockRecords{}
+
+type mockRecords struct {
+	mock.Mock
+}
+
+func NewMockRecords() *mockRecords {
+	return &mockRecords{}
+}
+
+func (m *mockRecords) Failures(ctx context.Context, reportType storer.ReportType, year int, month int) ([]storer.FileFailure, error) {
+	args := m.Called(ctx, reportType, year, month)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]storer.FileFailure), args.Error(1)
+}
+
+func (m *mockRecords) StubFailures(reportType interface{}, year interface{}, month interface{}) *mock.Call {
+	return m.On("Failures", mock.Anything, reportType, year, month)
+}
+
+func (m *mockRecords) Quarantined(ctx context.Context, reportType storer.ReportType, year int, month int) ([]storer.QuarantinedFile, error) {
+	args := m.Called(ctx, reportType, year, month)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]storer.QuarantinedFile), args.Error(1)
+}
+
+func (m *mockRecords) StubQuarantined(reportType interface{}, year interface{}, month interface{}) *mock.Call {
+	return m.On("Quarantined", mock.Anything, reportType, year, month)
+}
+
+func (m *mockRecords) Release(ctx context.Context, reportType storer.ReportType, year int, month int, name string) (string, error) {
+	args := m.Called(ctx, reportType, year, month, name)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockRecords) StubRelease(reportType interface{}, year interface{}, month interface{}, name interface{}) *mock.Call {
+	return m.On("Release", mock.Anything, reportType, year, month, name)
+}
+
+func (m *mockRecords) Versions(ctx context.Context, reportType storer.ReportType, year int, month int) ([]storer.AggregateVersion, error) {
+	args := m.Called(ctx, reportType, year, month)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]storer.AggregateVersion), args.Error(1)
+}
+
+func (m *mockRecords) StubVersions(reportType interface{}, year interface{}, month interface{}) *mock.Call {
+	return m.On("Versions", mock.Anything, reportType, year, month)
+}
+
+func (m *mockRecords) Version(ctx context.Context, reportType storer.ReportType, year int, month int, id string) ([]byte, error) {
+	args := m.Called(ctx, reportType, year, month, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *mockRecords) StubVersion(reportType interface{}, year interface{}, month interface{}, id interface{}) *mock.Call {
+	return m.On("Version", mock.Anything, reportType, year, month, id)
+}
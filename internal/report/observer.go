@@ -0,0 +1,60 @@
+package report
+
+import "context"
+
+type EventType string
+
+const (
+	// FilesListedEvent is emitted once the individual files of a period are known, with Total set to their number
+	FilesListedEvent EventType = "files_listed"
+	// FileFetchedEvent is emitted after each individual file has been downloaded, with Processed counting the files fetched so far
+	FileFetchedEvent EventType = "file_fetched"
+	// FileParsedEvent is emitted after each individual file has been parsed, with Processed counting the files parsed so far
+	FileParsedEvent EventType = "file_parsed"
+	// FileFailedEvent is emitted for each individual file left out of a best-effort aggregate, with Error and, when known, Line set
+	FileFailedEvent EventType = "file_failed"
+	// RowsMergedEvent is emitted once all files are merged, with Rows set to the number of data rows of the aggregate
+	RowsMergedEvent      EventType = "rows_merged"
+	AggregateStoredEvent EventType = "aggregate_stored"
+	// CompletedEvent is the last event of a successful generation, including one answered from an existing aggregate
+	CompletedEvent EventType = "completed"
+	// FailedEvent is the last event of a failed generation, with Error set
+	FailedEvent EventType = "failed"
+)
+
+type Event struct {
+	Type      EventType `json:"type"`
+	Key       string    `json:"key,omitempty"`
+	Processed int       `json:"processed,omitempty"`
+	Total     int       `json:"total,omitempty"`
+	Rows      int       `json:"rows,omitempty"`
+	Line      int       `json:"line,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Observer receives progress events while an aggregate is being generated. Events are delivered synchronously on the generating goroutine
+type Observer interface {
+	Observe(event Event)
+}
+
+type ObserverFunc func(event Event)
+
+func (f ObserverFunc) Observe(event Event) {
+	f(event)
+}
+
+type observerKey struct{}
+
+// WithObserver returns a context that makes the generator report its progress to observer
+func WithObserver(ctx context.Context, observer Observer) context.Context {
+	return context.WithValue(ctx, observerKey{}, observer)
+}
+
+// ObserverFrom returns the observer in ctx, or one that discards events when there is none
+func ObserverFrom(ctx context.Context) Observer {
+	if observer, ok := ctx.Value(observerKey{}).(Observer); ok {
+		return observer
+	}
+
+	return ObserverFunc(func(Event) {})
+}
@@ -0,0 +1,68 @@
+package report
+
+import (
+	"github.com/hpcsc/outside-in-go/internal/ingest"
+	"github.com/hpcsc/outside-in-go/internal/schema"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+)
+
+type GeneratorOption func(*csvGenerator)
+
+func WithAggregateListener(listener AggregateListener) GeneratorOption {
+	return func(g *csvGenerator) {
+		g.listeners = append(g.listeners, listener)
+	}
+}
+
+// WithSchemas validates source rows of the report types with a schema, handling invalid rows with policy
+func WithSchemas(schemas map[storer.ReportType]*schema.Validator, policy schema.Policy) GeneratorOption {
+	return func(g *csvGenerator) {
+		g.schemas = schemas
+		g.policy = policy
+	}
+}
+
+// WithIngestion reads individual files with the given encoding, delimiter and ragged rows policy
+func WithIngestion(opts ingest.Options) GeneratorOption {
+	return func(g *csvGenerator) {
+		g.ingestion = opts
+	}
+}
+
+// WithPartialAggregation leaves individual files that cannot be read out of aggregates instead of failing.
+// Partial aggregates are only stored when store is set, otherwise they are rebuilt on every request
+func WithPartialAggregation(store bool) GeneratorOption {
+	return func(g *csvGenerator) {
+		g.bestEffort = true
+		g.storePartial = store
+	}
+}
+
+// WithQuarantine moves the individual files left out of best-effort builds to quarantine, so that they are not read again until released.
+// Until then every build still counts them as failures, so the aggregates stay partial
+func WithQuarantine() GeneratorOption {
+	return func(g *csvGenerator) {
+		g.quarantine = true
+	}
+}
+
+// WithQuality sets the expected clusters and row count threshold quality reports check periods against
+func WithQuality(opts QualityOptions) GeneratorOption {
+	return func(g *csvGenerator) {
+		g.quality = opts
+	}
+}
+
+// WithSorting sorts the rows of aggregates of the report types with sort keys
+func WithSorting(sorting Sorting) GeneratorOption {
+	return func(g *csvGenerator) {
+		g.sorting = sorting
+	}
+}
+
+// WithDeduplication drops duplicate rows when merging individual files
+func WithDeduplication(dedup Deduplication) GeneratorOption {
+	return func(g *csvGenerator) {
+		g.dedup = &dedup
+	}
+}
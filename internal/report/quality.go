@@ -0,0 +1,256 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"github.com/hpcsc/outside-in-go/internal/schema"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"math"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultRowCountThreshold flags clusters whose rows changed by more than half from the previous month
+const DefaultRowCountThreshold = 0.5
+
+const (
+	ConfigExpectedClusters        = "config"
+	PreviousMonthExpectedClusters = "previous_month"
+	NoExpectedClusters            = "none"
+)
+
+// QualityOptions decide what the individual files of a period are checked against
+type QualityOptions struct {
+	// ExpectedClusters are the clusters expected to upload every period. Empty expects the clusters of the previous month
+	ExpectedClusters []string
+	// RowCountThreshold is the relative change in the rows of a cluster from the previous month above which it is flagged
+	RowCountThreshold float64
+}
+
+// Quality describes the individual files of a period before it is closed
+type Quality struct {
+	// ExpectedFrom tells where the expected clusters come from: config, previous_month, or none when there is nothing to compare with
+	ExpectedFrom       string           `json:"expected_from"`
+	Clusters           []ClusterQuality `json:"clusters"`
+	MissingClusters    []string         `json:"missing_clusters"`
+	UnexpectedClusters []string         `json:"unexpected_clusters"`
+	// EmptyFiles are the keys of files without data rows
+	EmptyFiles        []string             `json:"empty_files"`
+	UnreadableFiles   []storer.FileFailure `json:"unreadable_files"`
+	RowCountAnomalies []RowCountAnomaly    `json:"row_count_anomalies"`
+	// SchemaViolations is empty when the report type has no schema
+	SchemaViolations []schema.Problem `json:"schema_violations"`
+}
+
+// ClusterQuality is the readable file of one cluster
+type ClusterQuality struct {
+	Cluster string `json:"cluster"`
+	Key     string `json:"key"`
+	Rows    int    `json:"rows"`
+	// PreviousRows is the number of rows of the cluster the previous month, nil when it had no readable file
+	PreviousRows *int `json:"previous_rows"`
+}
+
+// RowCountAnomaly is a cluster whose rows changed from the previous month by more than the threshold
+type RowCountAnomaly struct {
+	Cluster      string `json:"cluster"`
+	Rows         int    `json:"rows"`
+	PreviousRows int    `json:"previous_rows"`
+	// Change is relative to the previous month, -0.5 for half as many rows
+	Change float64 `json:"change"`
+}
+
+// inspectedFile is an individual file read for its rows and schema problems
+type inspectedFile struct {
+	key      string
+	cluster  string
+	rows     int
+	problems []schema.Problem
+	// failure is set when the file cannot be read
+	failure *storer.FileFailure
+}
+
+// Quality checks the individual files of a period for missing clusters, empty files, row counts changing from the previous month and schema violations
+func (g *csvGenerator) Quality(ctx context.Context, reportType storer.ReportType, year int, month int) (_ Quality, err error) {
+	ctx, span := tracer.Start(ctx, "csvGenerator.Quality", trace.WithAttributes(
+		attribute.String("report.type", string(reportType)),
+		attribute.Int("report.year", year),
+		attribute.Int("report.month", month),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	current, err := g.inspectFiles(ctx, reportType, year, month, g.schemas[reportType])
+	if err != nil {
+		return Quality{}, err
+	}
+
+	previousMonth := time.Date(year, time.Month(month)-1, 1, 0, 0, 0, 0, time.UTC)
+	previous, err := g.inspectFiles(ctx, reportType, previousMonth.Year(), int(previousMonth.Month()), nil)
+	if err != nil {
+		return Quality{}, err
+	}
+
+	previousRows := map[string]int{}
+	for _, f := range previous {
+		if f.failure == nil {
+			previousRows[f.cluster] = f.rows
+		}
+	}
+
+	q := Quality{
+		Clusters:           []ClusterQuality{},
+		MissingClusters:    []string{},
+		UnexpectedClusters: []string{},
+		EmptyFiles:         []string{},
+		UnreadableFiles:    []storer.FileFailure{},
+		RowCountAnomalies:  []RowCountAnomaly{},
+		SchemaViolations:   []schema.Problem{},
+	}
+
+	present := map[string]bool{}
+	for _, f := range current {
+		present[f.cluster] = true
+		if f.failure != nil {
+			q.UnreadableFiles = append(q.UnreadableFiles, *f.failure)
+			continue
+		}
+
+		cluster := ClusterQuality{Cluster: f.cluster, Key: f.key, Rows: f.rows}
+		if rows, ok := previousRows[f.cluster]; ok {
+			cluster.PreviousRows = &rows
+			// a cluster without rows the previous month has no baseline to compare with
+			if rows > 0 {
+				change := float64(f.rows-rows) / float64(rows)
+				if math.Abs(change) > g.quality.threshold() {
+					q.RowCountAnomalies = append(q.RowCountAnomalies, RowCountAnomaly{Cluster: f.cluster, Rows: f.rows, PreviousRows: rows, Change: change})
+				}
+			}
+		}
+		q.Clusters = append(q.Clusters, cluster)
+
+		if f.rows == 0 {
+			q.EmptyFiles = append(q.EmptyFiles, f.key)
+		}
+		q.SchemaViolations = append(q.SchemaViolations, f.problems...)
+	}
+
+	var expected []string
+	switch {
+	case len(g.quality.ExpectedClusters) > 0:
+		q.ExpectedFrom, expected = ConfigExpectedClusters, g.quality.ExpectedClusters
+	case len(previous) > 0:
+		q.ExpectedFrom = PreviousMonthExpectedClusters
+		for _, f := range previous {
+			expected = append(expected, f.cluster)
+		}
+	default:
+		q.ExpectedFrom = NoExpectedClusters
+	}
+
+	for _, cluster := range expected {
+		if !present[cluster] && !slices.Contains(q.MissingClusters, cluster) {
+			q.MissingClusters = append(q.MissingClusters, cluster)
+		}
+	}
+	slices.Sort(q.MissingClusters)
+
+	if q.ExpectedFrom != NoExpectedClusters {
+		for cluster := range present {
+			if !slices.Contains(expected, cluster) {
+				q.UnexpectedClusters = append(q.UnexpectedClusters, cluster)
+			}
+		}
+		slices.Sort(q.UnexpectedClusters)
+	}
+
+	span.SetAttributes(
+		attribute.Int("report.missing_clusters", len(q.MissingClusters)),
+		attribute.Int("report.row_count_anomalies", len(q.RowCountAnomalies)),
+		attribute.Int("report.problems", len(q.SchemaViolations)),
+	)
+
+	return q, nil
+}
+
+// inspectFiles counts the rows of every individual file of a period and checks them against validator, which is nil to only count rows.
+// Unlike a build, a period without files is not an error, and files that cannot be read are described rather than failing
+func (g *csvGenerator) inspectFiles(ctx context.Context, reportType storer.ReportType, year int, month int, validator *schema.Validator) ([]inspectedFile, error) {
+	listed, err := g.storer.ListIndividualFiles(ctx, reportType, year, month)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]inspectedFile, 0, len(listed))
+	for _, f := range listed {
+		content, err := g.storer.RetrieveIndividualFile(ctx, f.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		// a file removed between listing and retrieval is treated as not being part of the period
+		if content == nil {
+			continue
+		}
+
+		inspected := inspectedFile{key: f.Key, cluster: clusterName(f.Key)}
+		inspected.rows, inspected.problems, err = g.inspectFile(f.Key, content, validator)
+		if err != nil {
+			failure := fileFailure(f.Key, err)
+			inspected.failure = &failure
+		}
+		files = append(files, inspected)
+	}
+
+	return files, nil
+}
+
+// inspectFile returns the number of data rows of an individual file with their schema problems. A file with an invalid header has its header problems listed once
+func (g *csvGenerator) inspectFile(key string, data []byte, validator *schema.Validator) (int, []schema.Problem, error) {
+	rows, err := newSourceRows(key, data, g.ingestion, validator)
+	// a file without even a header is empty rather than unreadable
+	if errors.Is(err, io.EOF) {
+		return 0, nil, nil
+	}
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	count := 0
+	problems := rows.headerProblems
+	for {
+		_, _, rowProblems, err := rows.next()
+		if err == io.EOF {
+			return count, problems, nil
+		}
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		count++
+		if len(rows.headerProblems) == 0 {
+			problems = append(problems, rowProblems...)
+		}
+	}
+}
+
+// clusterName is the name a cluster uploads its individual file under, which is the last segment of its key without extension
+func clusterName(key string) string {
+	name := path.Base(key)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+func (o QualityOptions) threshold() float64 {
+	if o.RowCountThreshold <= 0 {
+		return DefaultRowCountThreshold
+	}
+
+	return o.RowCountThreshold
+}
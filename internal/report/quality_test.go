@@ -0,0 +1,128 @@
+//go:build unit
+
+package report
+
+import (
+	"context"
+	"errors"
+	"github.com/hpcsc/outside-in-go/internal/schema"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCsvGenerator_Quality(t *testing.T) {
+	year := 2022
+	month := 4
+
+	t.Run("compare clusters and row counts with previous month", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, 3,
+			[]byte("CLUSTER,COST\ncluster-1,1\ncluster-1,2\n"),
+			[]byte("CLUSTER,COST\ncluster-2,1\n"),
+			[]byte("CLUSTER,COST\ncluster-3,1\n"),
+		)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month,
+			[]byte("CLUSTER,COST\ncluster-1,1\ncluster-1,2\n"),
+			[]byte("CLUSTER,COST\ncluster-2,1\ncluster-2,2\ncluster-2,3\n"),
+		)
+		g := NewCsvGenerator(stubStorer)
+
+		q, err := g.Quality(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		previousRows := []int{2, 1}
+		require.Equal(t, Quality{
+			ExpectedFrom: PreviousMonthExpectedClusters,
+			Clusters: []ClusterQuality{
+				{Cluster: "cluster-1", Key: "2022/04/single/cluster-1.csv", Rows: 2, PreviousRows: &previousRows[0]},
+				{Cluster: "cluster-2", Key: "2022/04/single/cluster-2.csv", Rows: 3, PreviousRows: &previousRows[1]},
+			},
+			MissingClusters:    []string{"cluster-3"},
+			UnexpectedClusters: []string{},
+			EmptyFiles:         []string{},
+			UnreadableFiles:    []storer.FileFailure{},
+			RowCountAnomalies:  []RowCountAnomaly{{Cluster: "cluster-2", Rows: 3, PreviousRows: 1, Change: 2}},
+			SchemaViolations:   []schema.Problem{},
+		}, q)
+	})
+
+	t.Run("compare clusters with configured clusters and flag empty files", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubListIndividualFiles(storer.SingleReportType, year, 3).Return([]storer.IndividualFile{}, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month,
+			[]byte("CLUSTER,COST\ncluster-1,1\n"),
+			[]byte("CLUSTER,COST\n"),
+			[]byte{},
+		)
+		g := NewCsvGenerator(stubStorer, WithQuality(QualityOptions{ExpectedClusters: []string{"cluster-1", "cluster-4"}}))
+
+		q, err := g.Quality(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, ConfigExpectedClusters, q.ExpectedFrom)
+		require.Equal(t, []string{"cluster-4"}, q.MissingClusters)
+		require.Equal(t, []string{"cluster-2", "cluster-3"}, q.UnexpectedClusters)
+		require.Equal(t, []string{"2022/04/single/cluster-2.csv", "2022/04/single/cluster-3.csv"}, q.EmptyFiles)
+		require.Empty(t, q.RowCountAnomalies)
+	})
+
+	t.Run("flag row count changes above configured threshold", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, 3, []byte("CLUSTER,COST\ncluster-1,1\ncluster-1,2\ncluster-1,3\ncluster-1,4\n"))
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month, []byte("CLUSTER,COST\ncluster-1,1\ncluster-1,2\ncluster-1,3\n"))
+		g := NewCsvGenerator(stubStorer, WithQuality(QualityOptions{RowCountThreshold: 0.2}))
+
+		q, err := g.Quality(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, []RowCountAnomaly{{Cluster: "cluster-1", Rows: 3, PreviousRows: 4, Change: -0.25}}, q.RowCountAnomalies)
+	})
+
+	t.Run("compare january with december of previous year", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubIndividualFiles(storer.SingleReportType, 2021, 12, []byte("CLUSTER,COST\ncluster-1,1\n"), []byte("CLUSTER,COST\ncluster-2,1\n"))
+		stubStorer.StubIndividualFiles(storer.SingleReportType, 2022, 1, []byte("CLUSTER,COST\ncluster-1,1\n"))
+		g := NewCsvGenerator(stubStorer)
+
+		q, err := g.Quality(context.TODO(), storer.SingleReportType, 2022, 1)
+
+		require.NoError(t, err)
+		require.Equal(t, []string{"cluster-2"}, q.MissingClusters)
+	})
+
+	t.Run("list schema violations and unreadable files", func(t *testing.T) {
+		validator, err := schema.New(schema.Schema{Columns: []schema.Column{{Name: "COST", Type: schema.NumberType}}})
+		require.NoError(t, err)
+		stubStorer := storer.NewMock()
+		stubStorer.StubListIndividualFiles(storer.SingleReportType, year, 3).Return([]storer.IndividualFile{}, nil)
+		stubStorer.StubIndividualFiles(storer.SingleReportType, year, month,
+			[]byte("CLUSTER,COST\ncluster-1,free\n"),
+			[]byte("CLUSTER,COST\ncluster-2\n"),
+		)
+		g := NewCsvGenerator(stubStorer, WithSchemas(map[storer.ReportType]*schema.Validator{storer.SingleReportType: validator}, schema.FailPolicy))
+
+		q, err := g.Quality(context.TODO(), storer.SingleReportType, year, month)
+
+		require.NoError(t, err)
+		require.Equal(t, NoExpectedClusters, q.ExpectedFrom)
+		require.Equal(t, []schema.Problem{
+			{Key: "2022/04/single/cluster-1.csv", Line: 2, Column: "COST", Value: "free", Message: "value is not a number"},
+		}, q.SchemaViolations)
+		require.Equal(t, []storer.FileFailure{
+			{Key: "2022/04/single/cluster-2.csv", Line: 2, Error: "wrong number of fields: expected 2, got 1"},
+		}, q.UnreadableFiles)
+		require.Len(t, q.Clusters, 1)
+		require.Empty(t, q.UnexpectedClusters)
+	})
+
+	t.Run("return error when individual files cannot be listed", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubListIndividualFiles(storer.SingleReportType, year, month).Return(nil, errors.New("some error"))
+		g := NewCsvGenerator(stubStorer)
+
+		_, err := g.Quality(context.TODO(), storer.SingleReportType, year, month)
+
+		require.EqualError(t, err, "some error")
+	})
+}
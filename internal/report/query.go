@@ -0,0 +1,243 @@
+package report
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+const (
+	EqualOperator       = "="
+	NotEqualOperator    = "!="
+	LessThanOperator    = "<"
+	GreaterThanOperator = ">"
+	ContainsOperator    = " contains "
+)
+
+// operators are listed so that an operator comes before any operator it contains
+var operators = []string{NotEqualOperator, LessThanOperator, GreaterThanOperator, EqualOperator, ContainsOperator}
+
+// Filter keeps the rows whose value in Column compares to Value with Operator
+type Filter struct {
+	Column   string
+	Operator string
+	Value    string
+}
+
+// Query selects rows and columns of a csv report. Filters are combined with AND
+type Query struct {
+	Columns []string
+	Filters []Filter
+}
+
+// ParseQuery reads a comma separated list of columns and filters written as COLUMN=value, COLUMN!=value, COLUMN<value, COLUMN>value or COLUMN contains value
+func ParseQuery(columns string, filters []string) (Query, error) {
+	var q Query
+	if columns != "" {
+		for _, column := range strings.Split(columns, ",") {
+			if column == "" {
+				return Query{}, fmt.Errorf("columns '%s' are invalid", columns)
+			}
+			q.Columns = append(q.Columns, column)
+		}
+	}
+
+	for _, f := range filters {
+		filter, err := parseFilter(f)
+		if err != nil {
+			return Query{}, err
+		}
+		q.Filters = append(q.Filters, filter)
+	}
+
+	return q, nil
+}
+
+func parseFilter(filter string) (Filter, error) {
+	index := -1
+	operator := ""
+	for _, op := range operators {
+		if i := strings.Index(filter, op); i >= 0 && (index < 0 || i < index) {
+			index = i
+			operator = op
+		}
+	}
+
+	if index <= 0 {
+		return Filter{}, fmt.Errorf("%w: '%s'", ErrInvalidFilter, filter)
+	}
+
+	return Filter{
+		Column:   filter[:index],
+		Operator: operator,
+		Value:    filter[index+len(operator):],
+	}, nil
+}
+
+func (q Query) IsEmpty() bool {
+	return len(q.Columns) == 0 && len(q.Filters) == 0
+}
+
+// Selection streams the rows of a csv report matching a query
+type Selection struct {
+	query   Query
+	reader  *csv.Reader
+	raw     io.Reader
+	header  []string
+	columns []int
+	filters []int
+}
+
+// Select reads the header of a csv report and validates the query columns against it, so that an invalid query fails before any output is written
+func (q Query) Select(r io.Reader) (*Selection, error) {
+	if q.IsEmpty() {
+		return &Selection{query: q, raw: r}, nil
+	}
+
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return &Selection{query: q, raw: strings.NewReader("")}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %v", err)
+	}
+
+	header = slices.Clone(header)
+	s := &Selection{query: q, reader: reader, header: header}
+	index := func(column string) (int, error) {
+		i := slices.Index(header, column)
+		if i < 0 {
+			return 0, fmt.Errorf("%w: '%s'", ErrUnknownColumn, column)
+		}
+		return i, nil
+	}
+
+	for _, column := range q.Columns {
+		i, err := index(column)
+		if err != nil {
+			return nil, err
+		}
+		s.columns = append(s.columns, i)
+	}
+
+	if len(q.Columns) == 0 {
+		for i := range header {
+			s.columns = append(s.columns, i)
+		}
+	}
+
+	for _, f := range q.Filters {
+		i, err := index(f.Column)
+		if err != nil {
+			return nil, err
+		}
+		s.filters = append(s.filters, i)
+	}
+
+	return s, nil
+}
+
+// Write streams the selected columns of the matching rows to w, header first. Without a query the report is copied unchanged
+func (s *Selection) Write(w io.Writer) error {
+	if s.raw != nil {
+		_, err := io.Copy(w, s.raw)
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	line := make([]string, len(s.columns))
+	project := func(record []string) []string {
+		for i, c := range s.columns {
+			line[i] = ""
+			if c < len(record) {
+				line[i] = record[c]
+			}
+		}
+		return line
+	}
+
+	if err := writer.Write(project(s.header)); err != nil {
+		return err
+	}
+
+	for {
+		record, err := s.reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read csv row: %v", err)
+		}
+
+		if !s.matches(record) {
+			continue
+		}
+
+		if err := writer.Write(project(record)); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (s *Selection) matches(record []string) bool {
+	for i, f := range s.query.Filters {
+		value := ""
+		if s.filters[i] < len(record) {
+			value = record[s.filters[i]]
+		}
+
+		if !f.matches(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f Filter) matches(value string) bool {
+	switch f.Operator {
+	case EqualOperator:
+		return value == f.Value
+	case NotEqualOperator:
+		return value != f.Value
+	case ContainsOperator:
+		return strings.Contains(value, f.Value)
+	case LessThanOperator:
+		return compare(value, f.Value) < 0
+	case GreaterThanOperator:
+		return compare(value, f.Value) > 0
+	default:
+		return false
+	}
+}
+
+// compare orders numbers by value and anything else lexically
+func compare(a string, b string) int {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,115 @@
+//go:build unit
+
+package report
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	t.Run("parse columns and filters", func(t *testing.T) {
+		q, err := ParseQuery("CLUSTER,COST", []string{"CLUSTER=cluster-1", "CLUSTER!=cluster-2", "COST<10", "COST>1", "OWNER contains team"})
+
+		require.NoError(t, err)
+		require.Equal(t, Query{
+			Columns: []string{"CLUSTER", "COST"},
+			Filters: []Filter{
+				{Column: "CLUSTER", Operator: EqualOperator, Value: "cluster-1"},
+				{Column: "CLUSTER", Operator: NotEqualOperator, Value: "cluster-2"},
+				{Column: "COST", Operator: LessThanOperator, Value: "10"},
+				{Column: "COST", Operator: GreaterThanOperator, Value: "1"},
+				{Column: "OWNER", Operator: ContainsOperator, Value: "team"},
+			},
+		}, q)
+	})
+
+	t.Run("keep operators in filter value", func(t *testing.T) {
+		q, err := ParseQuery("", []string{"LABELS=env=prod"})
+
+		require.NoError(t, err)
+		require.Equal(t, []Filter{{Column: "LABELS", Operator: EqualOperator, Value: "env=prod"}}, q.Filters)
+	})
+
+	t.Run("return error for filter without column or operator", func(t *testing.T) {
+		for _, filter := range []string{"", "CLUSTER", "=cluster-1"} {
+			_, err := ParseQuery("", []string{filter})
+
+			require.ErrorIs(t, err, ErrInvalidFilter, filter)
+		}
+	})
+
+	t.Run("return error for empty column", func(t *testing.T) {
+		_, err := ParseQuery("CLUSTER,,COST", nil)
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "columns 'CLUSTER,,COST' are invalid")
+	})
+}
+
+func TestQuery_Select(t *testing.T) {
+	data := []byte(`CLUSTER,OWNER,COST
+cluster-1,team-a,5
+cluster-2,team-b,12
+cluster-10,team-a,1.5
+`)
+
+	selectAll := func(t *testing.T, q Query) string {
+		s, err := q.Select(bytes.NewReader(data))
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, s.Write(&buf))
+		return buf.String()
+	}
+
+	t.Run("copy report unchanged without query", func(t *testing.T) {
+		require.Equal(t, string(data), selectAll(t, Query{}))
+	})
+
+	t.Run("project columns in requested order", func(t *testing.T) {
+		require.Equal(t, `COST,CLUSTER
+5,cluster-1
+12,cluster-2
+1.5,cluster-10
+`, selectAll(t, Query{Columns: []string{"COST", "CLUSTER"}}))
+	})
+
+	t.Run("keep rows matching every filter", func(t *testing.T) {
+		require.Equal(t, `CLUSTER,OWNER,COST
+cluster-1,team-a,5
+`, selectAll(t, Query{Filters: []Filter{
+			{Column: "OWNER", Operator: EqualOperator, Value: "team-a"},
+			{Column: "CLUSTER", Operator: NotEqualOperator, Value: "cluster-10"},
+		}}))
+	})
+
+	t.Run("compare numbers by value", func(t *testing.T) {
+		require.Equal(t, `CLUSTER
+cluster-2
+`, selectAll(t, Query{Columns: []string{"CLUSTER"}, Filters: []Filter{{Column: "COST", Operator: GreaterThanOperator, Value: "9"}}}))
+
+		require.Equal(t, `CLUSTER
+cluster-10
+`, selectAll(t, Query{Columns: []string{"CLUSTER"}, Filters: []Filter{{Column: "COST", Operator: LessThanOperator, Value: "2"}}}))
+	})
+
+	t.Run("match values containing filter value", func(t *testing.T) {
+		require.Equal(t, `CLUSTER
+cluster-10
+`, selectAll(t, Query{Columns: []string{"CLUSTER"}, Filters: []Filter{{Column: "CLUSTER", Operator: ContainsOperator, Value: "-10"}}}))
+	})
+
+	t.Run("return error for column not in header", func(t *testing.T) {
+		for _, q := range []Query{
+			{Columns: []string{"REGION"}},
+			{Filters: []Filter{{Column: "REGION", Operator: EqualOperator, Value: "us"}}},
+		} {
+			_, err := q.Select(bytes.NewReader(data))
+
+			require.ErrorIs(t, err, ErrUnknownColumn)
+			require.Contains(t, err.Error(), "'REGION'")
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+)
+
+// Records reads what builds leave next to an aggregate: the files they left out and the versions they stored.
+// Callers that do not build anything depend on it rather than on Generator
+type Records interface {
+	// Failures returns the individual files left out of the latest best-effort build of the aggregate of the given report type and period
+	Failures(ctx context.Context, reportType storer.ReportType, year int, month int) ([]storer.FileFailure, error)
+	// Quarantined returns the individual files of the given report type and period moved to quarantine
+	Quarantined(ctx context.Context, reportType storer.ReportType, year int, month int) ([]storer.QuarantinedFile, error)
+	// Release moves a quarantined file back among the individual files of its period and invalidates the aggregate so that the next build reads it.
+	// It returns storer.ErrNotQuarantined when there is no such file and storer.ErrPeriodClosed when the period is not open
+	Release(ctx context.Context, reportType storer.ReportType, year int, month int, name string) (string, error)
+	// Versions returns every build of the aggregate of the given report type and period, oldest first
+	Versions(ctx context.Context, reportType storer.ReportType, year int, month int) ([]storer.AggregateVersion, error)
+	// Version returns the content of one build of the aggregate. It returns ErrVersionNotFound when there is no such build
+	Version(ctx context.Context, reportType storer.ReportType, year int, month int, id string) ([]byte, error)
+}
+
+var _ Records = &storerRecords{}
+
+// storerRecords reads records straight from the storer, which traces every call
+type storerRecords struct {
+	storer storer.Storer
+}
+
+func NewRecords(storer storer.Storer) Records {
+	return &storerRecords{storer: storer}
+}
+
+func (r *storerRecords) Failures(ctx context.Context, reportType storer.ReportType, year int, month int) ([]storer.FileFailure, error) {
+	return r.storer.RetrieveFailures(ctx, reportType, year, month)
+}
+
+func (r *storerRecords) Quarantined(ctx context.Context, reportType storer.ReportType, year int, month int) ([]storer.QuarantinedFile, error) {
+	return r.storer.ListQuarantinedFiles(ctx, reportType, year, month)
+}
+
+func (r *storerRecords) Release(ctx context.Context, reportType storer.ReportType, year int, month int, name string) (string, error) {
+	key, err := r.storer.ReleaseQuarantinedFile(ctx, reportType, year, month, name)
+	if err != nil {
+		return "", err
+	}
+
+	if err := r.storer.DeleteAggregated(ctx, reportType, year, month); err != nil {
+		return "", fmt.Errorf("released %s but failed to invalidate aggregate: %v", key, err)
+	}
+
+	return key, nil
+}
+
+func (r *storerRecords) Versions(ctx context.Context, reportType storer.ReportType, year int, month int) ([]storer.AggregateVersion, error) {
+	return r.storer.ListAggregateVersions(ctx, reportType, year, month)
+}
+
+func (r *storerRecords) Version(ctx context.Context, reportType storer.ReportType, year int, month int, id string) ([]byte, error) {
+	data, err := r.storer.RetrieveAggregateVersion(ctx, reportType, year, month, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if data == nil {
+		return nil, fmt.Errorf("%w: %s for %02d/%d", ErrVersionNotFound, id, month, year)
+	}
+
+	return data, nil
+}
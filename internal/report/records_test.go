@@ -0,0 +1,59 @@
+//go:build unit
+
+package report
+
+import (
+	"context"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRecords(t *testing.T) {
+	year := 2022
+	month := 4
+
+	t.Run("return content of version", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrieveAggregateVersion(storer.CumulativeReportType, year, month, "20220503T101500.000000000Z").Return([]byte("some,data"), nil)
+		r := NewRecords(stubStorer)
+
+		data, err := r.Version(context.TODO(), storer.CumulativeReportType, year, month, "20220503T101500.000000000Z")
+
+		require.NoError(t, err)
+		require.Equal(t, []byte("some,data"), data)
+	})
+
+	t.Run("return error when version is not found", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrieveAggregateVersion(storer.CumulativeReportType, year, month, "unknown").Return(nil, nil)
+		r := NewRecords(stubStorer)
+
+		_, err := r.Version(context.TODO(), storer.CumulativeReportType, year, month, "unknown")
+
+		require.ErrorIs(t, err, ErrVersionNotFound)
+	})
+
+	t.Run("release quarantined file and invalidate aggregate", func(t *testing.T) {
+		mockStorer := storer.NewMock()
+		mockStorer.StubReleaseQuarantinedFile(storer.SingleReportType, year, month, "cluster-2.csv").Return("2022/04/single/cluster-2.csv", nil)
+		mockStorer.StubDeleteAggregated(storer.SingleReportType, year, month).Return(nil)
+		r := NewRecords(mockStorer)
+
+		key, err := r.Release(context.TODO(), storer.SingleReportType, year, month, "cluster-2.csv")
+
+		require.NoError(t, err)
+		require.Equal(t, "2022/04/single/cluster-2.csv", key)
+		mockStorer.AssertDeleteAggregatedCalled(t, storer.SingleReportType, year, month)
+	})
+
+	t.Run("return error when file is not quarantined", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubReleaseQuarantinedFile(storer.SingleReportType, year, month, "cluster-2.csv").Return("", storer.ErrNotQuarantined)
+		r := NewRecords(stubStorer)
+
+		_, err := r.Release(context.TODO(), storer.SingleReportType, year, month, "cluster-2.csv")
+
+		require.ErrorIs(t, err, storer.ErrNotQuarantined)
+	})
+}
@@ -0,0 +1,268 @@
+package report
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Sorting orders the rows of aggregates so that identical inputs build byte-identical aggregates whatever the order of their files
+type Sorting struct {
+	// Keys lists the columns to sort by per report type. Report types without sort keys keep the merge order
+	Keys map[storer.ReportType][]string
+	// ChunkRows is the number of rows held and sorted in memory at once before they are spilled to a temporary file. Zero sorts every row in memory
+	ChunkRows int
+	// TempDir holds the spilled chunks. Empty uses the default directory for temporary files
+	TempDir string
+}
+
+// newSorter returns a sorter ordering rows by the sort keys of the report type, breaking ties on the whole row, or nil when the report type has no sort keys.
+// Spilled rows are written back exactly as they were added, so the output does not depend on whether the rows were spilled
+func (s Sorting) newSorter(reportType storer.ReportType, header []string) (*externalSorter, error) {
+	keys := s.Keys[reportType]
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	var index []int
+	for _, k := range keys {
+		i := slices.Index(header, k)
+		if i < 0 {
+			return nil, fmt.Errorf("%w: sort key '%s'", ErrUnknownColumn, k)
+		}
+		index = append(index, i)
+	}
+
+	return &externalSorter{
+		compare:   compareRecords(index),
+		chunkRows: s.ChunkRows,
+		tempDir:   s.TempDir,
+	}, nil
+}
+
+// compareRecords orders records by the values at index, then by their whole content
+func compareRecords(index []int) func(a, b []string) int {
+	return func(a, b []string) int {
+		for _, i := range index {
+			if c := strings.Compare(valueAt(a, i), valueAt(b, i)); c != 0 {
+				return c
+			}
+		}
+
+		return slices.Compare(a, b)
+	}
+}
+
+func valueAt(record []string, i int) string {
+	if i < len(record) {
+		return record[i]
+	}
+
+	return ""
+}
+
+// externalSorter sorts records in chunks of chunkRows, spilling every full chunk to a temporary file and merging the files back in order
+type externalSorter struct {
+	compare   func(a, b []string) int
+	chunkRows int
+	tempDir   string
+	chunk     [][]string
+	spills    []*os.File
+}
+
+func (s *externalSorter) add(record []string) error {
+	s.chunk = append(s.chunk, record)
+	if s.chunkRows <= 0 || len(s.chunk) < s.chunkRows {
+		return nil
+	}
+
+	return s.spill()
+}
+
+func (s *externalSorter) spill() error {
+	slices.SortFunc(s.chunk, s.compare)
+
+	f, err := os.CreateTemp(s.tempDir, "aggregate-sort-*")
+	if err != nil {
+		return fmt.Errorf("failed to create sort chunk file: %v", err)
+	}
+	s.spills = append(s.spills, f)
+
+	w := &chunkWriter{w: bufio.NewWriter(f)}
+	for _, record := range s.chunk {
+		if err := w.write(record); err != nil {
+			return fmt.Errorf("failed to write sort chunk file: %v", err)
+		}
+	}
+
+	if err := w.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write sort chunk file: %v", err)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind sort chunk file: %v", err)
+	}
+
+	s.chunk = nil
+	return nil
+}
+
+// writeTo writes every added record in order
+func (s *externalSorter) writeTo(w *csv.Writer) error {
+	if len(s.spills) == 0 {
+		slices.SortFunc(s.chunk, s.compare)
+		if err := w.WriteAll(s.chunk); err != nil {
+			return fmt.Errorf("failed to write csv content to buffer: %v", err)
+		}
+		return nil
+	}
+
+	if len(s.chunk) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+
+	h := &chunkHeap{compare: s.compare}
+	for _, f := range s.spills {
+		if err := h.push(&chunkReader{r: bufio.NewReader(f)}); err != nil {
+			return err
+		}
+	}
+	heap.Init(h)
+
+	for h.Len() > 0 {
+		head := h.heads[0]
+		if err := w.Write(head.record); err != nil {
+			return fmt.Errorf("failed to write csv content to buffer: %v", err)
+		}
+
+		record, err := head.reader.read()
+		if err == io.EOF {
+			heap.Pop(h)
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read sort chunk file: %v", err)
+		}
+
+		head.record = record
+		heap.Fix(h, 0)
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write csv content to buffer: %v", err)
+	}
+	return nil
+}
+
+// close removes the spilled chunks
+func (s *externalSorter) close() {
+	for _, f := range s.spills {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	s.spills = nil
+}
+
+// chunkHead is the smallest record of a spilled chunk not yet written
+type chunkHead struct {
+	record []string
+	reader *chunkReader
+}
+
+// chunkHeap keeps the heads of the spilled chunks ordered so the smallest record is always first
+type chunkHeap struct {
+	compare func(a, b []string) int
+	heads   []*chunkHead
+}
+
+// push adds the first record of a chunk, leaving empty chunks out
+func (h *chunkHeap) push(reader *chunkReader) error {
+	record, err := reader.read()
+	if err == io.EOF {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to read sort chunk file: %v", err)
+	}
+
+	h.heads = append(h.heads, &chunkHead{record: record, reader: reader})
+	return nil
+}
+
+func (h *chunkHeap) Len() int           { return len(h.heads) }
+func (h *chunkHeap) Less(i, j int) bool { return h.compare(h.heads[i].record, h.heads[j].record) < 0 }
+func (h *chunkHeap) Swap(i, j int)      { h.heads[i], h.heads[j] = h.heads[j], h.heads[i] }
+func (h *chunkHeap) Push(x any)         { h.heads = append(h.heads, x.(*chunkHead)) }
+func (h *chunkHeap) Pop() any {
+	last := h.heads[len(h.heads)-1]
+	h.heads = h.heads[:len(h.heads)-1]
+	return last
+}
+
+// chunkWriter writes records to a spilled chunk as their number of fields followed by every field prefixed with its length.
+// Unlike csv, which reads \r\n inside quoted fields back as \n, this keeps every byte of a record
+type chunkWriter struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+func (c *chunkWriter) write(record []string) error {
+	c.buf = binary.AppendUvarint(c.buf[:0], uint64(len(record)))
+	for _, field := range record {
+		c.buf = binary.AppendUvarint(c.buf, uint64(len(field)))
+		c.buf = append(c.buf, field...)
+	}
+
+	_, err := c.w.Write(c.buf)
+	return err
+}
+
+// chunkReader reads back the records of a spilled chunk written by chunkWriter
+type chunkReader struct {
+	r *bufio.Reader
+}
+
+// read returns the next record, or io.EOF once every record has been read
+func (c *chunkReader) read() ([]string, error) {
+	fields, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]string, fields)
+	for i := range record {
+		size, err := binary.ReadUvarint(c.r)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		field := make([]byte, size)
+		if _, err := io.ReadFull(c.r, field); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		record[i] = string(field)
+	}
+
+	return record, nil
+}
+
+// unexpectedEOF tells a chunk cut short within a record apart from one that ends after its last record
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,124 @@
+//go:build unit
+
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestSorting(t *testing.T) {
+	header := []string{"CLUSTER", "DAY", "COST"}
+	records := func() [][]string {
+		return [][]string{
+			{"cluster-2", "02", "4"},
+			{"cluster-1", "02", "2"},
+			{"cluster-2", "01", "3"},
+			{"cluster-1", "01", "1.5"},
+			{"cluster-1", "01", "1"},
+		}
+	}
+	sorted := "cluster-1,01,1\ncluster-1,01,1.5\ncluster-1,02,2\ncluster-2,01,3\ncluster-2,02,4\n"
+	sortRecords := func(s Sorting, records [][]string) (string, error) {
+		sorter, err := s.newSorter(storer.SingleReportType, header)
+		if err != nil {
+			return "", err
+		}
+		defer sorter.close()
+
+		for _, record := range records {
+			if err := sorter.add(record); err != nil {
+				return "", err
+			}
+		}
+
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		err = sorter.writeTo(w)
+		w.Flush()
+		return buf.String(), err
+	}
+
+	t.Run("sort by keys breaking ties on whole row", func(t *testing.T) {
+		s := Sorting{Keys: map[storer.ReportType][]string{storer.SingleReportType: {"CLUSTER", "DAY"}}}
+
+		output, err := sortRecords(s, records())
+
+		require.NoError(t, err)
+		require.Equal(t, sorted, output)
+	})
+
+	t.Run("merge chunks spilled to temporary files and remove them", func(t *testing.T) {
+		dir := t.TempDir()
+		s := Sorting{
+			Keys:      map[storer.ReportType][]string{storer.SingleReportType: {"CLUSTER", "DAY"}},
+			ChunkRows: 2,
+			TempDir:   dir,
+		}
+
+		output, err := sortRecords(s, records())
+
+		require.NoError(t, err)
+		require.Equal(t, sorted, output)
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+
+	t.Run("write spilled rows exactly as rows sorted in memory", func(t *testing.T) {
+		s := Sorting{Keys: map[storer.ReportType][]string{storer.SingleReportType: {"CLUSTER"}}}
+		spilling := Sorting{Keys: s.Keys, ChunkRows: 1, TempDir: t.TempDir()}
+		withLineBreaks := func() [][]string {
+			return [][]string{
+				{"cluster-2", "line 1\r\nline 2", ""},
+				{"cluster-1", "\"quoted\", with comma", "\n"},
+				{"cluster-3"},
+			}
+		}
+
+		inMemory, err := sortRecords(s, withLineBreaks())
+		require.NoError(t, err)
+		spilled, err := sortRecords(spilling, withLineBreaks())
+		require.NoError(t, err)
+
+		require.Equal(t, inMemory, spilled)
+		require.Contains(t, spilled, "line 1\r\nline 2")
+	})
+
+	t.Run("produce same output whatever the input order", func(t *testing.T) {
+		s := Sorting{Keys: map[storer.ReportType][]string{storer.SingleReportType: {"DAY"}}, ChunkRows: 2, TempDir: t.TempDir()}
+		reversed := records()
+		for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+			reversed[i], reversed[j] = reversed[j], reversed[i]
+		}
+
+		first, err := sortRecords(s, records())
+		require.NoError(t, err)
+		second, err := sortRecords(s, reversed)
+		require.NoError(t, err)
+
+		require.Equal(t, first, second)
+		require.Equal(t, "cluster-1,01,1\ncluster-1,01,1.5\ncluster-2,01,3\ncluster-1,02,2\ncluster-2,02,4\n", first)
+	})
+
+	t.Run("return no sorter for report type without sort keys", func(t *testing.T) {
+		s := Sorting{Keys: map[storer.ReportType][]string{storer.CumulativeReportType: {"CLUSTER"}}}
+
+		sorter, err := s.newSorter(storer.SingleReportType, header)
+
+		require.NoError(t, err)
+		require.Nil(t, sorter)
+	})
+
+	t.Run("return error for sort key not in header", func(t *testing.T) {
+		s := Sorting{Keys: map[storer.ReportType][]string{storer.SingleReportType: {"REGION"}}}
+
+		_, err := sortRecords(s, records())
+
+		require.ErrorIs(t, err, ErrUnknownColumn)
+	})
+}
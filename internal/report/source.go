@@ -0,0 +1,87 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/ingest"
+	"github.com/hpcsc/outside-in-go/internal/schema"
+	"strconv"
+	"strings"
+)
+
+// sourceRows reads the rows of an individual file one at a time along with the schema problems of each row
+type sourceRows struct {
+	reader *ingest.Reader
+	file   *schema.File
+	header []string
+	// headerProblems apply to every row, since the rows of a file whose header does not match its schema cannot be trusted
+	headerProblems []schema.Problem
+}
+
+// newSourceRows reads the header of an individual file as configured by opts and binds it to validator, which is nil when the report type has no schema
+func newSourceRows(key string, data []byte, opts ingest.Options, validator *schema.Validator) (*sourceRows, error) {
+	reader, err := ingest.NewReader(key, data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := &sourceRows{reader: reader, header: reader.Header}
+	if validator != nil {
+		rows.file, rows.headerProblems = validator.File(key, reader.Header)
+	}
+
+	return rows, nil
+}
+
+// next returns the next row with its line and problems, or io.EOF after the last row
+func (r *sourceRows) next() ([]string, int, []schema.Problem, error) {
+	record, line, err := r.reader.Read()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	switch {
+	case len(r.headerProblems) > 0:
+		return record, line, r.headerProblems, nil
+	case r.file != nil:
+		return record, line, r.file.Row(line, record), nil
+	default:
+		return record, line, nil, nil
+	}
+}
+
+// rejectedRow is a source row left out of an aggregate because it does not match the schema
+type rejectedRow struct {
+	key      string
+	line     int
+	problems []schema.Problem
+	record   []string
+}
+
+// writeRejectedRows renders rejected rows as csv, each row prefixed with its file, line and problems
+func writeRejectedRows(header []string, rows []rejectedRow) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(append([]string{"key", "line", "problems"}, header...)); err != nil {
+		return nil, err
+	}
+
+	for _, r := range rows {
+		problems := make([]string, 0, len(r.problems))
+		for _, p := range r.problems {
+			problems = append(problems, fmt.Sprintf("column '%s': %s", p.Column, p.Message))
+		}
+
+		if err := writer.Write(append([]string{r.key, strconv.Itoa(r.line), strings.Join(problems, "; ")}, r.record...)); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write csv content to buffer: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,282 @@
+package report
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidSummary = errors.New("invalid summary")
+	ErrNonNumeric     = errors.New("non-numeric value")
+)
+
+const (
+	SumFunction   = "sum"
+	CountFunction = "count"
+	MinFunction   = "min"
+	MaxFunction   = "max"
+	AvgFunction   = "avg"
+)
+
+// Measure is a function computed over a column for each group. Count needs no column, it counts the rows of the group
+type Measure struct {
+	Function string
+	Column   string
+}
+
+func (m Measure) String() string {
+	if m.Column == "" {
+		return m.Function
+	}
+
+	return fmt.Sprintf("%s(%s)", m.Function, m.Column)
+}
+
+// Summary groups the rows of a report by the values of GroupBy columns and computes Measures for each group.
+// Without GroupBy columns the whole report is a single group
+type Summary struct {
+	GroupBy  []string
+	Measures []Measure
+}
+
+// ParseSummary reads a comma separated list of group by columns and measures written as function:COLUMN, or count. It defaults to count when no measure is given
+func ParseSummary(groupBy string, measures []string) (Summary, error) {
+	var s Summary
+	if groupBy != "" {
+		for _, column := range strings.Split(groupBy, ",") {
+			if column == "" {
+				return Summary{}, fmt.Errorf("%w: group by '%s'", ErrInvalidSummary, groupBy)
+			}
+			s.GroupBy = append(s.GroupBy, column)
+		}
+	}
+
+	for _, m := range measures {
+		function, column, _ := strings.Cut(m, ":")
+		switch function {
+		case CountFunction:
+			if column != "" {
+				return Summary{}, fmt.Errorf("%w: count takes no column, got '%s'", ErrInvalidSummary, m)
+			}
+		case SumFunction, MinFunction, MaxFunction, AvgFunction:
+			if column == "" {
+				return Summary{}, fmt.Errorf("%w: %s needs a column, got '%s'", ErrInvalidSummary, function, m)
+			}
+		default:
+			return Summary{}, fmt.Errorf("%w: aggregate '%s' is not one of sum, count, min, max, avg", ErrInvalidSummary, m)
+		}
+		s.Measures = append(s.Measures, Measure{Function: function, Column: column})
+	}
+
+	if len(s.Measures) == 0 {
+		s.Measures = []Measure{{Function: CountFunction}}
+	}
+
+	return s, nil
+}
+
+// Name identifies the summary in the cache. Summaries with the same columns and measures share a name
+func (s Summary) Name() string {
+	parts := []string{strings.Join(s.GroupBy, ",")}
+	for _, m := range s.Measures {
+		parts = append(parts, m.String())
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(parts, "\x00"))))[:16]
+}
+
+// cacheName identifies the summary of a given aggregate in the cache
+func (s Summary) cacheName(aggregate []byte) string {
+	return fmt.Sprintf("%s-%x", s.Name(), sha256.Sum256(aggregate))
+}
+
+// Summarize computes a summary of a csv report in one pass over its rows. Empty cells are left out of sum, min, max and avg,
+// any other cell of a measured column that is not a number fails the summary with ErrNonNumeric
+func Summarize(data []byte, s Summary) ([]byte, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: report is empty", ErrNoData)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %v", err)
+	}
+
+	index := func(column string) (int, error) {
+		i := slices.Index(header, column)
+		if i < 0 {
+			return 0, fmt.Errorf("%w: '%s'", ErrUnknownColumn, column)
+		}
+		return i, nil
+	}
+
+	groupBy := make([]int, 0, len(s.GroupBy))
+	for _, column := range s.GroupBy {
+		i, err := index(column)
+		if err != nil {
+			return nil, err
+		}
+		groupBy = append(groupBy, i)
+	}
+
+	measured := make([]int, len(s.Measures))
+	for i, m := range s.Measures {
+		if m.Column == "" {
+			continue
+		}
+
+		c, err := index(m.Column)
+		if err != nil {
+			return nil, err
+		}
+		measured[i] = c
+	}
+
+	groups := map[string]*group{}
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv row: %v", err)
+		}
+		line++
+
+		values := make([]string, len(groupBy))
+		for i, c := range groupBy {
+			values[i] = cell(record, c)
+		}
+
+		key := strings.Join(values, "\x00")
+		g, ok := groups[key]
+		if !ok {
+			g = &group{values: values, measures: make([]accumulator, len(s.Measures))}
+			groups[key] = g
+		}
+		g.rows++
+
+		for i, m := range s.Measures {
+			if m.Column == "" {
+				continue
+			}
+
+			value := cell(record, measured[i])
+			if value == "" {
+				continue
+			}
+
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: '%s' in column '%s' at line %d", ErrNonNumeric, value, m.Column, line)
+			}
+			g.measures[i].add(number)
+		}
+	}
+
+	sorted := make([]*group, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, g)
+	}
+	slices.SortFunc(sorted, func(a, b *group) int {
+		return slices.Compare(a.values, b.values)
+	})
+
+	var summary bytes.Buffer
+	writer := csv.NewWriter(&summary)
+	summaryHeader := append([]string{}, s.GroupBy...)
+	for _, m := range s.Measures {
+		summaryHeader = append(summaryHeader, m.String())
+	}
+
+	if err := writer.Write(summaryHeader); err != nil {
+		return nil, err
+	}
+
+	for _, g := range sorted {
+		row := append([]string{}, g.values...)
+		for i, m := range s.Measures {
+			row = append(row, g.value(m.Function, g.measures[i]))
+		}
+
+		if err := writer.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write csv content to buffer: %v", err)
+	}
+
+	return summary.Bytes(), nil
+}
+
+func cell(record []string, i int) string {
+	if i < len(record) {
+		return record[i]
+	}
+
+	return ""
+}
+
+type group struct {
+	values   []string
+	rows     int
+	measures []accumulator
+}
+
+// value renders a measure of the group. Measures over a column without any number are left empty
+func (g *group) value(function string, a accumulator) string {
+	if function == CountFunction {
+		return strconv.Itoa(g.rows)
+	}
+
+	if a.count == 0 {
+		return ""
+	}
+
+	var v float64
+	switch function {
+	case SumFunction:
+		v = a.sum
+	case MinFunction:
+		v = a.min
+	case MaxFunction:
+		v = a.max
+	case AvgFunction:
+		v = a.sum / float64(a.count)
+	}
+
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+type accumulator struct {
+	count int
+	sum   float64
+	min   float64
+	max   float64
+}
+
+func (a *accumulator) add(v float64) {
+	if a.count == 0 {
+		a.min = math.Inf(1)
+		a.max = math.Inf(-1)
+	}
+
+	a.count++
+	a.sum += v
+	a.min = math.Min(a.min, v)
+	a.max = math.Max(a.max, v)
+}
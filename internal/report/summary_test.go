@@ -0,0 +1,134 @@
+//go:build unit
+
+package report
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseSummary(t *testing.T) {
+	t.Run("parse group by columns and measures", func(t *testing.T) {
+		s, err := ParseSummary("CLUSTER,TEAM", []string{"sum:COST", "count", "min:CPU", "max:CPU", "avg:CPU"})
+
+		require.NoError(t, err)
+		require.Equal(t, Summary{
+			GroupBy: []string{"CLUSTER", "TEAM"},
+			Measures: []Measure{
+				{Function: SumFunction, Column: "COST"},
+				{Function: CountFunction},
+				{Function: MinFunction, Column: "CPU"},
+				{Function: MaxFunction, Column: "CPU"},
+				{Function: AvgFunction, Column: "CPU"},
+			},
+		}, s)
+	})
+
+	t.Run("default to count", func(t *testing.T) {
+		s, err := ParseSummary("CLUSTER", nil)
+
+		require.NoError(t, err)
+		require.Equal(t, []Measure{{Function: CountFunction}}, s.Measures)
+	})
+
+	t.Run("return error for invalid measure", func(t *testing.T) {
+		for _, measure := range []string{"median:COST", "sum", "count:COST", ""} {
+			_, err := ParseSummary("CLUSTER", []string{measure})
+
+			require.ErrorIs(t, err, ErrInvalidSummary, measure)
+		}
+	})
+
+	t.Run("return error for empty group by column", func(t *testing.T) {
+		_, err := ParseSummary("CLUSTER,", nil)
+
+		require.ErrorIs(t, err, ErrInvalidSummary)
+	})
+}
+
+func TestSummary_Name(t *testing.T) {
+	t.Run("name summaries by their columns and measures", func(t *testing.T) {
+		a, _ := ParseSummary("CLUSTER", []string{"sum:COST"})
+		b, _ := ParseSummary("CLUSTER", []string{"sum:COST"})
+		c, _ := ParseSummary("CLUSTER", []string{"avg:COST"})
+
+		require.Equal(t, a.Name(), b.Name())
+		require.NotEqual(t, a.Name(), c.Name())
+		require.Regexp(t, "^[0-9a-f]{16}$", a.Name())
+	})
+}
+
+func TestSummarize(t *testing.T) {
+	data := []byte(`CLUSTER,TEAM,COST
+cluster-2,team-a,4
+cluster-1,team-a,1.5
+cluster-1,team-b,2.5
+cluster-1,team-a,
+`)
+
+	t.Run("compute measures per group sorted by group values", func(t *testing.T) {
+		s, err := ParseSummary("CLUSTER", []string{"sum:COST", "count", "min:COST", "max:COST", "avg:COST"})
+		require.NoError(t, err)
+
+		summary, err := Summarize(data, s)
+
+		require.NoError(t, err)
+		require.Equal(t, `CLUSTER,sum(COST),count,min(COST),max(COST),avg(COST)
+cluster-1,4,3,1.5,2.5,2
+cluster-2,4,1,4,4,4
+`, string(summary))
+	})
+
+	t.Run("group by several columns", func(t *testing.T) {
+		s, err := ParseSummary("TEAM,CLUSTER", []string{"sum:COST"})
+		require.NoError(t, err)
+
+		summary, err := Summarize(data, s)
+
+		require.NoError(t, err)
+		require.Equal(t, `TEAM,CLUSTER,sum(COST)
+team-a,cluster-1,1.5
+team-a,cluster-2,4
+team-b,cluster-1,2.5
+`, string(summary))
+	})
+
+	t.Run("summarize whole report without group by columns", func(t *testing.T) {
+		s, err := ParseSummary("", []string{"sum:COST", "count"})
+		require.NoError(t, err)
+
+		summary, err := Summarize(data, s)
+
+		require.NoError(t, err)
+		require.Equal(t, "sum(COST),count\n8,4\n", string(summary))
+	})
+
+	t.Run("leave measure empty when group has no numbers", func(t *testing.T) {
+		s, err := ParseSummary("TEAM", []string{"avg:COST"})
+		require.NoError(t, err)
+
+		summary, err := Summarize([]byte("TEAM,COST\nteam-a,\n"), s)
+
+		require.NoError(t, err)
+		require.Equal(t, "TEAM,avg(COST)\nteam-a,\n", string(summary))
+	})
+
+	t.Run("return error with location of non-numeric cell", func(t *testing.T) {
+		s, err := ParseSummary("CLUSTER", []string{"sum:TEAM"})
+		require.NoError(t, err)
+
+		_, err = Summarize(data, s)
+
+		require.ErrorIs(t, err, ErrNonNumeric)
+		require.Contains(t, err.Error(), "'team-a' in column 'TEAM' at line 2")
+	})
+
+	t.Run("return error for column not in header", func(t *testing.T) {
+		s, err := ParseSummary("REGION", nil)
+		require.NoError(t, err)
+
+		_, err = Summarize(data, s)
+
+		require.ErrorIs(t, err, ErrUnknownColumn)
+	})
+}
@@ -0,0 +1,30 @@
+package s3event
+
+import (
+	"context"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ Processor = &mockProcessor{}
+
+type mockProcessor struct {
+	mock.Mock
+}
+
+func NewMockProcessor() *mockProcessor {
+	return &mockProcessor{}
+}
+
+func (m *mockProcessor) Process(ctx context.Context, body []byte) error {
+	args := m.Called(ctx, body)
+	return args.Error(0)
+}
+
+func (m *mockProcessor) StubProcess(body interface{}) *mock.Call {
+	return m.On("Process", mock.Anything, body)
+}
+
+func (m *mockProcessor) Stop() context.Context {
+	args := m.Called()
+	return args.Get(0).(context.Context)
+}
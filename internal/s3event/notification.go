@@ -0,0 +1,64 @@
+package s3event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var ErrInvalidNotification = errors.New("invalid s3 event notification")
+
+// notification is the subset of an S3 event notification this service reacts to
+type notification struct {
+	Records []record `json:"Records"`
+}
+
+type record struct {
+	EventName string `json:"eventName"`
+	S3        struct {
+		Object struct {
+			Key string `json:"key"`
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+// snsEnvelope wraps a notification fanned out to a queue through an SNS topic
+type snsEnvelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// createdKeys returns the keys of the objects created according to an S3 event notification, optionally wrapped in an SNS envelope.
+// Test events S3 sends when notifications are configured have no records and yield no keys
+func createdKeys(body []byte) ([]string, error) {
+	var envelope snsEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNotification, err)
+	}
+	if envelope.Type == "Notification" && envelope.Message != "" {
+		body = []byte(envelope.Message)
+	}
+
+	var n notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNotification, err)
+	}
+
+	var keys []string
+	for _, r := range n.Records {
+		if !strings.HasPrefix(r.EventName, "ObjectCreated:") {
+			continue
+		}
+
+		// keys are URL encoded in notifications, with spaces encoded as '+'
+		key, err := url.QueryUnescape(r.S3.Object.Key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key '%s' is not URL encoded: %v", ErrInvalidNotification, r.S3.Object.Key, err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,41 @@
+//go:build unit
+
+package s3event
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCreatedKeys(t *testing.T) {
+	t.Run("return decoded keys of object created records", func(t *testing.T) {
+		keys, err := createdKeys([]byte(`{"Records":[
+			{"eventName":"ObjectCreated:Put","s3":{"object":{"key":"2022/04/single/cluster+1%281%29.csv"}}},
+			{"eventName":"ObjectRemoved:Delete","s3":{"object":{"key":"2022/04/single/cluster-2.csv"}}},
+			{"eventName":"ObjectCreated:CompleteMultipartUpload","s3":{"object":{"key":"2022/04/cumulative/cluster-3.csv"}}}
+		]}`))
+
+		require.NoError(t, err)
+		require.Equal(t, []string{"2022/04/single/cluster 1(1).csv", "2022/04/cumulative/cluster-3.csv"}, keys)
+	})
+
+	t.Run("unwrap notification delivered through sns", func(t *testing.T) {
+		keys, err := createdKeys([]byte(`{"Type":"Notification","Message":"{\"Records\":[{\"eventName\":\"ObjectCreated:Put\",\"s3\":{\"object\":{\"key\":\"2022/04/single/cluster-1.csv\"}}}]}"}`))
+
+		require.NoError(t, err)
+		require.Equal(t, []string{"2022/04/single/cluster-1.csv"}, keys)
+	})
+
+	t.Run("return no keys for test event", func(t *testing.T) {
+		keys, err := createdKeys([]byte(`{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"some-bucket"}`))
+
+		require.NoError(t, err)
+		require.Empty(t, keys)
+	})
+
+	t.Run("return error for body that is not json", func(t *testing.T) {
+		_, err := createdKeys([]byte("not json"))
+
+		require.ErrorIs(t, err, ErrInvalidNotification)
+	})
+}
@@ -0,0 +1,221 @@
+package s3event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/logging"
+	"github.com/hpcsc/outside-in-go/internal/metrics"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var tracer = otel.Tracer("github.com/hpcsc/outside-in-go/internal/s3event")
+
+type Processor interface {
+	// Process invalidates the aggregates of the periods an S3 event notification uploaded individual files to.
+	// It returns ErrInvalidNotification for a body that is not a notification, and other errors when the notification should be retried
+	Process(ctx context.Context, body []byte) error
+	// Stop drops pending rebuilds. The returned context is done once rebuilds in progress have finished
+	Stop() context.Context
+}
+
+type Options struct {
+	// Rebuild regenerates invalidated aggregates in the background instead of leaving them to be built on next read
+	Rebuild bool
+	// Debounce is how long a period must go without uploads before it is rebuilt, so that a burst of uploads triggers one rebuild
+	Debounce time.Duration
+}
+
+var _ Processor = &processor{}
+
+type period struct {
+	reportType storer.ReportType
+	year       int
+	month      int
+}
+
+type rebuild struct {
+	// due moves forward with every upload. The timer re-arms itself until it fires past due
+	due     time.Time
+	timer   *time.Timer
+	running bool
+	// again records uploads received while running, which the finished rebuild may have missed
+	again bool
+}
+
+type processor struct {
+	generator report.Generator
+	storer    storer.Storer
+	options   Options
+	now       func() time.Time
+
+	mu       sync.Mutex
+	stopped  bool
+	rebuilds map[period]*rebuild
+	running  sync.WaitGroup
+}
+
+func NewProcessor(generator report.Generator, storer storer.Storer, options Options) Processor {
+	return &processor{
+		generator: generator,
+		storer:    storer,
+		options:   options,
+		now:       time.Now,
+		rebuilds:  map[period]*rebuild{},
+	}
+}
+
+func (p *processor) Process(ctx context.Context, body []byte) (err error) {
+	ctx, span := tracer.Start(ctx, "processor.Process")
+	defer func() { tracing.End(span, err) }()
+
+	keys, err := createdKeys(body)
+	if err != nil {
+		return err
+	}
+
+	var periods []period
+	seen := map[period]bool{}
+	for _, key := range keys {
+		reportType, year, month, ok := p.storer.ParseIndividualKey(key)
+		if !ok {
+			metrics.ObjectCreatedEvent("ignored")
+			slog.DebugContext(ctx, "ignored object created event", slog.String("key", key))
+			continue
+		}
+
+		pd := period{reportType: reportType, year: year, month: month}
+		if !seen[pd] {
+			seen[pd] = true
+			periods = append(periods, pd)
+		}
+	}
+
+	span.SetAttributes(attribute.Int("s3event.keys", len(keys)), attribute.Int("s3event.periods", len(periods)))
+
+	for _, pd := range periods {
+		err := p.storer.DeleteAggregated(ctx, pd.reportType, pd.year, pd.month)
+		if errors.Is(err, storer.ErrPeriodClosed) {
+			// the upload is not part of the signed off aggregate, and retrying cannot change that
+			metrics.ObjectCreatedEvent("ignored")
+			slog.WarnContext(ctx, "ignored upload to closed period", slog.String("report_type", string(pd.reportType)), logging.Period(pd.year, pd.month), slog.String("error", err.Error()))
+			continue
+		}
+
+		if err != nil {
+			metrics.ObjectCreatedEvent("failed")
+			return fmt.Errorf("failed to invalidate %s aggregate of %02d/%d: %v", pd.reportType, pd.month, pd.year, err)
+		}
+
+		metrics.ObjectCreatedEvent("invalidated")
+		slog.InfoContext(ctx, "invalidated aggregate", slog.String("report_type", string(pd.reportType)), logging.Period(pd.year, pd.month))
+
+		if p.options.Rebuild {
+			p.schedule(pd)
+		}
+	}
+
+	return nil
+}
+
+func (p *processor) Stop() context.Context {
+	p.mu.Lock()
+	p.stopped = true
+	for _, r := range p.rebuilds {
+		if r.timer != nil {
+			r.timer.Stop()
+		}
+	}
+	p.mu.Unlock()
+
+	ctx, done := context.WithCancel(context.Background())
+	go func() {
+		p.running.Wait()
+		done()
+	}()
+
+	return ctx
+}
+
+// schedule rebuilds a period once it has gone Debounce without uploads, and never runs two rebuilds of a period at once
+func (p *processor) schedule(pd period) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped {
+		return
+	}
+
+	r, ok := p.rebuilds[pd]
+	if !ok {
+		r = &rebuild{}
+		p.rebuilds[pd] = r
+	}
+
+	r.due = p.now().Add(p.options.Debounce)
+	if r.running {
+		r.again = true
+		return
+	}
+
+	if r.timer == nil {
+		r.timer = time.AfterFunc(p.options.Debounce, func() { p.fire(pd) })
+	}
+}
+
+func (p *processor) fire(pd period) {
+	p.mu.Lock()
+	r := p.rebuilds[pd]
+	if p.stopped || r == nil {
+		p.mu.Unlock()
+		return
+	}
+
+	if wait := r.due.Sub(p.now()); wait > 0 {
+		r.timer = time.AfterFunc(wait, func() { p.fire(pd) })
+		p.mu.Unlock()
+		return
+	}
+
+	r.timer = nil
+	r.running = true
+	p.running.Add(1)
+	p.mu.Unlock()
+
+	p.rebuild(pd)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running.Done()
+	r.running = false
+	if r.again && !p.stopped {
+		r.again = false
+		r.timer = time.AfterFunc(r.due.Sub(p.now()), func() { p.fire(pd) })
+		return
+	}
+
+	delete(p.rebuilds, pd)
+}
+
+func (p *processor) rebuild(pd period) {
+	ctx := context.Background()
+	logger := slog.Default().With(slog.String("report_type", string(pd.reportType)), logging.Period(pd.year, pd.month))
+
+	start := time.Now()
+	if _, err := p.generator.Regenerate(ctx, pd.reportType, pd.year, pd.month); err != nil {
+		// the aggregate stays invalidated, so it is built on next read instead
+		metrics.EventRebuilt(string(pd.reportType), "failed")
+		logger.ErrorContext(ctx, "failed to rebuild aggregate", slog.String("error", err.Error()))
+		return
+	}
+
+	metrics.EventRebuilt(string(pd.reportType), "succeeded")
+	logger.InfoContext(ctx, "rebuilt aggregate", logging.Duration(start))
+}
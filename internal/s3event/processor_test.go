@@ -0,0 +1,138 @@
+//go:build unit
+
+package s3event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestProcessor(t *testing.T) {
+	t.Run("invalidate aggregate of uploaded period", func(t *testing.T) {
+		mockStorer := storer.NewMock()
+		mockStorer.StubDeleteAggregated(storer.SingleReportType, 2022, 4).Return(nil)
+		p := NewProcessor(report.NewMockGenerator(), mockStorer, Options{})
+
+		err := p.Process(context.Background(), createdNotification("2022/04/single/cluster-1.csv", "2022/04/single/cluster-2.csv"))
+
+		require.NoError(t, err)
+		mockStorer.AssertNumberOfCalls(t, "DeleteAggregated", 1)
+	})
+
+	t.Run("ignore keys that are not individual files", func(t *testing.T) {
+		mockStorer := storer.NewMock()
+		p := NewProcessor(report.NewMockGenerator(), mockStorer, Options{})
+
+		err := p.Process(context.Background(), createdNotification("2022/04/aggregate/single.csv", "jobs/some-job.json"))
+
+		require.NoError(t, err)
+		mockStorer.AssertNotCalled(t, "DeleteAggregated", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("return error when aggregate cannot be invalidated", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubDeleteAggregated(storer.CumulativeReportType, 2022, 4).Return(errors.New("some error"))
+		p := NewProcessor(report.NewMockGenerator(), stubStorer, Options{})
+
+		err := p.Process(context.Background(), createdNotification("2022/04/cumulative/cluster-1.csv"))
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to invalidate cumulative aggregate of 04/2022: some error")
+	})
+
+	t.Run("ignore uploads to closed period", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubDeleteAggregated(storer.SingleReportType, 2022, 4).Return(fmt.Errorf("%w: 04/2022 is closed", storer.ErrPeriodClosed))
+		mockGenerator := report.NewMockGenerator()
+		p := NewProcessor(mockGenerator, stubStorer, Options{Rebuild: true, Debounce: time.Millisecond})
+
+		err := p.Process(context.Background(), createdNotification("2022/04/single/cluster-1.csv"))
+
+		require.NoError(t, err)
+		<-p.Stop().Done()
+		mockGenerator.AssertNotCalled(t, "Regenerate", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("rebuild once after a burst of uploads", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubDeleteAggregated(storer.SingleReportType, 2022, 4).Return(nil)
+		rebuilt := make(chan struct{}, 50)
+		mockGenerator := report.NewMockGenerator()
+		mockGenerator.On("Regenerate", mock.Anything, storer.SingleReportType, 2022, 4).
+			Run(func(mock.Arguments) { rebuilt <- struct{}{} }).
+			Return([]byte("some,data"), nil)
+		p := NewProcessor(mockGenerator, stubStorer, Options{Rebuild: true, Debounce: 50 * time.Millisecond})
+
+		for i := 1; i <= 50; i++ {
+			require.NoError(t, p.Process(context.Background(), createdNotification(fmt.Sprintf("2022/04/single/cluster-%d.csv", i))))
+		}
+
+		requireRebuilt(t, rebuilt)
+		time.Sleep(100 * time.Millisecond)
+		<-p.Stop().Done()
+		mockGenerator.AssertNumberOfCalls(t, "Regenerate", 1)
+	})
+
+	t.Run("rebuild again when uploads arrive during a rebuild", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubDeleteAggregated(storer.SingleReportType, 2022, 4).Return(nil)
+		rebuilt := make(chan struct{}, 2)
+		release := make(chan struct{})
+		mockGenerator := report.NewMockGenerator()
+		mockGenerator.On("Regenerate", mock.Anything, storer.SingleReportType, 2022, 4).
+			Run(func(mock.Arguments) {
+				rebuilt <- struct{}{}
+				<-release
+			}).
+			Return([]byte("some,data"), nil)
+		p := NewProcessor(mockGenerator, stubStorer, Options{Rebuild: true, Debounce: 10 * time.Millisecond})
+
+		require.NoError(t, p.Process(context.Background(), createdNotification("2022/04/single/cluster-1.csv")))
+		requireRebuilt(t, rebuilt)
+		require.NoError(t, p.Process(context.Background(), createdNotification("2022/04/single/cluster-2.csv")))
+		close(release)
+
+		requireRebuilt(t, rebuilt)
+		<-p.Stop().Done()
+		mockGenerator.AssertNumberOfCalls(t, "Regenerate", 2)
+	})
+
+	t.Run("drop pending rebuild when stopped", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubDeleteAggregated(storer.SingleReportType, 2022, 4).Return(nil)
+		mockGenerator := report.NewMockGenerator()
+		p := NewProcessor(mockGenerator, stubStorer, Options{Rebuild: true, Debounce: time.Hour})
+
+		require.NoError(t, p.Process(context.Background(), createdNotification("2022/04/single/cluster-1.csv")))
+		<-p.Stop().Done()
+
+		mockGenerator.AssertNotCalled(t, "Regenerate", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func createdNotification(keys ...string) []byte {
+	records := ""
+	for i, key := range keys {
+		if i > 0 {
+			records += ","
+		}
+		records += fmt.Sprintf(`{"eventName":"ObjectCreated:Put","s3":{"object":{"key":"%s"}}}`, key)
+	}
+
+	return []byte(fmt.Sprintf(`{"Records":[%s]}`, records))
+}
+
+func requireRebuilt(t *testing.T, rebuilt <-chan struct{}) {
+	select {
+	case <-rebuilt:
+	case <-time.After(time.Second):
+		require.Fail(t, "aggregate was not rebuilt")
+	}
+}
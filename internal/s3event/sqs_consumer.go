@@ -0,0 +1,178 @@
+package s3event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// waitTimeSeconds is the longest long poll SQS allows
+	waitTimeSeconds = 20
+	maxMessages     = 10
+	// receiveBackoff is waited after a failed receive so that an unreachable queue is not polled in a tight loop
+	receiveBackoff = 5 * time.Second
+)
+
+type SQSOptions struct {
+	// Endpoint overrides the SQS endpoint, e.g. to point at mock-aws. Empty means the AWS default
+	Endpoint string
+	// Region, AccessKeyID and SecretAccessKey override the AWS default configuration chain when set
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+type sqsClient interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+// SQSConsumer feeds S3 event notifications from an SQS queue to a processor. Messages that fail processing
+// are left on the queue and received again once their visibility timeout expires
+type SQSConsumer struct {
+	client    sqsClient
+	queueURL  string
+	processor Processor
+	sleep     func(ctx context.Context, d time.Duration) error
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewSQSConsumer(processor Processor, queueURL string, options SQSOptions) (*SQSConsumer, error) {
+	var loadOptions []func(*config.LoadOptions) error
+	if options.Region != "" {
+		loadOptions = append(loadOptions, config.WithRegion(options.Region))
+	}
+	if options.AccessKeyID != "" {
+		loadOptions = append(loadOptions, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(options.AccessKeyID, options.SecretAccessKey, ""),
+		))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(), loadOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load aws config: %v", err)
+	}
+	otelaws.AppendMiddlewares(&cfg.APIOptions)
+
+	client := sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+		if options.Endpoint != "" {
+			o.BaseEndpoint = aws.String(options.Endpoint)
+		}
+	})
+
+	return newSQSConsumer(client, queueURL, processor), nil
+}
+
+func newSQSConsumer(client sqsClient, queueURL string, processor Processor) *SQSConsumer {
+	return &SQSConsumer{
+		client:    client,
+		queueURL:  queueURL,
+		processor: processor,
+		sleep:     sleep,
+	}
+}
+
+// Start polls the queue in the background until Stop is called
+func (c *SQSConsumer) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+
+	go func() {
+		defer close(c.done)
+		for ctx.Err() == nil {
+			c.poll(ctx)
+		}
+	}()
+}
+
+// Stop ends polling. The returned context is done once messages already received have been processed
+func (c *SQSConsumer) Stop() context.Context {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctx, done := context.WithCancel(context.Background())
+	if c.cancel == nil {
+		done()
+		return ctx
+	}
+
+	c.cancel()
+	go func(finished <-chan struct{}) {
+		<-finished
+		done()
+	}(c.done)
+
+	return ctx
+}
+
+func (c *SQSConsumer) poll(ctx context.Context) {
+	output, err := c.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(c.queueURL),
+		MaxNumberOfMessages: maxMessages,
+		WaitTimeSeconds:     waitTimeSeconds,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+
+		slog.ErrorContext(ctx, "failed to receive s3 event notifications", slog.String("queue_url", c.queueURL), slog.String("error", err.Error()))
+		c.sleep(ctx, receiveBackoff)
+		return
+	}
+
+	// messages already received are processed even when stopping, rather than waiting out their visibility timeout
+	for _, message := range output.Messages {
+		c.handle(context.WithoutCancel(ctx), message)
+	}
+}
+
+func (c *SQSConsumer) handle(ctx context.Context, message types.Message) {
+	logger := slog.Default().With(slog.String("message_id", aws.ToString(message.MessageId)))
+
+	if err := c.processor.Process(ctx, []byte(aws.ToString(message.Body))); err != nil {
+		if !errors.Is(err, ErrInvalidNotification) {
+			logger.ErrorContext(ctx, "failed to process s3 event notification, leaving it to be received again", slog.String("error", err.Error()))
+			return
+		}
+
+		// receiving a malformed message again cannot succeed
+		logger.WarnContext(ctx, "discarding invalid s3 event notification", slog.String("error", err.Error()))
+	}
+
+	if _, err := c.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(c.queueURL),
+		ReceiptHandle: message.ReceiptHandle,
+	}); err != nil {
+		logger.ErrorContext(ctx, "failed to delete s3 event notification", slog.String("error", err.Error()))
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,84 @@
+//go:build unit
+
+package s3event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+func TestSQSConsumer(t *testing.T) {
+	t.Run("delete messages once processed or found invalid and leave failed messages on the queue", func(t *testing.T) {
+		client := newQueueClient(
+			types.Message{MessageId: aws.String("processed"), ReceiptHandle: aws.String("receipt-1"), Body: aws.String("processed")},
+			types.Message{MessageId: aws.String("invalid"), ReceiptHandle: aws.String("receipt-2"), Body: aws.String("invalid")},
+			types.Message{MessageId: aws.String("failed"), ReceiptHandle: aws.String("receipt-3"), Body: aws.String("failed")},
+		)
+		stubProcessor := NewMockProcessor()
+		stubProcessor.StubProcess([]byte("processed")).Return(nil)
+		stubProcessor.StubProcess([]byte("invalid")).Return(fmt.Errorf("%w: some reason", ErrInvalidNotification))
+		stubProcessor.StubProcess([]byte("failed")).Return(errors.New("some error"))
+		c := newSQSConsumer(client, "some-queue-url", stubProcessor)
+
+		c.Start()
+		<-client.drained
+		<-c.Stop().Done()
+
+		require.Equal(t, []string{"receipt-1", "receipt-2"}, client.deleted)
+	})
+
+	t.Run("stop without having started", func(t *testing.T) {
+		c := newSQSConsumer(newQueueClient(), "some-queue-url", NewMockProcessor())
+
+		<-c.Stop().Done()
+	})
+}
+
+// queueClient returns its messages on the first receive, then waits for the receive to be cancelled like an empty long poll
+type queueClient struct {
+	messages []types.Message
+	drained  chan struct{}
+
+	mu       sync.Mutex
+	received bool
+	deleted  []string
+}
+
+func newQueueClient(messages ...types.Message) *queueClient {
+	return &queueClient{
+		messages: messages,
+		drained:  make(chan struct{}),
+	}
+}
+
+func (c *queueClient) ReceiveMessage(ctx context.Context, _ *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	c.mu.Lock()
+	if !c.received {
+		c.received = true
+		c.mu.Unlock()
+		return &sqs.ReceiveMessageOutput{Messages: c.messages}, nil
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-c.drained:
+	default:
+		close(c.drained)
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c *queueClient) DeleteMessage(_ context.Context, params *sqs.DeleteMessageInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deleted = append(c.deleted, aws.ToString(params.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
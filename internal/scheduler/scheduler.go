@@ -0,0 +1,266 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/logging"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/robfig/cron/v3"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	NotDueResult    = "not_due"
+	SkippedResult   = "skipped"
+	SucceededResult = "succeeded"
+	FailedResult    = "failed"
+)
+
+type Options struct {
+	// Cron is a standard 5 field cron expression deciding how often the scheduler checks for work
+	Cron string
+	// NotBeforeDay and NotBeforeHour mark the point in a month after which the previous month is considered complete
+	NotBeforeDay  int
+	NotBeforeHour int
+	MaxAttempts   int
+	// InitialBackoff is doubled after every failed attempt
+	InitialBackoff time.Duration
+	// LeaseDuration bounds how long a crashed replica can keep others from building a period. It is renewed while building
+	LeaseDuration time.Duration
+	Owner         string
+}
+
+type Status struct {
+	LastRunAt *time.Time     `json:"last_run_at,omitempty"`
+	Result    string         `json:"result,omitempty"`
+	Message   string         `json:"message,omitempty"`
+	Period    string         `json:"period,omitempty"`
+	Reports   []ReportStatus `json:"reports,omitempty"`
+	// LastBuiltPeriod is the most recent period this replica built successfully
+	LastBuiltPeriod string `json:"last_built_period,omitempty"`
+}
+
+type ReportStatus struct {
+	Type     storer.ReportType `json:"type"`
+	Attempts int               `json:"attempts"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// Scheduler pre-generates the previous month's aggregates once the month is considered complete
+type Scheduler struct {
+	generator report.Generator
+	storer    storer.Storer
+	options   Options
+	schedule  cron.Schedule
+	now       func() time.Time
+	sleep     func(ctx context.Context, d time.Duration) error
+
+	mu     sync.Mutex
+	status Status
+	cron   *cron.Cron
+	// cancel interrupts a run in progress when stopping
+	cancel context.CancelFunc
+}
+
+func New(generator report.Generator, storer storer.Storer, options Options) (*Scheduler, error) {
+	schedule, err := cron.ParseStandard(options.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("cron expression '%s' is invalid: %v", options.Cron, err)
+	}
+
+	return &Scheduler{
+		generator: generator,
+		storer:    storer,
+		options:   options,
+		schedule:  schedule,
+		now:       time.Now,
+		sleep:     sleep,
+	}, nil
+}
+
+// Start runs the scheduler in the background until Stop is called
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.cron = cron.New()
+	s.cron.Schedule(s.schedule, cron.FuncJob(func() {
+		s.RunOnce(ctx)
+	}))
+	s.cron.Start()
+}
+
+// Stop prevents further runs and interrupts a run in progress. The returned context is done once that run has finished
+func (s *Scheduler) Stop() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cron == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		return ctx
+	}
+
+	s.cancel()
+	return s.cron.Stop()
+}
+
+func (s *Scheduler) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.status
+}
+
+// RunOnce builds the previous month's aggregates if the month is complete, this replica has not built them yet and no other replica holds the period lock
+func (s *Scheduler) RunOnce(ctx context.Context) Status {
+	now := s.now()
+	period := now.AddDate(0, 0, -now.Day())
+	year, month := period.Year(), int(period.Month())
+	periodName := fmt.Sprintf("%d-%02d", year, month)
+	status := Status{
+		LastRunAt:       &now,
+		Period:          periodName,
+		LastBuiltPeriod: s.Status().LastBuiltPeriod,
+	}
+
+	switch {
+	case !s.isDue(now):
+		status.Result = NotDueResult
+		status.Message = fmt.Sprintf("previous month is built after day %d, hour %d", s.options.NotBeforeDay, s.options.NotBeforeHour)
+	case status.LastBuiltPeriod == periodName:
+		status.Result = SkippedResult
+		status.Message = "already built by this replica"
+	default:
+		s.build(ctx, &status, year, month)
+	}
+
+	s.mu.Lock()
+	s.status = status
+	s.mu.Unlock()
+
+	return status
+}
+
+func (s *Scheduler) isDue(now time.Time) bool {
+	if now.Day() != s.options.NotBeforeDay {
+		return now.Day() > s.options.NotBeforeDay
+	}
+
+	return now.Hour() >= s.options.NotBeforeHour
+}
+
+func (s *Scheduler) build(ctx context.Context, status *Status, year int, month int) {
+	logger := slog.Default().With(logging.Period(year, month))
+	lockName := fmt.Sprintf("pregenerate-%s", status.Period)
+
+	acquired, err := s.storer.AcquireLock(ctx, lockName, s.options.Owner, s.now().Add(s.options.LeaseDuration))
+	if err != nil {
+		status.Result = FailedResult
+		status.Message = err.Error()
+		logger.ErrorContext(ctx, "failed to acquire pre-generation lock", slog.String("error", err.Error()))
+		return
+	}
+
+	if !acquired {
+		status.Result = SkippedResult
+		status.Message = "another replica holds the pre-generation lock"
+		logger.InfoContext(ctx, "skipped pre-generation, lock held by another replica")
+		return
+	}
+
+	// building can outlast the lease, so the lock is renewed until every aggregate is built
+	lockCtx, stopRenewing := storer.KeepLock(ctx, s.storer, lockName, s.options.Owner, s.options.LeaseDuration)
+	status.Result = SucceededResult
+	for _, reportType := range storer.ReportTypes {
+		reportStatus := s.buildWithRetry(lockCtx, reportType, year, month)
+		if reportStatus.Error != "" {
+			status.Result = FailedResult
+		}
+		status.Reports = append(status.Reports, reportStatus)
+	}
+	stopRenewing()
+
+	if status.Result == FailedResult {
+		// let another replica, or the next run, try again
+		if err := s.storer.ReleaseLock(context.WithoutCancel(ctx), lockName, s.options.Owner); err != nil {
+			logger.WarnContext(ctx, "failed to release pre-generation lock", slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	status.LastBuiltPeriod = status.Period
+	// keep holding the lock until the month is over so other replicas do not build the same period again
+	startOfNextMonth := time.Date(s.now().Year(), s.now().Month()+1, 1, 0, 0, 0, 0, s.now().Location())
+	if _, err := s.storer.AcquireLock(ctx, lockName, s.options.Owner, startOfNextMonth); err != nil {
+		logger.WarnContext(ctx, "failed to extend pre-generation lock", slog.String("error", err.Error()))
+	}
+}
+
+func (s *Scheduler) buildWithRetry(ctx context.Context, reportType storer.ReportType, year int, month int) ReportStatus {
+	logger := slog.Default().With(slog.String("report_type", string(reportType)), logging.Period(year, month))
+	status := ReportStatus{Type: reportType}
+	backoff := s.options.InitialBackoff
+
+	for status.Attempts < s.options.MaxAttempts {
+		status.Attempts++
+		start := time.Now()
+		_, err := s.generator.Regenerate(ctx, reportType, year, month)
+		if err == nil {
+			// a partial aggregate may not even be stored, and building it again fails the same way until its files are fixed, so it is left to the next run
+			failures, err := s.storer.RetrieveFailures(ctx, reportType, year, month)
+			if err != nil {
+				status.Error = err.Error()
+				return status
+			}
+
+			if len(failures) > 0 {
+				status.Error = fmt.Sprintf("aggregate leaves out %d individual files", len(failures))
+				logger.WarnContext(ctx, "pre-generated partial aggregate", slog.Int("failures", len(failures)))
+				return status
+			}
+
+			status.Error = ""
+			logger.InfoContext(ctx, "pre-generated aggregate", slog.Int("attempt", status.Attempts), logging.Duration(start))
+			return status
+		}
+
+		if errors.Is(err, storer.ErrPeriodClosed) {
+			// the aggregate was signed off before the scheduler got to it and is kept as it is
+			status.Error = ""
+			logger.InfoContext(ctx, "skipped pre-generation of closed period", slog.String("reason", err.Error()))
+			return status
+		}
+
+		status.Error = err.Error()
+		logger.WarnContext(ctx, "failed to pre-generate aggregate", slog.Int("attempt", status.Attempts), slog.String("error", err.Error()))
+
+		if status.Attempts < s.options.MaxAttempts {
+			if err := s.sleep(ctx, backoff); err != nil {
+				status.Error = err.Error()
+				return status
+			}
+			backoff *= 2
+		}
+	}
+
+	return status
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,231 @@
+//go:build unit
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduler_RunOnce(t *testing.T) {
+	dueTime := time.Date(2022, 5, 2, 6, 30, 0, 0, time.UTC)
+
+	t.Run("do nothing before configured day and hour", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubStorer := storer.NewMock()
+		s := newTestScheduler(t, stubGenerator, stubStorer, time.Date(2022, 5, 2, 5, 59, 0, 0, time.UTC))
+
+		status := s.RunOnce(context.Background())
+
+		require.Equal(t, NotDueResult, status.Result)
+		require.Equal(t, "2022-04", status.Period)
+		stubStorer.AssertNotCalled(t, "AcquireLock", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("build previous month aggregates and keep lock until month end", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Regenerate", mock.Anything, mock.Anything, 2022, 4).Return([]byte("some,data"), nil)
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrieveFailures(mock.Anything, 2022, 4).Return([]storer.FileFailure{}, nil)
+		stubStorer.StubAcquireLock("pregenerate-2022-04").Return(true, nil)
+		s := newTestScheduler(t, stubGenerator, stubStorer, dueTime)
+
+		status := s.RunOnce(context.Background())
+
+		require.Equal(t, SucceededResult, status.Result)
+		require.Equal(t, "2022-04", status.LastBuiltPeriod)
+		require.Equal(t, []ReportStatus{
+			{Type: storer.SingleReportType, Attempts: 1},
+			{Type: storer.CumulativeReportType, Attempts: 1},
+		}, status.Reports)
+		stubStorer.AssertCalled(t, "AcquireLock", mock.Anything, "pregenerate-2022-04", "some-owner", dueTime.Add(time.Hour))
+		stubStorer.AssertCalled(t, "AcquireLock", mock.Anything, "pregenerate-2022-04", "some-owner", time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC))
+		require.Equal(t, status, s.Status())
+	})
+
+	t.Run("skip when another replica holds the lock", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubStorer := storer.NewMock()
+		stubStorer.StubAcquireLock("pregenerate-2022-04").Return(false, nil)
+		s := newTestScheduler(t, stubGenerator, stubStorer, dueTime)
+
+		status := s.RunOnce(context.Background())
+
+		require.Equal(t, SkippedResult, status.Result)
+		require.Equal(t, "another replica holds the pre-generation lock", status.Message)
+		stubGenerator.AssertNotCalled(t, "Regenerate", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("skip period already built by this replica", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Regenerate", mock.Anything, mock.Anything, 2022, 4).Return([]byte("some,data"), nil)
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrieveFailures(mock.Anything, 2022, 4).Return([]storer.FileFailure{}, nil)
+		stubStorer.StubAcquireLock("pregenerate-2022-04").Return(true, nil)
+		s := newTestScheduler(t, stubGenerator, stubStorer, dueTime)
+		s.RunOnce(context.Background())
+
+		status := s.RunOnce(context.Background())
+
+		require.Equal(t, SkippedResult, status.Result)
+		require.Equal(t, "already built by this replica", status.Message)
+		stubGenerator.AssertNumberOfCalls(t, "Regenerate", 2)
+	})
+
+	t.Run("retry with exponential backoff", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Regenerate", mock.Anything, storer.SingleReportType, 2022, 4).Return(nil, errors.New("some error")).Twice()
+		stubGenerator.On("Regenerate", mock.Anything, mock.Anything, 2022, 4).Return([]byte("some,data"), nil)
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrieveFailures(mock.Anything, 2022, 4).Return([]storer.FileFailure{}, nil)
+		stubStorer.StubAcquireLock("pregenerate-2022-04").Return(true, nil)
+		s := newTestScheduler(t, stubGenerator, stubStorer, dueTime)
+		var waits []time.Duration
+		s.sleep = func(ctx context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return nil
+		}
+
+		status := s.RunOnce(context.Background())
+
+		require.Equal(t, SucceededResult, status.Result)
+		require.Equal(t, ReportStatus{Type: storer.SingleReportType, Attempts: 3}, status.Reports[0])
+		require.Equal(t, []time.Duration{time.Second, 2 * time.Second}, waits)
+	})
+
+	t.Run("keep aggregate of closed period without retrying", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Regenerate", mock.Anything, mock.Anything, 2022, 4).Return(nil, fmt.Errorf("%w: 04/2022 is closed", storer.ErrPeriodClosed))
+		stubStorer := storer.NewMock()
+		stubStorer.StubAcquireLock("pregenerate-2022-04").Return(true, nil)
+		s := newTestScheduler(t, stubGenerator, stubStorer, dueTime)
+
+		status := s.RunOnce(context.Background())
+
+		require.Equal(t, SucceededResult, status.Result)
+		require.Equal(t, ReportStatus{Type: storer.SingleReportType, Attempts: 1}, status.Reports[0])
+		stubGenerator.AssertNumberOfCalls(t, "Regenerate", 2)
+	})
+
+	t.Run("fail and release lock after max attempts", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Regenerate", mock.Anything, storer.SingleReportType, 2022, 4).Return(nil, errors.New("some error"))
+		stubGenerator.On("Regenerate", mock.Anything, storer.CumulativeReportType, 2022, 4).Return([]byte("some,data"), nil)
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrieveFailures(mock.Anything, 2022, 4).Return([]storer.FileFailure{}, nil)
+		stubStorer.StubAcquireLock("pregenerate-2022-04").Return(true, nil)
+		stubStorer.StubReleaseLock("pregenerate-2022-04").Return(nil)
+		s := newTestScheduler(t, stubGenerator, stubStorer, dueTime)
+
+		status := s.RunOnce(context.Background())
+
+		require.Equal(t, FailedResult, status.Result)
+		require.Equal(t, ReportStatus{Type: storer.SingleReportType, Attempts: 3, Error: "some error"}, status.Reports[0])
+		require.Empty(t, status.LastBuiltPeriod)
+		stubStorer.AssertCalled(t, "ReleaseLock", mock.Anything, "pregenerate-2022-04", "some-owner")
+	})
+
+	t.Run("fail and release lock when aggregate leaves out individual files", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubGenerator.On("Regenerate", mock.Anything, mock.Anything, 2022, 4).Return([]byte("some,data"), nil)
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrieveFailures(mock.Anything, 2022, 4).Return([]storer.FileFailure{{Key: "2022/04/single/cluster-2.csv", Error: "some error"}}, nil)
+		stubStorer.StubAcquireLock("pregenerate-2022-04").Return(true, nil)
+		stubStorer.StubReleaseLock("pregenerate-2022-04").Return(nil)
+		s := newTestScheduler(t, stubGenerator, stubStorer, dueTime)
+
+		status := s.RunOnce(context.Background())
+
+		require.Equal(t, FailedResult, status.Result)
+		require.Equal(t, ReportStatus{Type: storer.SingleReportType, Attempts: 1, Error: "aggregate leaves out 1 individual files"}, status.Reports[0])
+		require.Empty(t, status.LastBuiltPeriod)
+		stubStorer.AssertCalled(t, "ReleaseLock", mock.Anything, "pregenerate-2022-04", "some-owner")
+	})
+
+	t.Run("fail when lock cannot be acquired", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		stubStorer := storer.NewMock()
+		stubStorer.StubAcquireLock("pregenerate-2022-04").Return(false, errors.New("some error"))
+		s := newTestScheduler(t, stubGenerator, stubStorer, dueTime)
+
+		status := s.RunOnce(context.Background())
+
+		require.Equal(t, FailedResult, status.Result)
+		require.Equal(t, "some error", status.Message)
+	})
+}
+
+func TestNew(t *testing.T) {
+	t.Run("return error when cron expression is invalid", func(t *testing.T) {
+		_, err := New(report.NewMockGenerator(), storer.NewMock(), Options{Cron: "every hour"})
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "cron expression 'every hour' is invalid")
+	})
+}
+
+func TestScheduler_Stop(t *testing.T) {
+	t.Run("interrupt backoff of run in progress", func(t *testing.T) {
+		stubGenerator := report.NewMockGenerator()
+		started := make(chan struct{})
+		var start sync.Once
+		stubGenerator.On("Regenerate", mock.Anything, mock.Anything, 2022, 4).
+			Run(func(mock.Arguments) { start.Do(func() { close(started) }) }).
+			Return(nil, errors.New("some error"))
+		stubStorer := storer.NewMock()
+		stubStorer.StubAcquireLock("pregenerate-2022-04").Return(true, nil)
+		stubStorer.StubReleaseLock("pregenerate-2022-04").Return(nil)
+		s := newTestScheduler(t, stubGenerator, stubStorer, time.Date(2022, 5, 2, 6, 30, 0, 0, time.UTC))
+		s.schedule = &once{}
+		s.options.InitialBackoff = time.Hour
+		s.sleep = sleep
+		s.Start()
+		<-started
+
+		select {
+		case <-s.Stop().Done():
+		case <-time.After(time.Second):
+			require.Fail(t, "run in progress was not interrupted")
+		}
+
+		require.Equal(t, FailedResult, s.Status().Result)
+	})
+}
+
+// once schedules a single run straightaway
+type once struct {
+	scheduled bool
+}
+
+func (o *once) Next(t time.Time) time.Time {
+	if o.scheduled {
+		return t.AddDate(1, 0, 0)
+	}
+
+	o.scheduled = true
+	return t.Add(10 * time.Millisecond)
+}
+
+func newTestScheduler(t *testing.T, generator report.Generator, s storer.Storer, now time.Time) *Scheduler {
+	scheduler, err := New(generator, s, Options{
+		Cron:           "0 * * * *",
+		NotBeforeDay:   2,
+		NotBeforeHour:  6,
+		MaxAttempts:    3,
+		InitialBackoff: time.Second,
+		LeaseDuration:  time.Hour,
+		Owner:          "some-owner",
+	})
+	require.NoError(t, err)
+	scheduler.now = func() time.Time { return now }
+	scheduler.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	return scheduler
+}
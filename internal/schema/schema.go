@@ -0,0 +1,208 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ColumnType string
+
+const (
+	StringType   ColumnType = "string"
+	IntegerType  ColumnType = "integer"
+	NumberType   ColumnType = "number"
+	BooleanType  ColumnType = "boolean"
+	DateType     ColumnType = "date"
+	DateTimeType ColumnType = "datetime"
+)
+
+// dateLayout is the layout of date columns. Datetime columns are RFC 3339
+const dateLayout = "2006-01-02"
+
+// Policy decides what happens to source rows that do not match their schema
+type Policy string
+
+const (
+	// FailPolicy fails the generation on the first invalid row
+	FailPolicy Policy = "fail"
+	// SkipPolicy leaves invalid rows out of the aggregate
+	SkipPolicy Policy = "skip"
+	// QuarantinePolicy leaves invalid rows out of the aggregate and keeps them aside with their problems
+	QuarantinePolicy Policy = "quarantine"
+)
+
+func ParsePolicy(value string) (Policy, error) {
+	switch p := Policy(value); p {
+	case FailPolicy, SkipPolicy, QuarantinePolicy:
+		return p, nil
+	default:
+		return "", fmt.Errorf("schema policy '%s' is invalid", value)
+	}
+}
+
+// Column describes one column of a source file. A column without a type holds strings
+type Column struct {
+	Name     string     `yaml:"name"`
+	Type     ColumnType `yaml:"type"`
+	Required bool       `yaml:"required"`
+	// Allowed lists the only values the column may hold. Empty allows any value
+	Allowed []string `yaml:"allowed"`
+	// Pattern is a regular expression the whole value must match
+	Pattern string `yaml:"pattern"`
+}
+
+// Schema describes the columns every source file of a report type must have. Files may have extra columns
+type Schema struct {
+	Columns []Column `yaml:"columns"`
+}
+
+// Problem is a reason a source row, or the header of a source file at line 1, does not match its schema
+type Problem struct {
+	Key     string `json:"key"`
+	Line    int    `json:"line"`
+	Column  string `json:"column"`
+	Value   string `json:"value"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s line %d column '%s': %s", p.Key, p.Line, p.Column, p.Message)
+}
+
+// Validator checks source files against a schema
+type Validator struct {
+	columns  []Column
+	patterns []*regexp.Regexp
+}
+
+// New compiles a schema, failing on unknown types and invalid patterns
+func New(s Schema) (*Validator, error) {
+	if len(s.Columns) == 0 {
+		return nil, errors.New("schema must have at least one column")
+	}
+
+	v := &Validator{
+		columns:  make([]Column, 0, len(s.Columns)),
+		patterns: make([]*regexp.Regexp, 0, len(s.Columns)),
+	}
+	for _, c := range s.Columns {
+		if c.Name == "" {
+			return nil, errors.New("schema column name is required")
+		}
+
+		if c.Type == "" {
+			c.Type = StringType
+		}
+
+		switch c.Type {
+		case StringType, IntegerType, NumberType, BooleanType, DateType, DateTimeType:
+		default:
+			return nil, fmt.Errorf("schema column '%s' type '%s' is invalid", c.Name, c.Type)
+		}
+
+		var pattern *regexp.Regexp
+		if c.Pattern != "" {
+			compiled, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", c.Pattern))
+			if err != nil {
+				return nil, fmt.Errorf("schema column '%s' pattern is invalid: %v", c.Name, err)
+			}
+			pattern = compiled
+		}
+
+		v.columns = append(v.columns, c)
+		v.patterns = append(v.patterns, pattern)
+	}
+
+	return v, nil
+}
+
+// File binds the validator to the header of a source file. Problems with the header come back with a nil File, since none of its rows can be trusted
+func (v *Validator) File(key string, header []string) (*File, []Problem) {
+	f := &File{validator: v, key: key, index: make([]int, len(v.columns))}
+
+	var problems []Problem
+	for i, c := range v.columns {
+		f.index[i] = slices.Index(header, c.Name)
+		if f.index[i] < 0 {
+			problems = append(problems, Problem{Key: key, Line: 1, Column: c.Name, Message: "column is missing from header"})
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, problems
+	}
+
+	return f, nil
+}
+
+// File validates the rows of one source file
+type File struct {
+	validator *Validator
+	key       string
+	index     []int
+}
+
+// Row validates a row found at the given line of the file
+func (f *File) Row(line int, record []string) []Problem {
+	var problems []Problem
+	for i, c := range f.validator.columns {
+		value := ""
+		if f.index[i] < len(record) {
+			value = record[f.index[i]]
+		}
+
+		if message := f.validator.check(i, c, value); message != "" {
+			problems = append(problems, Problem{Key: f.key, Line: line, Column: c.Name, Value: value, Message: message})
+		}
+	}
+
+	return problems
+}
+
+// check returns why a value does not fit its column, or empty when it does
+func (v *Validator) check(i int, c Column, value string) string {
+	if value == "" {
+		if c.Required {
+			return "value is required"
+		}
+		return ""
+	}
+
+	switch c.Type {
+	case IntegerType:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "value is not an integer"
+		}
+	case NumberType:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "value is not a number"
+		}
+	case BooleanType:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return "value is not a boolean"
+		}
+	case DateType:
+		if _, err := time.Parse(dateLayout, value); err != nil {
+			return "value is not a date (YYYY-MM-DD)"
+		}
+	case DateTimeType:
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return "value is not an RFC 3339 datetime"
+		}
+	}
+
+	if len(c.Allowed) > 0 && !slices.Contains(c.Allowed, value) {
+		return fmt.Sprintf("value is not one of %s", strings.Join(c.Allowed, ", "))
+	}
+
+	if v.patterns[i] != nil && !v.patterns[i].MatchString(value) {
+		return fmt.Sprintf("value does not match pattern '%s'", c.Pattern)
+	}
+
+	return ""
+}
@@ -0,0 +1,88 @@
+//go:build unit
+
+package schema
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("return error for invalid schema", func(t *testing.T) {
+		for message, s := range map[string]Schema{
+			"schema must have at least one column":         {},
+			"schema column name is required":               {Columns: []Column{{Type: StringType}}},
+			"schema column 'COST' type 'money' is invalid": {Columns: []Column{{Name: "COST", Type: "money"}}},
+			"schema column 'CLUSTER' pattern is invalid":   {Columns: []Column{{Name: "CLUSTER", Pattern: "("}}},
+		} {
+			_, err := New(s)
+
+			require.Error(t, err)
+			require.Contains(t, err.Error(), message)
+		}
+	})
+}
+
+func TestValidator(t *testing.T) {
+	v, err := New(Schema{Columns: []Column{
+		{Name: "CLUSTER", Required: true, Pattern: "cluster-[0-9]+"},
+		{Name: "COST", Type: NumberType, Required: true},
+		{Name: "NODES", Type: IntegerType},
+		{Name: "SPOT", Type: BooleanType},
+		{Name: "DAY", Type: DateType},
+		{Name: "AT", Type: DateTimeType},
+		{Name: "ENV", Allowed: []string{"prod", "dev"}},
+	}})
+	require.NoError(t, err)
+	header := []string{"CLUSTER", "COST", "NODES", "SPOT", "DAY", "AT", "ENV", "EXTRA"}
+
+	t.Run("accept valid row", func(t *testing.T) {
+		f, problems := v.File("2022/04/single/cluster-1.csv", header)
+		require.Empty(t, problems)
+
+		require.Empty(t, f.Row(2, []string{"cluster-1", "1.5", "3", "true", "2022-04-01", "2022-04-01T10:00:00Z", "prod", "anything"}))
+		require.Empty(t, f.Row(3, []string{"cluster-1", "1.5", "", "", "", "", "", ""}))
+	})
+
+	t.Run("report every problem of invalid row", func(t *testing.T) {
+		f, _ := v.File("2022/04/single/cluster-1.csv", header)
+
+		problems := f.Row(2, []string{"node-1", "", "3.5", "maybe", "01/04/2022", "2022-04-01", "test"})
+
+		require.Equal(t, []Problem{
+			{Key: "2022/04/single/cluster-1.csv", Line: 2, Column: "CLUSTER", Value: "node-1", Message: "value does not match pattern 'cluster-[0-9]+'"},
+			{Key: "2022/04/single/cluster-1.csv", Line: 2, Column: "COST", Value: "", Message: "value is required"},
+			{Key: "2022/04/single/cluster-1.csv", Line: 2, Column: "NODES", Value: "3.5", Message: "value is not an integer"},
+			{Key: "2022/04/single/cluster-1.csv", Line: 2, Column: "SPOT", Value: "maybe", Message: "value is not a boolean"},
+			{Key: "2022/04/single/cluster-1.csv", Line: 2, Column: "DAY", Value: "01/04/2022", Message: "value is not a date (YYYY-MM-DD)"},
+			{Key: "2022/04/single/cluster-1.csv", Line: 2, Column: "AT", Value: "2022-04-01", Message: "value is not an RFC 3339 datetime"},
+			{Key: "2022/04/single/cluster-1.csv", Line: 2, Column: "ENV", Value: "test", Message: "value is not one of prod, dev"},
+		}, problems)
+	})
+
+	t.Run("report columns missing from header", func(t *testing.T) {
+		f, problems := v.File("2022/04/single/cluster-1.csv", []string{"CLUSTER", "NODES", "SPOT", "DAY", "AT", "ENV"})
+
+		require.Nil(t, f)
+		require.Equal(t, []Problem{
+			{Key: "2022/04/single/cluster-1.csv", Line: 1, Column: "COST", Message: "column is missing from header"},
+		}, problems)
+	})
+}
+
+func TestParsePolicy(t *testing.T) {
+	t.Run("parse known policies", func(t *testing.T) {
+		for _, p := range []Policy{FailPolicy, SkipPolicy, QuarantinePolicy} {
+			parsed, err := ParsePolicy(string(p))
+
+			require.NoError(t, err)
+			require.Equal(t, p, parsed)
+		}
+	})
+
+	t.Run("return error for unknown policy", func(t *testing.T) {
+		_, err := ParsePolicy("ignore")
+
+		require.EqualError(t, err, "schema policy 'ignore' is invalid")
+	})
+}
@@ -0,0 +1,233 @@
+package storer
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	yearPlaceholder       = "{year}"
+	monthPlaceholder      = "{month}"
+	reportTypePlaceholder = "{type}"
+)
+
+// quarantineTemplate is where quarantined individual files are kept whatever the key layout, so that they are never listed with the individual files
+const quarantineTemplate = "quarantine/{year}/{month}/{type}/"
+
+// KeyLayout describes where objects live in the bucket. Templates may use {year}, {month} (zero padded) and {type} placeholders
+type KeyLayout struct {
+	IndividualPrefix string `yaml:"individual_prefix"`
+	Aggregate        string `yaml:"aggregate"`
+	// Period is the key template of the status of a period, which has no report type
+	Period string `yaml:"period"`
+	// Locks and Jobs are the key prefixes of locks and background jobs, which belong to no period
+	Locks string `yaml:"locks"`
+	Jobs  string `yaml:"jobs"`
+}
+
+func DefaultKeyLayout() KeyLayout {
+	return KeyLayout{
+		IndividualPrefix: "{year}/{month}/{type}",
+		Aggregate:        "{year}/{month}/aggregate/{type}.csv",
+		Period:           "periods/{year}-{month}.json",
+		Locks:            "locks/",
+		Jobs:             "jobs/",
+	}
+}
+
+func (l KeyLayout) Validate() error {
+	for _, t := range []struct {
+		name         string
+		template     string
+		placeholders []string
+	}{
+		{"individual prefix", l.IndividualPrefix, []string{yearPlaceholder, monthPlaceholder, reportTypePlaceholder}},
+		{"aggregate", l.Aggregate, []string{yearPlaceholder, monthPlaceholder, reportTypePlaceholder}},
+		{"period", l.Period, []string{yearPlaceholder, monthPlaceholder}},
+	} {
+		for _, placeholder := range t.placeholders {
+			if !strings.Contains(t.template, placeholder) {
+				return fmt.Errorf("%s key layout '%s' must contain %s", t.name, t.template, placeholder)
+			}
+		}
+	}
+
+	for _, p := range []struct {
+		name   string
+		prefix string
+	}{
+		{"locks", l.Locks},
+		{"jobs", l.Jobs},
+	} {
+		if p.prefix == "" {
+			return fmt.Errorf("%s key layout must not be empty", p.name)
+		}
+	}
+
+	return nil
+}
+
+func (l KeyLayout) individualPrefix(reportType ReportType, year int, month int) string {
+	return expand(l.IndividualPrefix, reportType, year, month)
+}
+
+// individualKey places a file named after name under the individual prefix, whether or not the prefix ends with a slash
+func (l KeyLayout) individualKey(reportType ReportType, year int, month int, name string) string {
+	prefix := l.individualPrefix(reportType, year, month)
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return fmt.Sprintf("%s%s.csv", prefix, name)
+}
+
+func (l KeyLayout) aggregateKey(reportType ReportType, year int, month int) string {
+	return expand(l.Aggregate, reportType, year, month)
+}
+
+// versionsPrefix is where the versions of an aggregate are kept, next to the aggregate without its extension
+func (l KeyLayout) versionsPrefix(reportType ReportType, year int, month int) string {
+	key := l.aggregateKey(reportType, year, month)
+	return fmt.Sprintf("%s/versions/", strings.TrimSuffix(key, path.Ext(key)))
+}
+
+// summariesPrefix is where the summaries of an aggregate are kept, next to the aggregate without its extension
+func (l KeyLayout) summariesPrefix(reportType ReportType, year int, month int) string {
+	key := l.aggregateKey(reportType, year, month)
+	return fmt.Sprintf("%s/summaries/", strings.TrimSuffix(key, path.Ext(key)))
+}
+
+// rejectedRowsKey is where the source rows left out of an aggregate are kept, next to the aggregate
+func (l KeyLayout) rejectedRowsKey(reportType ReportType, year int, month int) string {
+	key := l.aggregateKey(reportType, year, month)
+	return fmt.Sprintf("%s/rejected%s", strings.TrimSuffix(key, path.Ext(key)), path.Ext(key))
+}
+
+// failuresKey is where the individual files left out of a partial aggregate are listed, next to the aggregate
+func (l KeyLayout) failuresKey(reportType ReportType, year int, month int) string {
+	key := l.aggregateKey(reportType, year, month)
+	return fmt.Sprintf("%s/failures.json", strings.TrimSuffix(key, path.Ext(key)))
+}
+
+func (l KeyLayout) periodKey(year int, month int) string {
+	return expand(l.Period, "", year, month)
+}
+
+func (l KeyLayout) lockKey(name string) string {
+	return fmt.Sprintf("%s%s.json", directory(l.Locks), name)
+}
+
+func (l KeyLayout) jobsPrefix() string {
+	return directory(l.Jobs)
+}
+
+func (l KeyLayout) jobKey(id string) string {
+	return fmt.Sprintf("%s%s.json", l.jobsPrefix(), id)
+}
+
+func (l KeyLayout) quarantinePrefix(reportType ReportType, year int, month int) string {
+	return expand(quarantineTemplate, reportType, year, month)
+}
+
+// quarantineName names an individual file by its key relative to the individual prefix, so that files nested under the prefix do not collide once quarantined
+func (l KeyLayout) quarantineName(reportType ReportType, year int, month int, key string) string {
+	prefix := l.individualPrefix(reportType, year, month)
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	if name, ok := strings.CutPrefix(key, prefix); ok {
+		return name
+	}
+
+	return path.Base(key)
+}
+
+// parseIndividualKey extracts the report type and period of an individual file key. It returns false for keys outside the individual prefix layout
+func (l KeyLayout) parseIndividualKey(key string) (ReportType, int, int, bool) {
+	pattern, placeholders := individualKeyPattern(l.IndividualPrefix)
+	matches := pattern.FindStringSubmatch(key)
+	if matches == nil {
+		return "", 0, 0, false
+	}
+
+	values := map[string]string{}
+	for i, placeholder := range placeholders {
+		// a placeholder repeated in the template must expand to the same value everywhere
+		if existing, ok := values[placeholder]; ok && existing != matches[i+1] {
+			return "", 0, 0, false
+		}
+		values[placeholder] = matches[i+1]
+	}
+
+	reportType, err := ParseReportType(values[reportTypePlaceholder])
+	if err != nil {
+		return "", 0, 0, false
+	}
+
+	year, _ := strconv.Atoi(values[yearPlaceholder])
+	month, _ := strconv.Atoi(values[monthPlaceholder])
+	if month < 1 || month > 12 {
+		return "", 0, 0, false
+	}
+
+	// an aggregate stored under the individual prefix must not look like an upload
+	if key == l.aggregateKey(reportType, year, month) {
+		return "", 0, 0, false
+	}
+
+	return reportType, year, month, true
+}
+
+// individualKeyPattern matches keys under the expanded template, capturing placeholder values in the order they are returned
+func individualKeyPattern(template string) (*regexp.Regexp, []string) {
+	placeholderPatterns := map[string]string{
+		yearPlaceholder:       `(\d{4})`,
+		monthPlaceholder:      `(\d{2})`,
+		reportTypePlaceholder: `([^/]+)`,
+	}
+
+	var pattern strings.Builder
+	var placeholders []string
+	pattern.WriteString("^")
+	for rest := template; rest != ""; {
+		next, placeholder := len(rest), ""
+		for p := range placeholderPatterns {
+			if i := strings.Index(rest, p); i >= 0 && i < next {
+				next, placeholder = i, p
+			}
+		}
+
+		pattern.WriteString(regexp.QuoteMeta(rest[:next]))
+		if placeholder == "" {
+			break
+		}
+
+		pattern.WriteString(placeholderPatterns[placeholder])
+		placeholders = append(placeholders, placeholder)
+		rest = rest[next+len(placeholder):]
+	}
+	pattern.WriteString(".+$")
+
+	return regexp.MustCompile(pattern.String()), placeholders
+}
+
+// directory makes a prefix end with a slash, so that keys under it are not mistaken for keys sharing its beginning
+func directory(prefix string) string {
+	if strings.HasSuffix(prefix, "/") {
+		return prefix
+	}
+
+	return prefix + "/"
+}
+
+func expand(template string, reportType ReportType, year int, month int) string {
+	return strings.NewReplacer(
+		yearPlaceholder, strconv.Itoa(year),
+		monthPlaceholder, fmt.Sprintf("%02d", month),
+		reportTypePlaceholder, string(reportType),
+	).Replace(template)
+}
@@ -0,0 +1,121 @@
+//go:build unit
+
+package storer
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestKeyLayout(t *testing.T) {
+	t.Run("default layout matches existing bucket structure", func(t *testing.T) {
+		layout := DefaultKeyLayout()
+
+		require.Equal(t, "2022/04/single", layout.individualPrefix(SingleReportType, 2022, 4))
+		require.Equal(t, "2022/04/aggregate/cumulative.csv", layout.aggregateKey(CumulativeReportType, 2022, 4))
+		require.Equal(t, "2022/04/single/cluster-1.csv", layout.individualKey(SingleReportType, 2022, 4, "cluster-1"))
+		require.Equal(t, "2022/04/aggregate/cumulative/versions/", layout.versionsPrefix(CumulativeReportType, 2022, 4))
+		require.Equal(t, "2022/04/aggregate/cumulative/summaries/", layout.summariesPrefix(CumulativeReportType, 2022, 4))
+		require.Equal(t, "2022/04/aggregate/cumulative/rejected.csv", layout.rejectedRowsKey(CumulativeReportType, 2022, 4))
+		require.Equal(t, "2022/04/aggregate/cumulative/failures.json", layout.failuresKey(CumulativeReportType, 2022, 4))
+		require.Equal(t, "quarantine/2022/04/cumulative/", layout.quarantinePrefix(CumulativeReportType, 2022, 4))
+		require.Equal(t, "cluster-1.csv", layout.quarantineName(CumulativeReportType, 2022, 4, "2022/04/cumulative/cluster-1.csv"))
+		require.Equal(t, "periods/2022-04.json", layout.periodKey(2022, 4))
+		require.Equal(t, "locks/pregenerate-2022-04.json", layout.lockKey("pregenerate-2022-04"))
+		require.Equal(t, "jobs/", layout.jobsPrefix())
+		require.Equal(t, "jobs/some-id.json", layout.jobKey("some-id"))
+	})
+
+	t.Run("expand custom period, lock and job keys", func(t *testing.T) {
+		layout := KeyLayout{
+			Period: "reports/periods/{year}{month}.json",
+			Locks:  "reports/locks",
+			Jobs:   "reports/jobs/",
+		}
+
+		require.Equal(t, "reports/periods/202211.json", layout.periodKey(2022, 11))
+		require.Equal(t, "reports/locks/some-lock.json", layout.lockKey("some-lock"))
+		require.Equal(t, "reports/jobs/some-id.json", layout.jobKey("some-id"))
+	})
+
+	t.Run("expand custom layout", func(t *testing.T) {
+		layout := KeyLayout{
+			IndividualPrefix: "reports/{type}/{year}-{month}/",
+			Aggregate:        "aggregates/{type}/{year}-{month}.csv",
+		}
+
+		require.Equal(t, "reports/single/2022-11/", layout.individualPrefix(SingleReportType, 2022, 11))
+		require.Equal(t, "aggregates/single/2022-11.csv", layout.aggregateKey(SingleReportType, 2022, 11))
+		require.Equal(t, "reports/single/2022-11/cluster-1.csv", layout.individualKey(SingleReportType, 2022, 11, "cluster-1"))
+		require.Equal(t, "quarantine/2022/11/single/", layout.quarantinePrefix(SingleReportType, 2022, 11))
+		require.Equal(t, "eu/cluster-1.csv", layout.quarantineName(SingleReportType, 2022, 11, "reports/single/2022-11/eu/cluster-1.csv"))
+	})
+
+	t.Run("parse individual file key of default layout", func(t *testing.T) {
+		reportType, year, month, ok := DefaultKeyLayout().parseIndividualKey("2022/04/single/cluster-1.csv")
+
+		require.True(t, ok)
+		require.Equal(t, SingleReportType, reportType)
+		require.Equal(t, 2022, year)
+		require.Equal(t, 4, month)
+	})
+
+	t.Run("parse individual file key of custom layout", func(t *testing.T) {
+		layout := KeyLayout{
+			IndividualPrefix: "reports/{type}/{year}-{month}/",
+			Aggregate:        "aggregates/{type}/{year}-{month}.csv",
+		}
+
+		reportType, year, month, ok := layout.parseIndividualKey("reports/cumulative/2022-11/cluster 1.csv")
+
+		require.True(t, ok)
+		require.Equal(t, CumulativeReportType, reportType)
+		require.Equal(t, 2022, year)
+		require.Equal(t, 11, month)
+	})
+
+	t.Run("reject keys that are not individual files", func(t *testing.T) {
+		layout := KeyLayout{
+			IndividualPrefix: "{year}/{month}/{type}",
+			Aggregate:        "{year}/{month}/{type}/aggregate.csv",
+		}
+
+		for _, key := range []string{
+			"2022/04/aggregate/single.csv",
+			"2022/04/single/aggregate.csv",
+			"2022/04/other/cluster-1.csv",
+			"2022/13/single/cluster-1.csv",
+			"2022/04/single",
+			"jobs/some-id.json",
+		} {
+			_, _, _, ok := layout.parseIndividualKey(key)
+			require.False(t, ok, key)
+		}
+	})
+
+	t.Run("return error when a placeholder is missing", func(t *testing.T) {
+		layout := KeyLayout{
+			IndividualPrefix: "{year}/{type}",
+			Aggregate:        "{year}/{month}/aggregate/{type}.csv",
+		}
+
+		err := layout.Validate()
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "individual prefix key layout '{year}/{type}' must contain {month}")
+	})
+
+	t.Run("return error when period placeholder or prefix is missing", func(t *testing.T) {
+		layout := DefaultKeyLayout()
+		layout.Period = "periods/{year}.json"
+		require.EqualError(t, layout.Validate(), "period key layout 'periods/{year}.json' must contain {month}")
+
+		layout = DefaultKeyLayout()
+		layout.Jobs = ""
+		require.EqualError(t, layout.Validate(), "jobs key layout must not be empty")
+	})
+
+	t.Run("default layout is valid", func(t *testing.T) {
+		require.NoError(t, DefaultKeyLayout().Validate())
+	})
+}
@@ -0,0 +1,55 @@
+package storer
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// KeepLock renews a lock held by owner every third of lease until stop is called, so that work outlasting a single lease keeps its lock.
+// The returned context is cancelled once the lock is taken by another owner, or could not be renewed for a whole lease, so that the work stops
+func KeepLock(ctx context.Context, s Storer, name string, owner string, lease time.Duration) (_ context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+
+		renewedAt := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			renewed, err := s.AcquireLock(ctx, name, owner, time.Now().Add(lease))
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err != nil {
+				slog.WarnContext(ctx, "failed to renew lock", slog.String("lock", name), slog.String("error", err.Error()))
+				if time.Since(renewedAt) < lease {
+					continue
+				}
+			}
+
+			if err != nil || !renewed {
+				slog.ErrorContext(ctx, "lost lock", slog.String("lock", name))
+				cancel()
+				return
+			}
+
+			renewedAt = time.Now()
+		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		<-done
+	}
+}
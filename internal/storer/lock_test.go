@@ -0,0 +1,55 @@
+//go:build unit
+
+package storer
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeepLock(t *testing.T) {
+	t.Run("renew lock until stopped", func(t *testing.T) {
+		stubStorer := NewMock()
+		var renewals atomic.Int32
+		stubStorer.StubAcquireLock("some-lock").Run(func(mock.Arguments) { renewals.Add(1) }).Return(true, nil)
+
+		ctx, stop := KeepLock(context.Background(), stubStorer, "some-lock", "some-owner", 30*time.Millisecond)
+		require.Eventually(t, func() bool {
+			return renewals.Load() >= 2
+		}, time.Second, 5*time.Millisecond)
+		stop()
+
+		require.ErrorIs(t, ctx.Err(), context.Canceled)
+	})
+
+	t.Run("cancel context when lock is taken by another owner", func(t *testing.T) {
+		stubStorer := NewMock()
+		stubStorer.StubAcquireLock("some-lock").Return(false, nil)
+
+		ctx, stop := KeepLock(context.Background(), stubStorer, "some-lock", "some-owner", 30*time.Millisecond)
+		defer stop()
+
+		require.Eventually(t, func() bool {
+			return ctx.Err() != nil
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("cancel context when lock cannot be renewed for a whole lease", func(t *testing.T) {
+		stubStorer := NewMock()
+		var renewals atomic.Int32
+		stubStorer.StubAcquireLock("some-lock").Run(func(mock.Arguments) { renewals.Add(1) }).Return(false, errors.New("some error"))
+
+		ctx, stop := KeepLock(context.Background(), stubStorer, "some-lock", "some-owner", 30*time.Millisecond)
+		defer stop()
+
+		require.Eventually(t, func() bool {
+			return ctx.Err() != nil
+		}, time.Second, 5*time.Millisecond)
+		require.GreaterOrEqual(t, renewals.Load(), int32(2))
+	})
+}
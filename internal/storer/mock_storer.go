@@ -1,8 +1,11 @@
 package storer
 
 import (
+	"context"
+	"fmt"
 	"github.com/stretchr/testify/mock"
 	"testing"
+	"time"
 )
 
 var _ Storer = &mockStorer{}
@@ -15,25 +18,67 @@ func NewMock() *mockStorer {
 	return &mockStorer{}
 }
 
-func (s *mockStorer) RetrieveIndividualFiles(reportType ReportType, year int, month int) ([][]byte, error) {
-	args := s.Called(reportType, year, month)
+func (s *mockStorer) ListIndividualFiles(ctx context.Context, reportType ReportType, year int, month int) ([]IndividualFile, error) {
+	args := s.Called(ctx, reportType, year, month)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 
-	return args.Get(0).([][]byte), args.Error(1)
+	return args.Get(0).([]IndividualFile), args.Error(1)
+}
+
+func (s *mockStorer) StubListIndividualFiles(reportType interface{}, year interface{}, month interface{}) *mock.Call {
+	return s.On("ListIndividualFiles", mock.Anything, reportType, year, month)
 }
 
-func (s *mockStorer) StubRetrieveIndividualFiles(reportType interface{}, year interface{}, month interface{}) *mock.Call {
-	return s.On("RetrieveIndividualFiles", reportType, year, month)
+func (s *mockStorer) AssertListIndividualFilesNotCalled(t *testing.T) {
+	s.AssertNotCalled(t, "ListIndividualFiles", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
 
-func (s *mockStorer) AssertRetrieveIndividualFilesNotCalled(t *testing.T) {
-	s.AssertNotCalled(t, "RetrieveIndividualFiles", mock.Anything, mock.Anything, mock.Anything)
+func (s *mockStorer) StoreIndividualFile(ctx context.Context, reportType ReportType, year int, month int, cluster string, data []byte) (string, error) {
+	args := s.Called(ctx, reportType, year, month, cluster, data)
+	return args.String(0), args.Error(1)
 }
 
-func (s *mockStorer) RetrieveAggregated(reportType ReportType, year int, month int) ([]byte, error) {
-	args := s.Called(reportType, year, month)
+func (s *mockStorer) StubStoreIndividualFile(reportType interface{}, year interface{}, month interface{}, cluster interface{}, data interface{}) *mock.Call {
+	return s.On("StoreIndividualFile", mock.Anything, reportType, year, month, cluster, data)
+}
+
+func (s *mockStorer) AssertStoreIndividualFileNotCalled(t *testing.T) {
+	s.AssertNotCalled(t, "StoreIndividualFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *mockStorer) RetrieveIndividualFile(ctx context.Context, key string) ([]byte, error) {
+	args := s.Called(ctx, key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (s *mockStorer) StubRetrieveIndividualFile(key interface{}) *mock.Call {
+	return s.On("RetrieveIndividualFile", mock.Anything, key)
+}
+
+// StubIndividualFiles stubs listing and retrieval of the given file contents, keyed cluster-1.csv, cluster-2.csv and so on under the default key layout
+func (s *mockStorer) StubIndividualFiles(reportType ReportType, year int, month int, contents ...[]byte) []IndividualFile {
+	files := make([]IndividualFile, 0, len(contents))
+	for i, content := range contents {
+		file := IndividualFile{
+			Key:  fmt.Sprintf("%s/cluster-%d.csv", DefaultKeyLayout().individualPrefix(reportType, year, month), i+1),
+			Size: int64(len(content)),
+		}
+		files = append(files, file)
+		s.StubRetrieveIndividualFile(file.Key).Return(content, nil)
+	}
+	s.StubListIndividualFiles(reportType, year, month).Return(files, nil)
+
+	return files
+}
+
+func (s *mockStorer) RetrieveAggregated(ctx context.Context, reportType ReportType, year int, month int) ([]byte, error) {
+	args := s.Called(ctx, reportType, year, month)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -42,22 +87,278 @@ func (s *mockStorer) RetrieveAggregated(reportType ReportType, year int, month i
 }
 
 func (s *mockStorer) StubRetrieveAggregated(reportType interface{}, year interface{}, month interface{}) *mock.Call {
-	return s.On("RetrieveAggregated", reportType, year, month)
+	return s.On("RetrieveAggregated", mock.Anything, reportType, year, month)
 }
 
-func (s *mockStorer) StoreAggregated(reportType ReportType, year int, month int, data []byte) error {
-	args := s.Called(reportType, year, month, data)
+func (s *mockStorer) AssertRetrieveAggregatedNotCalled(t *testing.T) {
+	s.AssertNotCalled(t, "RetrieveAggregated", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *mockStorer) StoreAggregated(ctx context.Context, reportType ReportType, year int, month int, data []byte) error {
+	args := s.Called(ctx, reportType, year, month, data)
 	return args.Error(0)
 }
 
 func (s *mockStorer) StubStoreAggregated(reportType interface{}, year interface{}, month interface{}, data interface{}) *mock.Call {
-	return s.On("StoreAggregated", reportType, year, month, data)
+	return s.On("StoreAggregated", mock.Anything, reportType, year, month, data)
 }
 
 func (s *mockStorer) AssertStoreAggregatedCalled(t *testing.T, reportType interface{}, year interface{}, month interface{}, data interface{}) {
-	s.AssertCalled(t, "StoreAggregated", reportType, year, month, data)
+	s.AssertCalled(t, "StoreAggregated", mock.Anything, reportType, year, month, data)
 }
 
 func (s *mockStorer) AssertStoreAggregatedNotCalled(t *testing.T) {
-	s.AssertNotCalled(t, "StoreAggregated", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	s.AssertNotCalled(t, "StoreAggregated", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *mockStorer) DeleteAggregated(ctx context.Context, reportType ReportType, year int, month int) error {
+	args := s.Called(ctx, reportType, year, month)
+	return args.Error(0)
+}
+
+func (s *mockStorer) StubDeleteAggregated(reportType interface{}, year interface{}, month interface{}) *mock.Call {
+	return s.On("DeleteAggregated", mock.Anything, reportType, year, month)
+}
+
+func (s *mockStorer) AssertDeleteAggregatedCalled(t *testing.T, reportType interface{}, year interface{}, month interface{}) {
+	s.AssertCalled(t, "DeleteAggregated", mock.Anything, reportType, year, month)
+}
+
+// AggregateKey follows the default key layout rather than expectations, since it is pure and called alongside StoreAggregated
+func (s *mockStorer) AggregateKey(reportType ReportType, year int, month int) string {
+	return DefaultKeyLayout().aggregateKey(reportType, year, month)
+}
+
+func (s *mockStorer) RetrievePeriodStatus(ctx context.Context, year int, month int) (PeriodStatus, error) {
+	args := s.Called(ctx, year, month)
+	return args.Get(0).(PeriodStatus), args.Error(1)
+}
+
+func (s *mockStorer) StubRetrievePeriodStatus(year interface{}, month interface{}) *mock.Call {
+	return s.On("RetrievePeriodStatus", mock.Anything, year, month)
+}
+
+func (s *mockStorer) StoreAggregateVersion(ctx context.Context, reportType ReportType, year int, month int, version AggregateVersion, data []byte) error {
+	args := s.Called(ctx, reportType, year, month, version, data)
+	return args.Error(0)
+}
+
+func (s *mockStorer) StubStoreAggregateVersion(reportType interface{}, year interface{}, month interface{}) *mock.Call {
+	return s.On("StoreAggregateVersion", mock.Anything, reportType, year, month, mock.Anything, mock.Anything)
+}
+
+func (s *mockStorer) ListAggregateVersions(ctx context.Context, reportType ReportType, year int, month int) ([]AggregateVersion, error) {
+	args := s.Called(ctx, reportType, year, month)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]AggregateVersion), args.Error(1)
+}
+
+func (s *mockStorer) StubListAggregateVersions(reportType interface{}, year interface{}, month interface{}) *mock.Call {
+	return s.On("ListAggregateVersions", mock.Anything, reportType, year, month)
+}
+
+func (s *mockStorer) RetrieveAggregateVersion(ctx context.Context, reportType ReportType, year int, month int, id string) ([]byte, error) {
+	args := s.Called(ctx, reportType, year, month, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (s *mockStorer) StubRetrieveAggregateVersion(reportType interface{}, year interface{}, month interface{}, id interface{}) *mock.Call {
+	return s.On("RetrieveAggregateVersion", mock.Anything, reportType, year, month, id)
+}
+
+func (s *mockStorer) StoreRejectedRows(ctx context.Context, reportType ReportType, year int, month int, data []byte) error {
+	args := s.Called(ctx, reportType, year, month, data)
+	return args.Error(0)
+}
+
+func (s *mockStorer) StubStoreRejectedRows(reportType interface{}, year interface{}, month interface{}, data interface{}) *mock.Call {
+	return s.On("StoreRejectedRows", mock.Anything, reportType, year, month, data)
+}
+
+func (s *mockStorer) StoreFailures(ctx context.Context, reportType ReportType, year int, month int, failures []FileFailure) error {
+	args := s.Called(ctx, reportType, year, month, failures)
+	return args.Error(0)
+}
+
+func (s *mockStorer) StubStoreFailures(reportType interface{}, year interface{}, month interface{}, failures interface{}) *mock.Call {
+	return s.On("StoreFailures", mock.Anything, reportType, year, month, failures)
+}
+
+func (s *mockStorer) RetrieveFailures(ctx context.Context, reportType ReportType, year int, month int) ([]FileFailure, error) {
+	args := s.Called(ctx, reportType, year, month)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]FileFailure), args.Error(1)
+}
+
+func (s *mockStorer) StubRetrieveFailures(reportType interface{}, year interface{}, month interface{}) *mock.Call {
+	return s.On("RetrieveFailures", mock.Anything, reportType, year, month)
+}
+
+func (s *mockStorer) QuarantineIndividualFile(ctx context.Context, key string, reason string) (string, error) {
+	args := s.Called(ctx, key, reason)
+	return args.String(0), args.Error(1)
+}
+
+func (s *mockStorer) StubQuarantineIndividualFile(key interface{}, reason interface{}) *mock.Call {
+	return s.On("QuarantineIndividualFile", mock.Anything, key, reason)
+}
+
+func (s *mockStorer) AssertQuarantineIndividualFileNotCalled(t *testing.T) {
+	s.AssertNotCalled(t, "QuarantineIndividualFile", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *mockStorer) ListQuarantinedFiles(ctx context.Context, reportType ReportType, year int, month int) ([]QuarantinedFile, error) {
+	args := s.Called(ctx, reportType, year, month)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]QuarantinedFile), args.Error(1)
+}
+
+func (s *mockStorer) StubListQuarantinedFiles(reportType interface{}, year interface{}, month interface{}) *mock.Call {
+	return s.On("ListQuarantinedFiles", mock.Anything, reportType, year, month)
+}
+
+func (s *mockStorer) ReleaseQuarantinedFile(ctx context.Context, reportType ReportType, year int, month int, name string) (string, error) {
+	args := s.Called(ctx, reportType, year, month, name)
+	return args.String(0), args.Error(1)
+}
+
+func (s *mockStorer) StubReleaseQuarantinedFile(reportType interface{}, year interface{}, month interface{}, name interface{}) *mock.Call {
+	return s.On("ReleaseQuarantinedFile", mock.Anything, reportType, year, month, name)
+}
+
+func (s *mockStorer) RetrieveSummary(ctx context.Context, reportType ReportType, year int, month int, name string) ([]byte, error) {
+	args := s.Called(ctx, reportType, year, month, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (s *mockStorer) StubRetrieveSummary(reportType interface{}, year interface{}, month interface{}, name interface{}) *mock.Call {
+	return s.On("RetrieveSummary", mock.Anything, reportType, year, month, name)
+}
+
+func (s *mockStorer) StoreSummary(ctx context.Context, reportType ReportType, year int, month int, name string, data []byte) error {
+	args := s.Called(ctx, reportType, year, month, name, data)
+	return args.Error(0)
+}
+
+func (s *mockStorer) StubStoreSummary(reportType interface{}, year interface{}, month interface{}, name interface{}, data interface{}) *mock.Call {
+	return s.On("StoreSummary", mock.Anything, reportType, year, month, name, data)
+}
+
+func (s *mockStorer) AssertStoreSummaryNotCalled(t *testing.T) {
+	s.AssertNotCalled(t, "StoreSummary", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *mockStorer) StorePeriodStatus(ctx context.Context, year int, month int, status PeriodStatus) error {
+	args := s.Called(ctx, year, month, status)
+	return args.Error(0)
+}
+
+func (s *mockStorer) StubStorePeriodStatus(year interface{}, month interface{}, status interface{}) *mock.Call {
+	return s.On("StorePeriodStatus", mock.Anything, year, month, status)
+}
+
+func (s *mockStorer) AssertStorePeriodStatusNotCalled(t *testing.T) {
+	s.AssertNotCalled(t, "StorePeriodStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *mockStorer) RetainAggregated(ctx context.Context, reportType ReportType, year int, month int, mode RetentionMode, until time.Time) (bool, error) {
+	args := s.Called(ctx, reportType, year, month, mode, until)
+	return args.Bool(0), args.Error(1)
+}
+
+func (s *mockStorer) StubRetainAggregated(reportType interface{}, year interface{}, month interface{}) *mock.Call {
+	return s.On("RetainAggregated", mock.Anything, reportType, year, month, mock.Anything, mock.Anything)
+}
+
+// ParseIndividualKey follows the default key layout rather than expectations, since it is pure
+func (s *mockStorer) ParseIndividualKey(key string) (ReportType, int, int, bool) {
+	return DefaultKeyLayout().parseIndividualKey(key)
+}
+
+func (s *mockStorer) Ping(ctx context.Context) error {
+	args := s.Called(ctx)
+	return args.Error(0)
+}
+
+func (s *mockStorer) StubPing() *mock.Call {
+	return s.On("Ping", mock.Anything)
+}
+
+func (s *mockStorer) AcquireLock(ctx context.Context, name string, owner string, expiresAt time.Time) (bool, error) {
+	args := s.Called(ctx, name, owner, expiresAt)
+	return args.Bool(0), args.Error(1)
+}
+
+func (s *mockStorer) StubAcquireLock(name interface{}) *mock.Call {
+	return s.On("AcquireLock", mock.Anything, name, mock.Anything, mock.Anything)
+}
+
+func (s *mockStorer) ReleaseLock(ctx context.Context, name string, owner string) error {
+	args := s.Called(ctx, name, owner)
+	return args.Error(0)
+}
+
+func (s *mockStorer) StubReleaseLock(name interface{}) *mock.Call {
+	return s.On("ReleaseLock", mock.Anything, name, mock.Anything)
+}
+
+func (s *mockStorer) StoreJob(ctx context.Context, id string, data []byte) error {
+	args := s.Called(ctx, id, data)
+	return args.Error(0)
+}
+
+func (s *mockStorer) StubStoreJob(id interface{}) *mock.Call {
+	return s.On("StoreJob", mock.Anything, id, mock.Anything)
+}
+
+func (s *mockStorer) RetrieveJob(ctx context.Context, id string) ([]byte, error) {
+	args := s.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (s *mockStorer) StubRetrieveJob(id interface{}) *mock.Call {
+	return s.On("RetrieveJob", mock.Anything, id)
+}
+
+func (s *mockStorer) RetrieveJobs(ctx context.Context) ([][]byte, error) {
+	args := s.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([][]byte), args.Error(1)
+}
+
+func (s *mockStorer) StubRetrieveJobs() *mock.Call {
+	return s.On("RetrieveJobs", mock.Anything)
+}
+
+func (s *mockStorer) DeleteJob(ctx context.Context, id string) error {
+	args := s.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (s *mockStorer) StubDeleteJob(id interface{}) *mock.Call {
+	return s.On("DeleteJob", mock.Anything, id)
 }
@@ -0,0 +1,64 @@
+package storer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+)
+
+// StoreFailures replaces the failures manifest of the previous build, removing it when the build read every file
+func (s *s3Storer) StoreFailures(ctx context.Context, reportType ReportType, year int, month int, failures []FileFailure) (err error) {
+	key := s.layout.failuresKey(reportType, year, month)
+	ctx, span := tracer.Start(ctx, "s3Storer.StoreFailures", trace.WithAttributes(
+		attribute.String("s3.key", key),
+		attribute.Int("report.failures", len(failures)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.ensureOpen(ctx, year, month); err != nil {
+		return err
+	}
+
+	if len(failures) == 0 {
+		return s.deleteObject(ctx, key)
+	}
+
+	data, err := json.Marshal(failures)
+	if err != nil {
+		return fmt.Errorf("failed to encode failures: %v", err)
+	}
+
+	if err := s.putObject(ctx, key, data, jsonContentType); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "stored failures", slog.String("key", key), slog.Int("failures", len(failures)))
+
+	return nil
+}
+
+func (s *s3Storer) RetrieveFailures(ctx context.Context, reportType ReportType, year int, month int) (_ []FileFailure, err error) {
+	key := s.layout.failuresKey(reportType, year, month)
+	ctx, span := tracer.Start(ctx, "s3Storer.RetrieveFailures", trace.WithAttributes(attribute.String("s3.key", key)))
+	defer func() { tracing.End(span, err) }()
+
+	data, err := s.getObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	failures := []FileFailure{}
+	if data == nil {
+		return failures, nil
+	}
+
+	if err := json.Unmarshal(data, &failures); err != nil {
+		return nil, fmt.Errorf("failed to decode failures %s: %v", key, err)
+	}
+
+	return failures, nil
+}
@@ -0,0 +1,67 @@
+package storer
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+)
+
+func (s *s3Storer) StoreJob(ctx context.Context, id string, data []byte) (err error) {
+	key := s.layout.jobKey(id)
+	ctx, span := tracer.Start(ctx, "s3Storer.StoreJob", trace.WithAttributes(attribute.String("s3.key", key)))
+	defer func() { tracing.End(span, err) }()
+
+	return s.putObject(ctx, key, data, jsonContentType)
+}
+
+func (s *s3Storer) RetrieveJob(ctx context.Context, id string) (_ []byte, err error) {
+	key := s.layout.jobKey(id)
+	ctx, span := tracer.Start(ctx, "s3Storer.RetrieveJob", trace.WithAttributes(attribute.String("s3.key", key)))
+	defer func() { tracing.End(span, err) }()
+
+	return s.getObject(ctx, key)
+}
+
+func (s *s3Storer) RetrieveJobs(ctx context.Context) (_ [][]byte, err error) {
+	prefix := s.layout.jobsPrefix()
+	ctx, span := tracer.Start(ctx, "s3Storer.RetrieveJobs", trace.WithAttributes(attribute.String("s3.prefix", prefix)))
+	defer func() { tracing.End(span, err) }()
+
+	objects, err := s.listObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs [][]byte
+	for _, o := range objects {
+		key := aws.ToString(o.Key)
+		if !strings.HasSuffix(key, ".json") {
+			continue
+		}
+
+		data, err := s.getObject(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		// the job may have been removed since it was listed
+		if data != nil {
+			jobs = append(jobs, data)
+		}
+	}
+
+	span.SetAttributes(attribute.Int("s3.objects", len(jobs)))
+
+	return jobs, nil
+}
+
+func (s *s3Storer) DeleteJob(ctx context.Context, id string) (err error) {
+	key := s.layout.jobKey(id)
+	ctx, span := tracer.Start(ctx, "s3Storer.DeleteJob", trace.WithAttributes(attribute.String("s3.key", key)))
+	defer func() { tracing.End(span, err) }()
+
+	return s.deleteObject(ctx, key)
+}
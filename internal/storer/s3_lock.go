@@ -0,0 +1,81 @@
+package storer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+type lock struct {
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AcquireLock writes the lock conditionally: a free lock is only created if it still does not exist, and a held or expired lock is only replaced
+// if it has not changed since it was read. Of replicas racing for the same lock, exactly one wins
+func (s *s3Storer) AcquireLock(ctx context.Context, name string, owner string, expiresAt time.Time) (_ bool, err error) {
+	key := s.layout.lockKey(name)
+	ctx, span := tracer.Start(ctx, "s3Storer.AcquireLock", trace.WithAttributes(attribute.String("s3.key", key)))
+	defer func() { tracing.End(span, err) }()
+
+	current, etag, err := s.retrieveLock(ctx, key)
+	if err != nil {
+		return false, err
+	}
+
+	if current != nil && current.Owner != owner && time.Now().Before(current.ExpiresAt) {
+		return false, nil
+	}
+
+	data, err := json.Marshal(lock{Owner: owner, ExpiresAt: expiresAt})
+	if err != nil {
+		return false, fmt.Errorf("failed to encode lock %s: %v", name, err)
+	}
+
+	err = s.putObjectIf(ctx, key, data, jsonContentType, etag)
+	if errors.Is(err, errPreconditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *s3Storer) ReleaseLock(ctx context.Context, name string, owner string) (err error) {
+	key := s.layout.lockKey(name)
+	ctx, span := tracer.Start(ctx, "s3Storer.ReleaseLock", trace.WithAttributes(attribute.String("s3.key", key)))
+	defer func() { tracing.End(span, err) }()
+
+	current, _, err := s.retrieveLock(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if current == nil || current.Owner != owner {
+		return nil
+	}
+
+	return s.deleteObject(ctx, key)
+}
+
+// retrieveLock returns the lock at key along with its ETag, or nil when there is no lock
+func (s *s3Storer) retrieveLock(ctx context.Context, key string) (*lock, string, error) {
+	data, etag, err := s.getObjectWithETag(ctx, key)
+	if err != nil || data == nil {
+		return nil, "", err
+	}
+
+	var l lock
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, "", fmt.Errorf("failed to decode lock at %s: %v", key, err)
+	}
+
+	return &l, etag, nil
+}
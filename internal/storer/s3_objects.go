@@ -0,0 +1,193 @@
+package storer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/hpcsc/outside-in-go/internal/metrics"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	csvContentType  = "text/csv"
+	jsonContentType = "application/json"
+)
+
+// errPreconditionFailed is returned by conditional writes when the object changed since it was read
+var errPreconditionFailed = errors.New("object was changed by another writer")
+
+// listObjects returns every object under prefix, following continuation tokens past the 1000 objects a single listing returns
+func (s *s3Storer) listObjects(ctx context.Context, prefix string) ([]types.Object, error) {
+	var objects []types.Object
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		start := time.Now()
+		page, err := paginator.NextPage(ctx)
+		metrics.ObserveS3Operation("ListObjectsV2", start, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects at %s: %v", prefix, err)
+		}
+
+		objects = append(objects, page.Contents...)
+	}
+
+	return objects, nil
+}
+
+// getObject returns the content at key, or nil without error when there is no object at key
+func (s *s3Storer) getObject(ctx context.Context, key string) ([]byte, error) {
+	content, _, err := s.getObjectWithETag(ctx, key)
+	return content, err
+}
+
+// getObjectWithETag returns the content at key along with its ETag, or nil without error when there is no object at key
+func (s *s3Storer) getObjectWithETag(ctx context.Context, key string) ([]byte, string, error) {
+	start := time.Now()
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKeyErr *types.NoSuchKey
+		if errors.As(err, &noSuchKeyErr) {
+			// a missing object is an expected outcome, not a failed operation
+			metrics.ObserveS3Operation("GetObject", start, nil)
+			return nil, "", nil
+		}
+
+		metrics.ObserveS3Operation("GetObject", start, err)
+		return nil, "", fmt.Errorf("failed to get object at %s: %v", key, err)
+	}
+	defer output.Body.Close()
+
+	content, err := io.ReadAll(output.Body)
+	metrics.ObserveS3Operation("GetObject", start, err)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read object content at %s: %v", key, err)
+	}
+
+	return content, aws.ToString(output.ETag), nil
+}
+
+func (s *s3Storer) putObject(ctx context.Context, key string, data []byte, contentType string) error {
+	start := time.Now()
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	metrics.ObserveS3Operation("PutObject", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to write object at %s: %v", key, err)
+	}
+
+	return nil
+}
+
+// putObjectIf writes the object at key only when it does not exist yet, given no etag, or when it still has etag otherwise.
+// It returns errPreconditionFailed when another writer got there first
+func (s *s3Storer) putObjectIf(ctx context.Context, key string, data []byte, contentType string, etag string) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	}
+	if etag == "" {
+		input.IfNoneMatch = aws.String("*")
+	} else {
+		input.IfMatch = aws.String(etag)
+	}
+
+	start := time.Now()
+	_, err := s.client.PutObject(ctx, input)
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			// losing the race to another writer is an expected outcome, not a failed operation
+			metrics.ObserveS3Operation("PutObject", start, nil)
+			return fmt.Errorf("%w at %s", errPreconditionFailed, key)
+		}
+	}
+
+	metrics.ObserveS3Operation("PutObject", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to write object at %s: %v", key, err)
+	}
+
+	return nil
+}
+
+func (s *s3Storer) deleteObject(ctx context.Context, key string) error {
+	start := time.Now()
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	metrics.ObserveS3Operation("DeleteObject", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete object at %s: %v", key, err)
+	}
+
+	return nil
+}
+
+// headObject returns the metadata of the object at key, or nil without error when there is no object at key
+func (s *s3Storer) headObject(ctx context.Context, key string) (*s3.HeadObjectOutput, error) {
+	start := time.Now()
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFoundErr *types.NotFound
+		if errors.As(err, &notFoundErr) {
+			metrics.ObserveS3Operation("HeadObject", start, nil)
+			return nil, nil
+		}
+
+		metrics.ObserveS3Operation("HeadObject", start, err)
+		return nil, fmt.Errorf("failed to get object metadata at %s: %v", key, err)
+	}
+
+	metrics.ObserveS3Operation("HeadObject", start, nil)
+	return output, nil
+}
+
+// copyObject copies the object at source to key, replacing its user metadata with metadata
+func (s *s3Storer) copyObject(ctx context.Context, source string, key string, contentType string, metadata map[string]string) error {
+	segments := strings.Split(source, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	start := time.Now()
+	_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(fmt.Sprintf("%s/%s", s.bucket, strings.Join(segments, "/"))),
+		ContentType:       aws.String(contentType),
+		Metadata:          metadata,
+		MetadataDirective: types.MetadataDirectiveReplace,
+	})
+	metrics.ObserveS3Operation("CopyObject", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to copy object at %s to %s: %v", source, key, err)
+	}
+
+	return nil
+}
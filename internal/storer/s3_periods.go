@@ -0,0 +1,123 @@
+package storer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/hpcsc/outside-in-go/internal/logging"
+	"github.com/hpcsc/outside-in-go/internal/metrics"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"time"
+)
+
+type periodMetadata struct {
+	Status    PeriodStatus `json:"status"`
+	ChangedAt time.Time    `json:"changed_at"`
+}
+
+func (s *s3Storer) RetrievePeriodStatus(ctx context.Context, year int, month int) (_ PeriodStatus, err error) {
+	key := s.layout.periodKey(year, month)
+	ctx, span := tracer.Start(ctx, "s3Storer.RetrievePeriodStatus", trace.WithAttributes(attribute.String("s3.key", key)))
+	defer func() { tracing.End(span, err) }()
+
+	data, err := s.getObject(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	if data == nil {
+		return OpenPeriodStatus, nil
+	}
+
+	var metadata periodMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return "", fmt.Errorf("failed to decode period metadata at %s: %v", key, err)
+	}
+
+	span.SetAttributes(attribute.String("period.status", string(metadata.Status)))
+
+	return metadata.Status, nil
+}
+
+func (s *s3Storer) StorePeriodStatus(ctx context.Context, year int, month int, status PeriodStatus) (err error) {
+	key := s.layout.periodKey(year, month)
+	ctx, span := tracer.Start(ctx, "s3Storer.StorePeriodStatus", trace.WithAttributes(
+		attribute.String("s3.key", key),
+		attribute.String("period.status", string(status)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	data, err := json.Marshal(periodMetadata{Status: status, ChangedAt: time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("failed to encode period metadata: %v", err)
+	}
+
+	if err := s.putObject(ctx, key, data, jsonContentType); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "stored period status", logging.Period(year, month), slog.String("status", string(status)))
+
+	return nil
+}
+
+func (s *s3Storer) RetainAggregated(ctx context.Context, reportType ReportType, year int, month int, mode RetentionMode, until time.Time) (_ bool, err error) {
+	key := s.layout.aggregateKey(reportType, year, month)
+	ctx, span := tracer.Start(ctx, "s3Storer.RetainAggregated", trace.WithAttributes(attribute.String("s3.key", key)))
+	defer func() { tracing.End(span, err) }()
+
+	start := time.Now()
+	_, err = s.client.PutObjectRetention(ctx, &s3.PutObjectRetentionInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Retention: &types.ObjectLockRetention{
+			Mode:            types.ObjectLockRetentionMode(mode),
+			RetainUntilDate: aws.Time(until),
+		},
+	})
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey":
+			metrics.ObserveS3Operation("PutObjectRetention", start, nil)
+			return false, nil
+		case "InvalidRequest", "ObjectLockConfigurationNotFoundError":
+			// buckets created without Object Lock reject retention as an invalid request
+			metrics.ObserveS3Operation("PutObjectRetention", start, nil)
+			return false, fmt.Errorf("%w on bucket %s: %v", ErrObjectLockUnavailable, s.bucket, err)
+		}
+	}
+
+	metrics.ObserveS3Operation("PutObjectRetention", start, err)
+	if err != nil {
+		return false, fmt.Errorf("failed to retain object at %s: %v", key, err)
+	}
+
+	slog.InfoContext(ctx, "retained aggregated file",
+		slog.String("key", key),
+		slog.String("mode", string(mode)),
+		slog.Time("until", until),
+		logging.Duration(start),
+	)
+
+	return true, nil
+}
+
+// ensureOpen returns ErrPeriodClosed unless the period is open
+func (s *s3Storer) ensureOpen(ctx context.Context, year int, month int) error {
+	status, err := s.RetrievePeriodStatus(ctx, year, month)
+	if err != nil {
+		return err
+	}
+
+	return EnsureOpen(status, year, month)
+}
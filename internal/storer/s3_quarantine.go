@@ -0,0 +1,181 @@
+package storer
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hpcsc/outside-in-go/internal/logging"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	reasonMetadata      = "reason"
+	originalKeyMetadata = "original-key"
+	// maxReasonBytes keeps the metadata of a quarantined file within the 2 KB S3 allows for user metadata once escaped
+	maxReasonBytes = 512
+)
+
+// QuarantineIndividualFile copies the file under the quarantine prefix before deleting it, so that a failed move never loses the file
+func (s *s3Storer) QuarantineIndividualFile(ctx context.Context, key string, reason string) (_ string, err error) {
+	ctx, span := tracer.Start(ctx, "s3Storer.QuarantineIndividualFile", trace.WithAttributes(attribute.String("s3.key", key)))
+	defer func() { tracing.End(span, err) }()
+
+	reportType, year, month, ok := s.layout.parseIndividualKey(key)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotIndividualFile, key)
+	}
+
+	if err := s.ensureOpen(ctx, year, month); err != nil {
+		return "", err
+	}
+
+	target := s.layout.quarantinePrefix(reportType, year, month) + s.layout.quarantineName(reportType, year, month, key)
+	span.SetAttributes(attribute.String("s3.target_key", target))
+
+	metadata := map[string]string{
+		reasonMetadata:      url.QueryEscape(truncate(reason, maxReasonBytes)),
+		originalKeyMetadata: url.QueryEscape(key),
+	}
+	if err := s.copyObject(ctx, key, target, csvContentType, metadata); err != nil {
+		return "", err
+	}
+
+	if err := s.deleteObject(ctx, key); err != nil {
+		return "", err
+	}
+
+	slog.InfoContext(ctx, "quarantined individual file",
+		slog.String("key", key),
+		slog.String("quarantine_key", target),
+		slog.String("reason", reason),
+	)
+
+	return target, nil
+}
+
+func (s *s3Storer) ListQuarantinedFiles(ctx context.Context, reportType ReportType, year int, month int) (_ []QuarantinedFile, err error) {
+	prefix := s.layout.quarantinePrefix(reportType, year, month)
+	ctx, span := tracer.Start(ctx, "s3Storer.ListQuarantinedFiles", trace.WithAttributes(attribute.String("s3.prefix", prefix)))
+	defer func() { tracing.End(span, err) }()
+
+	objects, err := s.listObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]QuarantinedFile, 0, len(objects))
+	for _, o := range objects {
+		key := aws.ToString(o.Key)
+		head, err := s.headObject(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		// a file released between listing and reading its metadata is no longer quarantined
+		if head == nil {
+			continue
+		}
+
+		name := strings.TrimPrefix(key, prefix)
+		files = append(files, QuarantinedFile{
+			Name:          name,
+			Key:           key,
+			OriginalKey:   s.originalKey(reportType, year, month, name, head.Metadata),
+			Reason:        unescapeMetadata(head.Metadata[reasonMetadata]),
+			QuarantinedAt: aws.ToTime(o.LastModified),
+			Size:          aws.ToInt64(o.Size),
+		})
+	}
+
+	slog.DebugContext(ctx, "listed quarantined files",
+		slog.String("report_type", string(reportType)),
+		logging.Period(year, month),
+		slog.Int("count", len(files)),
+	)
+
+	span.SetAttributes(attribute.Int("s3.objects", len(files)))
+
+	return files, nil
+}
+
+func (s *s3Storer) ReleaseQuarantinedFile(ctx context.Context, reportType ReportType, year int, month int, name string) (_ string, err error) {
+	key := s.layout.quarantinePrefix(reportType, year, month) + name
+	ctx, span := tracer.Start(ctx, "s3Storer.ReleaseQuarantinedFile", trace.WithAttributes(attribute.String("s3.key", key)))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.ensureOpen(ctx, year, month); err != nil {
+		return "", err
+	}
+
+	notQuarantined := fmt.Errorf("%w: '%s' for %02d/%d", ErrNotQuarantined, name, month, year)
+	if name == "" {
+		return "", notQuarantined
+	}
+
+	head, err := s.headObject(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	if head == nil {
+		return "", notQuarantined
+	}
+
+	original := s.originalKey(reportType, year, month, name, head.Metadata)
+	span.SetAttributes(attribute.String("s3.target_key", original))
+
+	if err := s.copyObject(ctx, key, original, csvContentType, nil); err != nil {
+		return "", err
+	}
+
+	if err := s.deleteObject(ctx, key); err != nil {
+		return "", err
+	}
+
+	slog.InfoContext(ctx, "released quarantined file", slog.String("quarantine_key", key), slog.String("key", original))
+
+	return original, nil
+}
+
+// originalKey returns the key a file was quarantined from, falling back to its name under the individual prefix when that was not recorded
+func (s *s3Storer) originalKey(reportType ReportType, year int, month int, name string, metadata map[string]string) string {
+	if original := unescapeMetadata(metadata[originalKeyMetadata]); original != "" {
+		return original
+	}
+
+	prefix := s.layout.individualPrefix(reportType, year, month)
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return prefix + name
+}
+
+// unescapeMetadata decodes a metadata value escaped to keep it within the ASCII S3 accepts in headers, returning values not escaped by this package as they are
+func unescapeMetadata(value string) string {
+	unescaped, err := url.QueryUnescape(value)
+	if err != nil {
+		return value
+	}
+
+	return unescaped
+}
+
+// truncate shortens value to at most n bytes without splitting a character
+func truncate(value string, n int) string {
+	if len(value) <= n {
+		return value
+	}
+
+	for n > 0 && !utf8.RuneStart(value[n]) {
+		n--
+	}
+
+	return value[:n]
+}
@@ -1,111 +1,285 @@
 package storer
 
 import (
-	"bytes"
 	"context"
-	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-	"io/ioutil"
+	"github.com/hpcsc/outside-in-go/internal/logging"
+	"github.com/hpcsc/outside-in-go/internal/metrics"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"time"
 )
 
 var _ Storer = &s3Storer{}
 
+var tracer = otel.Tracer("github.com/hpcsc/outside-in-go/internal/storer")
+
 type s3Storer struct {
 	bucket string
 	client *s3.Client
+	layout KeyLayout
+}
+
+type S3Option func(*s3Options)
+
+type s3Options struct {
+	layout      KeyLayout
+	loadOptions []func(*config.LoadOptions) error
+}
+
+func WithKeyLayout(layout KeyLayout) S3Option {
+	return func(o *s3Options) {
+		o.layout = layout
+	}
+}
+
+// WithRegion overrides the region resolved from the default AWS configuration chain
+func WithRegion(region string) S3Option {
+	return func(o *s3Options) {
+		if region != "" {
+			o.loadOptions = append(o.loadOptions, config.WithRegion(region))
+		}
+	}
 }
 
-func NewS3Storer(endpoint string, bucket string) (Storer, error) {
-	cfg, err := s3Config(endpoint)
+// WithStaticCredentials overrides the credentials resolved from the default AWS configuration chain
+func WithStaticCredentials(accessKeyID string, secretAccessKey string) S3Option {
+	return func(o *s3Options) {
+		if accessKeyID != "" {
+			o.loadOptions = append(o.loadOptions, config.WithCredentialsProvider(
+				credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, ""),
+			))
+		}
+	}
+}
+
+func NewS3Storer(endpoint string, bucket string, opts ...S3Option) (Storer, error) {
+	options := &s3Options{
+		layout: DefaultKeyLayout(),
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	cfg, err := s3Config(endpoint, options.loadOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load aws config: %v", err)
 	}
+	otelaws.AppendMiddlewares(&cfg.APIOptions)
 
 	return &s3Storer{
 		bucket: bucket,
 		client: s3.NewFromConfig(cfg, func(o *s3.Options) {
 			o.UsePathStyle = true
 		}),
+		layout: options.layout,
 	}, nil
 }
 
-func (s *s3Storer) RetrieveIndividualFiles(reportType ReportType, year int, month int) ([][]byte, error) {
-	prefix := fmt.Sprintf("%d/%02d/%s", year, month, reportType)
-	listResponse, err := s.client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
-		Bucket: aws.String(s.bucket),
-		Prefix: aws.String(prefix),
-	})
+func (s *s3Storer) ListIndividualFiles(ctx context.Context, reportType ReportType, year int, month int) (_ []IndividualFile, err error) {
+	prefix := s.layout.individualPrefix(reportType, year, month)
+	ctx, span := tracer.Start(ctx, "s3Storer.ListIndividualFiles", trace.WithAttributes(attribute.String("s3.prefix", prefix)))
+	defer func() { tracing.End(span, err) }()
+
+	start := time.Now()
+	objects, err := s.listObjects(ctx, prefix)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list objects at %s: %v", prefix, err)
+		return nil, err
 	}
 
-	var result [][]byte
-	for _, f := range listResponse.Contents {
-		object, err := s.client.GetObject(context.TODO(), &s3.GetObjectInput{
-			Bucket: aws.String(s.bucket),
-			Key:    f.Key,
+	files := make([]IndividualFile, 0, len(objects))
+	for _, o := range objects {
+		files = append(files, IndividualFile{
+			Key:          aws.ToString(o.Key),
+			LastModified: aws.ToTime(o.LastModified),
+			Size:         aws.ToInt64(o.Size),
 		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to get object at %s: %v", *f.Key, err)
-		}
+	}
 
-		content, err := ioutil.ReadAll(object.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read object content at %s: %v", *f.Key, err)
-		}
+	slog.DebugContext(ctx, "listed individual files",
+		slog.String("report_type", string(reportType)),
+		logging.Period(year, month),
+		slog.String("prefix", prefix),
+		slog.Int("count", len(files)),
+		logging.Duration(start),
+	)
+
+	span.SetAttributes(attribute.Int("s3.objects", len(files)))
+
+	return files, nil
+}
+
+func (s *s3Storer) StoreIndividualFile(ctx context.Context, reportType ReportType, year int, month int, cluster string, data []byte) (_ string, err error) {
+	key := s.layout.individualKey(reportType, year, month, cluster)
+	ctx, span := tracer.Start(ctx, "s3Storer.StoreIndividualFile", trace.WithAttributes(attribute.String("s3.key", key)))
+	defer func() { tracing.End(span, err) }()
 
-		result = append(result, content)
+	if err := s.ensureOpen(ctx, year, month); err != nil {
+		return "", err
 	}
 
-	return result, nil
+	start := time.Now()
+	if err := s.putObject(ctx, key, data, csvContentType); err != nil {
+		return "", err
+	}
+
+	slog.InfoContext(ctx, "stored individual file",
+		slog.String("key", key),
+		slog.Int("bytes", len(data)),
+		logging.Duration(start),
+	)
+
+	return key, nil
 }
 
-func (s *s3Storer) RetrieveAggregated(reportType ReportType, year int, month int) ([]byte, error) {
-	key := fmt.Sprintf("%d/%02d/aggregate/%s.csv", year, month, reportType)
-	getOutput, err := s.client.GetObject(context.TODO(), &s3.GetObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
-	})
+func (s *s3Storer) RetrieveIndividualFile(ctx context.Context, key string) (_ []byte, err error) {
+	ctx, span := tracer.Start(ctx, "s3Storer.RetrieveIndividualFile", trace.WithAttributes(attribute.String("s3.key", key)))
+	defer func() { tracing.End(span, err) }()
 
+	start := time.Now()
+	content, err := s.getObject(ctx, key)
 	if err != nil {
-		var noSuchKeyErr *types.NoSuchKey
-		if errors.As(err, &noSuchKeyErr) {
-			return nil, nil
-		}
-
-		return nil, fmt.Errorf("failed to get object at %s: %v", key, err)
+		return nil, err
 	}
 
-	body, err := ioutil.ReadAll(getOutput.Body)
+	slog.DebugContext(ctx, "retrieved individual file",
+		slog.String("key", key),
+		slog.Int("bytes", len(content)),
+		logging.Duration(start),
+	)
+
+	return content, nil
+}
+
+func (s *s3Storer) RetrieveAggregated(ctx context.Context, reportType ReportType, year int, month int) (_ []byte, err error) {
+	key := s.layout.aggregateKey(reportType, year, month)
+	ctx, span := tracer.Start(ctx, "s3Storer.RetrieveAggregated", trace.WithAttributes(attribute.String("s3.key", key)))
+	defer func() { tracing.End(span, err) }()
+
+	start := time.Now()
+	body, err := s.getObject(ctx, key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read object content at %s: %v", key, err)
+		return nil, err
+	}
+
+	if body == nil {
+		slog.DebugContext(ctx, "aggregated file not found", slog.String("key", key), logging.Duration(start))
+		return nil, nil
 	}
 
+	slog.DebugContext(ctx, "retrieved aggregated file",
+		slog.String("key", key),
+		slog.Int("bytes", len(body)),
+		logging.Duration(start),
+	)
+
 	return body, nil
 }
 
-func (s *s3Storer) StoreAggregated(reportType ReportType, year int, month int, data []byte) error {
-	key := fmt.Sprintf("%d/%02d/aggregate/%s.csv", year, month, reportType)
-	if _, err := s.client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(key),
-		Body:        bytes.NewReader(data),
-		ContentType: aws.String("text/csv"),
-	}); err != nil {
-		return fmt.Errorf("failed to write object at %s: %v", key, err)
+func (s *s3Storer) StoreAggregated(ctx context.Context, reportType ReportType, year int, month int, data []byte) (err error) {
+	key := s.layout.aggregateKey(reportType, year, month)
+	ctx, span := tracer.Start(ctx, "s3Storer.StoreAggregated", trace.WithAttributes(attribute.String("s3.key", key)))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.ensureOpen(ctx, year, month); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	if err := s.putObject(ctx, key, data, csvContentType); err != nil {
+		return err
+	}
+
+	if err := s.deleteSummaries(ctx, reportType, year, month); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "stored aggregated file",
+		slog.String("key", key),
+		slog.Int("bytes", len(data)),
+		logging.Duration(start),
+	)
+
+	return nil
+}
+
+func (s *s3Storer) DeleteAggregated(ctx context.Context, reportType ReportType, year int, month int) (err error) {
+	key := s.layout.aggregateKey(reportType, year, month)
+	ctx, span := tracer.Start(ctx, "s3Storer.DeleteAggregated", trace.WithAttributes(attribute.String("s3.key", key)))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.ensureOpen(ctx, year, month); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	if err := s.deleteObject(ctx, key); err != nil {
+		return err
+	}
+
+	if err := s.deleteSummaries(ctx, reportType, year, month); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "deleted aggregated file", slog.String("key", key), logging.Duration(start))
+
+	return nil
+}
+
+func (s *s3Storer) StoreRejectedRows(ctx context.Context, reportType ReportType, year int, month int, data []byte) (err error) {
+	key := s.layout.rejectedRowsKey(reportType, year, month)
+	ctx, span := tracer.Start(ctx, "s3Storer.StoreRejectedRows", trace.WithAttributes(attribute.String("s3.key", key)))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.ensureOpen(ctx, year, month); err != nil {
+		return err
+	}
+
+	if err := s.putObject(ctx, key, data, csvContentType); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "stored rejected rows", slog.String("key", key), slog.Int("bytes", len(data)))
+
+	return nil
+}
+
+func (s *s3Storer) AggregateKey(reportType ReportType, year int, month int) string {
+	return s.layout.aggregateKey(reportType, year, month)
+}
+
+func (s *s3Storer) ParseIndividualKey(key string) (ReportType, int, int, bool) {
+	return s.layout.parseIndividualKey(key)
+}
+
+func (s *s3Storer) Ping(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "s3Storer.Ping", trace.WithAttributes(attribute.String("s3.bucket", s.bucket)))
+	defer func() { tracing.End(span, err) }()
+
+	start := time.Now()
+	_, err = s.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucket),
+	})
+	metrics.ObserveS3Operation("HeadBucket", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to access bucket %s: %v", s.bucket, err)
 	}
 
 	return nil
 }
 
-func s3Config(endpoint string) (aws.Config, error) {
-	return config.LoadDefaultConfig(context.TODO(),
+func s3Config(endpoint string, optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
+	return config.LoadDefaultConfig(context.TODO(), append([]func(*config.LoadOptions) error{
 		config.WithEndpointResolverWithOptions(aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
-			if service == s3.ServiceID {
+			if service == s3.ServiceID && endpoint != "" {
 				return aws.Endpoint{
 					PartitionID:   "aws",
 					URL:           endpoint,
@@ -114,5 +288,6 @@ func s3Config(endpoint string) (aws.Config, error) {
 			}
 			// returning EndpointNotFoundError will allow the service to fallback to it's default resolution
 			return aws.Endpoint{}, &aws.EndpointNotFoundError{}
-		})))
+		})),
+	}, optFns...)...)
 }
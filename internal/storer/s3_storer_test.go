@@ -12,11 +12,13 @@ import (
 	"github.com/stretchr/testify/require"
 	"io/ioutil"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
-func TestS3Storer_RetrieveIndividualFiles(t *testing.T) {
+func TestS3Storer_ListIndividualFiles(t *testing.T) {
 	t.Run("return empty and no error when no files found", func(t *testing.T) {
 		s3Endpoint := os.Getenv("S3_ENDPOINT")
 		bucket := randomName("bucket")
@@ -26,10 +28,10 @@ func TestS3Storer_RetrieveIndividualFiles(t *testing.T) {
 
 		s, err := NewS3Storer(s3Endpoint, bucket)
 		require.NoError(t, err)
-		data, err := s.RetrieveIndividualFiles(SingleReportType, 2022, 4)
+		files, err := s.ListIndividualFiles(context.TODO(), SingleReportType, 2022, 4)
 
 		require.NoError(t, err)
-		require.Empty(t, data)
+		require.Empty(t, files)
 	})
 
 	t.Run("return files when found", func(t *testing.T) {
@@ -43,15 +45,65 @@ func TestS3Storer_RetrieveIndividualFiles(t *testing.T) {
 
 		s, err := NewS3Storer(s3Endpoint, bucket)
 		require.NoError(t, err)
-		data, err := s.RetrieveIndividualFiles(SingleReportType, 2022, 4)
+		files, err := s.ListIndividualFiles(context.TODO(), SingleReportType, 2022, 4)
 
 		require.NoError(t, err)
-		require.Len(t, data, 2)
-		expected := [][]byte{
-			[]byte(fmt.Sprintf("BUCKET,PATH\n%s,2022/04/single/cluster-1.csv", bucket)),
-			[]byte(fmt.Sprintf("BUCKET,PATH\n%s,2022/04/single/cluster-2.csv", bucket)),
-		}
-		require.Equal(t, expected, data)
+		require.Len(t, files, 2)
+		require.Equal(t, "2022/04/single/cluster-1.csv", files[0].Key)
+		require.Equal(t, "2022/04/single/cluster-2.csv", files[1].Key)
+		require.NotZero(t, files[0].Size)
+		require.False(t, files[0].LastModified.IsZero())
+	})
+}
+
+func TestS3Storer_StoreIndividualFile(t *testing.T) {
+	t.Run("store individual file under the individual prefix", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		data := []byte("BUCKET,PATH\nsome-bucket,some-path")
+
+		key, err := s.StoreIndividualFile(context.TODO(), SingleReportType, 2022, 4, "cluster-1", data)
+
+		require.NoError(t, err)
+		require.Equal(t, "2022/04/single/cluster-1.csv", key)
+		files, err := s.ListIndividualFiles(context.TODO(), SingleReportType, 2022, 4)
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		stored, err := s.RetrieveIndividualFile(context.TODO(), key)
+		require.NoError(t, err)
+		require.Equal(t, data, stored)
+	})
+}
+
+func TestS3Storer_RetrieveIndividualFile(t *testing.T) {
+	t.Run("return nil and no error when file not found", func(t *testing.T) {
+		s3Endpoint := os.Getenv("S3_ENDPOINT")
+		bucket := randomName("bucket")
+
+		client := s3ClientToMockAws(t, s3Endpoint)
+		newEncryptedS3Bucket(t, client, bucket)
+
+		s, err := NewS3Storer(s3Endpoint, bucket)
+		require.NoError(t, err)
+		data, err := s.RetrieveIndividualFile(context.TODO(), "2022/04/single/cluster-1.csv")
+
+		require.NoError(t, err)
+		require.Nil(t, data)
+	})
+
+	t.Run("return file content when found", func(t *testing.T) {
+		s3Endpoint := os.Getenv("S3_ENDPOINT")
+		bucket := randomName("bucket")
+
+		client := s3ClientToMockAws(t, s3Endpoint)
+		newEncryptedS3Bucket(t, client, bucket)
+		putTestCsvAtPath(t, client, bucket, "2022/04/single/cluster-1.csv")
+
+		s, err := NewS3Storer(s3Endpoint, bucket)
+		require.NoError(t, err)
+		data, err := s.RetrieveIndividualFile(context.TODO(), "2022/04/single/cluster-1.csv")
+
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("BUCKET,PATH\n%s,2022/04/single/cluster-1.csv", bucket)), data)
 	})
 }
 
@@ -66,7 +118,7 @@ func TestS3Storer_RetrieveAggregated(t *testing.T) {
 		s, err := NewS3Storer(s3Endpoint, bucket)
 		require.NoError(t, err)
 
-		data, err := s.RetrieveAggregated(SingleReportType, 2022, 4)
+		data, err := s.RetrieveAggregated(context.TODO(), SingleReportType, 2022, 4)
 
 		require.NoError(t, err)
 		require.Nil(t, data)
@@ -79,7 +131,7 @@ func TestS3Storer_RetrieveAggregated(t *testing.T) {
 		s, err := NewS3Storer(s3Endpoint, bucket)
 		require.NoError(t, err)
 
-		_, err = s.RetrieveAggregated(SingleReportType, 2022, 4)
+		_, err = s.RetrieveAggregated(context.TODO(), SingleReportType, 2022, 4)
 
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "failed to get object at")
@@ -96,7 +148,7 @@ func TestS3Storer_RetrieveAggregated(t *testing.T) {
 		s, err := NewS3Storer(s3Endpoint, bucket)
 		require.NoError(t, err)
 
-		data, err := s.RetrieveAggregated(SingleReportType, 2022, 4)
+		data, err := s.RetrieveAggregated(context.TODO(), SingleReportType, 2022, 4)
 
 		require.NoError(t, err)
 		expected := fmt.Sprintf("BUCKET,PATH\n%s,2022/04/aggregate/single.csv", bucket)
@@ -116,7 +168,7 @@ func TestS3Storer_StoreAggregated(t *testing.T) {
 		require.NoError(t, err)
 
 		data := []byte("some,csv,content")
-		err = s.StoreAggregated(SingleReportType, 2022, 4, data)
+		err = s.StoreAggregated(context.TODO(), SingleReportType, 2022, 4, data)
 
 		require.NoError(t, err)
 		getOutput, err := client.GetObject(context.TODO(), &s3.GetObjectInput{
@@ -130,6 +182,171 @@ func TestS3Storer_StoreAggregated(t *testing.T) {
 	})
 }
 
+func TestS3Storer_DeleteAggregated(t *testing.T) {
+	t.Run("delete aggregated file", func(t *testing.T) {
+		s3Endpoint := os.Getenv("S3_ENDPOINT")
+		bucket := randomName("bucket")
+
+		client := s3ClientToMockAws(t, s3Endpoint)
+		newEncryptedS3Bucket(t, client, bucket)
+
+		s, err := NewS3Storer(s3Endpoint, bucket)
+		require.NoError(t, err)
+		require.NoError(t, s.StoreAggregated(context.TODO(), SingleReportType, 2022, 4, []byte("some,csv,content")))
+
+		err = s.DeleteAggregated(context.TODO(), SingleReportType, 2022, 4)
+
+		require.NoError(t, err)
+		content, err := s.RetrieveAggregated(context.TODO(), SingleReportType, 2022, 4)
+		require.NoError(t, err)
+		require.Nil(t, content)
+	})
+
+	t.Run("return no error when aggregated file does not exist", func(t *testing.T) {
+		s3Endpoint := os.Getenv("S3_ENDPOINT")
+		bucket := randomName("bucket")
+
+		client := s3ClientToMockAws(t, s3Endpoint)
+		newEncryptedS3Bucket(t, client, bucket)
+
+		s, err := NewS3Storer(s3Endpoint, bucket)
+		require.NoError(t, err)
+
+		require.NoError(t, s.DeleteAggregated(context.TODO(), SingleReportType, 2022, 4))
+	})
+}
+
+func TestS3Storer_Ping(t *testing.T) {
+	t.Run("return no error when bucket is accessible", func(t *testing.T) {
+		s3Endpoint := os.Getenv("S3_ENDPOINT")
+		bucket := randomName("bucket")
+
+		client := s3ClientToMockAws(t, s3Endpoint)
+		newEncryptedS3Bucket(t, client, bucket)
+
+		s, err := NewS3Storer(s3Endpoint, bucket)
+		require.NoError(t, err)
+
+		err = s.Ping(context.TODO())
+
+		require.NoError(t, err)
+	})
+
+	t.Run("return error when bucket does not exist", func(t *testing.T) {
+		s3Endpoint := os.Getenv("S3_ENDPOINT")
+		bucket := randomName("bucket")
+
+		s, err := NewS3Storer(s3Endpoint, bucket)
+		require.NoError(t, err)
+
+		err = s.Ping(context.TODO())
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to access bucket")
+	})
+}
+
+func TestS3Storer_Lock(t *testing.T) {
+	t.Run("acquire free lock", func(t *testing.T) {
+		s := newTestS3Storer(t)
+
+		acquired, err := s.AcquireLock(context.TODO(), "some-lock", "owner-1", time.Now().Add(time.Minute))
+
+		require.NoError(t, err)
+		require.True(t, acquired)
+	})
+
+	t.Run("refuse lock held by another owner until it expires", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		_, err := s.AcquireLock(context.TODO(), "some-lock", "owner-1", time.Now().Add(time.Minute))
+		require.NoError(t, err)
+
+		acquired, err := s.AcquireLock(context.TODO(), "some-lock", "owner-2", time.Now().Add(time.Minute))
+
+		require.NoError(t, err)
+		require.False(t, acquired)
+	})
+
+	t.Run("let owner renew its lock", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		_, err := s.AcquireLock(context.TODO(), "some-lock", "owner-1", time.Now().Add(time.Minute))
+		require.NoError(t, err)
+
+		acquired, err := s.AcquireLock(context.TODO(), "some-lock", "owner-1", time.Now().Add(time.Hour))
+
+		require.NoError(t, err)
+		require.True(t, acquired)
+	})
+
+	t.Run("acquire expired lock", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		_, err := s.AcquireLock(context.TODO(), "some-lock", "owner-1", time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+
+		acquired, err := s.AcquireLock(context.TODO(), "some-lock", "owner-2", time.Now().Add(time.Minute))
+
+		require.NoError(t, err)
+		require.True(t, acquired)
+	})
+
+	t.Run("acquire lock released by owner", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		_, err := s.AcquireLock(context.TODO(), "some-lock", "owner-1", time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		require.NoError(t, s.ReleaseLock(context.TODO(), "some-lock", "owner-1"))
+
+		acquired, err := s.AcquireLock(context.TODO(), "some-lock", "owner-2", time.Now().Add(time.Minute))
+
+		require.NoError(t, err)
+		require.True(t, acquired)
+	})
+
+	t.Run("let only one of racing owners acquire a free lock", func(t *testing.T) {
+		s := newTestS3Storer(t)
+
+		var acquired atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(owner string) {
+				defer wg.Done()
+				ok, err := s.AcquireLock(context.TODO(), "some-lock", owner, time.Now().Add(time.Minute))
+				require.NoError(t, err)
+				if ok {
+					acquired.Add(1)
+				}
+			}(fmt.Sprintf("owner-%d", i))
+		}
+		wg.Wait()
+
+		require.Equal(t, int32(1), acquired.Load())
+	})
+
+	t.Run("ignore release by another owner", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		_, err := s.AcquireLock(context.TODO(), "some-lock", "owner-1", time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		require.NoError(t, s.ReleaseLock(context.TODO(), "some-lock", "owner-2"))
+
+		acquired, err := s.AcquireLock(context.TODO(), "some-lock", "owner-2", time.Now().Add(time.Minute))
+
+		require.NoError(t, err)
+		require.False(t, acquired)
+	})
+}
+
+func newTestS3Storer(t *testing.T) Storer {
+	s3Endpoint := os.Getenv("S3_ENDPOINT")
+	bucket := randomName("bucket")
+
+	client := s3ClientToMockAws(t, s3Endpoint)
+	newEncryptedS3Bucket(t, client, bucket)
+
+	s, err := NewS3Storer(s3Endpoint, bucket)
+	require.NoError(t, err)
+	return s
+}
+
 func putTestCsvAtPath(t *testing.T, s3Client *s3.Client, bucket string, path string) {
 	csv := fmt.Sprintf("BUCKET,PATH\n%s,%s", bucket, path)
 	_, err := s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
@@ -175,3 +392,318 @@ func s3ClientToMockAws(t *testing.T, endpoint string) *s3.Client {
 		o.UsePathStyle = true
 	})
 }
+
+func TestS3Storer_RetrievePeriodStatus(t *testing.T) {
+	t.Run("return open when no status is recorded", func(t *testing.T) {
+		s := newTestS3Storer(t)
+
+		status, err := s.RetrievePeriodStatus(context.TODO(), 2022, 4)
+
+		require.NoError(t, err)
+		require.Equal(t, OpenPeriodStatus, status)
+	})
+
+	t.Run("return stored status", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		require.NoError(t, s.StorePeriodStatus(context.TODO(), 2022, 4, ClosedPeriodStatus))
+
+		status, err := s.RetrievePeriodStatus(context.TODO(), 2022, 4)
+
+		require.NoError(t, err)
+		require.Equal(t, ClosedPeriodStatus, status)
+	})
+}
+
+func TestS3Storer_ClosedPeriod(t *testing.T) {
+	t.Run("reject changes to sources and aggregates of closed period", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		require.NoError(t, s.StoreAggregated(context.TODO(), SingleReportType, 2022, 4, []byte("some,csv,content")))
+		require.NoError(t, s.StorePeriodStatus(context.TODO(), 2022, 4, ClosedPeriodStatus))
+
+		require.ErrorIs(t, s.StoreAggregated(context.TODO(), SingleReportType, 2022, 4, []byte("other,csv,content")), ErrPeriodClosed)
+		require.ErrorIs(t, s.DeleteAggregated(context.TODO(), SingleReportType, 2022, 4), ErrPeriodClosed)
+		_, err := s.StoreIndividualFile(context.TODO(), SingleReportType, 2022, 4, "cluster-1", []byte("some,csv,content"))
+		require.ErrorIs(t, err, ErrPeriodClosed)
+
+		content, err := s.RetrieveAggregated(context.TODO(), SingleReportType, 2022, 4)
+		require.NoError(t, err)
+		require.Equal(t, []byte("some,csv,content"), content)
+	})
+
+	t.Run("return false when there is no aggregate to retain", func(t *testing.T) {
+		s := newTestS3Storer(t)
+
+		retained, err := s.RetainAggregated(context.TODO(), SingleReportType, 2022, 4, GovernanceRetentionMode, time.Now().Add(time.Hour))
+
+		require.False(t, retained)
+		if err != nil {
+			require.ErrorIs(t, err, ErrObjectLockUnavailable)
+		}
+	})
+}
+
+func TestS3Storer_AggregateVersions(t *testing.T) {
+	t.Run("return empty and no error when no versions are stored", func(t *testing.T) {
+		s := newTestS3Storer(t)
+
+		versions, err := s.ListAggregateVersions(context.TODO(), SingleReportType, 2022, 4)
+
+		require.NoError(t, err)
+		require.Empty(t, versions)
+	})
+
+	t.Run("list stored versions oldest first and retrieve their content", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		first := AggregateVersion{
+			ID:        "20220503T101500.000000000Z",
+			CreatedAt: time.Date(2022, 5, 3, 10, 15, 0, 0, time.UTC),
+			Rows:      1,
+			Checksum:  "first",
+			Sources:   []IndividualFile{{Key: "2022/04/single/cluster-1.csv", LastModified: time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC), Size: 10}},
+		}
+		second := AggregateVersion{
+			ID:         "20220510T090000.000000000Z",
+			CreatedAt:  time.Date(2022, 5, 10, 9, 0, 0, 0, time.UTC),
+			Rows:       2,
+			Duplicates: 1,
+			Checksum:   "second",
+			Sources:    []IndividualFile{},
+		}
+		require.NoError(t, s.StoreAggregateVersion(context.TODO(), SingleReportType, 2022, 4, second, []byte("second,csv,content")))
+		require.NoError(t, s.StoreAggregateVersion(context.TODO(), SingleReportType, 2022, 4, first, []byte("first,csv,content")))
+
+		versions, err := s.ListAggregateVersions(context.TODO(), SingleReportType, 2022, 4)
+		require.NoError(t, err)
+		require.Equal(t, []AggregateVersion{first, second}, versions)
+
+		content, err := s.RetrieveAggregateVersion(context.TODO(), SingleReportType, 2022, 4, first.ID)
+		require.NoError(t, err)
+		require.Equal(t, []byte("first,csv,content"), content)
+	})
+
+	t.Run("return nil and no error when version is not found", func(t *testing.T) {
+		s := newTestS3Storer(t)
+
+		for _, id := range []string{"20220503T101500.000000000Z", "../../single"} {
+			content, err := s.RetrieveAggregateVersion(context.TODO(), SingleReportType, 2022, 4, id)
+
+			require.NoError(t, err)
+			require.Nil(t, content)
+		}
+	})
+
+	t.Run("reject versions of closed period", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		require.NoError(t, s.StorePeriodStatus(context.TODO(), 2022, 4, ClosedPeriodStatus))
+
+		err := s.StoreAggregateVersion(context.TODO(), SingleReportType, 2022, 4, AggregateVersion{ID: "20220503T101500.000000000Z"}, []byte("some,csv,content"))
+
+		require.ErrorIs(t, err, ErrPeriodClosed)
+	})
+}
+
+func TestS3Storer_StoreRejectedRows(t *testing.T) {
+	t.Run("store rejected rows next to aggregate", func(t *testing.T) {
+		s3Endpoint := os.Getenv("S3_ENDPOINT")
+		bucket := randomName("bucket")
+
+		client := s3ClientToMockAws(t, s3Endpoint)
+		newEncryptedS3Bucket(t, client, bucket)
+
+		s, err := NewS3Storer(s3Endpoint, bucket)
+		require.NoError(t, err)
+		require.NoError(t, s.StoreRejectedRows(context.TODO(), SingleReportType, 2022, 4, []byte("key,line,problems")))
+
+		output, err := client.GetObject(context.TODO(), &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String("2022/04/aggregate/single/rejected.csv"),
+		})
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(output.Body)
+		require.NoError(t, err)
+		require.Equal(t, []byte("key,line,problems"), content)
+	})
+}
+
+func TestS3Storer_Failures(t *testing.T) {
+	t.Run("return empty failures when none are stored", func(t *testing.T) {
+		s := newTestS3Storer(t)
+
+		failures, err := s.RetrieveFailures(context.TODO(), SingleReportType, 2022, 4)
+
+		require.NoError(t, err)
+		require.Empty(t, failures)
+	})
+
+	t.Run("replace failures of previous build", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		failures := []FileFailure{{Key: "2022/04/single/cluster-2.csv", Line: 3, Error: "wrong number of fields"}}
+		require.NoError(t, s.StoreFailures(context.TODO(), SingleReportType, 2022, 4, failures))
+
+		stored, err := s.RetrieveFailures(context.TODO(), SingleReportType, 2022, 4)
+		require.NoError(t, err)
+		require.Equal(t, failures, stored)
+
+		require.NoError(t, s.StoreFailures(context.TODO(), SingleReportType, 2022, 4, nil))
+
+		stored, err = s.RetrieveFailures(context.TODO(), SingleReportType, 2022, 4)
+		require.NoError(t, err)
+		require.Empty(t, stored)
+	})
+}
+
+func TestS3Storer_Quarantine(t *testing.T) {
+	t.Run("move individual file to quarantine with reason", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		key, err := s.StoreIndividualFile(context.TODO(), SingleReportType, 2022, 4, "cluster-1", []byte("some,csv,content"))
+		require.NoError(t, err)
+
+		quarantineKey, err := s.QuarantineIndividualFile(context.TODO(), key, "line 3: wrong number of fields – expected 2")
+
+		require.NoError(t, err)
+		require.Equal(t, "quarantine/2022/04/single/cluster-1.csv", quarantineKey)
+		files, err := s.ListIndividualFiles(context.TODO(), SingleReportType, 2022, 4)
+		require.NoError(t, err)
+		require.Empty(t, files)
+		quarantined, err := s.ListQuarantinedFiles(context.TODO(), SingleReportType, 2022, 4)
+		require.NoError(t, err)
+		require.Len(t, quarantined, 1)
+		require.Equal(t, "cluster-1.csv", quarantined[0].Name)
+		require.Equal(t, quarantineKey, quarantined[0].Key)
+		require.Equal(t, key, quarantined[0].OriginalKey)
+		require.Equal(t, "line 3: wrong number of fields – expected 2", quarantined[0].Reason)
+		require.Equal(t, int64(16), quarantined[0].Size)
+	})
+
+	t.Run("release quarantined file back to its original key", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		key, err := s.StoreIndividualFile(context.TODO(), SingleReportType, 2022, 4, "cluster-1", []byte("some,csv,content"))
+		require.NoError(t, err)
+		_, err = s.QuarantineIndividualFile(context.TODO(), key, "some reason")
+		require.NoError(t, err)
+
+		released, err := s.ReleaseQuarantinedFile(context.TODO(), SingleReportType, 2022, 4, "cluster-1.csv")
+
+		require.NoError(t, err)
+		require.Equal(t, key, released)
+		content, err := s.RetrieveIndividualFile(context.TODO(), key)
+		require.NoError(t, err)
+		require.Equal(t, []byte("some,csv,content"), content)
+		quarantined, err := s.ListQuarantinedFiles(context.TODO(), SingleReportType, 2022, 4)
+		require.NoError(t, err)
+		require.Empty(t, quarantined)
+	})
+
+	t.Run("return error when releasing file that is not quarantined", func(t *testing.T) {
+		s := newTestS3Storer(t)
+
+		_, err := s.ReleaseQuarantinedFile(context.TODO(), SingleReportType, 2022, 4, "cluster-1.csv")
+
+		require.ErrorIs(t, err, ErrNotQuarantined)
+	})
+
+	t.Run("return error when quarantining key that is not an individual file", func(t *testing.T) {
+		s := newTestS3Storer(t)
+
+		_, err := s.QuarantineIndividualFile(context.TODO(), "2022/04/aggregate/single.csv", "some reason")
+
+		require.ErrorIs(t, err, ErrNotIndividualFile)
+	})
+
+	t.Run("return error when period is closed", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		key, err := s.StoreIndividualFile(context.TODO(), SingleReportType, 2022, 4, "cluster-1", []byte("some,csv,content"))
+		require.NoError(t, err)
+		require.NoError(t, s.StorePeriodStatus(context.TODO(), 2022, 4, ClosedPeriodStatus))
+
+		_, err = s.QuarantineIndividualFile(context.TODO(), key, "some reason")
+
+		require.ErrorIs(t, err, ErrPeriodClosed)
+	})
+}
+
+func TestS3Storer_Summaries(t *testing.T) {
+	t.Run("return nil and no error when summary is not stored", func(t *testing.T) {
+		s := newTestS3Storer(t)
+
+		content, err := s.RetrieveSummary(context.TODO(), SingleReportType, 2022, 4, "0123456789abcdef")
+
+		require.NoError(t, err)
+		require.Nil(t, content)
+	})
+
+	t.Run("retrieve stored summary", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		require.NoError(t, s.StoreSummary(context.TODO(), SingleReportType, 2022, 4, "0123456789abcdef", []byte("some,summary")))
+
+		content, err := s.RetrieveSummary(context.TODO(), SingleReportType, 2022, 4, "0123456789abcdef")
+
+		require.NoError(t, err)
+		require.Equal(t, []byte("some,summary"), content)
+	})
+
+	t.Run("drop summaries when aggregate changes", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		require.NoError(t, s.StoreSummary(context.TODO(), SingleReportType, 2022, 4, "0123456789abcdef", []byte("some,summary")))
+		require.NoError(t, s.StoreAggregated(context.TODO(), SingleReportType, 2022, 4, []byte("some,csv,content")))
+
+		content, err := s.RetrieveSummary(context.TODO(), SingleReportType, 2022, 4, "0123456789abcdef")
+
+		require.NoError(t, err)
+		require.Nil(t, content)
+	})
+
+	t.Run("drop summaries when aggregate is deleted", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		require.NoError(t, s.StoreSummary(context.TODO(), SingleReportType, 2022, 4, "0123456789abcdef", []byte("some,summary")))
+		require.NoError(t, s.DeleteAggregated(context.TODO(), SingleReportType, 2022, 4))
+
+		content, err := s.RetrieveSummary(context.TODO(), SingleReportType, 2022, 4, "0123456789abcdef")
+
+		require.NoError(t, err)
+		require.Nil(t, content)
+	})
+}
+
+func TestS3Storer_Jobs(t *testing.T) {
+	t.Run("return nil and no error when job not found", func(t *testing.T) {
+		s := newTestS3Storer(t)
+
+		data, err := s.RetrieveJob(context.TODO(), "some-job")
+
+		require.NoError(t, err)
+		require.Nil(t, data)
+	})
+
+	t.Run("retrieve stored job", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		require.NoError(t, s.StoreJob(context.TODO(), "some-job", []byte(`{"id":"some-job"}`)))
+
+		data, err := s.RetrieveJob(context.TODO(), "some-job")
+
+		require.NoError(t, err)
+		require.Equal(t, []byte(`{"id":"some-job"}`), data)
+	})
+
+	t.Run("retrieve all stored jobs", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		require.NoError(t, s.StoreJob(context.TODO(), "job-1", []byte(`{"id":"job-1"}`)))
+		require.NoError(t, s.StoreJob(context.TODO(), "job-2", []byte(`{"id":"job-2"}`)))
+
+		data, err := s.RetrieveJobs(context.TODO())
+
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte(`{"id":"job-1"}`), []byte(`{"id":"job-2"}`)}, data)
+	})
+
+	t.Run("delete stored job", func(t *testing.T) {
+		s := newTestS3Storer(t)
+		require.NoError(t, s.StoreJob(context.TODO(), "some-job", []byte(`{"id":"some-job"}`)))
+
+		require.NoError(t, s.DeleteJob(context.TODO(), "some-job"))
+
+		data, err := s.RetrieveJob(context.TODO(), "some-job")
+		require.NoError(t, err)
+		require.Nil(t, data)
+	})
+}
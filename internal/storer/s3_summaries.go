@@ -0,0 +1,67 @@
+package storer
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"regexp"
+)
+
+// summaryNamePattern keeps summary names within a single key segment
+var summaryNamePattern = regexp.MustCompile(`^[0-9A-Za-z.-]+$`)
+
+func (s *s3Storer) RetrieveSummary(ctx context.Context, reportType ReportType, year int, month int, name string) (_ []byte, err error) {
+	prefix := s.layout.summariesPrefix(reportType, year, month)
+	ctx, span := tracer.Start(ctx, "s3Storer.RetrieveSummary", trace.WithAttributes(
+		attribute.String("s3.prefix", prefix),
+		attribute.String("report.summary", name),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	if !summaryNamePattern.MatchString(name) {
+		return nil, nil
+	}
+
+	return s.getObject(ctx, prefix+name+".csv")
+}
+
+func (s *s3Storer) StoreSummary(ctx context.Context, reportType ReportType, year int, month int, name string, data []byte) (err error) {
+	prefix := s.layout.summariesPrefix(reportType, year, month)
+	ctx, span := tracer.Start(ctx, "s3Storer.StoreSummary", trace.WithAttributes(
+		attribute.String("s3.prefix", prefix),
+		attribute.String("report.summary", name),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	if !summaryNamePattern.MatchString(name) {
+		return fmt.Errorf("summary name '%s' is invalid", name)
+	}
+
+	if err := s.putObject(ctx, prefix+name+".csv", data, csvContentType); err != nil {
+		return err
+	}
+
+	slog.DebugContext(ctx, "stored summary", slog.String("prefix", prefix), slog.String("summary", name))
+
+	return nil
+}
+
+// deleteSummaries drops the summaries of an aggregate that has changed or gone
+func (s *s3Storer) deleteSummaries(ctx context.Context, reportType ReportType, year int, month int) error {
+	objects, err := s.listObjects(ctx, s.layout.summariesPrefix(reportType, year, month))
+	if err != nil {
+		return err
+	}
+
+	for _, o := range objects {
+		if err := s.deleteObject(ctx, aws.ToString(o.Key)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
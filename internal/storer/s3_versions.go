@@ -0,0 +1,105 @@
+package storer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// versionIDPattern keeps version ids, which may come from requests, within a single key segment
+var versionIDPattern = regexp.MustCompile(`^[0-9A-Za-z.-]+$`)
+
+// StoreAggregateVersion writes the content first, so that a listed version can always be retrieved
+func (s *s3Storer) StoreAggregateVersion(ctx context.Context, reportType ReportType, year int, month int, version AggregateVersion, data []byte) (err error) {
+	prefix := s.layout.versionsPrefix(reportType, year, month)
+	ctx, span := tracer.Start(ctx, "s3Storer.StoreAggregateVersion", trace.WithAttributes(
+		attribute.String("s3.prefix", prefix),
+		attribute.String("report.version", version.ID),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	if !versionIDPattern.MatchString(version.ID) {
+		return fmt.Errorf("version id '%s' is invalid", version.ID)
+	}
+
+	if err := s.ensureOpen(ctx, year, month); err != nil {
+		return err
+	}
+
+	if err := s.putObject(ctx, prefix+version.ID+".csv", data, csvContentType); err != nil {
+		return err
+	}
+
+	description, err := json.Marshal(version)
+	if err != nil {
+		return fmt.Errorf("failed to encode aggregate version: %v", err)
+	}
+
+	if err := s.putObject(ctx, prefix+version.ID+".json", description, jsonContentType); err != nil {
+		return err
+	}
+
+	slog.DebugContext(ctx, "stored aggregate version", slog.String("prefix", prefix), slog.String("version", version.ID))
+
+	return nil
+}
+
+func (s *s3Storer) ListAggregateVersions(ctx context.Context, reportType ReportType, year int, month int) (_ []AggregateVersion, err error) {
+	prefix := s.layout.versionsPrefix(reportType, year, month)
+	ctx, span := tracer.Start(ctx, "s3Storer.ListAggregateVersions", trace.WithAttributes(attribute.String("s3.prefix", prefix)))
+	defer func() { tracing.End(span, err) }()
+
+	objects, err := s.listObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []AggregateVersion{}
+	for _, o := range objects {
+		key := aws.ToString(o.Key)
+		if !strings.HasSuffix(key, ".json") {
+			continue
+		}
+
+		data, err := s.getObject(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		if data == nil {
+			continue
+		}
+
+		var version AggregateVersion
+		if err := json.Unmarshal(data, &version); err != nil {
+			return nil, fmt.Errorf("failed to decode aggregate version at %s: %v", key, err)
+		}
+		versions = append(versions, version)
+	}
+
+	span.SetAttributes(attribute.Int("s3.objects", len(versions)))
+
+	return versions, nil
+}
+
+func (s *s3Storer) RetrieveAggregateVersion(ctx context.Context, reportType ReportType, year int, month int, id string) (_ []byte, err error) {
+	prefix := s.layout.versionsPrefix(reportType, year, month)
+	ctx, span := tracer.Start(ctx, "s3Storer.RetrieveAggregateVersion", trace.WithAttributes(
+		attribute.String("s3.prefix", prefix),
+		attribute.String("report.version", id),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	if !versionIDPattern.MatchString(id) {
+		return nil, nil
+	}
+
+	return s.getObject(ctx, prefix+id+".csv")
+}
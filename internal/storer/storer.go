@@ -1,5 +1,12 @@
 package storer
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
 type ReportType string
 
 const (
@@ -7,8 +14,159 @@ const (
 	CumulativeReportType ReportType = "cumulative"
 )
 
+var ReportTypes = []ReportType{SingleReportType, CumulativeReportType}
+
+func ParseReportType(value string) (ReportType, error) {
+	for _, t := range ReportTypes {
+		if string(t) == value {
+			return t, nil
+		}
+	}
+
+	return "", fmt.Errorf("report type '%s' is invalid", value)
+}
+
+// PeriodStatus is the lifecycle status of a month, shared by all report types
+type PeriodStatus string
+
+const (
+	OpenPeriodStatus   PeriodStatus = "open"
+	ClosedPeriodStatus PeriodStatus = "closed"
+	LockedPeriodStatus PeriodStatus = "locked"
+)
+
+// RetentionMode is the S3 Object Lock mode an aggregate is retained with
+type RetentionMode string
+
+const (
+	// GovernanceRetentionMode lets principals with the s3:BypassGovernanceRetention permission still change the aggregate
+	GovernanceRetentionMode RetentionMode = "GOVERNANCE"
+	// ComplianceRetentionMode keeps anyone, including the root user, from changing the aggregate until retention ends
+	ComplianceRetentionMode RetentionMode = "COMPLIANCE"
+)
+
+var (
+	ErrPeriodClosed = errors.New("period does not accept changes")
+	// ErrObjectLockUnavailable is returned when the bucket has no S3 Object Lock configuration
+	ErrObjectLockUnavailable = errors.New("object lock is not available")
+	ErrNotQuarantined        = errors.New("file is not quarantined")
+	ErrNotIndividualFile     = errors.New("key is not an individual file")
+)
+
+// EnsureOpen returns ErrPeriodClosed unless status lets the sources and aggregates of the period change
+func EnsureOpen(status PeriodStatus, year int, month int) error {
+	if status == OpenPeriodStatus {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %02d/%d is %s", ErrPeriodClosed, month, year, status)
+}
+
+// IndividualFile describes a file uploaded by one cluster for a report type and period
+type IndividualFile struct {
+	Key          string    `json:"key"`
+	LastModified time.Time `json:"last_modified"`
+	Size         int64     `json:"size"`
+}
+
+// FileFailure is an individual file left out of an aggregate because it could not be read
+type FileFailure struct {
+	Key string `json:"key"`
+	// Line is where reading failed, or 0 when the failure is not tied to a line
+	Line  int    `json:"line,omitempty"`
+	Error string `json:"error"`
+}
+
+// QuarantinedFile is an individual file moved aside so that it is left out of aggregates until it is released
+type QuarantinedFile struct {
+	// Name identifies the file among the quarantined files of its report type and period
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	// OriginalKey is where the file is moved back to when it is released
+	OriginalKey   string    `json:"original_key"`
+	Reason        string    `json:"reason"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+	Size          int64     `json:"size"`
+}
+
+// AggregateVersion describes one build of an aggregate. Every build is kept so that earlier versions of a report can be retrieved
+type AggregateVersion struct {
+	// ID orders versions by creation time
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Rows      int       `json:"rows"`
+	// Duplicates is the number of rows dropped by deduplication
+	Duplicates int `json:"duplicates_dropped"`
+	// Checksum is the hex encoded SHA-256 of the aggregate content
+	Checksum string `json:"checksum"`
+	// Sources are the individual files the version was built from
+	Sources []IndividualFile `json:"sources"`
+	// Failures are the individual files left out of a partial version
+	Failures []FileFailure `json:"failures,omitempty"`
+}
+
 type Storer interface {
-	RetrieveIndividualFiles(reportType ReportType, year int, month int) ([][]byte, error)
-	RetrieveAggregated(reportType ReportType, year int, month int) ([]byte, error)
-	StoreAggregated(reportType ReportType, year int, month int, data []byte) error
+	// ListIndividualFiles returns the individual files of a report type and period in key order
+	ListIndividualFiles(ctx context.Context, reportType ReportType, year int, month int) ([]IndividualFile, error)
+	// StoreIndividualFile creates or replaces the file uploaded by a cluster for a report type and period and returns its key.
+	// It returns ErrPeriodClosed when the period is not open
+	StoreIndividualFile(ctx context.Context, reportType ReportType, year int, month int, cluster string, data []byte) (string, error)
+	// RetrieveIndividualFile returns the content of an individual file, or nil when it no longer exists
+	RetrieveIndividualFile(ctx context.Context, key string) ([]byte, error)
+	RetrieveAggregated(ctx context.Context, reportType ReportType, year int, month int) ([]byte, error)
+	// StoreAggregated creates or replaces the aggregate of a report type and period. It returns ErrPeriodClosed when the period is not open
+	StoreAggregated(ctx context.Context, reportType ReportType, year int, month int, data []byte) error
+	// DeleteAggregated removes the aggregate of a report type and period so that it is rebuilt on next generation. Deleting a missing aggregate is not an error.
+	// It returns ErrPeriodClosed when the period is not open
+	DeleteAggregated(ctx context.Context, reportType ReportType, year int, month int) error
+	// AggregateKey returns the key the aggregate of a report type and period is stored at
+	AggregateKey(reportType ReportType, year int, month int) string
+	// StoreAggregateVersion keeps a build of an aggregate alongside its description. It returns ErrPeriodClosed when the period is not open
+	StoreAggregateVersion(ctx context.Context, reportType ReportType, year int, month int, version AggregateVersion, data []byte) error
+	// ListAggregateVersions returns the versions of an aggregate, oldest first
+	ListAggregateVersions(ctx context.Context, reportType ReportType, year int, month int) ([]AggregateVersion, error)
+	// RetrieveAggregateVersion returns the content of a version of an aggregate, or nil when there is no such version
+	RetrieveAggregateVersion(ctx context.Context, reportType ReportType, year int, month int, id string) ([]byte, error)
+	// StoreRejectedRows keeps the source rows left out of an aggregate, replacing those of its previous build. It returns ErrPeriodClosed when the period is not open
+	StoreRejectedRows(ctx context.Context, reportType ReportType, year int, month int, data []byte) error
+	// StoreFailures records the individual files left out of the latest build of an aggregate, replacing those of its previous build.
+	// It returns ErrPeriodClosed when the period is not open
+	StoreFailures(ctx context.Context, reportType ReportType, year int, month int, failures []FileFailure) error
+	// RetrieveFailures returns the individual files left out of the latest build of an aggregate, empty when none were
+	RetrieveFailures(ctx context.Context, reportType ReportType, year int, month int) ([]FileFailure, error)
+	// QuarantineIndividualFile moves an individual file under the quarantine prefix of its report type and period, recording reason alongside it, and returns its key in quarantine.
+	// It returns ErrNotIndividualFile when key is not an individual file, and ErrPeriodClosed when the period is not open
+	QuarantineIndividualFile(ctx context.Context, key string, reason string) (string, error)
+	// ListQuarantinedFiles returns the quarantined files of a report type and period in key order
+	ListQuarantinedFiles(ctx context.Context, reportType ReportType, year int, month int) ([]QuarantinedFile, error)
+	// ReleaseQuarantinedFile moves a quarantined file back to where it was quarantined from and returns its key.
+	// It returns ErrNotQuarantined when there is no such file, and ErrPeriodClosed when the period is not open
+	ReleaseQuarantinedFile(ctx context.Context, reportType ReportType, year int, month int, name string) (string, error)
+	// RetrieveSummary returns a summary of an aggregate by name, or nil when it has not been stored since the aggregate last changed
+	RetrieveSummary(ctx context.Context, reportType ReportType, year int, month int, name string) ([]byte, error)
+	// StoreSummary caches a summary of an aggregate under a name. Summaries are derived from the aggregate, so they are accepted for closed periods
+	StoreSummary(ctx context.Context, reportType ReportType, year int, month int, name string, data []byte) error
+	// RetainAggregated protects the aggregate of a report type and period from changes until the given time using S3 Object Lock.
+	// It returns false when there is no aggregate, and ErrObjectLockUnavailable when the bucket does not support Object Lock
+	RetainAggregated(ctx context.Context, reportType ReportType, year int, month int, mode RetentionMode, until time.Time) (bool, error)
+	// RetrievePeriodStatus returns the lifecycle status of a period, which is open until another status is recorded
+	RetrievePeriodStatus(ctx context.Context, year int, month int) (PeriodStatus, error)
+	// StorePeriodStatus records the lifecycle status of a period
+	StorePeriodStatus(ctx context.Context, year int, month int, status PeriodStatus) error
+	// ParseIndividualKey returns the report type and period an individual file key belongs to, or false when the key is not an individual file
+	ParseIndividualKey(key string) (ReportType, int, int, bool)
+	// Ping verifies the underlying storage is reachable and accessible
+	Ping(ctx context.Context) error
+	// AcquireLock takes or renews the named lock for owner until expiresAt. It returns false when another owner holds an unexpired lock
+	AcquireLock(ctx context.Context, name string, owner string, expiresAt time.Time) (bool, error)
+	// ReleaseLock removes the named lock if owner holds it
+	ReleaseLock(ctx context.Context, name string, owner string) error
+	// StoreJob creates or replaces the serialized state of a job
+	StoreJob(ctx context.Context, id string, data []byte) error
+	// RetrieveJob returns the serialized state of a job, or nil when there is no such job
+	RetrieveJob(ctx context.Context, id string) ([]byte, error)
+	// RetrieveJobs returns the serialized state of every stored job
+	RetrieveJobs(ctx context.Context) ([][]byte, error)
+	// DeleteJob removes the serialized state of a job. Deleting a job that does not exist is not an error
+	DeleteJob(ctx context.Context, id string) error
 }
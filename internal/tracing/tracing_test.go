@@ -0,0 +1,56 @@
+//go:build unit
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	t.Run("return no-op shutdown when exporter is none", func(t *testing.T) {
+		shutdown, err := Setup(context.Background(), NoneExporter, "some-service")
+
+		require.NoError(t, err)
+		require.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("return error when exporter is unknown", func(t *testing.T) {
+		_, err := Setup(context.Background(), "zipkin", "some-service")
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "traces exporter 'zipkin' is invalid")
+	})
+}
+
+func TestEnd(t *testing.T) {
+	t.Run("record error and mark span as failed", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		_, span := provider.Tracer("test").Start(context.Background(), "some-span")
+
+		End(span, errors.New("some error"))
+
+		ended := recorder.Ended()
+		require.Len(t, ended, 1)
+		require.Equal(t, codes.Error, ended[0].Status().Code)
+		require.Equal(t, "some error", ended[0].Status().Description)
+	})
+
+	t.Run("leave status unset when there is no error", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		_, span := provider.Tracer("test").Start(context.Background(), "some-span")
+
+		End(span, nil)
+
+		ended := recorder.Ended()
+		require.Len(t, ended, 1)
+		require.Equal(t, codes.Unset, ended[0].Status().Code)
+	})
+}
@@ -0,0 +1,31 @@
+package upload
+
+import (
+	"context"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+var _ Uploader = &mockUploader{}
+
+type mockUploader struct {
+	mock.Mock
+}
+
+func NewMockUploader() *mockUploader {
+	return &mockUploader{}
+}
+
+func (m *mockUploader) Upload(ctx context.Context, reportType storer.ReportType, year int, month int, cluster string, data []byte) (Upload, error) {
+	args := m.Called(ctx, reportType, year, month, cluster, data)
+	return args.Get(0).(Upload), args.Error(1)
+}
+
+func (m *mockUploader) StubUpload(reportType interface{}, year interface{}, month interface{}, cluster interface{}, data interface{}) *mock.Call {
+	return m.On("Upload", mock.Anything, reportType, year, month, cluster, data)
+}
+
+func (m *mockUploader) AssertUploadNotCalled(t *testing.T) {
+	m.AssertNotCalled(t, "Upload", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,174 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/ingest"
+	"github.com/hpcsc/outside-in-go/internal/logging"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/hpcsc/outside-in-go/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"io"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var tracer = otel.Tracer("github.com/hpcsc/outside-in-go/internal/upload")
+
+var (
+	ErrInvalidCluster = errors.New("cluster name is invalid")
+	ErrInvalidFile    = errors.New("file is not a valid csv")
+)
+
+// clusterPattern keeps cluster names usable as the last segment of a key
+var clusterPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+type Options struct {
+	// Header is the header every upload must have. Empty means uploads must match the header of files already uploaded for the period
+	Header []string
+	// Ingestion reads uploads the way individual files are read when they are merged, so that uploads are accepted whenever they can be aggregated
+	Ingestion ingest.Options
+}
+
+type Upload struct {
+	Key  string `json:"key"`
+	Rows int    `json:"rows"`
+}
+
+type Uploader interface {
+	// Upload validates and stores the file of a cluster for a report type and period, then invalidates the period's aggregate.
+	// It returns storer.ErrPeriodClosed when the period is not open
+	Upload(ctx context.Context, reportType storer.ReportType, year int, month int, cluster string, data []byte) (Upload, error)
+}
+
+var _ Uploader = &csvUploader{}
+
+type csvUploader struct {
+	storer  storer.Storer
+	options Options
+}
+
+func NewUploader(storer storer.Storer, options Options) Uploader {
+	return &csvUploader{
+		storer:  storer,
+		options: options,
+	}
+}
+
+func (u *csvUploader) Upload(ctx context.Context, reportType storer.ReportType, year int, month int, cluster string, data []byte) (_ Upload, err error) {
+	ctx, span := tracer.Start(ctx, "csvUploader.Upload")
+	defer func() { tracing.End(span, err) }()
+
+	if !clusterPattern.MatchString(cluster) {
+		return Upload{}, fmt.Errorf("%w: '%s' must be letters, digits, '.', '_' or '-'", ErrInvalidCluster, cluster)
+	}
+
+	status, err := u.storer.RetrievePeriodStatus(ctx, year, month)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	if err := storer.EnsureOpen(status, year, month); err != nil {
+		return Upload{}, err
+	}
+
+	header, rows, err := parse(fmt.Sprintf("%s.csv", cluster), data, u.options.Ingestion)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	expected, err := u.expectedHeader(ctx, reportType, year, month, cluster)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	if expected != nil && !slices.Equal(header, expected) {
+		return Upload{}, fmt.Errorf("%w: header '%s' does not match expected header '%s'", ErrInvalidFile, strings.Join(header, ","), strings.Join(expected, ","))
+	}
+
+	key, err := u.storer.StoreIndividualFile(ctx, reportType, year, month, cluster, data)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	if err := u.storer.DeleteAggregated(ctx, reportType, year, month); err != nil {
+		return Upload{}, fmt.Errorf("stored %s but failed to invalidate aggregate: %v", key, err)
+	}
+
+	span.SetAttributes(attribute.String("upload.key", key), attribute.Int("upload.rows", rows))
+	slog.InfoContext(ctx, "uploaded individual file",
+		slog.String("report_type", string(reportType)),
+		logging.Period(year, month),
+		slog.String("key", key),
+		slog.Int("rows", rows),
+	)
+
+	return Upload{Key: key, Rows: rows}, nil
+}
+
+// expectedHeader returns the configured header, or else the header of another cluster's file for the period. It returns nil when there is nothing to match
+func (u *csvUploader) expectedHeader(ctx context.Context, reportType storer.ReportType, year int, month int, cluster string) ([]string, error) {
+	if len(u.options.Header) > 0 {
+		return u.options.Header, nil
+	}
+
+	files, err := u.storer.ListIndividualFiles(ctx, reportType, year, month)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		// a cluster may replace its own file with a corrected header
+		if strings.HasSuffix(f.Key, fmt.Sprintf("/%s.csv", cluster)) {
+			continue
+		}
+
+		content, err := u.storer.RetrieveIndividualFile(ctx, f.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		if content == nil {
+			continue
+		}
+
+		header, _, err := parse(f.Key, content, u.options.Ingestion)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read header of %s: %v", f.Key, err)
+		}
+
+		return header, nil
+	}
+
+	return nil, nil
+}
+
+// parse returns the header of a csv file and its number of data rows, reading it with the ingestion options.
+// Rows with a different number of fields than the header are handled by the ragged rows policy, and those left out are not counted
+func parse(key string, data []byte, opts ingest.Options) ([]string, int, error) {
+	reader, err := ingest.NewReader(key, data, opts)
+	if errors.Is(err, io.EOF) {
+		return nil, 0, fmt.Errorf("%w: file is empty", ErrInvalidFile)
+	}
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+
+	rows := 0
+	for {
+		_, _, err := reader.Read()
+		if err == io.EOF {
+			return reader.Header, rows, nil
+		}
+
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+		rows++
+	}
+}
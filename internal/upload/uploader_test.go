@@ -0,0 +1,156 @@
+//go:build unit
+
+package upload
+
+import (
+	"context"
+	"errors"
+	"github.com/hpcsc/outside-in-go/internal/ingest"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestUploader(t *testing.T) {
+	data := []byte("BUCKET,PATH\nsome-bucket,some-path\nother-bucket,other-path")
+
+	t.Run("store file and invalidate aggregate", func(t *testing.T) {
+		mockStorer := storer.NewMock()
+		mockStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.OpenPeriodStatus, nil)
+		mockStorer.StubStoreIndividualFile(storer.SingleReportType, 2022, 4, "cluster-1", data).Return("2022/04/single/cluster-1.csv", nil)
+		mockStorer.StubDeleteAggregated(storer.SingleReportType, 2022, 4).Return(nil)
+		u := NewUploader(mockStorer, Options{Header: []string{"BUCKET", "PATH"}})
+
+		upload, err := u.Upload(context.Background(), storer.SingleReportType, 2022, 4, "cluster-1", data)
+
+		require.NoError(t, err)
+		require.Equal(t, Upload{Key: "2022/04/single/cluster-1.csv", Rows: 2}, upload)
+		mockStorer.AssertDeleteAggregatedCalled(t, storer.SingleReportType, 2022, 4)
+	})
+
+	t.Run("match header of files uploaded by other clusters when no header is configured", func(t *testing.T) {
+		mockStorer := storer.NewMock()
+		mockStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.OpenPeriodStatus, nil)
+		files := mockStorer.StubIndividualFiles(storer.SingleReportType, 2022, 4, []byte("NAME,SIZE\nsome-name,1"))
+		mockStorer.StubListIndividualFiles(storer.SingleReportType, 2022, 4).Return(files, nil)
+		u := NewUploader(mockStorer, Options{})
+
+		_, err := u.Upload(context.Background(), storer.SingleReportType, 2022, 4, "cluster-2", data)
+
+		require.ErrorIs(t, err, ErrInvalidFile)
+		require.Contains(t, err.Error(), "header 'BUCKET,PATH' does not match expected header 'NAME,SIZE'")
+		mockStorer.AssertStoreIndividualFileNotCalled(t)
+	})
+
+	t.Run("let a cluster replace its own file with a different header", func(t *testing.T) {
+		mockStorer := storer.NewMock()
+		mockStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.OpenPeriodStatus, nil)
+		files := mockStorer.StubIndividualFiles(storer.SingleReportType, 2022, 4, []byte("NAME,SIZE\nsome-name,1"))
+		mockStorer.StubListIndividualFiles(storer.SingleReportType, 2022, 4).Return(files, nil)
+		mockStorer.StubStoreIndividualFile(storer.SingleReportType, 2022, 4, "cluster-1", data).Return("2022/04/single/cluster-1.csv", nil)
+		mockStorer.StubDeleteAggregated(storer.SingleReportType, 2022, 4).Return(nil)
+		u := NewUploader(mockStorer, Options{})
+
+		_, err := u.Upload(context.Background(), storer.SingleReportType, 2022, 4, "cluster-1", data)
+
+		require.NoError(t, err)
+	})
+
+	t.Run("reject rows with a different number of fields than the header", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.OpenPeriodStatus, nil)
+		u := NewUploader(stubStorer, Options{Header: []string{"BUCKET", "PATH"}})
+
+		_, err := u.Upload(context.Background(), storer.SingleReportType, 2022, 4, "cluster-1", []byte("BUCKET,PATH\nsome-bucket"))
+
+		require.ErrorIs(t, err, ErrInvalidFile)
+	})
+
+	t.Run("read file with other delimiter and encoding like individual files", func(t *testing.T) {
+		latin1 := []byte("BUCKET;PATH\nsome-bucket;caf\xe9\n")
+		mockStorer := storer.NewMock()
+		mockStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.OpenPeriodStatus, nil)
+		mockStorer.StubStoreIndividualFile(storer.SingleReportType, 2022, 4, "cluster-1", latin1).Return("2022/04/single/cluster-1.csv", nil)
+		mockStorer.StubDeleteAggregated(storer.SingleReportType, 2022, 4).Return(nil)
+		u := NewUploader(mockStorer, Options{Header: []string{"BUCKET", "PATH"}, Ingestion: ingest.Options{Encoding: ingest.Latin1Encoding}})
+
+		upload, err := u.Upload(context.Background(), storer.SingleReportType, 2022, 4, "cluster-1", latin1)
+
+		require.NoError(t, err)
+		require.Equal(t, 1, upload.Rows)
+	})
+
+	t.Run("match header after byte order mark", func(t *testing.T) {
+		withBOM := append([]byte("\xef\xbb\xbf"), data...)
+		mockStorer := storer.NewMock()
+		mockStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.OpenPeriodStatus, nil)
+		mockStorer.StubStoreIndividualFile(storer.SingleReportType, 2022, 4, "cluster-1", withBOM).Return("2022/04/single/cluster-1.csv", nil)
+		mockStorer.StubDeleteAggregated(storer.SingleReportType, 2022, 4).Return(nil)
+		u := NewUploader(mockStorer, Options{Header: []string{"BUCKET", "PATH"}})
+
+		_, err := u.Upload(context.Background(), storer.SingleReportType, 2022, 4, "cluster-1", withBOM)
+
+		require.NoError(t, err)
+	})
+
+	t.Run("accept ragged rows skipped by ragged rows policy", func(t *testing.T) {
+		ragged := []byte("BUCKET,PATH\nsome-bucket\nother-bucket,other-path\n")
+		mockStorer := storer.NewMock()
+		mockStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.OpenPeriodStatus, nil)
+		mockStorer.StubStoreIndividualFile(storer.SingleReportType, 2022, 4, "cluster-1", ragged).Return("2022/04/single/cluster-1.csv", nil)
+		mockStorer.StubDeleteAggregated(storer.SingleReportType, 2022, 4).Return(nil)
+		u := NewUploader(mockStorer, Options{Header: []string{"BUCKET", "PATH"}, Ingestion: ingest.Options{Ragged: ingest.SkipRagged}})
+
+		upload, err := u.Upload(context.Background(), storer.SingleReportType, 2022, 4, "cluster-1", ragged)
+
+		require.NoError(t, err)
+		require.Equal(t, 1, upload.Rows)
+	})
+
+	t.Run("reject empty file", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.OpenPeriodStatus, nil)
+		u := NewUploader(stubStorer, Options{Header: []string{"BUCKET", "PATH"}})
+
+		_, err := u.Upload(context.Background(), storer.SingleReportType, 2022, 4, "cluster-1", nil)
+
+		require.ErrorIs(t, err, ErrInvalidFile)
+		require.Contains(t, err.Error(), "file is empty")
+	})
+
+	t.Run("reject upload for period that is not open", func(t *testing.T) {
+		for _, status := range []storer.PeriodStatus{storer.ClosedPeriodStatus, storer.LockedPeriodStatus} {
+			mockStorer := storer.NewMock()
+			mockStorer.StubRetrievePeriodStatus(2022, 4).Return(status, nil)
+			u := NewUploader(mockStorer, Options{})
+
+			_, err := u.Upload(context.Background(), storer.SingleReportType, 2022, 4, "cluster-1", data)
+
+			require.ErrorIs(t, err, storer.ErrPeriodClosed)
+			require.Contains(t, err.Error(), "04/2022 is "+string(status))
+			mockStorer.AssertStoreIndividualFileNotCalled(t)
+		}
+	})
+
+	t.Run("reject cluster name that is not a key segment", func(t *testing.T) {
+		u := NewUploader(storer.NewMock(), Options{})
+
+		_, err := u.Upload(context.Background(), storer.SingleReportType, 2022, 4, "../cluster-1", data)
+
+		require.ErrorIs(t, err, ErrInvalidCluster)
+	})
+
+	t.Run("return error when aggregate cannot be invalidated", func(t *testing.T) {
+		stubStorer := storer.NewMock()
+		stubStorer.StubRetrievePeriodStatus(2022, 4).Return(storer.OpenPeriodStatus, nil)
+		stubStorer.StubStoreIndividualFile(storer.SingleReportType, 2022, 4, "cluster-1", mock.Anything).Return("2022/04/single/cluster-1.csv", nil)
+		stubStorer.StubDeleteAggregated(storer.SingleReportType, 2022, 4).Return(errors.New("some error"))
+		u := NewUploader(stubStorer, Options{Header: []string{"BUCKET", "PATH"}})
+
+		_, err := u.Upload(context.Background(), storer.SingleReportType, 2022, 4, "cluster-1", data)
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "stored 2022/04/single/cluster-1.csv but failed to invalidate aggregate: some error")
+	})
+}
@@ -0,0 +1,238 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/hpcsc/outside-in-go/internal/metrics"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var _ report.AggregateListener = &Notifier{}
+
+const (
+	AggregateStoredEvent = "aggregate.stored"
+
+	// SignatureHeader carries "sha256=" followed by the hex encoded HMAC-SHA256 of the request body keyed with the shared secret
+	SignatureHeader = "X-Signature-256"
+	EventHeader     = "X-Webhook-Event"
+)
+
+type Options struct {
+	URLs []string
+	// Secret signs every payload so that receivers can verify it comes from this service
+	Secret      string
+	MaxAttempts int
+	// InitialBackoff is doubled after every failed attempt
+	InitialBackoff time.Duration
+	// Timeout bounds a single delivery attempt
+	Timeout time.Duration
+	// DeadLetter receives one JSON line per delivery that failed every attempt. Nil only logs them
+	DeadLetter io.Writer
+}
+
+type Payload struct {
+	Event      string `json:"event"`
+	ReportType string `json:"report_type"`
+	Year       int    `json:"year"`
+	Month      int    `json:"month"`
+	Period     string `json:"period"`
+	Key        string `json:"key"`
+	Rows       int    `json:"rows"`
+	// Checksum is "sha256:" followed by the hex encoded SHA-256 of the aggregate content
+	Checksum   string    `json:"checksum"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+type DeadLetter struct {
+	URL      string          `json:"url"`
+	Payload  json.RawMessage `json:"payload"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+// Notifier posts a signed payload to every configured URL when an aggregate is stored. Deliveries happen in the background
+type Notifier struct {
+	options Options
+	client  *http.Client
+	now     func() time.Time
+	sleep   func(ctx context.Context, d time.Duration) error
+
+	// mu guards stopped, starting deliveries and writing dead letters
+	mu         sync.Mutex
+	stopped    bool
+	deliveries sync.WaitGroup
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+func New(options Options) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Notifier{
+		options: options,
+		client:  &http.Client{Timeout: options.Timeout},
+		now:     time.Now,
+		sleep:   sleep,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+func (n *Notifier) AggregateStored(ctx context.Context, aggregate report.Aggregate) {
+	body, err := json.Marshal(Payload{
+		Event:      AggregateStoredEvent,
+		ReportType: string(aggregate.ReportType),
+		Year:       aggregate.Year,
+		Month:      aggregate.Month,
+		Period:     fmt.Sprintf("%d-%02d", aggregate.Year, aggregate.Month),
+		Key:        aggregate.Key,
+		Rows:       aggregate.Rows,
+		Checksum:   fmt.Sprintf("sha256:%s", aggregate.Checksum),
+		OccurredAt: n.now().UTC(),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to encode webhook payload", slog.String("error", err.Error()))
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped {
+		// the dead letter writer may already be closed once stopped, so late events are only logged
+		for _, url := range n.options.URLs {
+			metrics.WebhookDelivered("dead_lettered")
+			slog.ErrorContext(ctx, "dead-lettered webhook for aggregate stored after stop", slog.String("url", url), slog.String("payload", string(body)))
+		}
+		return
+	}
+
+	for _, url := range n.options.URLs {
+		n.deliveries.Add(1)
+		go func(url string) {
+			defer n.deliveries.Done()
+			n.deliver(n.ctx, url, body)
+		}(url)
+	}
+}
+
+// Stop dead-letters deliveries waiting to be retried and only logs aggregates stored afterwards. The returned context is done once attempts in progress have finished
+func (n *Notifier) Stop() context.Context {
+	n.mu.Lock()
+	n.stopped = true
+	n.mu.Unlock()
+	n.cancel()
+
+	ctx, done := context.WithCancel(context.Background())
+	go func() {
+		n.deliveries.Wait()
+		done()
+	}()
+
+	return ctx
+}
+
+func (n *Notifier) deliver(ctx context.Context, url string, body []byte) {
+	logger := slog.Default().With(slog.String("url", url))
+	backoff := n.options.InitialBackoff
+
+	var err error
+	attempts := 0
+	for attempts < n.options.MaxAttempts {
+		attempts++
+		// an attempt in progress is bounded by the client timeout and allowed to finish on stop
+		if err = n.post(context.WithoutCancel(ctx), url, body); err == nil {
+			metrics.WebhookDelivered("delivered")
+			logger.InfoContext(ctx, "delivered webhook", slog.Int("attempt", attempts))
+			return
+		}
+
+		logger.WarnContext(ctx, "failed to deliver webhook", slog.Int("attempt", attempts), slog.String("error", err.Error()))
+		if attempts < n.options.MaxAttempts {
+			if err := n.sleep(ctx, backoff); err != nil {
+				break
+			}
+			backoff *= 2
+		}
+	}
+
+	metrics.WebhookDelivered("dead_lettered")
+	n.deadLetter(logger, DeadLetter{
+		URL:      url,
+		Payload:  body,
+		Attempts: attempts,
+		Error:    err.Error(),
+		FailedAt: n.now().UTC(),
+	})
+}
+
+func (n *Notifier) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, AggregateStoredEvent)
+	req.Header.Set(SignatureHeader, Sign(n.options.Secret, body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (n *Notifier) deadLetter(logger *slog.Logger, letter DeadLetter) {
+	logger.Error("dead-lettered webhook", slog.Int("attempts", letter.Attempts), slog.String("error", letter.Error))
+	if n.options.DeadLetter == nil {
+		return
+	}
+
+	line, err := json.Marshal(letter)
+	if err != nil {
+		logger.Error("failed to encode dead letter", slog.String("error", err.Error()))
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, err := n.options.DeadLetter.Write(append(line, '\n')); err != nil {
+		logger.Error("failed to write dead letter", slog.String("error", err.Error()))
+	}
+}
+
+// Sign returns the value of SignatureHeader for body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return fmt.Sprintf("sha256=%s", hex.EncodeToString(mac.Sum(nil)))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
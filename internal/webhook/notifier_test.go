@@ -0,0 +1,163 @@
+//go:build unit
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/hpcsc/outside-in-go/internal/report"
+	"github.com/hpcsc/outside-in-go/internal/storer"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNotifier(t *testing.T) {
+	aggregate := report.Aggregate{
+		ReportType: storer.SingleReportType,
+		Year:       2022,
+		Month:      4,
+		Key:        "2022/04/aggregate/single.csv",
+		Rows:       3,
+		Checksum:   "abc123",
+	}
+
+	t.Run("post signed payload to every url", func(t *testing.T) {
+		receiver := newTestReceiver(t)
+		otherReceiver := newTestReceiver(t)
+		n := newTestNotifier(Options{URLs: []string{receiver.URL, otherReceiver.URL}, Secret: "some-secret", MaxAttempts: 1})
+
+		n.AggregateStored(context.Background(), aggregate)
+		<-n.Stop().Done()
+
+		for _, r := range []*testReceiver{receiver, otherReceiver} {
+			require.Len(t, r.requests, 1)
+			req := r.requests[0]
+			require.Equal(t, AggregateStoredEvent, req.header.Get(EventHeader))
+			require.Equal(t, Sign("some-secret", req.body), req.header.Get(SignatureHeader))
+
+			var payload Payload
+			require.NoError(t, json.Unmarshal(req.body, &payload))
+			require.Equal(t, Payload{
+				Event:      AggregateStoredEvent,
+				ReportType: "single",
+				Year:       2022,
+				Month:      4,
+				Period:     "2022-04",
+				Key:        "2022/04/aggregate/single.csv",
+				Rows:       3,
+				Checksum:   "sha256:abc123",
+				OccurredAt: time.Date(2022, 5, 2, 6, 0, 0, 0, time.UTC),
+			}, payload)
+		}
+	})
+
+	t.Run("retry with exponential backoff until delivered", func(t *testing.T) {
+		receiver := newTestReceiver(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK)
+		var deadLetters bytes.Buffer
+		n := newTestNotifier(Options{URLs: []string{receiver.URL}, MaxAttempts: 5, InitialBackoff: time.Second, DeadLetter: &deadLetters})
+		var backoffs []time.Duration
+		n.sleep = func(_ context.Context, d time.Duration) error {
+			backoffs = append(backoffs, d)
+			return nil
+		}
+
+		n.AggregateStored(context.Background(), aggregate)
+		<-n.Stop().Done()
+
+		require.Len(t, receiver.requests, 3)
+		require.Equal(t, []time.Duration{time.Second, 2 * time.Second}, backoffs)
+		require.Empty(t, deadLetters.String())
+	})
+
+	t.Run("dead-letter delivery that failed every attempt", func(t *testing.T) {
+		receiver := newTestReceiver(t, http.StatusInternalServerError, http.StatusInternalServerError)
+		var deadLetters bytes.Buffer
+		n := newTestNotifier(Options{URLs: []string{receiver.URL}, MaxAttempts: 2, InitialBackoff: time.Second, DeadLetter: &deadLetters})
+		n.sleep = func(context.Context, time.Duration) error { return nil }
+
+		n.AggregateStored(context.Background(), aggregate)
+		<-n.Stop().Done()
+
+		require.Len(t, receiver.requests, 2)
+		var letter DeadLetter
+		require.NoError(t, json.Unmarshal(deadLetters.Bytes(), &letter))
+		require.Equal(t, receiver.URL, letter.URL)
+		require.Equal(t, 2, letter.Attempts)
+		require.Equal(t, "receiver responded with status 500", letter.Error)
+		require.JSONEq(t, string(receiver.requests[0].body), string(letter.Payload))
+	})
+
+	t.Run("dead-letter delivery waiting to be retried when stopped", func(t *testing.T) {
+		receiver := newTestReceiver(t, http.StatusInternalServerError)
+		var deadLetters bytes.Buffer
+		n := newTestNotifier(Options{URLs: []string{receiver.URL}, MaxAttempts: 2, InitialBackoff: time.Hour, DeadLetter: &deadLetters})
+
+		n.AggregateStored(context.Background(), aggregate)
+		<-n.Stop().Done()
+
+		require.Len(t, receiver.requests, 1)
+		require.Contains(t, deadLetters.String(), `"attempts":1`)
+	})
+
+	t.Run("only log aggregate stored after stop", func(t *testing.T) {
+		receiver := newTestReceiver(t)
+		var deadLetters bytes.Buffer
+		n := newTestNotifier(Options{URLs: []string{receiver.URL}, MaxAttempts: 1, DeadLetter: &deadLetters})
+		<-n.Stop().Done()
+
+		n.AggregateStored(context.Background(), aggregate)
+
+		require.Empty(t, receiver.requests)
+		require.Empty(t, deadLetters.String())
+	})
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+type testReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []receivedRequest
+}
+
+// newTestReceiver responds with the given statuses in turn, then with 200
+func newTestReceiver(t *testing.T, statuses ...int) *testReceiver {
+	r := &testReceiver{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, receivedRequest{header: req.Header, body: body})
+
+		status := http.StatusOK
+		if len(r.requests) <= len(statuses) {
+			status = statuses[len(r.requests)-1]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+
+	return r
+}
+
+func newTestNotifier(options Options) *Notifier {
+	options.Timeout = time.Second
+	n := New(options)
+	n.now = func() time.Time {
+		return time.Date(2022, 5, 2, 6, 0, 0, 0, time.UTC)
+	}
+
+	return n
+}